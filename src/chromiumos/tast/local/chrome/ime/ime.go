@@ -12,6 +12,7 @@ import (
 
 	"chromiumos/tast/errors"
 	"chromiumos/tast/local/chrome"
+	"chromiumos/tast/local/input"
 	"chromiumos/tast/testing"
 )
 
@@ -87,6 +88,17 @@ func GetCurrentInputMethod(ctx context.Context, tconn *chrome.TestConn) (string,
 	return imeID, err
 }
 
+// GetCurrentKeyboardLayout returns the keyboard layout of the current IME, to be
+// used with input.KeyboardEventWriter.SetLayout. It returns an error if the IME
+// is not an xkb layout supported by the input package.
+func GetCurrentKeyboardLayout(ctx context.Context, tconn *chrome.TestConn) (*input.KeyboardLayout, error) {
+	imeID, err := GetCurrentInputMethod(ctx, tconn)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get current ime")
+	}
+	return input.KeyboardLayoutForInputMethod(imeID)
+}
+
 // WaitForInputMethodMatches repeatedly checks until the current IME matches expectation.
 func WaitForInputMethodMatches(ctx context.Context, tconn *chrome.TestConn, imeID string, timeout time.Duration) error {
 	return testing.Poll(ctx, func(ctx context.Context) error {
@@ -0,0 +1,51 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package a11yaudit checks the accessibility of the UI through the automation tree.
+package a11yaudit
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/chrome"
+	"chromiumos/tast/local/chrome/ui"
+	"chromiumos/tast/testing"
+)
+
+// AuditNode checks the accessibility of n and of its descendants.
+// See Audit for details.
+func AuditNode(ctx context.Context, n *ui.Node, opts *Options) ([]Finding, error) {
+	s, err := n.Snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Audit(s, opts), nil
+}
+
+// Check waits for the node matching params to exist, checks its accessibility and returns
+// an error describing the violations, if any. The violations are also logged.
+func Check(ctx context.Context, tconn *chrome.TestConn, params ui.FindParams, timeout time.Duration, opts *Options) error {
+	n, err := ui.FindWithTimeout(ctx, tconn, params, timeout)
+	if err != nil {
+		return errors.Wrap(err, "failed to find the audited node")
+	}
+	defer n.Release(ctx)
+
+	findings, err := AuditNode(ctx, n, opts)
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(findings))
+	for i, f := range findings {
+		testing.ContextLog(ctx, "Accessibility violation: ", f.String())
+		msgs[i] = f.String()
+	}
+	return errors.Errorf("found %d accessibility violations: %s", len(findings), strings.Join(msgs, "; "))
+}
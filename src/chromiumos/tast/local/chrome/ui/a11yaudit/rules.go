@@ -0,0 +1,171 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package a11yaudit
+
+import (
+	"fmt"
+	"regexp"
+
+	"chromiumos/tast/local/chrome/ui"
+)
+
+// Rule identifies an accessibility check.
+type Rule string
+
+// Rules checked by Audit.
+const (
+	// UnnamedFocusable reports focusable nodes without a name, which are announced
+	// by their role only by screen readers.
+	UnnamedFocusable Rule = "unnamedFocusable"
+	// ZeroSizeButton reports visible buttons with empty bounds, which cannot be clicked.
+	ZeroSizeButton Rule = "zeroSizeButton"
+	// DuplicateID reports nodes sharing an HTML id with a previous node of the same web area,
+	// which breaks label and ARIA references.
+	DuplicateID Rule = "duplicateID"
+	// ImageWithoutAlt reports images without alt text.
+	ImageWithoutAlt Rule = "imageWithoutAlt"
+	// DialogFocusTrap reports visible dialogs without visible focusable nodes. Keyboard
+	// users cannot move the focus into such dialogs, nor dismiss them.
+	DialogFocusTrap Rule = "dialogFocusTrap"
+)
+
+// AllRules contains all the rules checked by Audit.
+var AllRules = []Rule{UnnamedFocusable, ZeroSizeButton, DuplicateID, ImageWithoutAlt, DialogFocusTrap}
+
+// unnamedRoles contains the roles of focusable containers whose names are not announced.
+var unnamedRoles = map[ui.RoleType]bool{
+	ui.RoleTypeClient:      true,
+	ui.RoleTypeIframe:      true,
+	ui.RoleTypeRootWebArea: true,
+	ui.RoleTypeWebView:     true,
+	ui.RoleTypeWindow:      true,
+}
+
+// Finding is a violation of a rule.
+type Finding struct {
+	Rule Rule `json:"rule"`
+	// Path is the path of the node from the audited node, e.g. `window > dialog > button`.
+	Path    string           `json:"path"`
+	Node    *ui.NodeSnapshot `json:"-"`
+	Message string           `json:"message"`
+}
+
+// String returns a description of the finding.
+func (f *Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Rule, f.Path, f.Message)
+}
+
+// Exemption exempts nodes from a rule. Exemptions are meant to be listed per tested
+// surface, with a reference to the bug tracking the fix.
+type Exemption struct {
+	Rule Rule
+	// Path is matched against the paths of the nodes, e.g. regexp.MustCompile(`> image\[className="Logo"\]$`).
+	Path *regexp.Regexp
+	// Bug is the bug tracking the violation, e.g. "crbug.com/123456".
+	Bug string
+}
+
+// Options configures Audit.
+type Options struct {
+	// Rules contains the rules to check. AllRules is used if it is nil.
+	Rules []Rule
+	// Allowlist contains the violations which are not reported.
+	Allowlist []Exemption
+}
+
+// Audit checks the accessibility of the node whose snapshot is root and of its descendants,
+// and returns the violations which are not allowlisted. Invisible nodes and their descendants
+// are skipped. opts may be nil to check all rules.
+func Audit(root *ui.NodeSnapshot, opts *Options) []Finding {
+	if opts == nil {
+		opts = &Options{}
+	}
+	rules := opts.Rules
+	if rules == nil {
+		rules = AllRules
+	}
+	a := &auditor{
+		rules:     make(map[Rule]bool),
+		allowlist: opts.Allowlist,
+		ids:       make(map[*ui.NodeSnapshot]map[string]bool),
+	}
+	for _, r := range rules {
+		a.rules[r] = true
+	}
+	a.walk(root, root.Label(), root)
+	return a.findings
+}
+
+// auditor accumulates the violations found in a snapshot.
+type auditor struct {
+	rules     map[Rule]bool
+	allowlist []Exemption
+	// ids contains the HTML ids seen in each web area.
+	ids      map[*ui.NodeSnapshot]map[string]bool
+	findings []Finding
+}
+
+// report records a violation unless it is exempted.
+func (a *auditor) report(r Rule, n *ui.NodeSnapshot, path, format string, args ...interface{}) {
+	if !a.rules[r] {
+		return
+	}
+	for _, e := range a.allowlist {
+		if e.Rule == r && e.Path.MatchString(path) {
+			return
+		}
+	}
+	a.findings = append(a.findings, Finding{Rule: r, Path: path, Node: n, Message: fmt.Sprintf(format, args...)})
+}
+
+// walk checks n and its visible descendants. webArea is the web area containing n,
+// or the audited node if n is not in web contents.
+func (a *auditor) walk(n *ui.NodeSnapshot, path string, webArea *ui.NodeSnapshot) {
+	if n.State[ui.StateTypeInvisible] {
+		return
+	}
+	if n.Role == ui.RoleTypeRootWebArea {
+		webArea = n
+	}
+
+	if n.State[ui.StateTypeFocusable] && n.Name == "" && !unnamedRoles[n.Role] {
+		a.report(UnnamedFocusable, n, path, "focusable %s has no name", n.Role)
+	}
+	if n.Role == ui.RoleTypeButton && !n.State[ui.StateTypeOffscreen] && (n.Location.Width == 0 || n.Location.Height == 0) {
+		a.report(ZeroSizeButton, n, path, "button has empty bounds %v", n.Location)
+	}
+	if id := n.HTMLAttributes["id"]; id != "" {
+		if a.ids[webArea] == nil {
+			a.ids[webArea] = make(map[string]bool)
+		}
+		if a.ids[webArea][id] {
+			a.report(DuplicateID, n, path, "id %q is already used", id)
+		}
+		a.ids[webArea][id] = true
+	}
+	if n.Role == ui.RoleTypeImage && n.Name == "" {
+		a.report(ImageWithoutAlt, n, path, "image has no alt text")
+	}
+	if (n.Role == ui.RoleTypeDialog || n.Role == ui.RoleTypeAlertDialog) && !hasFocusableDescendant(n) {
+		a.report(DialogFocusTrap, n, path, "%s has no focusable node", n.Role)
+	}
+
+	for _, c := range n.Children {
+		a.walk(c, path+" > "+c.Label(), webArea)
+	}
+}
+
+// hasFocusableDescendant returns whether n has a visible focusable descendant.
+func hasFocusableDescendant(n *ui.NodeSnapshot) bool {
+	for _, c := range n.Children {
+		if c.State[ui.StateTypeInvisible] {
+			continue
+		}
+		if c.State[ui.StateTypeFocusable] || hasFocusableDescendant(c) {
+			return true
+		}
+	}
+	return false
+}
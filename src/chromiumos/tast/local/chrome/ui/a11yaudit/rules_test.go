@@ -0,0 +1,81 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package a11yaudit
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"chromiumos/tast/local/chrome/ui"
+	"chromiumos/tast/local/coords"
+)
+
+func TestAudit(t *testing.T) {
+	focusable := map[ui.StateType]bool{ui.StateTypeFocusable: true}
+	bounds := coords.NewRect(0, 0, 10, 10)
+	withID := func(n *ui.NodeSnapshot, id string) *ui.NodeSnapshot {
+		n.HTMLAttributes = map[string]string{"id": id}
+		return n
+	}
+	root := &ui.NodeSnapshot{Role: ui.RoleTypeWindow, Name: "Settings", State: focusable, Children: []*ui.NodeSnapshot{
+		{Role: ui.RoleTypeButton, Name: "OK", State: focusable, Location: bounds},
+		{Role: ui.RoleTypeButton, State: focusable, Location: bounds},
+		{Role: ui.RoleTypeButton, Name: "Hidden", State: map[ui.StateType]bool{ui.StateTypeOffscreen: true}},
+		{Role: ui.RoleTypeButton, Name: "Empty", Location: coords.NewRect(5, 5, 0, 10)},
+		{Role: ui.RoleTypeImage, Name: "Logo", Location: bounds},
+		{Role: ui.RoleTypeImage, Location: bounds},
+		{Role: ui.RoleTypeGroup, State: map[ui.StateType]bool{ui.StateTypeInvisible: true}, Children: []*ui.NodeSnapshot{
+			{Role: ui.RoleTypeImage},
+		}},
+		{Role: ui.RoleTypeRootWebArea, State: focusable, Children: []*ui.NodeSnapshot{
+			withID(&ui.NodeSnapshot{Role: ui.RoleTypeLink, Name: "Help", State: focusable}, "help"),
+			withID(&ui.NodeSnapshot{Role: ui.RoleTypeLink, Name: "Help", State: focusable}, "help"),
+			{Role: ui.RoleTypeDialog, Name: "Confirm", Children: []*ui.NodeSnapshot{
+				{Role: ui.RoleTypeStaticText, Name: "Are you sure?"},
+				{Role: ui.RoleTypeButton, Name: "Yes", State: map[ui.StateType]bool{ui.StateTypeFocusable: true, ui.StateTypeInvisible: true}, Location: bounds},
+			}},
+		}},
+		{Role: ui.RoleTypeRootWebArea, Children: []*ui.NodeSnapshot{
+			withID(&ui.NodeSnapshot{Role: ui.RoleTypeStaticText, Name: "Help"}, "help"),
+		}},
+	}}
+
+	for _, tc := range []struct {
+		name     string
+		opts     *Options
+		findings []string
+	}{
+		{"all", nil, []string{
+			`unnamedFocusable: window[name="Settings"] > button: focusable button has no name`,
+			`zeroSizeButton: window[name="Settings"] > button[name="Empty"]: button has empty bounds (5, 5) - (0 x 10)`,
+			`imageWithoutAlt: window[name="Settings"] > image: image has no alt text`,
+			`duplicateID: window[name="Settings"] > rootWebArea > link[name="Help"]: id "help" is already used`,
+			`dialogFocusTrap: window[name="Settings"] > rootWebArea > dialog[name="Confirm"]: dialog has no focusable node`,
+		}},
+		{"rules", &Options{Rules: []Rule{ImageWithoutAlt, ZeroSizeButton}}, []string{
+			`zeroSizeButton: window[name="Settings"] > button[name="Empty"]: button has empty bounds (5, 5) - (0 x 10)`,
+			`imageWithoutAlt: window[name="Settings"] > image: image has no alt text`,
+		}},
+		{"allowlist", &Options{Allowlist: []Exemption{
+			{Rule: UnnamedFocusable, Path: regexp.MustCompile(`> button$`), Bug: "crbug.com/1"},
+			{Rule: DialogFocusTrap, Path: regexp.MustCompile(`.`), Bug: "crbug.com/2"},
+			// The rule does not match, so the image is still reported.
+			{Rule: ZeroSizeButton, Path: regexp.MustCompile(`> image$`), Bug: "crbug.com/3"},
+		}}, []string{
+			`zeroSizeButton: window[name="Settings"] > button[name="Empty"]: button has empty bounds (5, 5) - (0 x 10)`,
+			`imageWithoutAlt: window[name="Settings"] > image: image has no alt text`,
+			`duplicateID: window[name="Settings"] > rootWebArea > link[name="Help"]: id "help" is already used`,
+		}},
+	} {
+		var findings []string
+		for _, f := range Audit(root, tc.opts) {
+			findings = append(findings, f.String())
+		}
+		if !reflect.DeepEqual(findings, tc.findings) {
+			t.Errorf("%s: Audit returned %q; want %q", tc.name, findings, tc.findings)
+		}
+	}
+}
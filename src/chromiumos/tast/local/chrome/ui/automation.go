@@ -304,27 +304,29 @@ func (n *Node) LeftClickUntil(ctx context.Context, condition func(context.Contex
 	}, opts)
 }
 
-// StableFind repeatedly finds the first matching node until the node's location if stable.
-// It will relocate the node if unexpected error happens, such as an element being refreshed.
+// StableFind waits for the first matching node whose location is stable, and returns it.
+// As with testing.Poll, opts.Interval (default 100ms) is the period at which the node is polled,
+// and its location is stable once it did not change for that period. The node is looked up again
+// if it is deleted and recreated, e.g. when an element is refreshed.
+// The node is also checked on chrome.automation events and tree changes between polls.
 // Stable*Click and WaitLocationStable are alternative solutions if the node is not completely deleted and recreated.
 // Side effect: using this function will increase the test duration.
-// Error example: "Failed to update the node's location: unexpected end of JSON input".
-// Error example: "Cannot read property 'left' of undefined".
-func StableFind(ctx context.Context, tconn *chrome.TestConn, params FindParams, opts *testing.PollOptions) (node *Node, err error) {
-	location := coords.Rect{}
-
-	return node, testing.Poll(ctx, func(ctx context.Context) error {
-		node, err = Find(ctx, tconn, params)
-		if err != nil {
-			return errors.Wrap(err, "failed to find node")
+func StableFind(ctx context.Context, tconn *chrome.TestConn, params FindParams, opts *testing.PollOptions) (*Node, error) {
+	interval := 100 * time.Millisecond
+	var timeout time.Duration
+	if opts != nil {
+		if opts.Interval > 0 {
+			interval = opts.Interval
 		}
-		if !cmp.Equal(node.Location, location) {
-			location = node.Location
-			node.Release(ctx)
-			return errors.New("node location still changing")
-		}
-		return nil
-	}, opts)
+		timeout = opts.Timeout
+	}
+
+	root, err := Root(ctx, tconn)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Release(ctx)
+	return root.waitForStableDescendant(ctx, params, interval, timeout)
 }
 
 // StableFindAndClick waits for the first matching stable node and then left clicks it.
@@ -399,8 +401,14 @@ func (n *Node) Descendants(ctx context.Context, params FindParams) (NodeSlice, e
 	if err != nil {
 		return nil, err
 	}
+	return n.callNodeList(ctx, fmt.Sprintf("function(){return this.findAll(%s)}", paramsBytes))
+}
+
+// callNodeList calls the JavaScript function fn on this node and returns the nodes
+// of the array it returns.
+func (n *Node) callNodeList(ctx context.Context, fn string) (NodeSlice, error) {
 	nodeList := &chrome.JSObject{}
-	if err := n.object.Call(ctx, nodeList, fmt.Sprintf("function(){return this.findAll(%s)}", paramsBytes)); err != nil {
+	if err := n.object.Call(ctx, nodeList, fn); err != nil {
 		return nil, err
 	}
 	defer nodeList.Release(ctx)
@@ -454,37 +462,21 @@ func (n *Node) DescendantExists(ctx context.Context, params FindParams) (bool, e
 // ErrNodeDoesNotExist is returned when the node is not found.
 var ErrNodeDoesNotExist = errors.New("node does not exist")
 
-// WaitUntilDescendantExists checks if a descendant node exists repeatedly until the timeout.
+// WaitUntilDescendantExists waits until a descendant node exists or the timeout is hit.
+// The condition is checked on chrome.automation events and tree changes, and periodically.
 // If the timeout is hit or the JavaScript fails to execute, an error is returned.
 func (n *Node) WaitUntilDescendantExists(ctx context.Context, params FindParams, timeout time.Duration) error {
-	return testing.Poll(ctx, func(ctx context.Context) error {
-		exists, err := n.DescendantExists(ctx, params)
-		if err != nil {
-			return testing.PollBreak(err)
-		}
-		if !exists {
-			return ErrNodeDoesNotExist
-		}
-		return nil
-	}, &testing.PollOptions{Timeout: timeout})
+	return n.waitForDescendant(ctx, params, true, timeout)
 }
 
 // ErrNodeExists is returned when the node is found, but should not exist.
 var ErrNodeExists = errors.New("node still exists")
 
-// WaitUntilDescendantGone checks if a descendant node doesn't exist repeatedly until the timeout.
+// WaitUntilDescendantGone waits until a descendant node doesn't exist or the timeout is hit.
+// The condition is checked on chrome.automation events and tree changes, and periodically.
 // If the timeout is hit or the JavaScript fails to execute, an error is returned.
 func (n *Node) WaitUntilDescendantGone(ctx context.Context, params FindParams, timeout time.Duration) error {
-	return testing.Poll(ctx, func(ctx context.Context) error {
-		exists, err := n.DescendantExists(ctx, params)
-		if err != nil {
-			return testing.PollBreak(err)
-		}
-		if exists {
-			return ErrNodeExists
-		}
-		return nil
-	}, &testing.PollOptions{Timeout: timeout})
+	return n.waitForDescendant(ctx, params, false, timeout)
 }
 
 // Matches returns whether this node matches the given params.
@@ -649,6 +641,21 @@ func WaitUntilExistsStatus(ctx context.Context, tconn *chrome.TestConn, params F
 	return WaitUntilGone(ctx, tconn, params, timeout)
 }
 
+// FocusedNode returns the node which has the keyboard focus.
+// An error is returned if no node is focused or the JavaScript fails to execute.
+func FocusedNode(ctx context.Context, tconn *chrome.TestConn) (*Node, error) {
+	obj := &chrome.JSObject{}
+	if err := tconn.EvalPromise(ctx, `tast.promisify(chrome.automation.getFocus)().then((node) => {
+		if (!node) {
+			throw new Error("no node is focused");
+		}
+		return node;
+	})`, obj); err != nil {
+		return nil, err
+	}
+	return NewNode(ctx, tconn, obj)
+}
+
 // RootDebugInfo returns the chrome.automation root as a string.
 // If the JavaScript fails to execute, an error is returned.
 func RootDebugInfo(ctx context.Context, tconn *chrome.TestConn) (string, error) {
@@ -666,6 +673,39 @@ func LogRootDebugInfo(ctx context.Context, tconn *chrome.TestConn, filename stri
 	return ioutil.WriteFile(filename, []byte(debugInfo), 0644)
 }
 
+// Snapshot returns a snapshot of this node and its descendants.
+// If the JavaScript fails to execute, an error is returned.
+func (n *Node) Snapshot(ctx context.Context) (*NodeSnapshot, error) {
+	var s NodeSnapshot
+	if err := n.object.Call(ctx, &s, snapshotNode); err != nil {
+		return nil, errors.Wrap(err, "failed to take snapshot")
+	}
+	return &s, nil
+}
+
+// Snapshot returns a snapshot of the chrome.automation root and its descendants.
+func Snapshot(ctx context.Context, tconn *chrome.TestConn) (*NodeSnapshot, error) {
+	root, err := Root(ctx, tconn)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Release(ctx)
+	return root.Snapshot(ctx)
+}
+
+// LogSnapshot writes a JSON snapshot of the chrome.automation root to a file.
+func LogSnapshot(ctx context.Context, tconn *chrome.TestConn, filename string) error {
+	s, err := Snapshot(ctx, tconn)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, b, 0644)
+}
+
 // ErrNoRadioButtons is returned when there are no radio buttons under the radio group.
 var ErrNoRadioButtons = errors.New("no radio buttons in this radio group")
 
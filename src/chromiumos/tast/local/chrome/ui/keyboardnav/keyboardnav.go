@@ -0,0 +1,172 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package keyboardnav drives the UI by moving the keyboard focus, like users who
+// cannot use a pointing device.
+package keyboardnav
+
+import (
+	"context"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/chrome"
+	"chromiumos/tast/local/chrome/ui"
+	"chromiumos/tast/local/input"
+	"chromiumos/tast/testing"
+)
+
+// Accelerators commonly used to move the focus.
+const (
+	Forward  = "Tab"
+	Backward = "Shift+Tab"
+	Up       = "Up"
+	Down     = "Down"
+	Left     = "Left"
+	Right    = "Right"
+)
+
+const (
+	// defaultMaxSteps is the default value of Navigator.MaxSteps.
+	defaultMaxSteps = 100
+	// defaultFocusTimeout is the default value of Navigator.FocusTimeout.
+	defaultFocusTimeout = 2 * time.Second
+)
+
+// ErrUnreachable is returned when the focus cannot be moved to a node.
+var ErrUnreachable = errors.New("node is unreachable by keyboard")
+
+// Navigator moves the keyboard focus with a keyboard, and tracks the focused nodes.
+type Navigator struct {
+	tconn *chrome.TestConn
+	kw    *input.KeyboardEventWriter
+
+	// MaxSteps is the maximum number of key presses to reach a node or to traverse the UI.
+	MaxSteps int
+	// FocusTimeout is how long to wait for the focus to move after a key press.
+	// The focus is assumed not to move if no focus event occurs before the timeout.
+	FocusTimeout time.Duration
+}
+
+// New returns a Navigator pressing keys with kw.
+func New(tconn *chrome.TestConn, kw *input.KeyboardEventWriter) *Navigator {
+	return &Navigator{tconn: tconn, kw: kw, MaxSteps: defaultMaxSteps, FocusTimeout: defaultFocusTimeout}
+}
+
+// nodeStop returns the stop for n.
+func nodeStop(n *ui.Node) Stop {
+	return Stop{Role: n.Role, Name: n.Name, ClassName: n.ClassName, Location: n.Location}
+}
+
+// Focused returns the stop of the node which has the keyboard focus.
+func (nv *Navigator) Focused(ctx context.Context) (Stop, error) {
+	n, err := ui.FocusedNode(ctx, nv.tconn)
+	if err != nil {
+		return Stop{}, errors.Wrap(err, "failed to get the focused node")
+	}
+	defer n.Release(ctx)
+	return nodeStop(n), nil
+}
+
+// Press presses the accelerator accel, e.g. Forward, waits for the focus to move and
+// returns the stop of the newly focused node.
+func (nv *Navigator) Press(ctx context.Context, accel string) (Stop, error) {
+	if err := nv.press(ctx, accel); err != nil {
+		return Stop{}, err
+	}
+	return nv.Focused(ctx)
+}
+
+// press presses the accelerator accel and waits for a focus event.
+// The focus is assumed not to move if no focus event occurs before nv.FocusTimeout.
+func (nv *Navigator) press(ctx context.Context, accel string) error {
+	ew, err := ui.NewRootWatcher(ctx, nv.tconn, ui.EventTypeFocus)
+	if err != nil {
+		return errors.Wrap(err, "failed to create focus event watcher")
+	}
+	defer ew.Release(ctx)
+
+	if err := nv.kw.Accel(ctx, accel); err != nil {
+		return errors.Wrapf(err, "failed to press %q", accel)
+	}
+	if _, err := ew.WaitForEvent(ctx, nv.FocusTimeout); err != nil {
+		testing.ContextLogf(ctx, "No focus event after pressing %q: %v", accel, err)
+	}
+	return nil
+}
+
+// FocusNode presses the accelerator accel until the focused node matches params, and
+// returns it along with the stops traversed on the way. ErrUnreachable is returned if
+// the focus comes back to a node it already visited, or stops moving, before a matching
+// node is found. The caller is responsible for releasing the returned node.
+func (nv *Navigator) FocusNode(ctx context.Context, params ui.FindParams, accel string) (*ui.Node, []Stop, error) {
+	var order []Stop
+	visited := make(map[Stop]bool)
+	for i := 0; ; i++ {
+		n, err := ui.FocusedNode(ctx, nv.tconn)
+		if err != nil {
+			return nil, order, errors.Wrap(err, "failed to get the focused node")
+		}
+		stop := nodeStop(n)
+		match, err := n.Matches(ctx, params)
+		if err != nil {
+			n.Release(ctx)
+			return nil, order, errors.Wrap(err, "failed to match the focused node")
+		}
+		if match {
+			return n, append(order, stop), nil
+		}
+		n.Release(ctx)
+
+		if visited[stop] {
+			return nil, order, errors.Wrapf(ErrUnreachable, "node with %+v not found after %d stops", params, len(order))
+		}
+		visited[stop] = true
+		order = append(order, stop)
+		if i == nv.MaxSteps {
+			return nil, order, errors.Errorf("node with %+v not found after pressing %q %d times", params, accel, nv.MaxSteps)
+		}
+		if err := nv.press(ctx, accel); err != nil {
+			return nil, order, err
+		}
+	}
+}
+
+// Traverse presses the accelerator accel until the focus comes back to a node it already
+// visited or stops moving, and returns the stops in traversal order, starting from the
+// currently focused node.
+func (nv *Navigator) Traverse(ctx context.Context, accel string) ([]Stop, error) {
+	stop, err := nv.Focused(ctx)
+	if err != nil {
+		return nil, err
+	}
+	order := []Stop{stop}
+	visited := map[Stop]bool{stop: true}
+	for i := 0; i < nv.MaxSteps; i++ {
+		if stop, err = nv.Press(ctx, accel); err != nil {
+			return order, err
+		}
+		if visited[stop] {
+			return order, nil
+		}
+		visited[stop] = true
+		order = append(order, stop)
+	}
+	return order, errors.Errorf("focus did not loop after pressing %q %d times", accel, nv.MaxSteps)
+}
+
+// Unreachable traverses the UI with the accelerator accel like Traverse, and returns the
+// visible focusable nodes under root which were not focused during the traversal, along
+// with the traversal order.
+func (nv *Navigator) Unreachable(ctx context.Context, root *ui.Node, accel string) (unreachable, order []Stop, err error) {
+	order, err = nv.Traverse(ctx, accel)
+	if err != nil {
+		return nil, order, err
+	}
+	s, err := root.Snapshot(ctx)
+	if err != nil {
+		return nil, order, err
+	}
+	return unreachableStops(s, order), order, nil
+}
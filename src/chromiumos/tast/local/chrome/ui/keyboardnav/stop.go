@@ -0,0 +1,72 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package keyboardnav
+
+import (
+	"fmt"
+
+	"chromiumos/tast/local/chrome/ui"
+	"chromiumos/tast/local/coords"
+)
+
+// Stop describes a node which received the keyboard focus during a traversal.
+type Stop struct {
+	Role      ui.RoleType `json:"role,omitempty"`
+	Name      string      `json:"name,omitempty"`
+	ClassName string      `json:"className,omitempty"`
+	Location  coords.Rect `json:"location"`
+}
+
+// String returns a description of the stop, e.g. `button "OK" (10, 20) - (30 x 40)`.
+func (s Stop) String() string {
+	str := string(s.Role)
+	if s.Name != "" {
+		str += fmt.Sprintf(" %q", s.Name)
+	}
+	if s.ClassName != "" {
+		str += " " + s.ClassName
+	}
+	return fmt.Sprintf("%s %v", str, s.Location)
+}
+
+// snapshotStop returns the stop for the node of the snapshot s.
+func snapshotStop(s *ui.NodeSnapshot) Stop {
+	return Stop{Role: s.Role, Name: s.Name, ClassName: s.ClassName, Location: s.Location}
+}
+
+// focusableStops returns the stops for the visible focusable nodes of the snapshot root,
+// including root itself, in tree order.
+func focusableStops(root *ui.NodeSnapshot) []Stop {
+	var stops []Stop
+	var walk func(n *ui.NodeSnapshot)
+	walk = func(n *ui.NodeSnapshot) {
+		if n.State[ui.StateTypeInvisible] || n.State[ui.StateTypeOffscreen] {
+			return
+		}
+		if n.State[ui.StateTypeFocusable] {
+			stops = append(stops, snapshotStop(n))
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(root)
+	return stops
+}
+
+// unreachableStops returns the visible focusable nodes of the snapshot root which are not in order.
+func unreachableStops(root *ui.NodeSnapshot, order []Stop) []Stop {
+	visited := make(map[Stop]bool)
+	for _, s := range order {
+		visited[s] = true
+	}
+	var unreachable []Stop
+	for _, s := range focusableStops(root) {
+		if !visited[s] {
+			unreachable = append(unreachable, s)
+		}
+	}
+	return unreachable
+}
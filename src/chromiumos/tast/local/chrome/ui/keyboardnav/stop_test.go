@@ -0,0 +1,49 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package keyboardnav
+
+import (
+	"reflect"
+	"testing"
+
+	"chromiumos/tast/local/chrome/ui"
+	"chromiumos/tast/local/coords"
+)
+
+func TestUnreachableStops(t *testing.T) {
+	focusable := map[ui.StateType]bool{ui.StateTypeFocusable: true}
+	button := func(name string, x int, state map[ui.StateType]bool) *ui.NodeSnapshot {
+		return &ui.NodeSnapshot{Role: ui.RoleTypeButton, Name: name, Location: coords.NewRect(x, 0, 10, 10), State: state}
+	}
+	root := &ui.NodeSnapshot{Role: ui.RoleTypeDialog, Name: "Settings", Children: []*ui.NodeSnapshot{
+		button("OK", 0, focusable),
+		button("Cancel", 20, focusable),
+		// Nodes which are not focusable or not visible are not expected to be reachable.
+		button("Label", 40, nil),
+		button("Hidden", 60, map[ui.StateType]bool{ui.StateTypeFocusable: true, ui.StateTypeInvisible: true}),
+		{Role: ui.RoleTypeGroup, Children: []*ui.NodeSnapshot{
+			button("Help", 80, focusable),
+			// Same name as the first button, but at another location.
+			button("OK", 100, focusable),
+		}},
+	}}
+
+	order := []Stop{
+		{Role: ui.RoleTypeButton, Name: "OK", Location: coords.NewRect(0, 0, 10, 10)},
+		{Role: ui.RoleTypeButton, Name: "Help", Location: coords.NewRect(80, 0, 10, 10)},
+	}
+	want := []Stop{
+		{Role: ui.RoleTypeButton, Name: "Cancel", Location: coords.NewRect(20, 0, 10, 10)},
+		{Role: ui.RoleTypeButton, Name: "OK", Location: coords.NewRect(100, 0, 10, 10)},
+	}
+	if got := unreachableStops(root, order); !reflect.DeepEqual(got, want) {
+		t.Errorf("unreachableStops returned %v; want %v", got, want)
+	}
+
+	const wantStr = `button "OK" (0, 0) - (10 x 10)`
+	if s := order[0].String(); s != wantStr {
+		t.Errorf("String() = %q; want %q", s, wantStr)
+	}
+}
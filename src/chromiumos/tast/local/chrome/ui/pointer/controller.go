@@ -3,7 +3,7 @@
 // found in the LICENSE file.
 
 // Package pointer provides utility interfaces to handle pointing devices (i.e.
-// mouse and touch screen).
+// mouse, touch screen and trackpad).
 package pointer
 
 import (
@@ -181,3 +181,137 @@ func (tc *TouchController) Close() {
 	tc.stw.Close()
 	tc.tsew.Close()
 }
+
+// MultiController provides the common interface to perform multi-finger
+// gestures on screen, either by the touch screen or a trackpad. Locations and
+// distances are in DIPs.
+type MultiController interface {
+	// Pinch moves two fingers horizontally and symmetrically around center,
+	// from being apart by from to being apart by to. A pinch with to larger
+	// than from zooms in.
+	Pinch(ctx context.Context, center coords.Point, from, to int, duration time.Duration) error
+
+	// Rotate rotates two fingers on opposite sides of the circle of the given
+	// radius around center by degrees. Positive degrees rotate clockwise.
+	Rotate(ctx context.Context, center coords.Point, radius int, degrees float64, duration time.Duration) error
+
+	// Scroll moves two fingers together from start to end.
+	Scroll(ctx context.Context, start, end coords.Point, duration time.Duration) error
+
+	// MultiSwipe moves fingers together from start to end, e.g. three fingers
+	// to enter overview with a trackpad.
+	MultiSwipe(ctx context.Context, start, end coords.Point, fingers int, duration time.Duration) error
+
+	// Close closes the access to the underlying system and releases resources.
+	Close()
+}
+
+// performGesture performs g on tsew with as many touches as g has contacts.
+func performGesture(ctx context.Context, tsew *input.TouchscreenEventWriter, g *input.Gesture) error {
+	tw, err := tsew.NewMultiTouchWriter(len(g.Contacts))
+	if err != nil {
+		return errors.Wrap(err, "failed to create the multi touch writer")
+	}
+	defer tw.Close()
+	return tw.Perform(ctx, g)
+}
+
+// touchMapping returns the mapping from the screen to the touch screen.
+func (tc *TouchController) touchMapping() *touchMapping {
+	return newTouchMapping(tc.tcc, coords.Point{}, input.TouchPoint{})
+}
+
+// Pinch implements MultiController.Pinch.
+func (tc *TouchController) Pinch(ctx context.Context, center coords.Point, from, to int, duration time.Duration) error {
+	return performGesture(ctx, tc.tsew, tc.touchMapping().pinchGesture(center, from, to, duration))
+}
+
+// Rotate implements MultiController.Rotate.
+func (tc *TouchController) Rotate(ctx context.Context, center coords.Point, radius int, degrees float64, duration time.Duration) error {
+	return performGesture(ctx, tc.tsew, tc.touchMapping().rotateGesture(center, radius, degrees, duration))
+}
+
+// Scroll implements MultiController.Scroll.
+func (tc *TouchController) Scroll(ctx context.Context, start, end coords.Point, duration time.Duration) error {
+	return tc.MultiSwipe(ctx, start, end, 2, duration)
+}
+
+// MultiSwipe implements MultiController.MultiSwipe.
+func (tc *TouchController) MultiSwipe(ctx context.Context, start, end coords.Point, fingers int, duration time.Duration) error {
+	return performGesture(ctx, tc.tsew, tc.touchMapping().swipeGesture(start, end, fingers, duration))
+}
+
+// TrackpadController implements MultiController, conducted by a trackpad.
+// As trackpad gestures apply at the mouse cursor, the cursor is first moved
+// to the center of the gesture. The trackpad surface is scaled to the size
+// of the internal display, so distances on screen are only approximated.
+type TrackpadController struct {
+	tconn *chrome.TestConn
+	tpew  *input.TrackpadEventWriter
+	tcc   *input.TouchCoordConverter
+}
+
+// NewTrackpadController creates a TrackpadController on a new TrackpadEventWriter.
+func NewTrackpadController(ctx context.Context, tconn *chrome.TestConn) (*TrackpadController, error) {
+	tpew, err := input.Trackpad(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to access to the trackpad")
+	}
+	info, err := display.GetInternalInfo(ctx, tconn)
+	if err != nil {
+		if err := tpew.Close(); err != nil {
+			testing.ContextLog(ctx, "Failed to close the trackpad: ", err)
+		}
+		return nil, errors.Wrap(err, "failed to get the internal display info")
+	}
+	tcc := tpew.NewTouchCoordConverter(info.Bounds.Size())
+	return &TrackpadController{tconn: tconn, tpew: tpew, tcc: tcc}, nil
+}
+
+// Trackpad returns the trackpad for this controller.
+func (tc *TrackpadController) Trackpad() *input.TrackpadEventWriter {
+	return tc.tpew
+}
+
+// perform moves the mouse cursor to center, and performs the gesture
+// returned by gesture with center mapped to the center of the trackpad.
+func (tc *TrackpadController) perform(ctx context.Context, center coords.Point, gesture func(m *touchMapping) *input.Gesture) error {
+	if err := mouse.Move(ctx, tc.tconn, center, 0); err != nil {
+		return errors.Wrapf(err, "failed to move to the location: %v", center)
+	}
+	m := newTouchMapping(tc.tcc, center, input.TouchPoint{X: tc.tpew.Width() / 2, Y: tc.tpew.Height() / 2})
+	return performGesture(ctx, &tc.tpew.TouchscreenEventWriter, gesture(m))
+}
+
+// Pinch implements MultiController.Pinch.
+func (tc *TrackpadController) Pinch(ctx context.Context, center coords.Point, from, to int, duration time.Duration) error {
+	return tc.perform(ctx, center, func(m *touchMapping) *input.Gesture {
+		return m.pinchGesture(center, from, to, duration)
+	})
+}
+
+// Rotate implements MultiController.Rotate.
+func (tc *TrackpadController) Rotate(ctx context.Context, center coords.Point, radius int, degrees float64, duration time.Duration) error {
+	return tc.perform(ctx, center, func(m *touchMapping) *input.Gesture {
+		return m.rotateGesture(center, radius, degrees, duration)
+	})
+}
+
+// Scroll implements MultiController.Scroll.
+func (tc *TrackpadController) Scroll(ctx context.Context, start, end coords.Point, duration time.Duration) error {
+	return tc.MultiSwipe(ctx, start, end, 2, duration)
+}
+
+// MultiSwipe implements MultiController.MultiSwipe. The cursor is moved to
+// the middle of start and end, so that the swipe is centered on the trackpad.
+func (tc *TrackpadController) MultiSwipe(ctx context.Context, start, end coords.Point, fingers int, duration time.Duration) error {
+	middle := coords.NewPoint((start.X+end.X)/2, (start.Y+end.Y)/2)
+	return tc.perform(ctx, middle, func(m *touchMapping) *input.Gesture {
+		return m.swipeGesture(start, end, fingers, duration)
+	})
+}
+
+// Close implements MultiController.Close.
+func (tc *TrackpadController) Close() {
+	tc.tpew.Close()
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pointer
+
+import (
+	"math"
+	"time"
+
+	"chromiumos/tast/local/coords"
+	"chromiumos/tast/local/input"
+)
+
+// fingerSpacing is the distance in DIPs between the fingers of swipes and scrolls.
+const fingerSpacing = 40
+
+// touchMapping maps locations on screen to locations on a touch surface.
+type touchMapping struct {
+	// origin is the location on screen mapped to touchOrigin.
+	origin      coords.Point
+	touchOrigin input.TouchPoint
+	// scaleX and scaleY are the numbers of touch coordinates per DIP.
+	scaleX, scaleY float64
+}
+
+// newTouchMapping returns a touchMapping with the scale of tcc, mapping origin to touchOrigin.
+func newTouchMapping(tcc *input.TouchCoordConverter, origin coords.Point, touchOrigin input.TouchPoint) *touchMapping {
+	return &touchMapping{origin: origin, touchOrigin: touchOrigin, scaleX: tcc.ScaleX, scaleY: tcc.ScaleY}
+}
+
+// convert returns the touch coordinates of the location (x, y) on screen.
+func (m *touchMapping) convert(x, y float64) (float64, float64) {
+	return float64(m.touchOrigin.X) + (x-float64(m.origin.X))*m.scaleX,
+		float64(m.touchOrigin.Y) + (y-float64(m.origin.Y))*m.scaleY
+}
+
+// screenPath is an input.Path defined in screen coordinates.
+type screenPath struct {
+	m *touchMapping
+	// at returns the location on screen at progress t.
+	at func(t float64) (x, y float64)
+}
+
+// At implements input.Path.At.
+func (p *screenPath) At(t float64) (x, y float64) {
+	return p.m.convert(p.at(t))
+}
+
+// linePath returns a path going straight from one location on screen to another.
+func (m *touchMapping) linePath(from, to coords.Point) input.Path {
+	return &screenPath{m, func(t float64) (float64, float64) {
+		return float64(from.X) + float64(to.X-from.X)*t, float64(from.Y) + float64(to.Y-from.Y)*t
+	}}
+}
+
+// arcPath returns a path following the circle of the given radius around center on screen,
+// from the angle fromDeg to toDeg in degrees. Positive angles go clockwise.
+func (m *touchMapping) arcPath(center coords.Point, radius, fromDeg, toDeg float64) input.Path {
+	return &screenPath{m, func(t float64) (float64, float64) {
+		rad := (fromDeg + (toDeg-fromDeg)*t) * math.Pi / 180
+		return float64(center.X) + radius*math.Cos(rad), float64(center.Y) + radius*math.Sin(rad)
+	}}
+}
+
+// pinchGesture returns a gesture in which two fingers move horizontally and symmetrically
+// around center, from being apart by from DIPs to being apart by to DIPs.
+func (m *touchMapping) pinchGesture(center coords.Point, from, to int, duration time.Duration) *input.Gesture {
+	return &input.Gesture{Contacts: []input.Contact{
+		{Path: m.linePath(center.Sub(coords.NewPoint(from/2, 0)), center.Sub(coords.NewPoint(to/2, 0))), End: duration},
+		{Path: m.linePath(center.Add(coords.NewPoint(from/2, 0)), center.Add(coords.NewPoint(to/2, 0))), End: duration},
+	}}
+}
+
+// rotateGesture returns a gesture in which two fingers on opposite sides of the circle of
+// the given radius around center rotate by degrees. Positive degrees rotate clockwise.
+func (m *touchMapping) rotateGesture(center coords.Point, radius int, degrees float64, duration time.Duration) *input.Gesture {
+	return &input.Gesture{Contacts: []input.Contact{
+		{Path: m.arcPath(center, float64(radius), 180, 180+degrees), End: duration},
+		{Path: m.arcPath(center, float64(radius), 0, degrees), End: duration},
+	}}
+}
+
+// swipeGesture returns a gesture in which fingers move together from start to end. The fingers
+// are placed horizontally fingerSpacing apart, centered on start and end.
+func (m *touchMapping) swipeGesture(start, end coords.Point, fingers int, duration time.Duration) *input.Gesture {
+	g := &input.Gesture{}
+	for i := 0; i < fingers; i++ {
+		offset := coords.NewPoint(i*fingerSpacing-(fingers-1)*fingerSpacing/2, 0)
+		g.Contacts = append(g.Contacts, input.Contact{Path: m.linePath(start.Add(offset), end.Add(offset)), End: duration})
+	}
+	return g
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pointer
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"chromiumos/tast/local/coords"
+	"chromiumos/tast/local/input"
+)
+
+func TestGestures(t *testing.T) {
+	// The screen location (100, 50) is mapped to the center of a 1000x800 touch surface,
+	// with 2 touch coordinates per DIP horizontally and 4 vertically.
+	m := newTouchMapping(&input.TouchCoordConverter{ScaleX: 2, ScaleY: 4},
+		coords.NewPoint(100, 50), input.TouchPoint{X: 500, Y: 400})
+	const d = time.Second
+
+	type point struct{ x, y float64 }
+	for _, tc := range []struct {
+		name  string
+		g     *input.Gesture
+		start []point
+		end   []point
+	}{
+		{"pinch", m.pinchGesture(coords.NewPoint(100, 50), 20, 100, d),
+			[]point{{480, 400}, {520, 400}}, []point{{400, 400}, {600, 400}}},
+		{"rotate", m.rotateGesture(coords.NewPoint(110, 50), 10, 90, d),
+			[]point{{500, 400}, {540, 400}}, []point{{520, 360}, {520, 440}}},
+		{"swipe", m.swipeGesture(coords.NewPoint(100, 50), coords.NewPoint(100, 0), 3, d),
+			[]point{{420, 400}, {500, 400}, {580, 400}}, []point{{420, 200}, {500, 200}, {580, 200}}},
+	} {
+		if len(tc.g.Contacts) != len(tc.start) {
+			t.Errorf("%s: got %d contacts; want %d", tc.name, len(tc.g.Contacts), len(tc.start))
+			continue
+		}
+		if tc.g.Duration() != d {
+			t.Errorf("%s: Duration() = %v; want %v", tc.name, tc.g.Duration(), d)
+		}
+		for i, c := range tc.g.Contacts {
+			for _, p := range []struct {
+				t    float64
+				want point
+			}{{0, tc.start[i]}, {1, tc.end[i]}} {
+				x, y := c.Path.At(p.t)
+				if math.Abs(x-p.want.x) > 1e-6 || math.Abs(y-p.want.y) > 1e-6 {
+					t.Errorf("%s: contact %d at %v = (%v, %v); want %v", tc.name, i, p.t, x, y, p.want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ui
+
+import (
+	"context"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/chrome"
+	"chromiumos/tast/testing"
+)
+
+// QueryAll returns the nodes selected by selector, evaluated on this node.
+// The selector syntax is described in the Selector documentation.
+// If the selector is invalid or the JavaScript fails to execute, an error is returned.
+func (n *Node) QueryAll(ctx context.Context, selector string) (NodeSlice, error) {
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := sel.queryFunc()
+	if err != nil {
+		return nil, err
+	}
+	return n.callNodeList(ctx, fn)
+}
+
+// Query returns the first node selected by selector, evaluated on this node.
+// ErrNodeDoesNotExist is returned if no node is selected.
+func (n *Node) Query(ctx context.Context, selector string) (*Node, error) {
+	nodes, err := n.QueryAll(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, ErrNodeDoesNotExist
+	}
+	nodes[1:].Release(ctx)
+	return nodes[0], nil
+}
+
+// QueryWithTimeout repeatedly evaluates selector on this node until it selects a node,
+// and returns the first selected node.
+// If the timeout is hit or the JavaScript fails to execute, an error is returned.
+func (n *Node) QueryWithTimeout(ctx context.Context, selector string, timeout time.Duration) (*Node, error) {
+	if _, err := ParseSelector(selector); err != nil {
+		return nil, err
+	}
+	var node *Node
+	if err := testing.Poll(ctx, func(ctx context.Context) error {
+		var err error
+		node, err = n.Query(ctx, selector)
+		if err != nil && !errors.Is(err, ErrNodeDoesNotExist) {
+			return testing.PollBreak(err)
+		}
+		return err
+	}, &testing.PollOptions{Timeout: timeout}); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// Query returns the first node selected by selector, evaluated on the root node.
+// ErrNodeDoesNotExist is returned if no node is selected.
+func Query(ctx context.Context, tconn *chrome.TestConn, selector string) (*Node, error) {
+	root, err := Root(ctx, tconn)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Release(ctx)
+	return root.Query(ctx, selector)
+}
+
+// QueryAll returns the nodes selected by selector, evaluated on the root node.
+func QueryAll(ctx context.Context, tconn *chrome.TestConn, selector string) (NodeSlice, error) {
+	root, err := Root(ctx, tconn)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Release(ctx)
+	return root.QueryAll(ctx, selector)
+}
+
+// QueryWithTimeout repeatedly evaluates selector on the root node until it selects a node,
+// and returns the first selected node.
+func QueryWithTimeout(ctx context.Context, tconn *chrome.TestConn, selector string, timeout time.Duration) (*Node, error) {
+	root, err := Root(ctx, tconn)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Release(ctx)
+	return root.QueryWithTimeout(ctx, selector, timeout)
+}
@@ -0,0 +1,424 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"unicode"
+
+	"chromiumos/tast/errors"
+)
+
+// Combinator describes how the nodes selected by a step of a Selector relate to the
+// nodes selected by the previous step.
+type Combinator string
+
+// Combinators supported by selectors, along with their syntax.
+const (
+	// DescendantCombinator selects descendants, e.g. "dialog button".
+	DescendantCombinator Combinator = "descendant"
+	// ChildCombinator selects children, e.g. "dialog > button".
+	ChildCombinator Combinator = "child"
+	// NextSiblingCombinator selects the next sibling, e.g. "staticText + button".
+	NextSiblingCombinator Combinator = "nextSibling"
+	// SiblingCombinator selects all following siblings, e.g. "staticText ~ button".
+	SiblingCombinator Combinator = "sibling"
+	// AncestorCombinator selects ancestors, e.g. "button ^ dialog".
+	AncestorCombinator Combinator = "ancestor"
+)
+
+// combinatorTokens maps the tokens of combinators other than DescendantCombinator.
+var combinatorTokens = map[rune]Combinator{
+	'>': ChildCombinator,
+	'+': NextSiblingCombinator,
+	'~': SiblingCombinator,
+	'^': AncestorCombinator,
+}
+
+// SelectorStep is a step of a Selector. It selects the nodes matching Params which are
+// related to the nodes selected by the previous step as described by Combinator.
+type SelectorStep struct {
+	Combinator Combinator
+	Params     FindParams
+	// Index selects a single node among the nodes matched by the step if HasIndex is true.
+	// Negative values count from the last node.
+	Index    int
+	HasIndex bool
+}
+
+// Selector is a compiled query selecting nodes of the automation tree. Selectors are written
+// in a syntax similar to CSS selectors:
+//
+//	dialog[name=/Settings/] > button[name="OK"]:nth(1)
+//
+// A selector is a sequence of compound selectors separated by combinators. The first compound
+// selector matches descendants of the node the selector is evaluated on. The combinators are
+// whitespace (descendant), ">" (child), "+" (next sibling), "~" (following sibling) and "^"
+// (ancestor).
+//
+// A compound selector starts with an optional role (or "*"), followed by any number of:
+//
+//	[attr=value]  matches an attribute. "name" and "className" set the corresponding FindParams
+//	              fields; other attributes are set in FindParams.Attributes. value is a quoted
+//	              string, a regular expression between slashes, true, false, a number or a
+//	              word made of letters, digits, '_', '-' and '.'.
+//	:state        matches nodes in the given state, e.g. ":focused".
+//	:not(state)   matches nodes not in the given state.
+//	:nth(i)       selects the i-th node (starting from 0) among the nodes matched so far.
+//	:first        is equivalent to :nth(0).
+//	:last         selects the last node among the nodes matched so far.
+type Selector struct {
+	Steps []SelectorStep
+	src   string
+}
+
+// ParseSelector parses a selector written in the syntax described in the Selector documentation.
+func ParseSelector(s string) (*Selector, error) {
+	p := &selectorParser{src: []rune(s)}
+	sel, err := p.parse()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse selector %q", s)
+	}
+	sel.src = s
+	return sel, nil
+}
+
+// MustParseSelector is like ParseSelector but panics on error. It is intended to
+// initialize variables holding selectors.
+func MustParseSelector(s string) *Selector {
+	sel, err := ParseSelector(s)
+	if err != nil {
+		panic(err.Error())
+	}
+	return sel
+}
+
+// String returns the source of the selector.
+func (sel *Selector) String() string {
+	return sel.src
+}
+
+// selectorParser is a recursive descent parser for selectors.
+type selectorParser struct {
+	src []rune
+	pos int
+}
+
+func (p *selectorParser) peek() rune {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *selectorParser) skipSpaces() bool {
+	start := p.pos
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func (p *selectorParser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *selectorParser) expect(r rune) error {
+	if p.peek() != r {
+		return p.errorf("expected %q", r)
+	}
+	p.pos++
+	return nil
+}
+
+// word parses a sequence of characters allowed in unquoted words.
+func (p *selectorParser) word() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		r := p.src[p.pos]
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '.' {
+			break
+		}
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+func (p *selectorParser) parse() (*Selector, error) {
+	sel := &Selector{}
+	p.skipSpaces()
+	comb := DescendantCombinator
+	for {
+		step, err := p.compound()
+		if err != nil {
+			return nil, err
+		}
+		step.Combinator = comb
+		sel.Steps = append(sel.Steps, *step)
+
+		spaces := p.skipSpaces()
+		if p.pos == len(p.src) {
+			return sel, nil
+		}
+		if c, ok := combinatorTokens[p.peek()]; ok {
+			comb = c
+			p.pos++
+			p.skipSpaces()
+		} else if spaces {
+			comb = DescendantCombinator
+		} else {
+			return nil, p.errorf("unexpected %q", p.peek())
+		}
+	}
+}
+
+// compound parses a compound selector.
+func (p *selectorParser) compound() (*SelectorStep, error) {
+	step := &SelectorStep{}
+	start := p.pos
+	if p.peek() == '*' {
+		p.pos++
+	} else if role := p.word(); role != "" {
+		step.Params.Role = RoleType(role)
+	}
+
+	for {
+		switch p.peek() {
+		case '[':
+			if err := p.attribute(&step.Params); err != nil {
+				return nil, err
+			}
+		case ':':
+			if err := p.pseudoClass(step); err != nil {
+				return nil, err
+			}
+		default:
+			if p.pos == start {
+				return nil, p.errorf("expected selector")
+			}
+			return step, nil
+		}
+	}
+}
+
+// attribute parses an attribute selector and adds it to params.
+func (p *selectorParser) attribute(params *FindParams) error {
+	p.pos++ // '['
+	p.skipSpaces()
+	name := p.word()
+	if name == "" {
+		return p.errorf("expected attribute name")
+	}
+	p.skipSpaces()
+	if err := p.expect('='); err != nil {
+		return err
+	}
+	p.skipSpaces()
+	val, err := p.value()
+	if err != nil {
+		return err
+	}
+	p.skipSpaces()
+	if err := p.expect(']'); err != nil {
+		return err
+	}
+
+	if _, ok := params.Attributes[name]; ok || (name == "name" && params.Name != "") ||
+		(name == "className" && params.ClassName != "") || (name == "role" && params.Role != "") {
+		return p.errorf("attribute %q is set twice", name)
+	}
+	if str, ok := val.(string); ok {
+		switch name {
+		case "role":
+			params.Role = RoleType(str)
+			return nil
+		case "name":
+			params.Name = str
+			return nil
+		case "className":
+			params.ClassName = str
+			return nil
+		}
+	}
+	if params.Attributes == nil {
+		params.Attributes = make(map[string]interface{})
+	}
+	params.Attributes[name] = val
+	return nil
+}
+
+// value parses the value of an attribute selector.
+func (p *selectorParser) value() (interface{}, error) {
+	switch p.peek() {
+	case '"':
+		// Find the closing quote, skipping escaped characters.
+		start := p.pos
+		for p.pos++; p.pos < len(p.src) && p.src[p.pos] != '"'; p.pos++ {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+		}
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unterminated string")
+		}
+		p.pos++
+		s, err := strconv.Unquote(string(p.src[start:p.pos]))
+		if err != nil {
+			return nil, p.errorf("invalid string: %v", err)
+		}
+		return s, nil
+	case '/':
+		// Regular expressions are passed to JavaScript as literals, so escaped slashes are kept.
+		start := p.pos + 1
+		for p.pos++; p.pos < len(p.src) && p.src[p.pos] != '/'; p.pos++ {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+		}
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unterminated regular expression")
+		}
+		re, err := regexp.Compile(string(p.src[start:p.pos]))
+		if err != nil {
+			return nil, p.errorf("invalid regular expression: %v", err)
+		}
+		p.pos++
+		return re, nil
+	}
+
+	w := p.word()
+	switch {
+	case w == "":
+		return nil, p.errorf("expected attribute value")
+	case w == "true" || w == "false":
+		return w == "true", nil
+	}
+	if i, err := strconv.Atoi(w); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(w, 64); err == nil {
+		return f, nil
+	}
+	return w, nil
+}
+
+// pseudoClass parses a pseudo-class and applies it to step.
+func (p *selectorParser) pseudoClass(step *SelectorStep) error {
+	p.pos++ // ':'
+	name := p.word()
+	if name == "" {
+		return p.errorf("expected pseudo-class")
+	}
+
+	var arg string
+	hasArg := p.peek() == '('
+	if hasArg {
+		p.pos++
+		p.skipSpaces()
+		arg = p.word()
+		p.skipSpaces()
+		if err := p.expect(')'); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case name == "nth" && hasArg, name == "first" && !hasArg, name == "last" && !hasArg:
+		if step.HasIndex {
+			return p.errorf("index is set twice")
+		}
+		step.HasIndex = true
+		switch name {
+		case "first":
+			step.Index = 0
+		case "last":
+			step.Index = -1
+		default:
+			i, err := strconv.Atoi(arg)
+			if err != nil || i < 0 {
+				return p.errorf("invalid index %q", arg)
+			}
+			step.Index = i
+		}
+	case name == "not" && hasArg && arg != "":
+		return p.setState(&step.Params, StateType(arg), false)
+	case !hasArg:
+		return p.setState(&step.Params, StateType(name), true)
+	default:
+		return p.errorf("invalid pseudo-class %q", name)
+	}
+	return nil
+}
+
+func (p *selectorParser) setState(params *FindParams, st StateType, val bool) error {
+	if params.State == nil {
+		params.State = make(map[StateType]bool)
+	}
+	if _, ok := params.State[st]; ok {
+		return p.errorf("state %q is set twice", st)
+	}
+	params.State[st] = val
+	return nil
+}
+
+// queryFunc returns a JavaScript function to be called on an AutomationNode which returns
+// the array of nodes selected by sel.
+func (sel *Selector) queryFunc() (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, step := range sel.Steps {
+		params, err := step.Params.rawBytes()
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid step %d", i)
+		}
+		index := "null"
+		if step.HasIndex {
+			index = strconv.Itoa(step.Index)
+		}
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, `{comb:%q,params:%s,index:%s}`, step.Combinator, params, index)
+	}
+	buf.WriteString("]")
+
+	return fmt.Sprintf(`function() {
+		const steps = %s;
+		let nodes = [this];
+		for (const step of steps) {
+			const next = [];
+			const add = (n) => { if (n && !next.includes(n)) next.push(n); };
+			for (const node of nodes) {
+				switch (step.comb) {
+				case %q:
+					node.findAll(step.params).forEach(add);
+					break;
+				case %q:
+					node.children.filter((c) => c.matches(step.params)).forEach(add);
+					break;
+				case %q:
+					if (node.nextSibling && node.nextSibling.matches(step.params)) add(node.nextSibling);
+					break;
+				case %q:
+					for (let s = node.nextSibling; s; s = s.nextSibling) if (s.matches(step.params)) add(s);
+					break;
+				case %q:
+					for (let a = node.parent; a; a = a.parent) if (a.matches(step.params)) add(a);
+					break;
+				}
+			}
+			if (step.index === null) {
+				nodes = next;
+			} else {
+				const i = step.index < 0 ? next.length + step.index : step.index;
+				nodes = i >= 0 && i < next.length ? [next[i]] : [];
+			}
+		}
+		return nodes;
+	}`, buf.String(), DescendantCombinator, ChildCombinator, NextSiblingCombinator, SiblingCombinator, AncestorCombinator), nil
+}
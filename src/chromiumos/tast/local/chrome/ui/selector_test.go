@@ -0,0 +1,94 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ui
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	for _, tc := range []struct {
+		sel   string
+		steps []SelectorStep
+	}{
+		{"button", []SelectorStep{
+			{Combinator: DescendantCombinator, Params: FindParams{Role: RoleTypeButton}},
+		}},
+		{`dialog[name=/Settings/] > button[name="OK"]:nth(1)`, []SelectorStep{
+			{Combinator: DescendantCombinator, Params: FindParams{
+				Role:       RoleTypeDialog,
+				Attributes: map[string]interface{}{"name": regexp.MustCompile("Settings")},
+			}},
+			{Combinator: ChildCombinator, Params: FindParams{Role: RoleTypeButton, Name: "OK"}, Index: 1, HasIndex: true},
+		}},
+		{`*[className=FeaturePodIconButton]:focused:not(invisible)  ~staticText:last`, []SelectorStep{
+			{Combinator: DescendantCombinator, Params: FindParams{
+				ClassName: "FeaturePodIconButton",
+				State:     map[StateType]bool{StateTypeFocused: true, StateTypeInvisible: false},
+			}},
+			{Combinator: SiblingCombinator, Params: FindParams{Role: RoleTypeStaticText}, Index: -1, HasIndex: true},
+		}},
+		{`textField[value="a \"b\""][checked=true][valueForRange=0.5] ^ group + listItem:first`, []SelectorStep{
+			{Combinator: DescendantCombinator, Params: FindParams{
+				Role:       RoleTypeTextField,
+				Attributes: map[string]interface{}{"value": `a "b"`, "checked": true, "valueForRange": 0.5},
+			}},
+			{Combinator: AncestorCombinator, Params: FindParams{Role: RoleTypeGroup}},
+			{Combinator: NextSiblingCombinator, Params: FindParams{Role: RoleTypeListItem}, HasIndex: true},
+		}},
+	} {
+		sel, err := ParseSelector(tc.sel)
+		if err != nil {
+			t.Errorf("ParseSelector(%q) failed: %v", tc.sel, err)
+			continue
+		}
+		if !reflect.DeepEqual(sel.Steps, tc.steps) {
+			t.Errorf("ParseSelector(%q) = %+v; want %+v", tc.sel, sel.Steps, tc.steps)
+		}
+		if sel.String() != tc.sel {
+			t.Errorf("ParseSelector(%q).String() = %q", tc.sel, sel.String())
+		}
+	}
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"button >",
+		"button[name]",
+		`button[name="OK"`,
+		`button[name="OK][role=button]`,
+		"button[name=/(/]",
+		`button[name="OK"][name=/OK/]`,
+		"button:nth(-1)",
+		"button:nth(1):last",
+		"button:focused:focused",
+		"button:not()",
+		"button)",
+	} {
+		if sel, err := ParseSelector(s); err == nil {
+			t.Errorf("ParseSelector(%q) = %+v; want error", s, sel.Steps)
+		}
+	}
+}
+
+func TestSelectorQueryFunc(t *testing.T) {
+	sel := MustParseSelector(`dialog > button[name="OK"]:last`)
+	fn, err := sel.queryFunc()
+	if err != nil {
+		t.Fatal("queryFunc failed: ", err)
+	}
+	for _, want := range []string{
+		`{comb:"descendant",params:{"attributes":null,"role":"dialog","state":null},index:null}`,
+		`{comb:"child",params:{"attributes":{"name":"OK"},"role":"button","state":null},index:-1}`,
+	} {
+		if !strings.Contains(fn, want) {
+			t.Errorf("queryFunc returned %q; want it to contain %q", fn, want)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"chromiumos/tast/local/coords"
+)
+
+// NodeSnapshot is a snapshot of an automation node and its descendants.
+// Snapshots are serializable to JSON, so they can be saved for debugging or compared later.
+type NodeSnapshot struct {
+	Role      RoleType           `json:"role,omitempty"`
+	Name      string             `json:"name,omitempty"`
+	ClassName string             `json:"className,omitempty"`
+	Value     string             `json:"value,omitempty"`
+	Checked   CheckedState       `json:"checked,omitempty"`
+	Location  coords.Rect        `json:"location"`
+	State     map[StateType]bool `json:"state,omitempty"`
+	// HTMLAttributes contains the HTML attributes of nodes in web contents, e.g. "id".
+	HTMLAttributes map[string]string `json:"htmlAttributes,omitempty"`
+	Children       []*NodeSnapshot   `json:"children,omitempty"`
+}
+
+// snapshotNode is a JavaScript function returning the snapshot of the node it is called on.
+const snapshotNode = `function() {
+	const snapshot = (n) => ({
+		role: n.role,
+		name: n.name,
+		className: n.className,
+		value: n.value,
+		checked: n.checked,
+		location: n.location || {left: 0, top: 0, width: 0, height: 0},
+		state: n.state,
+		htmlAttributes: n.htmlAttributes,
+		children: (n.children || []).map(snapshot),
+	});
+	return snapshot(this);
+}`
+
+// Label returns a short description of the node, in the syntax of selectors,
+// e.g. `button[name="OK"]`.
+func (s *NodeSnapshot) Label() string {
+	var b strings.Builder
+	if s.Role == "" {
+		b.WriteString("*")
+	} else {
+		b.WriteString(string(s.Role))
+	}
+	if s.ClassName != "" {
+		fmt.Fprintf(&b, "[className=%q]", s.ClassName)
+	}
+	if s.Name != "" {
+		fmt.Fprintf(&b, "[name=%q]", s.Name)
+	}
+	return b.String()
+}
+
+// String returns an indented representation of the snapshot, with a node per line.
+func (s *NodeSnapshot) String() string {
+	var b strings.Builder
+	var write func(n *NodeSnapshot, depth int)
+	write = func(n *NodeSnapshot, depth int) {
+		fmt.Fprintf(&b, "%s%s %v\n", strings.Repeat("  ", depth), n.Label(), n.Location)
+		for _, c := range n.Children {
+			write(c, depth+1)
+		}
+	}
+	write(s, 0)
+	return b.String()
+}
+
+// ChangeType describes how a node differs between two snapshots.
+type ChangeType string
+
+// Types of changes reported by DiffSnapshots.
+const (
+	NodeAdded   ChangeType = "added"
+	NodeRemoved ChangeType = "removed"
+	NodeChanged ChangeType = "changed"
+)
+
+// NodeChange describes a difference between two snapshots.
+type NodeChange struct {
+	Type ChangeType `json:"type"`
+	// Path is the path of the node from the root of the snapshot, e.g.
+	// `rootWebArea > dialog[name="Settings"] > button[name="OK"]`.
+	Path string `json:"path"`
+	// Old and New are the node in the old and new snapshots. Old is nil for
+	// added nodes and New is nil for removed nodes.
+	Old *NodeSnapshot `json:"old,omitempty"`
+	New *NodeSnapshot `json:"new,omitempty"`
+	// Fields contains descriptions of the changed fields for changed nodes, e.g. `name: "OK" -> "Done"`.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// String returns a description of the change.
+func (c *NodeChange) String() string {
+	if c.Type == NodeChanged {
+		return fmt.Sprintf("%s %s: %s", c.Type, c.Path, strings.Join(c.Fields, ", "))
+	}
+	return fmt.Sprintf("%s %s", c.Type, c.Path)
+}
+
+// DefaultIgnoredStates contains the states ignored by DiffSnapshots by default, as they
+// change with the position of the mouse and of the focus.
+var DefaultIgnoredStates = []StateType{StateTypeFocused, StateTypeHovered, StateTypeOffscreen}
+
+// DiffOptions configures DiffSnapshots.
+type DiffOptions struct {
+	// CompareLocation makes DiffSnapshots report location changes. Locations are ignored
+	// by default as they change during animations.
+	CompareLocation bool
+	// IgnoredStates contains the states whose changes are ignored.
+	// DefaultIgnoredStates is used if it is nil.
+	IgnoredStates []StateType
+}
+
+// DiffSnapshots returns the differences between the snapshots before and after of a node.
+// Children are matched by role, class name and name, in order. A node whose role and class
+// name are unchanged but whose name changed is reported as changed if it is at the same
+// position relative to the matched nodes around it. When a node is added or removed, its
+// descendants are not reported. opts may be nil to use the default options.
+func DiffSnapshots(before, after *NodeSnapshot, opts *DiffOptions) []NodeChange {
+	if opts == nil {
+		opts = &DiffOptions{}
+	}
+	ignored := opts.IgnoredStates
+	if ignored == nil {
+		ignored = DefaultIgnoredStates
+	}
+	d := &snapshotDiffer{opts: opts, ignoredStates: make(map[StateType]bool)}
+	for _, st := range ignored {
+		d.ignoredStates[st] = true
+	}
+	d.diffNode(before, after, before.Label())
+	return d.changes
+}
+
+// snapshotDiffer accumulates the changes found between two snapshots.
+type snapshotDiffer struct {
+	opts          *DiffOptions
+	ignoredStates map[StateType]bool
+	changes       []NodeChange
+}
+
+// diffNode compares a node matched between the two snapshots, along with its descendants.
+func (d *snapshotDiffer) diffNode(before, after *NodeSnapshot, path string) {
+	if fields := d.changedFields(before, after); len(fields) > 0 {
+		d.changes = append(d.changes, NodeChange{Type: NodeChanged, Path: path, Old: before, New: after, Fields: fields})
+	}
+
+	childPath := func(n *NodeSnapshot) string { return path + " > " + n.Label() }
+	for _, p := range alignChildren(before.Children, after.Children) {
+		switch {
+		case p.before == nil:
+			d.changes = append(d.changes, NodeChange{Type: NodeAdded, Path: childPath(p.after), New: p.after})
+		case p.after == nil:
+			d.changes = append(d.changes, NodeChange{Type: NodeRemoved, Path: childPath(p.before), Old: p.before})
+		default:
+			d.diffNode(p.before, p.after, childPath(p.after))
+		}
+	}
+}
+
+// changedFields returns descriptions of the fields which differ between before and after,
+// excluding their children.
+func (d *snapshotDiffer) changedFields(before, after *NodeSnapshot) []string {
+	var fields []string
+	for _, f := range []struct {
+		name          string
+		before, after string
+	}{
+		{"role", string(before.Role), string(after.Role)},
+		{"className", before.ClassName, after.ClassName},
+		{"name", before.Name, after.Name},
+		{"value", before.Value, after.Value},
+		{"checked", string(before.Checked), string(after.Checked)},
+	} {
+		if f.before != f.after {
+			fields = append(fields, fmt.Sprintf("%s: %q -> %q", f.name, f.before, f.after))
+		}
+	}
+	if d.opts.CompareLocation && before.Location != after.Location {
+		fields = append(fields, fmt.Sprintf("location: %v -> %v", before.Location, after.Location))
+	}
+
+	// States missing from the maps are false.
+	states := make(map[StateType]struct{})
+	for st := range before.State {
+		states[st] = struct{}{}
+	}
+	for st := range after.State {
+		states[st] = struct{}{}
+	}
+	var changed []string
+	for st := range states {
+		if !d.ignoredStates[st] && before.State[st] != after.State[st] {
+			changed = append(changed, fmt.Sprintf("state %s: %v -> %v", st, before.State[st], after.State[st]))
+		}
+	}
+	sort.Strings(changed)
+	return append(fields, changed...)
+}
+
+// childPair is a pair of children matched between two snapshots.
+// before or after is nil for removed or added children.
+type childPair struct {
+	before, after *NodeSnapshot
+}
+
+// alignChildren matches the children of a node in the snapshots before and after. Children with the same role,
+// class name and name are matched using a longest common subsequence. In each gap between
+// matched children, the remaining children are then paired in order by role and class name.
+func alignChildren(before, after []*NodeSnapshot) []childPair {
+	same := func(a, b *NodeSnapshot) bool {
+		return a.Role == b.Role && a.ClassName == b.ClassName && a.Name == b.Name
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of before[i:] and after[j:].
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if same(before[i], after[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var pairs []childPair
+	var beforeGap, afterGap []*NodeSnapshot
+	flushGap := func() {
+		pairs = append(pairs, pairGap(beforeGap, afterGap)...)
+		beforeGap, afterGap = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(before) && j < len(after) {
+		switch {
+		case same(before[i], after[j]):
+			flushGap()
+			pairs = append(pairs, childPair{before[i], after[j]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			beforeGap = append(beforeGap, before[i])
+			i++
+		default:
+			afterGap = append(afterGap, after[j])
+			j++
+		}
+	}
+	beforeGap = append(beforeGap, before[i:]...)
+	afterGap = append(afterGap, after[j:]...)
+	flushGap()
+	return pairs
+}
+
+// pairGap pairs the unmatched children of before and after found between two matched children.
+// Children with the same role and class name are paired in order; the others are
+// reported as removed or added.
+func pairGap(before, after []*NodeSnapshot) []childPair {
+	var pairs []childPair
+	j := 0
+	for _, o := range before {
+		k := j
+		for k < len(after) && (after[k].Role != o.Role || after[k].ClassName != o.ClassName) {
+			k++
+		}
+		if k == len(after) {
+			pairs = append(pairs, childPair{before: o})
+			continue
+		}
+		for ; j < k; j++ {
+			pairs = append(pairs, childPair{after: after[j]})
+		}
+		pairs = append(pairs, childPair{o, after[k]})
+		j = k + 1
+	}
+	for ; j < len(after); j++ {
+		pairs = append(pairs, childPair{after: after[j]})
+	}
+	return pairs
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ui
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"chromiumos/tast/local/coords"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	button := func(name string, state map[StateType]bool) *NodeSnapshot {
+		return &NodeSnapshot{Role: RoleTypeButton, Name: name, State: state}
+	}
+	window := func(children ...*NodeSnapshot) *NodeSnapshot {
+		return &NodeSnapshot{Role: RoleTypeWindow, Name: "Settings", Children: children}
+	}
+	old := window(
+		&NodeSnapshot{Role: RoleTypeStaticText, Name: "Title", Location: coords.NewRect(0, 0, 10, 10)},
+		button("Cancel", nil),
+		button("OK", map[StateType]bool{StateTypeFocused: true}),
+		&NodeSnapshot{Role: RoleTypeCheckBox, Name: "Remember", Checked: CheckedStateFalse},
+	)
+
+	for _, tc := range []struct {
+		name    string
+		new     *NodeSnapshot
+		opts    *DiffOptions
+		changes []string
+	}{
+		{"volatile", window(
+			&NodeSnapshot{Role: RoleTypeStaticText, Name: "Title", Location: coords.NewRect(5, 0, 10, 10)},
+			button("Cancel", map[StateType]bool{StateTypeFocused: true, StateTypeHovered: true}),
+			button("OK", nil),
+			&NodeSnapshot{Role: RoleTypeCheckBox, Name: "Remember", Checked: CheckedStateFalse},
+		), nil, nil},
+		{"location", window(
+			&NodeSnapshot{Role: RoleTypeStaticText, Name: "Title", Location: coords.NewRect(5, 0, 10, 10)},
+			button("Cancel", nil),
+			button("OK", map[StateType]bool{StateTypeFocused: true}),
+			// States missing from a snapshot are false.
+			&NodeSnapshot{Role: RoleTypeCheckBox, Name: "Remember", Checked: CheckedStateFalse,
+				State: map[StateType]bool{StateTypeFocused: true}},
+		), &DiffOptions{CompareLocation: true, IgnoredStates: []StateType{}}, []string{
+			`changed window[name="Settings"] > staticText[name="Title"]: location: ` +
+				`(0, 0) - (10 x 10) -> (5, 0) - (10 x 10)`,
+			`changed window[name="Settings"] > checkBox[name="Remember"]: state focused: false -> true`,
+		}},
+		{"changed", window(
+			&NodeSnapshot{Role: RoleTypeStaticText, Name: "Title", Location: coords.NewRect(0, 0, 10, 10)},
+			button("Cancel", nil),
+			button("Done", map[StateType]bool{StateTypeCollapsed: true}),
+			&NodeSnapshot{Role: RoleTypeCheckBox, Name: "Remember", Checked: CheckedStateTrue},
+		), nil, []string{
+			`changed window[name="Settings"] > button[name="Done"]: name: "OK" -> "Done", state collapsed: false -> true`,
+			`changed window[name="Settings"] > checkBox[name="Remember"]: checked: "false" -> "true"`,
+		}},
+		{"addedRemoved", window(
+			button("Back", nil),
+			&NodeSnapshot{Role: RoleTypeStaticText, Name: "Title", Location: coords.NewRect(0, 0, 10, 10)},
+			button("Cancel", nil),
+			&NodeSnapshot{Role: RoleTypeCheckBox, Name: "Remember", Checked: CheckedStateFalse},
+			&NodeSnapshot{Role: RoleTypeStaticText, Name: "Saved"},
+		), nil, []string{
+			`added window[name="Settings"] > button[name="Back"]`,
+			`removed window[name="Settings"] > button[name="OK"]`,
+			`added window[name="Settings"] > staticText[name="Saved"]`,
+		}},
+	} {
+		var changes []string
+		for _, c := range DiffSnapshots(old, tc.new, tc.opts) {
+			changes = append(changes, c.String())
+		}
+		if !reflect.DeepEqual(changes, tc.changes) {
+			t.Errorf("%s: DiffSnapshots returned %q; want %q", tc.name, changes, tc.changes)
+		}
+	}
+}
+
+func TestNodeSnapshotJSON(t *testing.T) {
+	// This is the format returned by the JavaScript function taking snapshots.
+	const js = `{
+		"role": "window", "name": "Settings", "className": "", "value": "", "checked": null,
+		"location": {"left": 1, "top": 2, "width": 300, "height": 200},
+		"state": {"focusable": true},
+		"children": [{"role": "button", "name": "OK", "location": {"left": 10, "top": 20, "width": 30, "height": 40}}]
+	}`
+	var s NodeSnapshot
+	if err := json.Unmarshal([]byte(js), &s); err != nil {
+		t.Fatal("Failed to unmarshal snapshot: ", err)
+	}
+	want := NodeSnapshot{
+		Role:     RoleTypeWindow,
+		Name:     "Settings",
+		Location: coords.NewRect(1, 2, 300, 200),
+		State:    map[StateType]bool{StateTypeFocusable: true},
+		Children: []*NodeSnapshot{{Role: RoleTypeButton, Name: "OK", Location: coords.NewRect(10, 20, 30, 40)}},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Fatalf("Unmarshaled %+v; want %+v", s, want)
+	}
+
+	b, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatal("Failed to marshal snapshot: ", err)
+	}
+	var s2 NodeSnapshot
+	if err := json.Unmarshal(b, &s2); err != nil {
+		t.Fatal("Failed to unmarshal snapshot: ", err)
+	}
+	if !reflect.DeepEqual(s2, want) {
+		t.Errorf("Round trip returned %+v; want %+v", s2, want)
+	}
+}
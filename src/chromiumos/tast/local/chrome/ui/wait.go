@@ -0,0 +1,218 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ui
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/chrome"
+)
+
+// waitEventTypes are the types of the chrome.automation events on which waits check their condition.
+// Waits also check their condition on tree changes (e.g. nodeCreated, nodeChanged), and every
+// waitPollInterval in case a change does not fire any event.
+var waitEventTypes = []EventType{
+	EventTypeChildrenChanged,
+	EventTypeLocationChanged,
+	EventTypeStateChanged,
+	EventTypeShow,
+	EventTypeHide,
+	EventTypeAlert,
+	EventTypeFocus,
+}
+
+// waitPollInterval is the interval at which waits check their condition without events.
+const waitPollInterval = 500 * time.Millisecond
+
+// waitTimeoutMargin is how long before the deadline of the context the JavaScript side of waits
+// times out, so that it gets to remove its listeners and resolve its promise before ctx is done.
+// The margin is reduced to a tenth of the remaining time for contexts close to their deadline.
+const waitTimeoutMargin = time.Second
+
+// waitFunc is a JavaScript function called on an AutomationNode, which calls check(node, target)
+// when events occur on the node or its descendants, on tree changes, and periodically, until it
+// returns a truthy value. target is the target of the event or tree change, or null when polling.
+// The returned promise is resolved with {result: value} where value is the value returned by check,
+// or null when timeoutMs (if positive) expires. It is rejected if check throws when polling, e.g.
+// because of invalid FindParams. Exceptions thrown while checking the target of an event are
+// ignored, as the target may be destroyed while being checked.
+const waitFunc = `function(eventTypes, pollMs, timeoutMs) {
+	const check = %s;
+	return new Promise((resolve, reject) => {
+		let finished = false;
+		let poller = null;
+		let timer = null;
+		const isDescendant = (n) => {
+			for (; n; n = n.parent) {
+				if (n === this) return true;
+			}
+			return false;
+		};
+		const cleanUp = () => {
+			finished = true;
+			eventTypes.forEach((t) => this.removeEventListener(t, onEvent, false));
+			chrome.automation.removeTreeChangeObserver(onTreeChange);
+			clearInterval(poller);
+			clearTimeout(timer);
+		};
+		const finish = (result) => {
+			cleanUp();
+			resolve({result: result});
+		};
+		const run = (target) => {
+			if (finished) return;
+			let result = null;
+			try {
+				result = check(this, target && isDescendant(target) ? target : null);
+			} catch (e) {
+				if (target) return;
+				cleanUp();
+				reject(e);
+				return;
+			}
+			if (result) finish(result);
+		};
+		const onEvent = (ev) => run(ev.target);
+		const onTreeChange = (change) => run(change.target);
+
+		eventTypes.forEach((t) => this.addEventListener(t, onEvent, false));
+		chrome.automation.addTreeChangeObserver('allTreeChanges', onTreeChange);
+		poller = setInterval(() => run(null), pollMs);
+		if (timeoutMs > 0) {
+			timer = setTimeout(() => finish(null), timeoutMs);
+		}
+		run(null);
+	});
+}`
+
+// waitFor waits until the JavaScript function check returns a truthy value, as described in
+// waitFunc, and stores the result object in out. check is also called every interval, which is
+// rounded up to whole milliseconds. A zero timeout waits until ctx is done, which must then have
+// a deadline: the JavaScript side of the wait is not stopped when ctx is cancelled, so it must
+// time out by itself to remove its listeners.
+// It returns the timeout the wait was actually given, which is shorter than timeout when ctx
+// has an earlier deadline.
+func (n *Node) waitFor(ctx context.Context, out interface{}, check string, interval, timeout time.Duration) (time.Duration, error) {
+	timeout, err := jsWaitTimeout(ctx, timeout)
+	if err != nil {
+		return 0, err
+	}
+	// waitFunc takes whole milliseconds, and setInterval would poll continuously with zero.
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	return timeout, n.object.Call(ctx, out, fmt.Sprintf(waitFunc, check), waitEventTypes, interval.Milliseconds(), timeout.Milliseconds())
+}
+
+// jsWaitTimeout returns the timeout to pass to waitFunc, so that the JavaScript side of a wait
+// times out shortly before ctx does, rather than racing it. A zero timeout means no timeout other
+// than the deadline of ctx. An error is returned if ctx is already done, or if there is neither
+// a timeout nor a deadline, as the wait would never end in JavaScript.
+func jsWaitTimeout(ctx context.Context, timeout time.Duration) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	// waitFunc takes whole milliseconds, and zero would mean no timeout at all.
+	if timeout > 0 && timeout < time.Millisecond {
+		timeout = time.Millisecond
+	}
+	dl, ok := ctx.Deadline()
+	if !ok {
+		if timeout <= 0 {
+			return 0, errors.New("waiting requires a timeout or a context with a deadline")
+		}
+		return timeout, nil
+	}
+	left := time.Until(dl)
+	margin := waitTimeoutMargin
+	if left/10 < margin {
+		margin = left / 10
+	}
+	left -= margin
+	if left < time.Millisecond {
+		left = time.Millisecond
+	}
+	if timeout == 0 || left < timeout {
+		return left, nil
+	}
+	return timeout, nil
+}
+
+// waitForDescendant waits until a descendant matching params exists or is gone, depending on exists.
+func (n *Node) waitForDescendant(ctx context.Context, params FindParams, exists bool, timeout time.Duration) error {
+	paramsBytes, err := params.rawBytes()
+	if err != nil {
+		return err
+	}
+	// The target of events is checked as well, so that short-lived nodes like toasts
+	// are found while their creation is being dispatched.
+	check := fmt.Sprintf(`(node, target) => (target && target.matches(%[1]s)) || !!node.find(%[1]s)`, paramsBytes)
+	if !exists {
+		check = fmt.Sprintf(`(node) => !node.find(%s)`, paramsBytes)
+	}
+	var out struct {
+		Result bool `json:"result"`
+	}
+	timeout, err = n.waitFor(ctx, &out, check, waitPollInterval, timeout)
+	if err != nil {
+		return err
+	}
+	if out.Result {
+		return nil
+	}
+	if exists {
+		return errors.Wrapf(ErrNodeDoesNotExist, "timed out after %v", timeout)
+	}
+	return errors.Wrapf(ErrNodeExists, "timed out after %v", timeout)
+}
+
+// waitForStableDescendant polls every interval until a descendant matching params exists and
+// its location did not change for interval, and returns it.
+func (n *Node) waitForStableDescendant(ctx context.Context, params FindParams, interval, timeout time.Duration) (*Node, error) {
+	paramsBytes, err := params.rawBytes()
+	if err != nil {
+		return nil, err
+	}
+	check := fmt.Sprintf(`(() => {
+		let last = null;
+		let since = 0;
+		return (node) => {
+			const found = node.find(%s);
+			if (!found) {
+				last = null;
+				return null;
+			}
+			const loc = JSON.stringify(found.location);
+			if (loc !== last) {
+				last = loc;
+				since = Date.now();
+				return null;
+			}
+			return Date.now() - since >= %d ? found : null;
+		};
+	})()`, paramsBytes, interval.Milliseconds())
+
+	out := &chrome.JSObject{}
+	if _, err := n.waitFor(ctx, out, check, interval, timeout); err != nil {
+		return nil, err
+	}
+	defer out.Release(ctx)
+
+	var found bool
+	if err := out.Call(ctx, &found, "function(){return !!this.result}"); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.Errorf("node with %+v did not become stable", params)
+	}
+	obj := &chrome.JSObject{}
+	if err := out.Call(ctx, obj, "function(){return this.result}"); err != nil {
+		return nil, err
+	}
+	return NewNode(ctx, n.tconn, obj)
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package ui
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJSWaitTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		deadline time.Duration // zero for no deadline
+		timeout  time.Duration
+		// The returned timeout must be within (min, max].
+		min, max time.Duration
+	}{
+		{"no deadline", 0, 5 * time.Second, 5*time.Second - 1, 5 * time.Second},
+		{"sub-millisecond timeout", 0, time.Microsecond, time.Millisecond - 1, time.Millisecond},
+		{"timeout before deadline", time.Minute, 5 * time.Second, 5*time.Second - 1, 5 * time.Second},
+		{"deadline before timeout", 10 * time.Second, time.Minute, 8 * time.Second, 9 * time.Second},
+		{"deadline without timeout", 10 * time.Second, 0, 8 * time.Second, 9 * time.Second},
+		// The margin is reduced to a tenth of the time left for deadlines closer than 10 times the margin.
+		{"deadline within margin", waitTimeoutMargin / 2, time.Minute, waitTimeoutMargin / 4, waitTimeoutMargin / 2 * 9 / 10},
+	} {
+		ctx := context.Background()
+		if tc.deadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tc.deadline)
+			defer cancel()
+		}
+		timeout, err := jsWaitTimeout(ctx, tc.timeout)
+		if err != nil {
+			t.Errorf("%s: jsWaitTimeout failed: %v", tc.name, err)
+		} else if timeout <= tc.min || timeout > tc.max {
+			t.Errorf("%s: jsWaitTimeout returned %v; want a timeout in (%v, %v]", tc.name, timeout, tc.min, tc.max)
+		}
+	}
+
+	if _, err := jsWaitTimeout(context.Background(), 0); err == nil {
+		t.Error("jsWaitTimeout unexpectedly succeeded without timeout nor deadline")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := jsWaitTimeout(ctx, 0); err != context.Canceled {
+		t.Errorf("jsWaitTimeout returned %v for a done context; want %v", err, context.Canceled)
+	}
+}
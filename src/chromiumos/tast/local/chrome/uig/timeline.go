@@ -0,0 +1,154 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uig
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"chromiumos/tast/local/chrome/ui"
+	"chromiumos/tast/local/coords"
+)
+
+// NodeInfo describes the node resulting from a step.
+type NodeInfo struct {
+	Role      ui.RoleType `json:"role,omitempty"`
+	Name      string      `json:"name,omitempty"`
+	ClassName string      `json:"className,omitempty"`
+	Location  coords.Rect `json:"location"`
+}
+
+// Step is the record of the execution of an action of a graph.
+type Step struct {
+	// ID is the index of the step in the timeline.
+	ID int `json:"id"`
+	// Parent is the ID of the step which executed this step, or -1 for top-level steps.
+	Parent int       `json:"parent"`
+	Name   string    `json:"name"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	// Attempts is the number of attempts made by Retry actions.
+	Attempts int `json:"attempts,omitempty"`
+	// Node is the node resulting from the step, if it succeeded.
+	Node *NodeInfo `json:"node,omitempty"`
+	// Error is the error returned by the step, if it failed.
+	Error string `json:"error,omitempty"`
+	// Screenshot is the name of the screenshot file taken when the step failed, relative to the timeline files.
+	Screenshot string `json:"screenshot,omitempty"`
+
+	// parent is the step which executed this step.
+	parent *Step
+	// childFailed is set if the last step executed by this step failed.
+	childFailed bool
+}
+
+// Duration returns the duration of the step.
+func (s *Step) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Timeline is the record of the execution of action graphs.
+type Timeline struct {
+	Start time.Time `json:"start"`
+	// Steps contains the steps in the order they were started.
+	Steps []*Step `json:"steps"`
+}
+
+// WriteJSON writes the timeline in JSON format to w.
+func (t *Timeline) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t)
+}
+
+// timelineTemplate is the template of the HTML timeline. Steps are listed in the order they
+// were started, and indented under the step which executed them.
+var timelineTemplate = template.Must(template.New("timeline").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>uig timeline</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; }
+table { border-collapse: collapse; width: 100%; }
+td, th { border-bottom: 1px solid #ddd; padding: 2px 6px; text-align: left; vertical-align: top; }
+.bar { background: #4285f4; height: 10px; min-width: 1px; }
+.failed .bar { background: #db4437; }
+.failed .name { color: #db4437; }
+.timeline { width: 30%; }
+</style>
+</head>
+<body>
+<p>Started at {{.Start}}, took {{.Duration}}.</p>
+<table>
+<tr><th>Step</th><th>Start</th><th>Duration</th><th class="timeline"></th><th>Attempts</th><th>Node</th><th>Error</th></tr>
+{{range .Rows}}<tr{{if .Error}} class="failed"{{end}}>
+<td class="name" style="padding-left: {{.Indent}}px">{{.Name}}</td>
+<td>{{.Offset}}</td>
+<td>{{.Duration}}</td>
+<td class="timeline"><div class="bar" style="margin-left: {{.Left}}%; width: {{.Width}}%"></div></td>
+<td>{{if .Attempts}}{{.Attempts}}{{end}}</td>
+<td>{{with .Node}}{{.Role}} {{printf "%q" .Name}} {{.ClassName}} {{.Location}}{{end}}</td>
+<td>{{.Error}}{{with .Screenshot}} <a href="{{.}}">screenshot</a>{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// timelineRow is a row of the HTML timeline.
+type timelineRow struct {
+	*Step
+	Indent   int
+	Offset   time.Duration
+	Duration time.Duration
+	// Left and Width are the position of the bar of the step, in percents of the timeline duration.
+	Left, Width string
+}
+
+// WriteHTML writes the timeline as an HTML page to w.
+func (t *Timeline) WriteHTML(w io.Writer) error {
+	end := t.Start
+	for _, s := range t.Steps {
+		if s.End.After(end) {
+			end = s.End
+		}
+	}
+	total := end.Sub(t.Start)
+	percent := func(d time.Duration) string {
+		if total <= 0 {
+			return "0"
+		}
+		return fmt.Sprintf("%.2f", 100*float64(d)/float64(total))
+	}
+
+	depths := make(map[int]int)
+	var rows []timelineRow
+	for _, s := range t.Steps {
+		depth := 0
+		if s.Parent >= 0 {
+			depth = depths[s.Parent] + 1
+		}
+		depths[s.ID] = depth
+		offset := s.Start.Sub(t.Start)
+		rows = append(rows, timelineRow{
+			Step:     s,
+			Indent:   6 + 16*depth,
+			Offset:   offset,
+			Duration: s.Duration(),
+			Left:     percent(offset),
+			Width:    percent(s.Duration()),
+		})
+	}
+
+	return timelineTemplate.Execute(w, struct {
+		Start    time.Time
+		Duration time.Duration
+		Rows     []timelineRow
+	}{t.Start, total, rows})
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uig
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"chromiumos/tast/local/chrome/ui"
+	"chromiumos/tast/local/coords"
+)
+
+var timelineStart = time.Unix(100, 0).UTC()
+
+// at returns the time ms milliseconds after timelineStart.
+func at(ms int) time.Time {
+	return timelineStart.Add(time.Duration(ms) * time.Millisecond)
+}
+
+// failedClickTimeline is the timeline of a click on a button which was found, followed by a
+// Retry action whose attempts all failed.
+func failedClickTimeline() *Timeline {
+	return &Timeline{Start: timelineStart, Steps: []*Step{
+		{ID: 0, Parent: -1, Name: `uig.Find({Name:"OK"}).LeftClick()`, Start: at(0), End: at(400), Error: "failed to click"},
+		{ID: 1, Parent: 0, Name: `uig.Find({Name:"OK"})`, Start: at(0), End: at(100),
+			Node: &NodeInfo{Role: ui.RoleTypeButton, Name: "OK", Location: coords.NewRect(1, 2, 3, 4)}},
+		{ID: 2, Parent: -1, Name: "uig.Retry(2, ...)", Start: at(500), End: at(1000), Attempts: 2, Error: "<not found>",
+			Screenshot: "test_step2.png"},
+	}}
+}
+
+// retriedFindTimeline is the timeline of a Retry action whose second attempt found a nested node.
+func retriedFindTimeline() *Timeline {
+	return &Timeline{Start: timelineStart, Steps: []*Step{
+		{ID: 0, Parent: -1, Name: "uig.Retry(3, ...)", Start: at(0), End: at(800), Attempts: 2,
+			Node: &NodeInfo{Role: ui.RoleTypeStaticText, Name: "Done"}},
+		{ID: 1, Parent: 0, Name: `uig.Find({Role:dialog}).Find({Name:"Done"})`, Start: at(0), End: at(200), Error: "not found",
+			Screenshot: "test_step1.png"},
+		{ID: 2, Parent: 1, Name: "uig.Find({Role:dialog})", Start: at(0), End: at(100),
+			Node: &NodeInfo{Role: ui.RoleTypeDialog}},
+		{ID: 3, Parent: 0, Name: `uig.Find({Role:dialog}).Find({Name:"Done"})`, Start: at(400), End: at(800),
+			Node: &NodeInfo{Role: ui.RoleTypeStaticText, Name: "Done"}},
+		{ID: 4, Parent: 3, Name: "uig.Find({Role:dialog})", Start: at(400), End: at(600),
+			Node: &NodeInfo{Role: ui.RoleTypeDialog}},
+	}}
+}
+
+func TestTimelineJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		tl   *Timeline
+		want []string
+	}{
+		{"failed click", failedClickTimeline(), []string{`"error": "failed to click"`, `"screenshot": "test_step2.png"`}},
+		{"retried find", retriedFindTimeline(), []string{`"parent": 3`, `"attempts": 2`, `"role": "dialog"`}},
+		{"empty", &Timeline{Start: timelineStart}, []string{`"steps": null`}},
+	} {
+		var b bytes.Buffer
+		if err := tc.tl.WriteJSON(&b); err != nil {
+			t.Errorf("%s: WriteJSON failed: %v", tc.name, err)
+			continue
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(b.String(), want) {
+				t.Errorf("%s: WriteJSON output does not contain %q:\n%s", tc.name, want, b.String())
+			}
+		}
+		var got Timeline
+		if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+			t.Errorf("%s: Failed to unmarshal timeline: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(&got, tc.tl) {
+			t.Errorf("%s: Unmarshaled %+v; want %+v", tc.name, got, tc.tl)
+		}
+	}
+}
+
+func TestTimelineHTML(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		tl   *Timeline
+		want []string
+	}{
+		{"failed click", failedClickTimeline(), []string{
+			`<td class="name" style="padding-left: 22px">uig.Find({Name:&#34;OK&#34;})</td>`,
+			`<div class="bar" style="margin-left: 50.00%; width: 50.00%">`,
+			`<td>button &#34;OK&#34;  (1, 2) - (3 x 4)</td>`,
+			`<tr class="failed">`,
+			`&lt;not found&gt; <a href="test_step2.png">screenshot</a>`,
+			`<td>2</td>`,
+		}},
+		{"retried find", retriedFindTimeline(), []string{
+			`UTC, took 800ms.</p>`,
+			`<td class="name" style="padding-left: 6px">uig.Retry(3, ...)</td>`,
+			// The steps executed by the attempts of the Retry action are nested under them.
+			`<td class="name" style="padding-left: 38px">uig.Find({Role:dialog})</td>`,
+			`<td>400ms</td>`,
+			`<div class="bar" style="margin-left: 50.00%; width: 25.00%">`,
+			`not found <a href="test_step1.png">screenshot</a>`,
+		}},
+		{"empty", &Timeline{Start: timelineStart}, []string{
+			`UTC, took 0s.</p>`,
+		}},
+	} {
+		var b bytes.Buffer
+		if err := tc.tl.WriteHTML(&b); err != nil {
+			t.Errorf("%s: WriteHTML failed: %v", tc.name, err)
+			continue
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(b.String(), want) {
+				t.Errorf("%s: WriteHTML output does not contain %q:\n%s", tc.name, want, b.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/chrome"
+	"chromiumos/tast/local/chrome/ui"
+	"chromiumos/tast/local/screenshot"
+	"chromiumos/tast/testing"
+)
+
+// Recorder records the execution of action graphs. For each executed action, it records
+// the start and end times, the number of attempts of Retry actions, the resulting node and
+// the error. A screenshot is taken when an action fails before any of the actions it executes.
+//
+// Example:
+//  rec := uig.NewRecorder(s.OutDir(), "toggle_wifi")
+//  defer rec.Save()
+//  if err := rec.Do(ctx, tconn, steps); err != nil {
+//     s.Fatal("Failed to toggle Wi-Fi: ", err)
+//  }
+type Recorder struct {
+	dir      string
+	name     string
+	timeline Timeline
+}
+
+// NewRecorder returns a recorder saving its timeline and screenshots in dir.
+// name is used as the prefix of the saved files.
+func NewRecorder(dir, name string) *Recorder {
+	return &Recorder{dir: dir, name: name}
+}
+
+// Do is like uig.Do, but records the execution of the graphs.
+// It can be called several times to record a sequence of graphs in the same timeline.
+func (r *Recorder) Do(ctx context.Context, tconn *chrome.TestConn, graphs ...*Action) error {
+	return Do(r.context(ctx), tconn, graphs...)
+}
+
+// GetNode is like uig.GetNode, but records the execution of the graph.
+func (r *Recorder) GetNode(ctx context.Context, tconn *chrome.TestConn, graph *Action) (*ui.Node, error) {
+	return GetNode(r.context(ctx), tconn, graph)
+}
+
+// Timeline returns the timeline recorded so far.
+func (r *Recorder) Timeline() *Timeline {
+	return &r.timeline
+}
+
+// Save writes the timeline in JSON and HTML formats to the <name>_timeline.json and
+// <name>_timeline.html files.
+func (r *Recorder) Save() error {
+	for ext, write := range map[string]func(f *os.File) error{
+		"json": func(f *os.File) error { return r.timeline.WriteJSON(f) },
+		"html": func(f *os.File) error { return r.timeline.WriteHTML(f) },
+	} {
+		path := filepath.Join(r.dir, fmt.Sprintf("%s_timeline.%s", r.name, ext))
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := write(f); err != nil {
+			f.Close()
+			return errors.Wrapf(err, "failed to write %s", path)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DoWithTrace executes the graphs like uig.Do, and saves the timeline of their
+// execution to dir. See Recorder for details.
+func DoWithTrace(ctx context.Context, tconn *chrome.TestConn, dir, name string, graphs ...*Action) error {
+	r := NewRecorder(dir, name)
+	err := r.Do(ctx, tconn, graphs...)
+	if saveErr := r.Save(); saveErr != nil {
+		testing.ContextLog(ctx, "Failed to save the uig timeline: ", saveErr)
+	}
+	return err
+}
+
+// traceKey is the key of the *traceState stored in contexts of recorded executions.
+type traceKey struct{}
+
+// traceState is the state of a recorded execution.
+type traceState struct {
+	rec *Recorder
+	// step is the step being executed, or nil at the top level.
+	step *Step
+}
+
+// context returns a context recording the executions of actions in r.
+func (r *Recorder) context(ctx context.Context) context.Context {
+	if r.timeline.Start.IsZero() {
+		r.timeline.Start = time.Now()
+	}
+	return context.WithValue(ctx, traceKey{}, &traceState{rec: r})
+}
+
+// exec executes the graph starting from a, recording it if ctx comes from a Recorder.
+// Actions must execute their parent and child actions with exec rather than do.
+func (a *Action) exec(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
+	st, ok := ctx.Value(traceKey{}).(*traceState)
+	if !ok || a.untraced {
+		return a.do(ctx, tconn, root)
+	}
+
+	step := st.rec.begin(st.step, a.name)
+	node, err := a.do(context.WithValue(ctx, traceKey{}, &traceState{rec: st.rec, step: step}), tconn, root)
+	st.rec.end(ctx, step, node, err)
+	return node, err
+}
+
+// recordAttempt records the number of attempts made by the step being executed.
+func recordAttempt(ctx context.Context, attempts int) {
+	if st, ok := ctx.Value(traceKey{}).(*traceState); ok && st.step != nil {
+		st.step.Attempts = attempts
+	}
+}
+
+// begin adds a step started now to the timeline.
+func (r *Recorder) begin(parent *Step, name string) *Step {
+	step := &Step{ID: len(r.timeline.Steps), Parent: -1, Name: name, Start: time.Now(), parent: parent}
+	if parent != nil {
+		step.Parent = parent.ID
+	}
+	r.timeline.Steps = append(r.timeline.Steps, step)
+	return step
+}
+
+// end records the result of step.
+func (r *Recorder) end(ctx context.Context, step *Step, node *nodeRef, err error) {
+	step.End = time.Now()
+	if step.parent != nil {
+		// Only the last step executed by the parent matters, so that the failed attempts
+		// of a Retry action are forgotten once an attempt succeeds.
+		step.parent.childFailed = err != nil
+	}
+	if err == nil {
+		if n := node.node; n != nil {
+			step.Node = &NodeInfo{Role: n.Role, Name: n.Name, ClassName: n.ClassName, Location: n.Location}
+		}
+		return
+	}
+
+	step.Error = err.Error()
+	// Only take a screenshot where the failure happened, rather than in every failed ancestor.
+	if !step.childFailed {
+		file := fmt.Sprintf("%s_step%d.png", r.name, step.ID)
+		if err := screenshot.Capture(ctx, filepath.Join(r.dir, file)); err != nil {
+			testing.ContextLogf(ctx, "Failed to take screenshot for step %d: %v", step.ID, err)
+		} else {
+			step.Screenshot = file
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uig
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/chrome"
+)
+
+// flakyAction returns an action failing the first failures times it is executed.
+func flakyAction(failures int) *Action {
+	return &Action{
+		name: "flaky()",
+		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
+			if failures > 0 {
+				failures--
+				root.release(ctx)
+				return nil, errors.New("flaked")
+			}
+			return root, nil
+		},
+	}
+}
+
+func TestRecorderRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uig_trace_test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		name        string
+		failures    int
+		attempts    int
+		childFailed bool
+	}{
+		{"first attempt succeeds", 0, 1, false},
+		{"second attempt succeeds", 1, 2, false},
+		{"all attempts fail", 3, 3, true},
+	} {
+		rec := NewRecorder(dir, "test")
+		// Keep enough references to the root so that it is never released.
+		root := &nodeRef{refs: 10}
+		_, err := Retry(3, flakyAction(tc.failures)).exec(rec.context(context.Background()), nil, root)
+		if tc.childFailed != (err != nil) {
+			t.Errorf("%s: Retry returned %v", tc.name, err)
+		}
+		steps := rec.Timeline().Steps
+		if len(steps) != tc.attempts+1 {
+			t.Errorf("%s: Recorded %d steps; want %d", tc.name, len(steps), tc.attempts+1)
+			continue
+		}
+		if s := steps[0]; s.Attempts != tc.attempts || s.childFailed != tc.childFailed {
+			t.Errorf("%s: Retry step has %d attempts and childFailed %v; want %d and %v",
+				tc.name, s.Attempts, s.childFailed, tc.attempts, tc.childFailed)
+		}
+	}
+}
+
+func TestRecorderWithNamef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uig_trace_test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rec := NewRecorder(dir, "test")
+	root := &nodeRef{refs: 10}
+	const name = "FindFlaky()"
+	if _, err := flakyAction(0).WithNamef(name).exec(rec.context(context.Background()), nil, root); err != nil {
+		t.Fatal("Action failed: ", err)
+	}
+	// The renamed action must be recorded once under its new name, not nested in a step of the same action.
+	steps := rec.Timeline().Steps
+	if len(steps) != 1 || steps[0].Name != name {
+		var names []string
+		for _, s := range steps {
+			names = append(names, s.Name)
+		}
+		t.Errorf("Recorded steps %q; want [%q]", names, name)
+	}
+}
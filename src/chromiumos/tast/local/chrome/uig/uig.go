@@ -50,6 +50,9 @@ type Action struct {
 
 	// name is a string representation of the graph starting at this node, typically used in error messages.
 	name string
+
+	// untraced is set for actions which are not recorded by Recorder.
+	untraced bool
 }
 
 // nodeRef is a reference counted wrapper around a ui.Node.
@@ -105,8 +108,11 @@ func (a *Action) String() string {
 // file.go:27: got an error: FindColorButton("blue").LeftClick(): couldn't click.
 func (a *Action) WithNamef(format string, params ...interface{}) *Action {
 	name := fmt.Sprintf(format, params...)
+	// The wrapped action is called with do rather than exec, so that Recorder records a single step
+	// for both, under the new name.
 	return &Action{
-		name: name,
+		name:     name,
+		untraced: a.untraced,
 		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
 			node, err := a.do(ctx, tconn, root)
 			if err != nil {
@@ -115,7 +121,6 @@ func (a *Action) WithNamef(format string, params ...interface{}) *Action {
 			return node, nil
 		},
 	}
-
 }
 
 // Steps combines actions into a sequence of steps that are executed one after another.
@@ -130,13 +135,13 @@ func (a *Action) Steps(actions ...*Action) *Action {
 	return &Action{
 		name: name,
 		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
-			node, err := a.do(ctx, tconn, root)
+			node, err := a.exec(ctx, tconn, root)
 			if err != nil {
 				return nil, errors.Wrap(err, name)
 			}
 			for i, action := range actions {
 				node.acquire()
-				child, err := action.do(ctx, tconn, node)
+				child, err := action.exec(ctx, tconn, node)
 				if err != nil {
 					if len(actions) > 1 {
 						return nil, errors.Wrapf(err, "Step %d", i+1)
@@ -166,7 +171,7 @@ func (a *Action) Retry(times int, action *Action) *Action {
 	return &Action{
 		name: name,
 		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
-			node, err := a.do(ctx, tconn, root)
+			node, err := a.exec(ctx, tconn, root)
 			if err != nil {
 				return nil, errors.Wrap(err, name)
 			}
@@ -174,7 +179,8 @@ func (a *Action) Retry(times int, action *Action) *Action {
 			for i := 0; i < times; i++ {
 				node.acquire()
 				var child *nodeRef
-				child, actionErr = action.do(ctx, tconn, node)
+				child, actionErr = action.exec(ctx, tconn, node)
+				recordAttempt(ctx, i+1)
 				if actionErr == nil {
 					node.release(ctx)
 					return child, nil
@@ -203,7 +209,7 @@ func (a *Action) LeftClick() *Action {
 	return &Action{
 		name: name,
 		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
-			node, err := a.do(ctx, tconn, root)
+			node, err := a.exec(ctx, tconn, root)
 			if err != nil {
 				return nil, err
 			}
@@ -228,7 +234,7 @@ func (a *Action) RightClick() *Action {
 	return &Action{
 		name: name,
 		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
-			node, err := a.do(ctx, tconn, root)
+			node, err := a.exec(ctx, tconn, root)
 			if err != nil {
 				return nil, err
 			}
@@ -250,7 +256,7 @@ func (a *Action) FocusAndWait(timeout time.Duration) *Action {
 	return &Action{
 		name: name,
 		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
-			node, err := a.do(ctx, tconn, root)
+			node, err := a.exec(ctx, tconn, root)
 			if err != nil {
 				return nil, err
 			}
@@ -269,7 +275,7 @@ func (a *Action) Find(params ui.FindParams) *Action {
 	return &Action{
 		name: name,
 		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
-			node, err := a.do(ctx, tconn, root)
+			node, err := a.exec(ctx, tconn, root)
 			if err != nil {
 				return nil, err
 			}
@@ -294,7 +300,7 @@ func (a *Action) FindWithTimeout(params ui.FindParams, timeout time.Duration) *A
 	return &Action{
 		name: name,
 		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
-			node, err := a.do(ctx, tconn, root)
+			node, err := a.exec(ctx, tconn, root)
 			if err != nil {
 				return nil, err
 			}
@@ -313,6 +319,58 @@ func FindWithTimeout(params ui.FindParams, timeout time.Duration) *Action {
 	return Root().FindWithTimeout(params, timeout).WithNamef("uig.FindWithTimeout(%+v, %v)", params, timeout)
 }
 
+// Query finds the first node selected by selector, evaluated on the node it is called on.
+// The selector syntax is described in the ui.Selector documentation.
+func (a *Action) Query(selector string) *Action {
+	name := fmt.Sprintf("%s.Query(%q)", a.String(), selector)
+	return &Action{
+		name: name,
+		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
+			node, err := a.exec(ctx, tconn, root)
+			if err != nil {
+				return nil, err
+			}
+			child, err := node.node.Query(ctx, selector)
+			node.release(ctx)
+			if err != nil {
+				return nil, errors.Wrap(err, name)
+			}
+			return newNodeRef(child), nil
+		},
+	}
+}
+
+// Query is a shortcut for uig.Root().Query(...).
+func Query(selector string) *Action {
+	return Root().Query(selector).WithNamef("uig.Query(%q)", selector)
+}
+
+// QueryWithTimeout finds the first node selected by selector, evaluated on the node it is
+// called on. It returns an error if the timeout expires.
+func (a *Action) QueryWithTimeout(selector string, timeout time.Duration) *Action {
+	name := fmt.Sprintf("%s.QueryWithTimeout(%q, %v)", a.String(), selector, timeout)
+	return &Action{
+		name: name,
+		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
+			node, err := a.exec(ctx, tconn, root)
+			if err != nil {
+				return nil, err
+			}
+			child, err := node.node.QueryWithTimeout(ctx, selector, timeout)
+			node.release(ctx)
+			if err != nil {
+				return nil, errors.Wrap(err, name)
+			}
+			return newNodeRef(child), nil
+		},
+	}
+}
+
+// QueryWithTimeout is a shortcut for uig.Root().QueryWithTimeout(...).
+func QueryWithTimeout(selector string, timeout time.Duration) *Action {
+	return Root().QueryWithTimeout(selector, timeout).WithNamef("uig.QueryWithTimeout(%q, %v)", selector, timeout)
+}
+
 // WaitUntilDescendantExists waits until a given node is found as a descendant
 // of the node this is called on.
 //
@@ -322,7 +380,7 @@ func (a *Action) WaitUntilDescendantExists(params ui.FindParams, timeout time.Du
 	return &Action{
 		name: name,
 		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
-			node, err := a.do(ctx, tconn, root)
+			node, err := a.exec(ctx, tconn, root)
 			if err != nil {
 				return nil, err
 			}
@@ -350,7 +408,7 @@ func (a *Action) WaitUntilDescendantGone(params ui.FindParams, timeout time.Dura
 	return &Action{
 		name: name,
 		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
-			node, err := a.do(ctx, tconn, root)
+			node, err := a.exec(ctx, tconn, root)
 			if err != nil {
 				return nil, err
 			}
@@ -377,7 +435,7 @@ func (a *Action) WaitForLocationChangeCompleted() *Action {
 	return &Action{
 		name: name,
 		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
-			node, err := a.do(ctx, tconn, root)
+			node, err := a.exec(ctx, tconn, root)
 			if err != nil {
 				return nil, err
 			}
@@ -408,7 +466,8 @@ func WaitForLocationChangeCompleted() *Action {
 func Root() *Action {
 	name := "uig.Root()"
 	return &Action{
-		name: name,
+		name:     name,
+		untraced: true,
 		do: func(ctx context.Context, tconn *chrome.TestConn, root *nodeRef) (*nodeRef, error) {
 			return root, nil
 		},
@@ -423,7 +482,7 @@ func GetNode(ctx context.Context, tconn *chrome.TestConn, graph *Action) (*ui.No
 	if err != nil {
 		return nil, errors.Wrap(err, "could not get desktop ui.Node in uig.GetNode")
 	}
-	node, err := graph.do(ctx, tconn, newNodeRef(root))
+	node, err := graph.exec(ctx, tconn, newNodeRef(root))
 	if err != nil {
 		return nil, err
 	}
@@ -437,7 +496,7 @@ func Do(ctx context.Context, tconn *chrome.TestConn, graphs ...*Action) error {
 	if err != nil {
 		return errors.Wrap(err, "could not get desktop ui.Node in uig.Do")
 	}
-	node, err := Steps(graphs...).do(ctx, tconn, newNodeRef(root))
+	node, err := Steps(graphs...).exec(ctx, tconn, newNodeRef(root))
 	if err != nil {
 		return err
 	}
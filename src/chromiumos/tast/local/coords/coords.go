@@ -42,6 +42,11 @@ func (p Point) Sub(p2 Point) Point {
 	return Point{p.X - p2.X, p.Y - p2.Y}
 }
 
+// ToPointF returns the float representation of p.
+func (p Point) ToPointF() PointF {
+	return PointF{X: float64(p.X), Y: float64(p.Y)}
+}
+
 // Size represents a size of a region.
 type Size struct {
 	Width  int `json:"width"`
@@ -162,6 +167,57 @@ func (r Rect) WithOffset(dl, dt int) Rect {
 	return NewRect(r.Left+dl, r.Top+dt, r.Width, r.Height)
 }
 
+// Contains returns true if p lies inside of r. Like the other methods of
+// Rect, the right and bottom edges are exclusive.
+func (r Rect) Contains(p Point) bool {
+	return r.Left <= p.X && p.X < r.Right() && r.Top <= p.Y && p.Y < r.Bottom()
+}
+
+// ContainsRect returns true if r2 is entirely inside of r. An empty r2 is
+// contained in any rect.
+func (r Rect) ContainsRect(r2 Rect) bool {
+	if r2.Width <= 0 || r2.Height <= 0 {
+		return true
+	}
+	return r.Left <= r2.Left && r2.Right() <= r.Right() && r.Top <= r2.Top && r2.Bottom() <= r.Bottom()
+}
+
+// Intersect returns the intersection of r and r2. If they do not overlap,
+// an empty rect is returned.
+func (r Rect) Intersect(r2 Rect) Rect {
+	l := maxInt(r.Left, r2.Left)
+	t := maxInt(r.Top, r2.Top)
+	rt := minInt(r.Right(), r2.Right())
+	b := minInt(r.Bottom(), r2.Bottom())
+	if rt <= l || b <= t {
+		return Rect{}
+	}
+	return NewRectLTRB(l, t, rt, b)
+}
+
+// Union returns the smallest rect which contains both r and r2. A rect with
+// no area is ignored, so the union of an empty rect and r2 is r2.
+func (r Rect) Union(r2 Rect) Rect {
+	if r.Width <= 0 || r.Height <= 0 {
+		return r2
+	}
+	if r2.Width <= 0 || r2.Height <= 0 {
+		return r
+	}
+	return NewRectLTRB(minInt(r.Left, r2.Left), minInt(r.Top, r2.Top), maxInt(r.Right(), r2.Right()), maxInt(r.Bottom(), r2.Bottom()))
+}
+
+// Overlaps returns true if r and r2 share a region with a positive area.
+// Rects which only touch each other on an edge do not overlap.
+func (r Rect) Overlaps(r2 Rect) bool {
+	return !r.Intersect(r2).Empty()
+}
+
+// ToRectF returns the float representation of r.
+func (r Rect) ToRectF() RectF {
+	return RectF{Left: float64(r.Left), Top: float64(r.Top), Width: float64(r.Width), Height: float64(r.Height)}
+}
+
 // convertBounds is used by ConvertBoundsFromDPToPX and ConvertBoundsFromPXToDP.
 func convertBounds(bounds Rect, factor float64) Rect {
 	return Rect{
@@ -182,3 +238,17 @@ func ConvertBoundsFromDPToPX(bounds Rect, dsf float64) Rect {
 func ConvertBoundsFromPXToDP(bounds Rect, dsf float64) Rect {
 	return convertBounds(bounds, 1.0/dsf)
 }
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package coords
+
+import (
+	"testing"
+)
+
+func TestRectContains(t *testing.T) {
+	r := NewRect(10, 20, 30, 40)
+	for _, tc := range []struct {
+		p    Point
+		want bool
+	}{
+		{NewPoint(10, 20), true},
+		{NewPoint(39, 59), true},
+		{NewPoint(40, 30), false},
+		{NewPoint(20, 60), false},
+		{NewPoint(9, 30), false},
+	} {
+		if got := r.Contains(tc.p); got != tc.want {
+			t.Errorf("%v.Contains(%v) = %v; want %v", r, tc.p, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		r2   Rect
+		want bool
+	}{
+		{r, true},
+		{NewRect(15, 25, 5, 5), true},
+		{NewRect(15, 25, 30, 5), false},
+		{NewRect(100, 100, 0, 0), true},
+	} {
+		if got := r.ContainsRect(tc.r2); got != tc.want {
+			t.Errorf("%v.ContainsRect(%v) = %v; want %v", r, tc.r2, got, tc.want)
+		}
+	}
+}
+
+func TestRectIntersectUnion(t *testing.T) {
+	for _, tc := range []struct {
+		r1, r2    Rect
+		intersect Rect
+		union     Rect
+		overlaps  bool
+	}{
+		{NewRect(0, 0, 10, 10), NewRect(5, 5, 10, 10), NewRect(5, 5, 5, 5), NewRect(0, 0, 15, 15), true},
+		{NewRect(0, 0, 10, 10), NewRect(2, 2, 3, 3), NewRect(2, 2, 3, 3), NewRect(0, 0, 10, 10), true},
+		{NewRect(0, 0, 10, 10), NewRect(10, 0, 10, 10), Rect{}, NewRect(0, 0, 20, 10), false},
+		{NewRect(0, 0, 10, 10), NewRect(20, 20, 5, 5), Rect{}, NewRect(0, 0, 25, 25), false},
+		{Rect{}, NewRect(20, 20, 5, 5), Rect{}, NewRect(20, 20, 5, 5), false},
+	} {
+		if got := tc.r1.Intersect(tc.r2); got != tc.intersect {
+			t.Errorf("%v.Intersect(%v) = %v; want %v", tc.r1, tc.r2, got, tc.intersect)
+		}
+		if got := tc.r2.Intersect(tc.r1); got != tc.intersect {
+			t.Errorf("%v.Intersect(%v) = %v; want %v", tc.r2, tc.r1, got, tc.intersect)
+		}
+		if got := tc.r1.Union(tc.r2); got != tc.union {
+			t.Errorf("%v.Union(%v) = %v; want %v", tc.r1, tc.r2, got, tc.union)
+		}
+		if got := tc.r1.Overlaps(tc.r2); got != tc.overlaps {
+			t.Errorf("%v.Overlaps(%v) = %v; want %v", tc.r1, tc.r2, got, tc.overlaps)
+		}
+	}
+}
+
+func TestRectFRound(t *testing.T) {
+	r := NewRectF(0.4, 0.6, 10.2, 10.2)
+	if got, want := r.Round(), NewRectLTRB(0, 1, 11, 11); got != want {
+		t.Errorf("%v.Round() = %v; want %v", r, got, want)
+	}
+	if got, want := r.Enclosing(), NewRectLTRB(0, 0, 11, 11); got != want {
+		t.Errorf("%v.Enclosing() = %v; want %v", r, got, want)
+	}
+}
+
+func TestNewRotation(t *testing.T) {
+	for _, tc := range []struct {
+		degrees int
+		want    Rotation
+		wantErr bool
+	}{
+		{0, Rotate0, false},
+		{90, Rotate90, false},
+		{-90, Rotate270, false},
+		{540, Rotate180, false},
+		{45, Rotate0, true},
+	} {
+		got, err := NewRotation(tc.degrees)
+		if err != nil {
+			if !tc.wantErr {
+				t.Errorf("NewRotation(%d) failed: %v", tc.degrees, err)
+			}
+			continue
+		}
+		if tc.wantErr {
+			t.Errorf("NewRotation(%d) = %v; want error", tc.degrees, got)
+		} else if got != tc.want {
+			t.Errorf("NewRotation(%d) = %v; want %v", tc.degrees, got, tc.want)
+		}
+	}
+}
+
+func TestRotateTransform(t *testing.T) {
+	size := NewSize(100, 50)
+	r := NewRect(10, 20, 30, 10)
+	for _, tc := range []struct {
+		rot   Rotation
+		point Point
+		rect  Rect
+	}{
+		{Rotate0, NewPoint(10, 20), r},
+		{Rotate90, NewPoint(30, 10), NewRect(20, 10, 10, 30)},
+		{Rotate180, NewPoint(90, 30), NewRect(60, 20, 30, 10)},
+		{Rotate270, NewPoint(20, 90), NewRect(20, 60, 10, 30)},
+	} {
+		tr := NewRotateTransform(tc.rot, size)
+		if got := tr.ApplyPoint(r.TopLeft()); got != tc.point {
+			t.Errorf("Rotating %v by %d = %v; want %v", r.TopLeft(), tc.rot, got, tc.point)
+		}
+		if got := tr.ApplyRect(r); got != tc.rect {
+			t.Errorf("Rotating %v by %d = %v; want %v", r, tc.rot, got, tc.rect)
+		}
+		inv, err := tr.Inverse()
+		if err != nil {
+			t.Errorf("Failed to invert rotation by %d: %v", tc.rot, err)
+		} else if got := inv.ApplyRect(tc.rect); got != r {
+			t.Errorf("Inverse rotation by %d of %v = %v; want %v", tc.rot, tc.rect, got, r)
+		}
+	}
+}
+
+func TestTransformThen(t *testing.T) {
+	tr := NewScaleTransform(2, 3).Then(NewTranslateTransform(5, 7))
+	if got, want := tr.ApplyPoint(NewPoint(1, 1)), NewPoint(7, 10); got != want {
+		t.Errorf("Scale then translate of (1, 1) = %v; want %v", got, want)
+	}
+	if _, err := NewScaleTransform(0, 1).Inverse(); err == nil {
+		t.Error("Inverse of a zero scale unexpectedly succeeded")
+	}
+}
+
+func TestScreenToTouchscreen(t *testing.T) {
+	// A portrait display on the right of the primary one.
+	display := NewRect(1000, 0, 500, 1000)
+	touch := NewSize(2000, 1000)
+	for _, tc := range []struct {
+		rot  Rotation
+		p    Point
+		want Point
+	}{
+		{Rotate0, NewPoint(1000, 0), NewPoint(0, 0)},
+		{Rotate0, NewPoint(1250, 500), NewPoint(1000, 500)},
+		{Rotate90, NewPoint(1000, 0), NewPoint(2000, 0)},
+		{Rotate90, NewPoint(1000, 1000), NewPoint(0, 0)},
+		{Rotate90, NewPoint(1500, 1000), NewPoint(0, 1000)},
+	} {
+		tr := ScreenToTouchscreen(display, touch, tc.rot)
+		if got := tr.ApplyPoint(tc.p); got != tc.want {
+			t.Errorf("ScreenToTouchscreen(%v, %v, %d) of %v = %v; want %v", display, touch, tc.rot, tc.p, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package coords
+
+import (
+	"fmt"
+	"math"
+)
+
+// PointF represents a location with sub-pixel precision.
+type PointF struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// NewPointF creates a new PointF instance for given x,y coordinates.
+func NewPointF(x, y float64) PointF {
+	return PointF{X: x, Y: y}
+}
+
+// String returns the string representation of PointF.
+func (p PointF) String() string {
+	return fmt.Sprintf("(%g, %g)", p.X, p.Y)
+}
+
+// Add returns the addition of two PointFs.
+func (p PointF) Add(p2 PointF) PointF {
+	return PointF{p.X + p2.X, p.Y + p2.Y}
+}
+
+// Sub returns the subtraction of two PointFs.
+func (p PointF) Sub(p2 PointF) PointF {
+	return PointF{p.X - p2.X, p.Y - p2.Y}
+}
+
+// Round returns the Point nearest to p.
+func (p PointF) Round() Point {
+	return Point{X: int(math.Round(p.X)), Y: int(math.Round(p.Y))}
+}
+
+// RectF represents a rectangular region with sub-pixel precision.
+type RectF struct {
+	Left   float64 `json:"left"`
+	Top    float64 `json:"top"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// NewRectF creates a new RectF instance for given x, y width, and height.
+func NewRectF(x, y, w, h float64) RectF {
+	return RectF{Left: x, Top: y, Width: w, Height: h}
+}
+
+// NewRectFLTRB creates a new RectF instance for left, top, right, and bottom
+// coordinates.
+func NewRectFLTRB(l, t, r, b float64) RectF {
+	return RectF{Left: l, Top: t, Width: r - l, Height: b - t}
+}
+
+// String returns the string representation of RectF.
+func (r RectF) String() string {
+	return fmt.Sprintf("(%g, %g) - (%g x %g)", r.Left, r.Top, r.Width, r.Height)
+}
+
+// Right returns the x-value of the right edge of the rectangle.
+func (r RectF) Right() float64 {
+	return r.Left + r.Width
+}
+
+// Bottom returns the y-value of the bottom edge of the rectangle.
+func (r RectF) Bottom() float64 {
+	return r.Top + r.Height
+}
+
+// TopLeft returns the location of the top left of the rectangle.
+func (r RectF) TopLeft() PointF {
+	return PointF{X: r.Left, Y: r.Top}
+}
+
+// BottomRight returns the location of the bottom right of the rectangle.
+func (r RectF) BottomRight() PointF {
+	return PointF{X: r.Right(), Y: r.Bottom()}
+}
+
+// CenterPoint returns the location of the center of the rectangle.
+func (r RectF) CenterPoint() PointF {
+	return PointF{X: r.Left + r.Width/2, Y: r.Top + r.Height/2}
+}
+
+// Empty returns true if the r has no area.
+func (r RectF) Empty() bool {
+	return r.Width <= 0 || r.Height <= 0
+}
+
+// Contains returns true if p lies inside of r. The right and bottom edges are
+// exclusive.
+func (r RectF) Contains(p PointF) bool {
+	return r.Left <= p.X && p.X < r.Right() && r.Top <= p.Y && p.Y < r.Bottom()
+}
+
+// ContainsRect returns true if r2 is entirely inside of r.
+func (r RectF) ContainsRect(r2 RectF) bool {
+	if r2.Empty() {
+		return true
+	}
+	return r.Left <= r2.Left && r2.Right() <= r.Right() && r.Top <= r2.Top && r2.Bottom() <= r.Bottom()
+}
+
+// Intersect returns the intersection of r and r2. If they do not overlap,
+// a zero-value RectF is returned.
+func (r RectF) Intersect(r2 RectF) RectF {
+	l := math.Max(r.Left, r2.Left)
+	t := math.Max(r.Top, r2.Top)
+	rt := math.Min(r.Right(), r2.Right())
+	b := math.Min(r.Bottom(), r2.Bottom())
+	if rt <= l || b <= t {
+		return RectF{}
+	}
+	return NewRectFLTRB(l, t, rt, b)
+}
+
+// Union returns the smallest rect which contains both r and r2. A rect with
+// no area is ignored.
+func (r RectF) Union(r2 RectF) RectF {
+	if r.Empty() {
+		return r2
+	}
+	if r2.Empty() {
+		return r
+	}
+	return NewRectFLTRB(math.Min(r.Left, r2.Left), math.Min(r.Top, r2.Top), math.Max(r.Right(), r2.Right()), math.Max(r.Bottom(), r2.Bottom()))
+}
+
+// Overlaps returns true if r and r2 share a region with a positive area.
+func (r RectF) Overlaps(r2 RectF) bool {
+	return !r.Intersect(r2).Empty()
+}
+
+// Round returns the Rect whose edges are nearest to the edges of r. The edges
+// are rounded rather than the size, so that adjacent rects stay adjacent.
+func (r RectF) Round() Rect {
+	return NewRectLTRB(int(math.Round(r.Left)), int(math.Round(r.Top)), int(math.Round(r.Right())), int(math.Round(r.Bottom())))
+}
+
+// Enclosing returns the smallest Rect which contains r entirely.
+func (r RectF) Enclosing() Rect {
+	return NewRectLTRB(int(math.Floor(r.Left)), int(math.Floor(r.Top)), int(math.Ceil(r.Right())), int(math.Ceil(r.Bottom())))
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package coords
+
+import (
+	"math"
+
+	"chromiumos/tast/errors"
+)
+
+// Rotation represents a clockwise rotation of a display, in degrees.
+type Rotation int
+
+// Rotations supported by displays.
+const (
+	Rotate0   Rotation = 0
+	Rotate90  Rotation = 90
+	Rotate180 Rotation = 180
+	Rotate270 Rotation = 270
+)
+
+// NewRotation returns the Rotation for the given degrees. The degrees are
+// normalized into [0, 360), and an error is returned if the result is not a
+// multiple of 90.
+func NewRotation(degrees int) (Rotation, error) {
+	degrees = degrees % 360
+	if degrees < 0 {
+		degrees += 360
+	}
+	if degrees%90 != 0 {
+		return Rotate0, errors.Errorf("unsupported rotation: %d", degrees)
+	}
+	return Rotation(degrees), nil
+}
+
+// Size returns the size of a region of size s after it is rotated by r.
+func (r Rotation) Size(s Size) Size {
+	if r == Rotate90 || r == Rotate270 {
+		return Size{Width: s.Height, Height: s.Width}
+	}
+	return s
+}
+
+// Transform is a 2D affine transformation. A point (x, y) is transformed to
+// (A*x + B*y + TX, C*x + D*y + TY).
+type Transform struct {
+	A, B, TX float64
+	C, D, TY float64
+}
+
+// NewIdentityTransform returns a Transform which doesn't change anything.
+func NewIdentityTransform() Transform {
+	return Transform{A: 1, D: 1}
+}
+
+// NewTranslateTransform returns a Transform which offsets by (dx, dy).
+func NewTranslateTransform(dx, dy float64) Transform {
+	return Transform{A: 1, D: 1, TX: dx, TY: dy}
+}
+
+// NewScaleTransform returns a Transform which scales by sx horizontally and
+// by sy vertically around the origin.
+func NewScaleTransform(sx, sy float64) Transform {
+	return Transform{A: sx, D: sy}
+}
+
+// NewRotateTransform returns a Transform which rotates a region of the given
+// size clockwise by r, so that the region again starts at the origin. The
+// result is within a region of size r.Size(size).
+func NewRotateTransform(r Rotation, size Size) Transform {
+	w, h := float64(size.Width), float64(size.Height)
+	switch r {
+	case Rotate90:
+		return Transform{B: -1, TX: h, C: 1}
+	case Rotate180:
+		return Transform{A: -1, TX: w, D: -1, TY: h}
+	case Rotate270:
+		return Transform{B: 1, C: -1, TY: w}
+	}
+	return NewIdentityTransform()
+}
+
+// Then returns the Transform which applies t first and then t2.
+func (t Transform) Then(t2 Transform) Transform {
+	return Transform{
+		A:  t2.A*t.A + t2.B*t.C,
+		B:  t2.A*t.B + t2.B*t.D,
+		TX: t2.A*t.TX + t2.B*t.TY + t2.TX,
+		C:  t2.C*t.A + t2.D*t.C,
+		D:  t2.C*t.B + t2.D*t.D,
+		TY: t2.C*t.TX + t2.D*t.TY + t2.TY,
+	}
+}
+
+// Inverse returns the Transform which reverts t. It returns an error if t is
+// not invertible, e.g. when it scales by zero.
+func (t Transform) Inverse() (Transform, error) {
+	det := t.A*t.D - t.B*t.C
+	if det == 0 {
+		return Transform{}, errors.Errorf("transform %+v is not invertible", t)
+	}
+	return Transform{
+		A:  t.D / det,
+		B:  -t.B / det,
+		TX: (t.B*t.TY - t.D*t.TX) / det,
+		C:  -t.C / det,
+		D:  t.A / det,
+		TY: (t.C*t.TX - t.A*t.TY) / det,
+	}, nil
+}
+
+// ApplyPointF returns p transformed by t.
+func (t Transform) ApplyPointF(p PointF) PointF {
+	return PointF{X: t.A*p.X + t.B*p.Y + t.TX, Y: t.C*p.X + t.D*p.Y + t.TY}
+}
+
+// ApplyPoint returns p transformed by t, rounded to the nearest Point.
+func (t Transform) ApplyPoint(p Point) Point {
+	return t.ApplyPointF(p.ToPointF()).Round()
+}
+
+// ApplyRectF returns the bounding rect of r transformed by t. As only
+// rotations by multiple of 90 degrees are constructed in this package, the
+// result is usually the exact transformed rect.
+func (t Transform) ApplyRectF(r RectF) RectF {
+	p1 := t.ApplyPointF(r.TopLeft())
+	p2 := t.ApplyPointF(PointF{X: r.Right(), Y: r.Top})
+	p3 := t.ApplyPointF(PointF{X: r.Left, Y: r.Bottom()})
+	p4 := t.ApplyPointF(r.BottomRight())
+	return NewRectFLTRB(
+		math.Min(math.Min(p1.X, p2.X), math.Min(p3.X, p4.X)),
+		math.Min(math.Min(p1.Y, p2.Y), math.Min(p3.Y, p4.Y)),
+		math.Max(math.Max(p1.X, p2.X), math.Max(p3.X, p4.X)),
+		math.Max(math.Max(p1.Y, p2.Y), math.Max(p3.Y, p4.Y)))
+}
+
+// ApplyRect returns the bounding rect of r transformed by t. The edges of the
+// result are rounded.
+func (t Transform) ApplyRect(r Rect) Rect {
+	return t.ApplyRectF(r.ToRectF()).Round()
+}
+
+// ScreenToDisplay returns the Transform from screen coordinates to the local
+// coordinates of the display whose bounds in the screen are display.
+func ScreenToDisplay(display Rect) Transform {
+	return NewTranslateTransform(-float64(display.Left), -float64(display.Top))
+}
+
+// DisplayToScreen returns the Transform from the local coordinates of the
+// display whose bounds in the screen are display to screen coordinates.
+func DisplayToScreen(display Rect) Transform {
+	return NewTranslateTransform(float64(display.Left), float64(display.Top))
+}
+
+// DisplayToTouchscreen returns the Transform from the local coordinates of a
+// display to the coordinates of the touchscreen covering it. displaySize is
+// the size of the display as it is currently rotated, touchSize is the range
+// of the touchscreen in its natural orientation, and r is the current
+// clockwise rotation of the display.
+// Note that input.TouchscreenEventWriter applies its own rotation, so Rotate0
+// should be used with it when its rotation has been set.
+func DisplayToTouchscreen(displaySize, touchSize Size, r Rotation) Transform {
+	rotated := r.Size(touchSize)
+	scale := NewScaleTransform(
+		float64(rotated.Width)/float64(displaySize.Width),
+		float64(rotated.Height)/float64(displaySize.Height))
+	return scale.Then(NewRotateTransform(r, rotated))
+}
+
+// ScreenToTouchscreen returns the Transform from screen coordinates to the
+// coordinates of the touchscreen covering the display whose bounds in the
+// screen are display. See DisplayToTouchscreen for touchSize and r.
+func ScreenToTouchscreen(display Rect, touchSize Size, r Rotation) Transform {
+	return ScreenToDisplay(display).Then(DisplayToTouchscreen(display.Size(), touchSize, r))
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bios
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"chromiumos/tast/errors"
+)
+
+// fmapSignature starts the flash map in a firmware image.
+const fmapSignature = "__FMAP__"
+
+// fmapHeader is the binary layout of the flash map header, as defined by flashmap's fmap.h.
+type fmapHeader struct {
+	Signature [8]byte
+	VerMajor  uint8
+	VerMinor  uint8
+	Base      uint64
+	Size      uint32
+	Name      [32]byte
+	NAreas    uint16
+}
+
+// fmapArea is the binary layout of a flash map area, which follows the header.
+type fmapArea struct {
+	Offset uint32
+	Size   uint32
+	Name   [32]byte
+	Flags  uint16
+}
+
+// FMAPArea is an area of a firmware image described by its flash map.
+type FMAPArea struct {
+	Name   ImageSection
+	Offset uint32
+	Size   uint32
+	Flags  uint16
+}
+
+// FMAP is the flash map of a firmware image, which describes its areas.
+type FMAP struct {
+	VerMajor uint8
+	VerMinor uint8
+	Base     uint64
+	Size     uint32
+	Name     string
+	Areas    []FMAPArea
+}
+
+// cString returns the string stored in b, up to its first NUL byte.
+func cString(b []byte) string {
+	if n := bytes.IndexByte(b, 0); n >= 0 {
+		b = b[:n]
+	}
+	return string(b)
+}
+
+// ParseFMAP finds and parses the flash map of the firmware image data.
+// Occurrences of the signature which are not followed by a valid flash map are skipped.
+func ParseFMAP(data []byte) (*FMAP, error) {
+	var lastErr error
+	for off := 0; ; {
+		n := bytes.Index(data[off:], []byte(fmapSignature))
+		if n < 0 {
+			break
+		}
+		f, err := parseFMAPAt(data, off+n)
+		if err == nil {
+			return f, nil
+		}
+		lastErr = err
+		off += n + 1
+	}
+	if lastErr != nil {
+		return nil, errors.Wrap(lastErr, "no valid FMAP found")
+	}
+	return nil, errors.New("FMAP signature not found")
+}
+
+// parseFMAPAt parses the flash map starting at off in data.
+func parseFMAPAt(data []byte, off int) (*FMAP, error) {
+	r := bytes.NewReader(data[off:])
+	var h fmapHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, errors.Wrapf(err, "reading FMAP header at 0x%x", off)
+	}
+	if h.VerMajor != 1 {
+		return nil, errors.Errorf("unsupported FMAP version %d.%d at 0x%x", h.VerMajor, h.VerMinor, off)
+	}
+	f := &FMAP{
+		VerMajor: h.VerMajor,
+		VerMinor: h.VerMinor,
+		Base:     h.Base,
+		Size:     h.Size,
+		Name:     cString(h.Name[:]),
+	}
+	for i := 0; i < int(h.NAreas); i++ {
+		var a fmapArea
+		if err := binary.Read(r, binary.LittleEndian, &a); err != nil {
+			return nil, errors.Wrapf(err, "reading FMAP area %d at 0x%x", i, off)
+		}
+		if uint64(a.Offset)+uint64(a.Size) > uint64(h.Size) {
+			return nil, errors.Errorf("FMAP area %q (0x%x+0x%x) exceeds the image size 0x%x", cString(a.Name[:]), a.Offset, a.Size, h.Size)
+		}
+		f.Areas = append(f.Areas, FMAPArea{ImageSection(cString(a.Name[:])), a.Offset, a.Size, a.Flags})
+	}
+	return f, nil
+}
+
+// Area returns the area named name.
+func (f *FMAP) Area(name ImageSection) (FMAPArea, bool) {
+	for _, a := range f.Areas {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return FMAPArea{}, false
+}
+
+// Sections returns the locations of the areas, as used by Image.
+func (f *FMAP) Sections() map[ImageSection]SectionInfo {
+	ret := make(map[ImageSection]SectionInfo)
+	for _, a := range f.Areas {
+		ret[a.Name] = SectionInfo{uint(a.Offset), uint(a.Size)}
+	}
+	return ret
+}
+
+// NewImageFromData creates an Image from the contents of a firmware image, e.g. read from a file,
+// locating its sections with its flash map.
+func NewImageFromData(data []byte) (*Image, error) {
+	f, err := ParseFMAP(data)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) < uint64(f.Size) {
+		return nil, errors.Errorf("image is shorter than its FMAP size: %d < %d", len(data), f.Size)
+	}
+	return &Image{data, f.Sections()}, nil
+}
+
+// SectionData returns a copy of the contents of sec.
+func (i *Image) SectionData(sec ImageSection) ([]byte, error) {
+	b, err := i.sectionBytes(sec)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// sectionBytes returns the contents of sec, sharing the image data.
+func (i *Image) sectionBytes(sec ImageSection) ([]byte, error) {
+	si, ok := i.sections[sec]
+	if !ok {
+		return nil, errors.Errorf("Section %s not found", sec)
+	}
+	end := si.Start + si.Length
+	if uint(len(i.data)) < end {
+		return nil, errors.Errorf("Data length too short: %d (<%d)", len(i.data), end)
+	}
+	return i.data[si.Start:end], nil
+}
+
+// DiffSections returns the sorted names of the sections whose contents differ between i and other,
+// including the sections which are missing from either image.
+func (i *Image) DiffSections(other *Image) []ImageSection {
+	names := make(map[ImageSection]struct{})
+	for sec := range i.sections {
+		names[sec] = struct{}{}
+	}
+	for sec := range other.sections {
+		names[sec] = struct{}{}
+	}
+	var diff []ImageSection
+	for sec := range names {
+		a, errA := i.sectionBytes(sec)
+		b, errB := other.sectionBytes(sec)
+		if errA != nil || errB != nil || !bytes.Equal(a, b) {
+			diff = append(diff, sec)
+		}
+	}
+	sort.Slice(diff, func(x, y int) bool {
+		return diff[x] < diff[y]
+	})
+	return diff
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bios
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testImageSize is the size of the images built by buildImage.
+const testImageSize = 0x400
+
+// testAreas are the areas of the images built by buildImage.
+var testAreas = []FMAPArea{
+	{"FMAP", 0x000, 0x180, 0},
+	{GBBImageSection, 0x180, 0x80, 0},
+	{ROFRIDImageSection, 0x200, 0x40, 0},
+	{RWFWIDAImageSection, 0x240, 0x40, 0},
+	{RWFWIDBImageSection, 0x280, 0x40, 0},
+	{VBlockAImageSection, 0x300, 0x100, 0},
+}
+
+// buildFMAP returns the binary flash map of an image of size bytes with areas.
+func buildFMAP(t *testing.T, size uint32, areas []FMAPArea) []byte {
+	var buf bytes.Buffer
+	h := fmapHeader{VerMajor: 1, VerMinor: 1, Size: size, NAreas: uint16(len(areas))}
+	copy(h.Signature[:], fmapSignature)
+	copy(h.Name[:], "FLASH")
+	if err := binary.Write(&buf, binary.LittleEndian, h); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range areas {
+		fa := fmapArea{Offset: a.Offset, Size: a.Size, Flags: a.Flags}
+		copy(fa.Name[:], a.Name)
+		if err := binary.Write(&buf, binary.LittleEndian, fa); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// buildImage returns an image with the flash map of testAreas at its start, and contents written at the start of their sections.
+func buildImage(t *testing.T, contents map[ImageSection][]byte) []byte {
+	data := bytes.Repeat([]byte{0xff}, testImageSize)
+	copy(data, buildFMAP(t, testImageSize, testAreas))
+	for _, a := range testAreas {
+		if c, ok := contents[a.Name]; ok {
+			copy(data[a.Offset:a.Offset+a.Size], c)
+		}
+	}
+	return data
+}
+
+func TestParseFMAP(t *testing.T) {
+	// A stray signature precedes the flash map.
+	data := append([]byte("xx"+fmapSignature+"yy"), buildFMAP(t, testImageSize, testAreas)...)
+	f, err := ParseFMAP(data)
+	if err != nil {
+		t.Fatal("ParseFMAP failed: ", err)
+	}
+	if f.Name != "FLASH" || f.Size != testImageSize || f.VerMajor != 1 {
+		t.Errorf("ParseFMAP returned header %q, size %d, version %d; want %q, %d, 1", f.Name, f.Size, f.VerMajor, "FLASH", testImageSize)
+	}
+	if !reflect.DeepEqual(f.Areas, testAreas) {
+		t.Errorf("ParseFMAP returned areas %v; want %v", f.Areas, testAreas)
+	}
+	if a, ok := f.Area(VBlockAImageSection); !ok || a.Offset != 0x300 {
+		t.Errorf("Area(%q) = %v, %v; want offset 0x300", VBlockAImageSection, a, ok)
+	}
+	if _, ok := f.Area("MISSING"); ok {
+		t.Error("Area of a missing section unexpectedly succeeded")
+	}
+}
+
+func TestParseFMAPErrors(t *testing.T) {
+	tooLarge := buildFMAP(t, 0x100, testAreas)
+	badVersion := buildFMAP(t, testImageSize, testAreas)
+	badVersion[len(fmapSignature)] = 2
+	truncated := buildFMAP(t, testImageSize, testAreas)
+	truncated = truncated[:len(truncated)-1]
+	for name, data := range map[string][]byte{
+		"no signature":   bytes.Repeat([]byte{0xff}, 64),
+		"area too large": tooLarge,
+		"bad version":    badVersion,
+		"truncated":      truncated,
+	} {
+		if _, err := ParseFMAP(data); err == nil {
+			t.Errorf("ParseFMAP unexpectedly succeeded for %s", name)
+		}
+	}
+}
+
+func TestNewImageFromData(t *testing.T) {
+	data := buildImage(t, map[ImageSection][]byte{GBBImageSection: {0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0x01, 0, 0}})
+	i, err := NewImageFromData(data)
+	if err != nil {
+		t.Fatal("NewImageFromData failed: ", err)
+	}
+	if _, sf, err := i.GetGBBFlags(); err != nil {
+		t.Error("GetGBBFlags failed: ", err)
+	} else if len(sf) != 2 {
+		t.Errorf("GetGBBFlags returned set flags %v; want 2 flags", sf)
+	}
+	b, err := i.SectionData(GBBImageSection)
+	if err != nil {
+		t.Fatal("SectionData failed: ", err)
+	}
+	if len(b) != 0x80 {
+		t.Errorf("SectionData returned %d bytes; want %d", len(b), 0x80)
+	}
+	// SectionData returns a copy.
+	b[0] = 0x42
+	if i.data[0x180] == 0x42 {
+		t.Error("Modifying the section data modified the image")
+	}
+
+	if _, err := NewImageFromData(data[:testImageSize/2]); err == nil {
+		t.Error("NewImageFromData unexpectedly succeeded for a truncated image")
+	}
+}
+
+func TestDiffSections(t *testing.T) {
+	a, err := NewImageFromData(buildImage(t, map[ImageSection][]byte{
+		ROFRIDImageSection:  []byte("Google_Board.1.0.0"),
+		RWFWIDAImageSection: []byte("Google_Board.1.0.0"),
+	}))
+	if err != nil {
+		t.Fatal("NewImageFromData failed: ", err)
+	}
+	b, err := NewImageFromData(buildImage(t, map[ImageSection][]byte{
+		ROFRIDImageSection:  []byte("Google_Board.1.0.0"),
+		RWFWIDAImageSection: []byte("Google_Board.1.1.0"),
+	}))
+	if err != nil {
+		t.Fatal("NewImageFromData failed: ", err)
+	}
+	if diff := a.DiffSections(a); len(diff) != 0 {
+		t.Errorf("DiffSections with itself = %v; want none", diff)
+	}
+	if diff, expected := a.DiffSections(b), []ImageSection{RWFWIDAImageSection}; !reflect.DeepEqual(diff, expected) {
+		t.Errorf("DiffSections = %v; want %v", diff, expected)
+	}
+
+	// Sections missing from an image differ.
+	delete(b.sections, GBBImageSection)
+	if diff, expected := b.DiffSections(a), []ImageSection{GBBImageSection, RWFWIDAImageSection}; !reflect.DeepEqual(diff, expected) {
+		t.Errorf("DiffSections with a missing section = %v; want %v", diff, expected)
+	}
+}
@@ -28,6 +28,17 @@ const (
 	// GBBImageSection is the named section for GBB as output from dump_fmap.
 	GBBImageSection ImageSection = "GBB"
 
+	// ROFRIDImageSection holds the version string of the RO firmware.
+	ROFRIDImageSection ImageSection = "RO_FRID"
+
+	// RWFWIDAImageSection and RWFWIDBImageSection hold the version strings of the RW firmware A and B.
+	RWFWIDAImageSection ImageSection = "RW_FWID_A"
+	RWFWIDBImageSection ImageSection = "RW_FWID_B"
+
+	// VBlockAImageSection and VBlockBImageSection hold the keyblock and preamble verifying the RW firmware A and B.
+	VBlockAImageSection ImageSection = "VBLOCK_A"
+	VBlockBImageSection ImageSection = "VBLOCK_B"
+
 	// gbbHeaderOffset is the location of the GBB header in GBBImageSection.
 	gbbHeaderOffset uint = 12
 )
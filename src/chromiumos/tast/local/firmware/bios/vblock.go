@@ -0,0 +1,190 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bios
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+
+	"chromiumos/tast/errors"
+)
+
+// keyblockMagic starts a vboot keyblock.
+const keyblockMagic = "CHROMEOS"
+
+// Supported major versions of the vboot structures.
+const (
+	keyblockVersionMajor   = 2
+	fwPreambleVersionMajor = 2
+)
+
+// Flags of a keyblock, telling in which boot modes it is valid.
+const (
+	KeyblockFlagDeveloper0 uint32 = 0x1
+	KeyblockFlagDeveloper1 uint32 = 0x2
+	KeyblockFlagRecovery0  uint32 = 0x4
+	KeyblockFlagRecovery1  uint32 = 0x8
+)
+
+// FWPreambleFlagUseRONormal is set in the flags of a firmware preamble if the RO firmware
+// should be used in normal mode instead of the RW firmware.
+const FWPreambleFlagUseRONormal uint32 = 0x1
+
+// vbSignature is the binary layout of vboot's vb2_signature.
+type vbSignature struct {
+	SigOffset uint32
+	Reserved0 uint32
+	SigSize   uint32
+	Reserved1 uint32
+	DataSize  uint32
+	Reserved2 uint32
+}
+
+// vbPackedKey is the binary layout of vboot's vb2_packed_key.
+type vbPackedKey struct {
+	KeyOffset  uint32
+	Reserved0  uint32
+	KeySize    uint32
+	Reserved1  uint32
+	Algorithm  uint32
+	Reserved2  uint32
+	KeyVersion uint32
+	Reserved3  uint32
+}
+
+// vbKeyblock is the binary layout of vboot's vb2_keyblock.
+type vbKeyblock struct {
+	Magic              [8]byte
+	HeaderVersionMajor uint32
+	HeaderVersionMinor uint32
+	KeyblockSize       uint32
+	Reserved0          uint32
+	KeyblockSignature  vbSignature
+	KeyblockHash       vbSignature
+	KeyblockFlags      uint32
+	Reserved1          uint32
+	DataKey            vbPackedKey
+}
+
+// vbFWPreamble is the binary layout of vboot's vb2_fw_preamble.
+type vbFWPreamble struct {
+	PreambleSize       uint32
+	Reserved0          uint32
+	PreambleSignature  vbSignature
+	HeaderVersionMajor uint32
+	HeaderVersionMinor uint32
+	FirmwareVersion    uint32
+	Reserved1          uint32
+	KernelSubkey       vbPackedKey
+	BodySignature      vbSignature
+	Flags              uint32
+}
+
+// Keyblock is the decoded header of a vboot keyblock, which signs the key verifying the firmware preamble.
+type Keyblock struct {
+	VersionMajor uint32
+	VersionMinor uint32
+	Size         uint32
+	Flags        uint32
+	// DataKeyAlgorithm and DataKeyVersion describe the key verifying the preamble.
+	DataKeyAlgorithm uint32
+	DataKeyVersion   uint32
+}
+
+// FWPreamble is the decoded header of a vboot firmware preamble, which signs the RW firmware body.
+type FWPreamble struct {
+	VersionMajor    uint32
+	VersionMinor    uint32
+	Size            uint32
+	FirmwareVersion uint32
+	// KernelSubkeyAlgorithm and KernelSubkeyVersion describe the key verifying the kernel keyblock.
+	KernelSubkeyAlgorithm uint32
+	KernelSubkeyVersion   uint32
+	// BodySize is the size of the firmware body signed by the preamble.
+	BodySize uint32
+	Flags    uint32
+}
+
+// VBlock is the decoded contents of a VBLOCK section.
+type VBlock struct {
+	Keyblock Keyblock
+	Preamble FWPreamble
+}
+
+// ParseVBlock decodes the keyblock and the firmware preamble following it in data.
+func ParseVBlock(data []byte) (*VBlock, error) {
+	var kb vbKeyblock
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &kb); err != nil {
+		return nil, errors.Wrap(err, "reading keyblock")
+	}
+	if string(kb.Magic[:]) != keyblockMagic {
+		return nil, errors.Errorf("bad keyblock magic %q", kb.Magic[:])
+	}
+	if kb.HeaderVersionMajor != keyblockVersionMajor {
+		return nil, errors.Errorf("unsupported keyblock version %d.%d", kb.HeaderVersionMajor, kb.HeaderVersionMinor)
+	}
+	if int(kb.KeyblockSize) < binary.Size(kb) || int(kb.KeyblockSize) > len(data) {
+		return nil, errors.Errorf("invalid keyblock size %d for %d bytes of data", kb.KeyblockSize, len(data))
+	}
+
+	var pr vbFWPreamble
+	if err := binary.Read(bytes.NewReader(data[kb.KeyblockSize:]), binary.LittleEndian, &pr); err != nil {
+		return nil, errors.Wrap(err, "reading firmware preamble")
+	}
+	if pr.HeaderVersionMajor != fwPreambleVersionMajor {
+		return nil, errors.Errorf("unsupported firmware preamble version %d.%d", pr.HeaderVersionMajor, pr.HeaderVersionMinor)
+	}
+	if int(pr.PreambleSize) < binary.Size(pr) || int(kb.KeyblockSize)+int(pr.PreambleSize) > len(data) {
+		return nil, errors.Errorf("invalid firmware preamble size %d for %d bytes of data", pr.PreambleSize, len(data)-int(kb.KeyblockSize))
+	}
+	return &VBlock{
+		Keyblock: Keyblock{
+			VersionMajor:     kb.HeaderVersionMajor,
+			VersionMinor:     kb.HeaderVersionMinor,
+			Size:             kb.KeyblockSize,
+			Flags:            kb.KeyblockFlags,
+			DataKeyAlgorithm: kb.DataKey.Algorithm,
+			DataKeyVersion:   kb.DataKey.KeyVersion,
+		},
+		Preamble: FWPreamble{
+			VersionMajor:          pr.HeaderVersionMajor,
+			VersionMinor:          pr.HeaderVersionMinor,
+			Size:                  pr.PreambleSize,
+			FirmwareVersion:       pr.FirmwareVersion,
+			KernelSubkeyAlgorithm: pr.KernelSubkey.Algorithm,
+			KernelSubkeyVersion:   pr.KernelSubkey.KeyVersion,
+			BodySize:              pr.BodySignature.DataSize,
+			Flags:                 pr.Flags,
+		},
+	}, nil
+}
+
+// VBlock decodes the VBLOCK section sec, e.g. VBlockAImageSection.
+func (i *Image) VBlock(sec ImageSection) (*VBlock, error) {
+	b, err := i.sectionBytes(sec)
+	if err != nil {
+		return nil, err
+	}
+	vb, err := ParseVBlock(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing section %s", sec)
+	}
+	return vb, nil
+}
+
+// Version returns the version string stored in the section sec, e.g. ROFRIDImageSection.
+func (i *Image) Version(sec ImageSection) (string, error) {
+	b, err := i.sectionBytes(sec)
+	if err != nil {
+		return "", err
+	}
+	// Version sections are padded with NUL or erased (0xff) bytes.
+	v := strings.TrimRight(cString(b), "\xff")
+	if v == "" {
+		return "", errors.Errorf("section %s holds no version", sec)
+	}
+	return v, nil
+}
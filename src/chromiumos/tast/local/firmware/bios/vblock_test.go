@@ -0,0 +1,127 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bios
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// buildVBlock returns a VBLOCK with a keyblock and a firmware preamble, followed by fake keys and signatures.
+func buildVBlock(t *testing.T, keyVersion, fwVersion, flags uint32) []byte {
+	kb := vbKeyblock{
+		HeaderVersionMajor: 2,
+		HeaderVersionMinor: 1,
+		KeyblockFlags:      KeyblockFlagDeveloper0 | KeyblockFlagDeveloper1 | KeyblockFlagRecovery0,
+		DataKey:            vbPackedKey{Algorithm: 7, KeyVersion: keyVersion},
+	}
+	copy(kb.Magic[:], keyblockMagic)
+	kb.KeyblockSize = uint32(binary.Size(kb)) + 0x10
+	pr := vbFWPreamble{
+		HeaderVersionMajor: 2,
+		HeaderVersionMinor: 1,
+		FirmwareVersion:    fwVersion,
+		KernelSubkey:       vbPackedKey{Algorithm: 4, KeyVersion: 1},
+		BodySignature:      vbSignature{DataSize: 0x1000},
+		Flags:              flags,
+	}
+	pr.PreambleSize = uint32(binary.Size(pr)) + 0x8
+
+	var buf bytes.Buffer
+	for _, v := range []interface{}{kb, make([]byte, 0x10), pr, make([]byte, 0x8)} {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestParseVBlock(t *testing.T) {
+	vb, err := ParseVBlock(buildVBlock(t, 1, 3, FWPreambleFlagUseRONormal))
+	if err != nil {
+		t.Fatal("ParseVBlock failed: ", err)
+	}
+	expected := VBlock{
+		Keyblock: Keyblock{
+			VersionMajor:     2,
+			VersionMinor:     1,
+			Size:             uint32(binary.Size(vbKeyblock{})) + 0x10,
+			Flags:            KeyblockFlagDeveloper0 | KeyblockFlagDeveloper1 | KeyblockFlagRecovery0,
+			DataKeyAlgorithm: 7,
+			DataKeyVersion:   1,
+		},
+		Preamble: FWPreamble{
+			VersionMajor:          2,
+			VersionMinor:          1,
+			Size:                  uint32(binary.Size(vbFWPreamble{})) + 0x8,
+			FirmwareVersion:       3,
+			KernelSubkeyAlgorithm: 4,
+			KernelSubkeyVersion:   1,
+			BodySize:              0x1000,
+			Flags:                 FWPreambleFlagUseRONormal,
+		},
+	}
+	if *vb != expected {
+		t.Errorf("ParseVBlock returned %+v; want %+v", *vb, expected)
+	}
+}
+
+func TestParseVBlockErrors(t *testing.T) {
+	good := buildVBlock(t, 1, 1, 0)
+	kbSize := binary.Size(vbKeyblock{}) + 0x10
+	for _, tc := range []struct {
+		name   string
+		modify func(b []byte) []byte
+	}{
+		{"bad magic", func(b []byte) []byte { b[0] = 'X'; return b }},
+		{"bad keyblock version", func(b []byte) []byte { b[8] = 3; return b }},
+		{"keyblock size too large", func(b []byte) []byte { binary.LittleEndian.PutUint32(b[16:], 0x10000); return b }},
+		{"bad preamble version", func(b []byte) []byte { b[kbSize+32] = 1; return b }},
+		{"truncated preamble", func(b []byte) []byte { return b[:len(b)-0x10] }},
+	} {
+		b := tc.modify(append([]byte(nil), good...))
+		if _, err := ParseVBlock(b); err == nil {
+			t.Errorf("ParseVBlock unexpectedly succeeded with %s", tc.name)
+		}
+	}
+}
+
+func TestImageVBlockAndVersions(t *testing.T) {
+	i, err := NewImageFromData(buildImage(t, map[ImageSection][]byte{
+		ROFRIDImageSection:  []byte("Google_Board.12345.0.0\x00"),
+		RWFWIDAImageSection: []byte("Google_Board.12345.1.0"),
+		VBlockAImageSection: buildVBlock(t, 1, 2, 0),
+	}))
+	if err != nil {
+		t.Fatal("NewImageFromData failed: ", err)
+	}
+
+	for sec, expected := range map[ImageSection]string{
+		ROFRIDImageSection:  "Google_Board.12345.0.0",
+		RWFWIDAImageSection: "Google_Board.12345.1.0",
+	} {
+		if v, err := i.Version(sec); err != nil {
+			t.Errorf("Version(%s) failed: %v", sec, err)
+		} else if v != expected {
+			t.Errorf("Version(%s) = %q; want %q", sec, v, expected)
+		}
+	}
+	// RW_FWID_B is erased.
+	if v, err := i.Version(RWFWIDBImageSection); err == nil {
+		t.Errorf("Version(%s) = %q; want an error", RWFWIDBImageSection, v)
+	}
+
+	vb, err := i.VBlock(VBlockAImageSection)
+	if err != nil {
+		t.Fatal("VBlock failed: ", err)
+	}
+	if vb.Keyblock.DataKeyVersion != 1 || vb.Preamble.FirmwareVersion != 2 {
+		t.Errorf("VBlock(%s) has key version %d and firmware version %d; want 1 and 2", VBlockAImageSection, vb.Keyblock.DataKeyVersion, vb.Preamble.FirmwareVersion)
+	}
+	if _, err := i.VBlock(VBlockBImageSection); err == nil {
+		t.Errorf("VBlock(%s) unexpectedly succeeded for a missing section", VBlockBImageSection)
+	}
+}
@@ -5,6 +5,8 @@
 // Package graph contains graph-related utility functions.
 package graph
 
+import "sort"
+
 type bipartite struct {
 	edge map[int][]int
 }
@@ -43,12 +45,28 @@ func (g bipartite) matchingHelper(u int, match map[int]int, seen map[int]bool) b
 
 // MaxMatching returns the max number of matchings in the bipartite graph.
 func (g bipartite) MaxMatching() int {
-	matchMap := make(map[int]int)
-	count := 0
+	return len(g.Matching())
+}
+
+// Matching returns a maximum matching of the bipartite graph as a map from
+// source to the sink it is paired with. Sources which could not be paired are
+// not included. When there are several maximum matchings, sources with smaller
+// numbers are paired first so the result is deterministic.
+func (g bipartite) Matching() map[int]int {
+	var srcs []int
 	for src := range g.edge {
-		if g.matchingHelper(src, matchMap, map[int]bool{}) {
-			count = count + 1
-		}
+		srcs = append(srcs, src)
+	}
+	sort.Ints(srcs)
+
+	matchMap := make(map[int]int)
+	for _, src := range srcs {
+		g.matchingHelper(src, matchMap, map[int]bool{})
+	}
+
+	result := make(map[int]int)
+	for sink, src := range matchMap {
+		result[src] = sink
 	}
-	return count
+	return result
 }
@@ -3,7 +3,10 @@
 // found in the LICENSE file.
 package graph
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestEmptyGraph(t *testing.T) {
 	g := NewBipartite()
@@ -53,3 +56,17 @@ func TestPartialOneToOneGraph2(t *testing.T) {
 		t.Errorf("Wrong number of max matching, expect %d but got %d", expect, result)
 	}
 }
+
+func TestMatching(t *testing.T) {
+	g := NewBipartite()
+	g.AddEdge(0, 0)
+	g.AddEdge(0, 1)
+	g.AddEdge(1, 0)
+	g.AddEdge(2, 0)
+
+	// Source #1 and #2 both only connect to sink #0, so one of them is left.
+	expect := map[int]int{0: 1, 1: 0}
+	if result := g.Matching(); !reflect.DeepEqual(result, expect) {
+		t.Errorf("Wrong matching, expect %v but got %v", expect, result)
+	}
+}
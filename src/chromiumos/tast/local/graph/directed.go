@@ -0,0 +1,174 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package graph
+
+import (
+	"sort"
+
+	"chromiumos/tast/errors"
+)
+
+// Directed is a directed graph whose vertices are identified by integers.
+type Directed struct {
+	edge map[int][]int
+}
+
+// NewDirected returns an empty directed graph.
+func NewDirected() *Directed {
+	return &Directed{edge: make(map[int][]int)}
+}
+
+// AddVertex adds the vertex v. Vertices are also added implicitly by AddEdge,
+// so this only needs to be called for vertices without any edges.
+func (g *Directed) AddVertex(v int) {
+	if _, ok := g.edge[v]; !ok {
+		g.edge[v] = nil
+	}
+}
+
+// AddEdge adds an edge from x to y.
+func (g *Directed) AddEdge(x, y int) {
+	g.AddVertex(y)
+	g.edge[x] = append(g.edge[x], y)
+}
+
+// Vertices returns all the vertices in ascending order.
+func (g *Directed) Vertices() []int {
+	var vs []int
+	for v := range g.edge {
+		vs = append(vs, v)
+	}
+	sort.Ints(vs)
+	return vs
+}
+
+// TopologicalSort returns the vertices ordered so that every edge goes from an
+// earlier vertex to a later one. Among the vertices which can come next, the
+// smallest one is chosen so the result is deterministic. It returns an error
+// if the graph contains a cycle.
+func (g *Directed) TopologicalSort() ([]int, error) {
+	indeg := make(map[int]int)
+	for _, dests := range g.edge {
+		for _, d := range dests {
+			indeg[d]++
+		}
+	}
+
+	var ready []int
+	for _, v := range g.Vertices() {
+		if indeg[v] == 0 {
+			ready = append(ready, v)
+		}
+	}
+
+	var order []int
+	for len(ready) > 0 {
+		v := ready[0]
+		ready = ready[1:]
+		order = append(order, v)
+		for _, d := range g.edge[v] {
+			indeg[d]--
+			if indeg[d] == 0 {
+				i := sort.SearchInts(ready, d)
+				ready = append(ready, 0)
+				copy(ready[i+1:], ready[i:])
+				ready[i] = d
+			}
+		}
+	}
+
+	if len(order) != len(g.edge) {
+		return nil, errors.Errorf("graph contains a cycle: %v", g.FindCycle())
+	}
+	return order, nil
+}
+
+// FindCycle returns the vertices of a cycle in the graph in the order they
+// are visited, or nil if the graph is acyclic. The first vertex is not
+// repeated at the end.
+func (g *Directed) FindCycle() []int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[int]int)
+	var stack []int
+
+	var visit func(v int) []int
+	visit = func(v int) []int {
+		state[v] = visiting
+		stack = append(stack, v)
+		for _, d := range g.edge[v] {
+			switch state[d] {
+			case visiting:
+				for i, s := range stack {
+					if s == d {
+						return append([]int(nil), stack[i:]...)
+					}
+				}
+			case unvisited:
+				if c := visit(d); c != nil {
+					return c
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[v] = visited
+		return nil
+	}
+
+	for _, v := range g.Vertices() {
+		if state[v] != unvisited {
+			continue
+		}
+		if c := visit(v); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// HasCycle returns true if the graph contains a cycle.
+func (g *Directed) HasCycle() bool {
+	return g.FindCycle() != nil
+}
+
+// Reachable returns all the vertices reachable from v in ascending order,
+// excluding v itself unless it is on a cycle.
+func (g *Directed) Reachable(v int) []int {
+	seen := make(map[int]bool)
+	queue := append([]int(nil), g.edge[v]...)
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+		queue = append(queue, g.edge[u]...)
+	}
+
+	var result []int
+	for u := range seen {
+		result = append(result, u)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// IsReachable returns true if there is a path from x to y. A vertex is always
+// reachable from itself.
+func (g *Directed) IsReachable(x, y int) bool {
+	if x == y {
+		return true
+	}
+	for _, v := range g.Reachable(x) {
+		if v == y {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopologicalSort(t *testing.T) {
+	g := NewDirected()
+	g.AddEdge(3, 1)
+	g.AddEdge(3, 0)
+	g.AddEdge(1, 0)
+	g.AddEdge(2, 0)
+	g.AddVertex(4)
+
+	expect := []int{2, 3, 1, 0, 4}
+	result, err := g.TopologicalSort()
+	if err != nil {
+		t.Fatal("TopologicalSort failed: ", err)
+	}
+	if !reflect.DeepEqual(result, expect) {
+		t.Errorf("Wrong order, expect %v but got %v", expect, result)
+	}
+	if g.HasCycle() {
+		t.Error("HasCycle returned true for an acyclic graph")
+	}
+}
+
+func TestCycle(t *testing.T) {
+	g := NewDirected()
+	g.AddEdge(0, 1)
+	g.AddEdge(1, 2)
+	g.AddEdge(2, 3)
+	g.AddEdge(3, 1)
+
+	expect := []int{1, 2, 3}
+	if result := g.FindCycle(); !reflect.DeepEqual(result, expect) {
+		t.Errorf("Wrong cycle, expect %v but got %v", expect, result)
+	}
+	if _, err := g.TopologicalSort(); err == nil {
+		t.Error("TopologicalSort unexpectedly succeeded for a cyclic graph")
+	}
+}
+
+func TestReachable(t *testing.T) {
+	g := NewDirected()
+	g.AddEdge(0, 1)
+	g.AddEdge(1, 2)
+	g.AddEdge(3, 2)
+
+	expect := []int{1, 2}
+	if result := g.Reachable(0); !reflect.DeepEqual(result, expect) {
+		t.Errorf("Wrong reachable vertices, expect %v but got %v", expect, result)
+	}
+	if g.IsReachable(0, 3) {
+		t.Error("IsReachable(0, 3) returned true")
+	}
+	if !g.IsReachable(3, 2) {
+		t.Error("IsReachable(3, 2) returned false")
+	}
+}
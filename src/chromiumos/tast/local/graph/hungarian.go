@@ -0,0 +1,137 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package graph
+
+import (
+	"math"
+
+	"chromiumos/tast/errors"
+)
+
+// MinCostAssignment pairs sources with sinks so that the total cost is
+// minimized, using the Hungarian algorithm. cost[i][j] is the cost of pairing
+// source #i with sink #j, and every row must have the same length.
+// It returns the sink paired with each source and the total cost. If there
+// are more sources than sinks, the sources left unpaired get -1.
+func MinCostAssignment(cost [][]float64) ([]int, float64, error) {
+	n := len(cost)
+	if n == 0 {
+		return nil, 0, nil
+	}
+	m := len(cost[0])
+	for i, row := range cost {
+		if len(row) != m {
+			return nil, 0, errors.Errorf("row %d has %d elements; want %d", i, len(row), m)
+		}
+		for j, c := range row {
+			if math.IsNaN(c) || math.IsInf(c, 0) {
+				return nil, 0, errors.Errorf("cost[%d][%d] is not finite: %v", i, j, c)
+			}
+		}
+	}
+
+	// The algorithm below requires at least as many sinks as sources.
+	if n > m {
+		transposed := make([][]float64, m)
+		for j := range transposed {
+			transposed[j] = make([]float64, n)
+			for i := range cost {
+				transposed[j][i] = cost[i][j]
+			}
+		}
+		sinkToSrc, total, err := MinCostAssignment(transposed)
+		if err != nil {
+			return nil, 0, err
+		}
+		result := make([]int, n)
+		for i := range result {
+			result[i] = -1
+		}
+		for sink, src := range sinkToSrc {
+			result[src] = sink
+		}
+		return result, total, nil
+	}
+
+	// u and v are the potentials of sources and sinks. p[j] is the source
+	// (1-origin) paired with sink j, and way[j] is the previous sink on the
+	// augmenting path. Index 0 is used as a sentinel.
+	u := make([]float64, n+1)
+	v := make([]float64, m+1)
+	p := make([]int, m+1)
+	way := make([]int, m+1)
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		minv := make([]float64, m+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+		used := make([]bool, m+1)
+		for {
+			used[j0] = true
+			i0 := p[j0]
+			delta := math.Inf(1)
+			j1 := 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				if cur := cost[i0-1][j-1] - u[i0] - v[j]; cur < minv[j] {
+					minv[j] = cur
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+
+	result := make([]int, n)
+	total := 0.0
+	for j := 1; j <= m; j++ {
+		if p[j] != 0 {
+			result[p[j]-1] = j - 1
+			total += cost[p[j]-1][j-1]
+		}
+	}
+	return result, total, nil
+}
+
+// MaxWeightAssignment is similar to MinCostAssignment, but pairs sources with
+// sinks so that the total weight is maximized.
+func MaxWeightAssignment(weight [][]float64) ([]int, float64, error) {
+	negated := make([][]float64, len(weight))
+	for i, row := range weight {
+		negated[i] = make([]float64, len(row))
+		for j, w := range row {
+			negated[i][j] = -w
+		}
+	}
+	result, total, err := MinCostAssignment(negated)
+	if err != nil {
+		return nil, 0, err
+	}
+	return result, -total, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMinCostAssignment(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		cost   [][]float64
+		expect []int
+		total  float64
+	}{
+		{"empty", nil, nil, 0},
+		{"square", [][]float64{
+			{4, 1, 3},
+			{2, 0, 5},
+			{3, 2, 2},
+		}, []int{1, 0, 2}, 5},
+		{"more sinks", [][]float64{
+			{10, 1, 7, 8},
+			{1, 10, 7, 8},
+		}, []int{1, 0}, 2},
+		{"more sources", [][]float64{
+			{5, 9},
+			{1, 8},
+			{7, 2},
+		}, []int{-1, 0, 1}, 3},
+	} {
+		result, total, err := MinCostAssignment(tc.cost)
+		if err != nil {
+			t.Errorf("%s: MinCostAssignment failed: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, tc.expect) || total != tc.total {
+			t.Errorf("%s: Wrong assignment, expect %v (cost %v) but got %v (cost %v)", tc.name, tc.expect, tc.total, result, total)
+		}
+	}
+}
+
+func TestMaxWeightAssignment(t *testing.T) {
+	weight := [][]float64{
+		{1, 5},
+		{4, 3},
+	}
+	expect := []int{1, 0}
+	result, total, err := MaxWeightAssignment(weight)
+	if err != nil {
+		t.Fatal("MaxWeightAssignment failed: ", err)
+	}
+	if !reflect.DeepEqual(result, expect) || total != 9 {
+		t.Errorf("Wrong assignment, expect %v (weight 9) but got %v (weight %v)", expect, result, total)
+	}
+}
+
+func TestMinCostAssignmentInvalid(t *testing.T) {
+	if _, _, err := MinCostAssignment([][]float64{{1, 2}, {3}}); err == nil {
+		t.Error("MinCostAssignment unexpectedly succeeded for ragged rows")
+	}
+}
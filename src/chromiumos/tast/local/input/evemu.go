@@ -0,0 +1,412 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package input
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
+)
+
+// RecordedEvent is an event of a Recording.
+type RecordedEvent struct {
+	// Time is the time of the event relative to the first event of the recording.
+	Time  time.Duration
+	Type  EventType
+	Code  EventCode
+	Value int32
+}
+
+// Recording contains the description of an input device and the events it delivered.
+// Recordings are read and written in the text format used by evemu-record and evemu-play.
+type Recording struct {
+	Device DeviceDescription
+	Events []RecordedEvent
+}
+
+// evemuVersion is the version of the evemu format written by Recording.Write.
+const evemuVersion = "1.3"
+
+// Record writes the description of the device followed by the events delivered to it
+// to w in the evemu format, until ctx is done. It returns nil when ctx is done.
+// If the device is not grabbed, the events are still delivered to other clients.
+func (r *EventReader) Record(ctx context.Context, w io.Writer) error {
+	desc, err := r.Description()
+	if err != nil {
+		return err
+	}
+	if err := writeEvemuDevice(w, desc); err != nil {
+		return err
+	}
+
+	var start time.Time
+	for {
+		ev, err := r.Read(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if start.IsZero() {
+			start = ev.Time
+		}
+		if err := writeEvemuEvent(w, RecordedEvent{ev.Time.Sub(start), ev.Type, ev.Code, ev.Value}); err != nil {
+			return err
+		}
+	}
+}
+
+// Write writes rec to w in the evemu format.
+func (rec *Recording) Write(w io.Writer) error {
+	if err := writeEvemuDevice(w, &rec.Device); err != nil {
+		return err
+	}
+	for _, ev := range rec.Events {
+		if err := writeEvemuEvent(w, ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEvemuDevice writes the description of a device in the evemu format.
+func writeEvemuDevice(w io.Writer, desc *DeviceDescription) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# EVEMU %s\n", evemuVersion)
+	fmt.Fprintf(&b, "N: %s\n", desc.Name)
+	fmt.Fprintf(&b, "I: %04x %04x %04x %04x\n", desc.Bustype, desc.Vendor, desc.Product, desc.Version)
+
+	// Bitfields are written as lines of 8 bytes. The supported event types are
+	// written as the bitfield of event type 0, i.e. EV_SYN.
+	for _, line := range evemuBitLines(big.NewInt(int64(desc.Props))) {
+		fmt.Fprintf(&b, "P: %s\n", line)
+	}
+	for _, line := range evemuBitLines(big.NewInt(int64(desc.EventTypes))) {
+		fmt.Fprintf(&b, "B: %02x %s\n", EV_SYN, line)
+	}
+	var types []int
+	for et := range desc.EventCodes {
+		types = append(types, int(et))
+	}
+	sort.Ints(types)
+	for _, et := range types {
+		for _, line := range evemuBitLines(desc.EventCodes[EventType(et)]) {
+			fmt.Fprintf(&b, "B: %02x %s\n", et, line)
+		}
+	}
+
+	var codes []int
+	for ec := range desc.Axes {
+		codes = append(codes, int(ec))
+	}
+	sort.Ints(codes)
+	for _, ec := range codes {
+		a := desc.Axes[EventCode(ec)]
+		fmt.Fprintf(&b, "A: %02x %d %d %d %d %d\n", ec, a.Minimum, a.Maximum, a.Fuzz, a.Flat, a.Resolution)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// evemuBitLines formats the bitfield v as lines of 8 space-separated hex bytes.
+func evemuBitLines(v *big.Int) []string {
+	bits := bigIntToBits(v, 8)
+	var lines []string
+	for i := 0; i < len(bits); i += 8 {
+		var parts []string
+		for j := i; j < i+8; j++ {
+			var b byte
+			if j < len(bits) {
+				b = bits[j]
+			}
+			parts = append(parts, fmt.Sprintf("%02x", b))
+		}
+		lines = append(lines, strings.Join(parts, " "))
+	}
+	return lines
+}
+
+// writeEvemuEvent writes ev in the evemu format.
+func writeEvemuEvent(w io.Writer, ev RecordedEvent) error {
+	_, err := fmt.Fprintf(w, "E: %d.%06d %04x %04x %04d\n",
+		ev.Time/time.Second, (ev.Time%time.Second)/time.Microsecond, ev.Type, ev.Code, ev.Value)
+	return err
+}
+
+// ReadRecording reads a recording in the evemu format from r, e.g. one written by
+// EventReader.Record or evemu-record. Event times are made relative to the first event.
+func ReadRecording(r io.Reader) (*Recording, error) {
+	rec := &Recording{Device: DeviceDescription{
+		EventCodes: make(map[EventType]*big.Int),
+		Axes:       make(map[EventCode]Axis),
+	}}
+	var props []byte
+	bits := make(map[EventType][]byte)
+
+	scanner := bufio.NewScanner(r)
+	for i := 1; scanner.Scan(); i++ {
+		line := scanner.Text()
+		// Event lines written by evemu-record end with a comment describing the event.
+		if j := strings.Index(line, "#"); j >= 0 {
+			line = line[:j]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("line %d: missing prefix in %q", i, line)
+		}
+		prefix, val := parts[0], strings.TrimSpace(parts[1])
+
+		var err error
+		switch prefix {
+		case "N":
+			rec.Device.Name = val
+		case "I":
+			var id []uint64
+			if id, err = parseEvemuInts(val, 16, 16, 4); err == nil {
+				rec.Device.Bustype, rec.Device.Vendor = uint16(id[0]), uint16(id[1])
+				rec.Device.Product, rec.Device.Version = uint16(id[2]), uint16(id[3])
+			}
+		case "P":
+			var bs []byte
+			if bs, err = parseEvemuBytes(val); err == nil {
+				props = append(props, bs...)
+			}
+		case "B":
+			fields := strings.SplitN(val, " ", 2)
+			var et uint64
+			if et, err = strconv.ParseUint(fields[0], 16, 8); err == nil && len(fields) == 2 {
+				var bs []byte
+				if bs, err = parseEvemuBytes(fields[1]); err == nil {
+					bits[EventType(et)] = append(bits[EventType(et)], bs...)
+				}
+			}
+		case "A":
+			err = parseEvemuAxis(val, rec.Device.Axes)
+		case "E":
+			var ev RecordedEvent
+			if ev, err = parseEvemuEvent(val); err == nil {
+				rec.Events = append(rec.Events, ev)
+			}
+		case "L", "S":
+			// The initial LED and switch states are not needed to replay events.
+		default:
+			err = errors.Errorf("unknown prefix %q", prefix)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", i)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if props := bitsToBigInt(props); props.IsUint64() && props.Uint64() <= 0xffffffff {
+		rec.Device.Props = uint32(props.Uint64())
+	} else {
+		return nil, errors.Errorf("invalid properties %#x", props)
+	}
+	for et, bs := range bits {
+		v := bitsToBigInt(bs)
+		if et == EV_SYN {
+			if !v.IsUint64() || v.Uint64() > 0xffffffff {
+				return nil, errors.Errorf("invalid event types %#x", v)
+			}
+			rec.Device.EventTypes = uint32(v.Uint64())
+			continue
+		}
+		if v.Sign() != 0 {
+			rec.Device.EventCodes[et] = v
+		}
+	}
+
+	if len(rec.Events) > 0 {
+		start := rec.Events[0].Time
+		for i := range rec.Events {
+			rec.Events[i].Time -= start
+		}
+	}
+	return rec, nil
+}
+
+// parseEvemuInts parses n space-separated integers in the given base and bit size.
+func parseEvemuInts(s string, base, bitSize, n int) ([]uint64, error) {
+	fields := strings.Fields(s)
+	if len(fields) != n {
+		return nil, errors.Errorf("got %d value(s) in %q; want %d", len(fields), s, n)
+	}
+	var vals []uint64
+	for _, f := range fields {
+		v, err := strconv.ParseUint(f, base, bitSize)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+// parseEvemuBytes parses space-separated hex bytes.
+func parseEvemuBytes(s string) ([]byte, error) {
+	var bs []byte
+	for _, f := range strings.Fields(s) {
+		b, err := strconv.ParseUint(f, 16, 8)
+		if err != nil {
+			return nil, err
+		}
+		bs = append(bs, byte(b))
+	}
+	return bs, nil
+}
+
+// parseEvemuAxis parses an axis written as "<code> <min> <max> <fuzz> <flat> [<resolution>]"
+// and adds it to axes. The resolution is missing in recordings older than evemu 1.1.
+func parseEvemuAxis(s string, axes map[EventCode]Axis) error {
+	fields := strings.Fields(s)
+	if len(fields) != 5 && len(fields) != 6 {
+		return errors.Errorf("got %d value(s) in axis %q; want 5 or 6", len(fields), s)
+	}
+	ec, err := strconv.ParseUint(fields[0], 16, 16)
+	if err != nil {
+		return err
+	}
+	var vals [5]int32
+	for i, f := range fields[1:] {
+		v, err := strconv.ParseInt(f, 10, 32)
+		if err != nil {
+			return err
+		}
+		vals[i] = int32(v)
+	}
+	axes[EventCode(ec)] = Axis{Minimum: vals[0], Maximum: vals[1], Fuzz: vals[2], Flat: vals[3], Resolution: vals[4]}
+	return nil
+}
+
+// parseEvemuEvent parses an event written as "<sec>.<usec> <type> <code> <value>".
+func parseEvemuEvent(s string) (RecordedEvent, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 4 {
+		return RecordedEvent{}, errors.Errorf("got %d value(s) in event %q; want 4", len(fields), s)
+	}
+	tv := strings.SplitN(fields[0], ".", 2)
+	if len(tv) != 2 || len(tv[1]) != 6 {
+		return RecordedEvent{}, errors.Errorf("invalid time %q", fields[0])
+	}
+	sec, err := strconv.ParseInt(tv[0], 10, 64)
+	if err != nil {
+		return RecordedEvent{}, err
+	}
+	usec, err := strconv.ParseInt(tv[1], 10, 64)
+	if err != nil {
+		return RecordedEvent{}, err
+	}
+	tc, err := parseEvemuInts(strings.Join(fields[1:3], " "), 16, 16, 2)
+	if err != nil {
+		return RecordedEvent{}, err
+	}
+	val, err := strconv.ParseInt(fields[3], 10, 32)
+	if err != nil {
+		return RecordedEvent{}, err
+	}
+	return RecordedEvent{
+		Time:  time.Duration(sec)*time.Second + time.Duration(usec)*time.Microsecond,
+		Type:  EventType(tc[0]),
+		Code:  EventCode(tc[1]),
+		Value: int32(val),
+	}, nil
+}
+
+// ReplayDevice is a virtual input device created from a DeviceDescription, e.g. the one
+// of a recorded device, and used to replay recorded events.
+type ReplayDevice struct {
+	rw   *RawEventWriter
+	virt *os.File // used to hold the virtual device open
+	dev  string   // path to underlying device in /dev/input
+}
+
+// NewReplayDevice creates a virtual device as described by desc.
+//
+// The device uses the name and ID of desc. When replaying a recording of a device which is
+// still present, desc.Name should be changed so that the virtual device can be told apart.
+func NewReplayDevice(ctx context.Context, desc *DeviceDescription) (*ReplayDevice, error) {
+	// Force feedback requires the number of effects to be set, which the description lacks.
+	eventTypes := desc.EventTypes &^ (1 << uint(EV_FF))
+	eventCodes := make(map[EventType]*big.Int)
+	for et, codes := range desc.EventCodes {
+		// Codes of event types like EV_REP can't be set on virtual devices.
+		if _, ok := eventTypeIoctls[et]; ok {
+			eventCodes[et] = codes
+		}
+	}
+
+	testing.ContextLogf(ctx, "Creating replay device %q", desc.Name)
+	d := &ReplayDevice{}
+	var err error
+	if d.dev, d.virt, err = createVirtual(desc.Name, devID{desc.Bustype, desc.Vendor, desc.Product, desc.Version},
+		desc.Props, eventTypes, eventCodes, desc.Axes); err != nil {
+		return nil, err
+	}
+	if d.rw, err = Device(ctx, d.dev); err != nil {
+		d.virt.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Device returns the path of the device in /dev/input.
+func (d *ReplayDevice) Device() string {
+	return d.dev
+}
+
+// Replay injects events into the device, respecting the time between them.
+func (d *ReplayDevice) Replay(ctx context.Context, events []RecordedEvent) error {
+	start := time.Now()
+	for _, ev := range events {
+		if delay := ev.Time - time.Since(start); delay > 0 {
+			if err := testing.Sleep(ctx, delay); err != nil {
+				return err
+			}
+		}
+		if err := d.rw.Event(ev.Type, ev.Code, ev.Value); err != nil {
+			return errors.Wrapf(err, "failed injecting event at %v", ev.Time)
+		}
+	}
+	return nil
+}
+
+// Close closes the device.
+func (d *ReplayDevice) Close() error {
+	firstErr := d.rw.Close()
+	if err := d.virt.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// Replay creates a virtual device as described by the recording, replays the recorded events
+// into it and removes it.
+func (rec *Recording) Replay(ctx context.Context) error {
+	d, err := NewReplayDevice(ctx, &rec.Device)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Replay(ctx, rec.Events)
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package input
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadInputEvent(t *testing.T) {
+	b := testBuffer{}
+	now := time.Unix(5, 123456000)
+	rw := &RawEventWriter{&b, func() time.Time { return now }}
+	if err := rw.Event(EV_ABS, ABS_X, -10); err != nil {
+		t.Fatal("Event failed: ", err)
+	}
+	if err := rw.Sync(); err != nil {
+		t.Fatal("Sync failed: ", err)
+	}
+
+	r := bytes.NewReader(b.buf.Bytes())
+	for _, want := range []Event{
+		{now, EV_ABS, ABS_X, -10},
+		{now, EV_SYN, SYN_REPORT, 0},
+	} {
+		ev, err := readInputEvent(r)
+		if err != nil {
+			t.Fatal("readInputEvent failed: ", err)
+		}
+		if !ev.Time.Equal(want.Time) || ev.Type != want.Type || ev.Code != want.Code || ev.Value != want.Value {
+			t.Errorf("readInputEvent returned %+v; want %+v", *ev, want)
+		}
+	}
+}
+
+func TestReadCancelIdle(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal("Pipe failed: ", err)
+	}
+	defer pw.Close()
+	r := &EventReader{f: pr}
+	defer r.Close()
+
+	// The ioctls fail on a pipe, but must leave it in non-blocking mode.
+	if _, err := r.Description(); err == nil {
+		t.Error("Description unexpectedly succeeded on a pipe")
+	}
+	if err := r.setGrab(true); err == nil {
+		t.Error("setGrab unexpectedly succeeded on a pipe")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Read(ctx)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Read returned %v; want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read did not return after ctx was done on an idle device")
+	}
+}
+
+func TestRecordingRoundTrip(t *testing.T) {
+	rec := &Recording{
+		Device: DeviceDescription{
+			Name:       "Test touchpad",
+			Bustype:    0x18,
+			Vendor:     0x6cb,
+			Product:    0x1234,
+			Version:    0x100,
+			Props:      1<<INPUT_PROP_POINTER | 1<<INPUT_PROP_BUTTONPAD,
+			EventTypes: 1<<EV_SYN | 1<<EV_KEY | 1<<EV_ABS,
+			EventCodes: map[EventType]*big.Int{
+				EV_KEY: makeBigIntFromEventCodes([]EventCode{BTN_LEFT, BTN_TOUCH, BTN_TOOL_FINGER}),
+				EV_ABS: makeBigIntFromEventCodes([]EventCode{ABS_X, ABS_Y, ABS_MT_SLOT}),
+			},
+			Axes: map[EventCode]Axis{
+				ABS_X:       {Minimum: 0, Maximum: 3000, Resolution: 30},
+				ABS_Y:       {Minimum: -10, Maximum: 2000, Fuzz: 2, Flat: 1, Resolution: 30},
+				ABS_MT_SLOT: {Minimum: 0, Maximum: 4},
+			},
+		},
+		Events: []RecordedEvent{
+			{0, EV_ABS, ABS_X, 100},
+			{0, EV_SYN, SYN_REPORT, 0},
+			{1500 * time.Millisecond, EV_ABS, ABS_Y, -5},
+			{1500 * time.Millisecond, EV_SYN, SYN_REPORT, 0},
+		},
+	}
+
+	var b bytes.Buffer
+	if err := rec.Write(&b); err != nil {
+		t.Fatal("Write failed: ", err)
+	}
+	got, err := ReadRecording(&b)
+	if err != nil {
+		t.Fatal("ReadRecording failed: ", err)
+	}
+	if !reflect.DeepEqual(got, rec) {
+		t.Errorf("ReadRecording returned %+v; want %+v", got, rec)
+	}
+}
+
+func TestReadEvemuRecording(t *testing.T) {
+	// This is an excerpt of a recording made by evemu-record.
+	const data = `# EVEMU 1.3
+# Kernel: 4.19.0
+# Input device name: "Test pen"
+N: Test pen
+I: 0003 056a 5000 0100
+P: 02 00 00 00 00 00 00 00
+B: 00 0b 00 00 00 00 00 00 00
+B: 01 00 00 00 00 00 00 00 00
+B: 01 00 00 00 00 00 00 00 00
+B: 01 00 00 00 00 00 00 00 00
+B: 01 00 00 00 00 00 00 00 00
+B: 01 00 00 00 00 00 00 00 00
+B: 01 00 04 00 00 00 00 00 00
+B: 01 00 00 00 00 00 00 00 00
+B: 01 00 00 00 00 00 00 00 00
+B: 01 00 00 00 00 00 00 00 00
+B: 01 00 00 00 00 00 00 00 00
+B: 01 00 00 00 00 00 00 00 00
+B: 01 00 00 00 00 00 00 00 00
+B: 02 00 00 00 00 00 00 00 00
+B: 03 03 00 00 00 00 00 00 00
+A: 00 0 9600 4 0 40
+A: 01 0 5400 4 0 40
+################################
+#      Waiting for events      #
+################################
+E: 10.500000 0001 014a 0001	# EV_KEY / BTN_TOUCH            1
+E: 10.500000 0003 0000 0250	# EV_ABS / ABS_X                250
+E: 10.500000 0000 0000 0000	# ------------ SYN_REPORT (0) ---------- +0ms
+E: 10.512345 0003 0001 -001	# EV_ABS / ABS_Y                -1
+`
+	rec, err := ReadRecording(strings.NewReader(data))
+	if err != nil {
+		t.Fatal("ReadRecording failed: ", err)
+	}
+
+	want := &Recording{
+		Device: DeviceDescription{
+			Name:       "Test pen",
+			Bustype:    0x3,
+			Vendor:     0x56a,
+			Product:    0x5000,
+			Version:    0x100,
+			Props:      1 << INPUT_PROP_DIRECT,
+			EventTypes: 1<<EV_SYN | 1<<EV_KEY | 1<<EV_ABS,
+			EventCodes: map[EventType]*big.Int{
+				EV_KEY: makeBigIntFromEventCodes([]EventCode{BTN_TOUCH}),
+				EV_ABS: makeBigIntFromEventCodes([]EventCode{ABS_X, ABS_Y}),
+			},
+			Axes: map[EventCode]Axis{
+				ABS_X: {Minimum: 0, Maximum: 9600, Fuzz: 4, Resolution: 40},
+				ABS_Y: {Minimum: 0, Maximum: 5400, Fuzz: 4, Resolution: 40},
+			},
+		},
+		Events: []RecordedEvent{
+			{0, EV_KEY, BTN_TOUCH, 1},
+			{0, EV_ABS, ABS_X, 250},
+			{0, EV_SYN, SYN_REPORT, 0},
+			{12345 * time.Microsecond, EV_ABS, ABS_Y, -1},
+		},
+	}
+	if !reflect.DeepEqual(rec, want) {
+		t.Errorf("ReadRecording returned %+v; want %+v", rec, want)
+	}
+}
+
+func TestReadRecordingErrors(t *testing.T) {
+	for _, data := range []string{
+		"X: 1\n",
+		"no prefix\n",
+		"I: 0003 0001\n",
+		"B: 01 zz\n",
+		"A: 00 0\n",
+		"E: 1.5 0001 014a 0001\n",
+		"E: 1.000000 0001 014a\n",
+	} {
+		if _, err := ReadRecording(strings.NewReader(data)); err == nil {
+			t.Errorf("ReadRecording unexpectedly succeeded for %q", data)
+		}
+	}
+}
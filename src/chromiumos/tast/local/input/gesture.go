@@ -0,0 +1,362 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package input
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
+)
+
+// TouchPoint is a location in touchscreen coordinates.
+type TouchPoint struct {
+	X TouchCoord
+	Y TouchCoord
+}
+
+// Path is the trajectory of a contact in a Gesture.
+type Path interface {
+	// At returns the location at progress t, from 0 at the start of
+	// the path to 1 at its end.
+	At(t float64) (x, y float64)
+}
+
+type linePath struct {
+	from, to TouchPoint
+}
+
+// LinePath returns a Path going straight from one point to another.
+func LinePath(from, to TouchPoint) Path {
+	return &linePath{from, to}
+}
+
+func (p *linePath) At(t float64) (x, y float64) {
+	return lerp(float64(p.from.X), float64(p.to.X), t), lerp(float64(p.from.Y), float64(p.to.Y), t)
+}
+
+type bezierPath struct {
+	points []TouchPoint
+}
+
+// BezierPath returns a Path following the Bézier curve defined by points.
+// The curve starts at the first point and ends at the last one, and the
+// points in between are control points, e.g. a cubic curve takes 4 points.
+func BezierPath(points ...TouchPoint) Path {
+	return &bezierPath{points}
+}
+
+func (p *bezierPath) At(t float64) (x, y float64) {
+	// De Casteljau's algorithm.
+	xs := make([]float64, len(p.points))
+	ys := make([]float64, len(p.points))
+	for i, pt := range p.points {
+		xs[i], ys[i] = float64(pt.X), float64(pt.Y)
+	}
+	for n := len(p.points) - 1; n > 0; n-- {
+		for i := 0; i < n; i++ {
+			xs[i] = lerp(xs[i], xs[i+1], t)
+			ys[i] = lerp(ys[i], ys[i+1], t)
+		}
+	}
+	return xs[0], ys[0]
+}
+
+type arcPath struct {
+	center         TouchPoint
+	radius         float64
+	fromDeg, toDeg float64
+}
+
+// ArcPath returns a Path following the circle of the given radius around
+// center, from the angle fromDeg to toDeg. Angles are in degrees from the
+// positive X axis. As the Y axis points down, positive angles go
+// clockwise on the screen.
+func ArcPath(center TouchPoint, radius, fromDeg, toDeg float64) Path {
+	return &arcPath{center, radius, fromDeg, toDeg}
+}
+
+func (p *arcPath) At(t float64) (x, y float64) {
+	rad := lerp(p.fromDeg, p.toDeg, t) * math.Pi / 180
+	return float64(p.center.X) + p.radius*math.Cos(rad), float64(p.center.Y) + p.radius*math.Sin(rad)
+}
+
+// Easing maps the elapsed fraction of a contact's time, from 0 to 1, to
+// its progress along its Path.
+type Easing func(t float64) float64
+
+// EaseLinear moves at a constant speed.
+func EaseLinear(t float64) float64 { return t }
+
+// EaseIn starts slowly and accelerates. The contact is moving fastest when
+// it is lifted, like in a fling.
+func EaseIn(t float64) float64 { return t * t }
+
+// EaseOut starts fast and decelerates to a stop.
+func EaseOut(t float64) float64 { return t * (2 - t) }
+
+// EaseInOut accelerates until the middle and then decelerates.
+func EaseInOut(t float64) float64 {
+	if t < 0.5 {
+		return 2 * t * t
+	}
+	return -1 + (4-2*t)*t
+}
+
+// Contact is a single touch in a Gesture.
+type Contact struct {
+	// Path is the trajectory of the contact.
+	Path Path
+	// Easing controls the speed along Path. If nil, EaseLinear is used.
+	Easing Easing
+	// Start and End are when the contact touches and leaves the surface,
+	// from the start of the gesture.
+	Start time.Duration
+	End   time.Duration
+
+	// Pressure, TouchMajor and TouchMinor are the values when the contact
+	// starts. They change linearly into EndPressure, EndTouchMajor and
+	// EndTouchMinor until it ends. Zero start values keep the defaults of
+	// the writer, and zero end values keep the start values.
+	Pressure      int32
+	EndPressure   int32
+	TouchMajor    int32
+	EndTouchMajor int32
+	TouchMinor    int32
+	EndTouchMinor int32
+}
+
+// Gesture is a set of contacts on a touch surface which may overlap in
+// time. It can be performed by TouchEventWriter.Perform on touchscreens as
+// well as trackpads.
+type Gesture struct {
+	Contacts []Contact
+}
+
+// Duration returns the time until the last contact of g ends.
+func (g *Gesture) Duration() time.Duration {
+	var d time.Duration
+	for _, c := range g.Contacts {
+		if c.End > d {
+			d = c.End
+		}
+	}
+	return d
+}
+
+// PinchGesture returns a two-finger Gesture in which the fingers move
+// symmetrically around center along the line of angleDeg, from being
+// apart by distance from to being apart by distance to. A pinch with to
+// larger than from zooms in.
+func PinchGesture(center TouchPoint, from, to, angleDeg float64, t time.Duration) *Gesture {
+	rad := angleDeg * math.Pi / 180
+	dx, dy := math.Cos(rad)/2, math.Sin(rad)/2
+	point := func(d, sign float64) TouchPoint {
+		return TouchPoint{
+			X: TouchCoord(math.Round(float64(center.X) + sign*d*dx)),
+			Y: TouchCoord(math.Round(float64(center.Y) + sign*d*dy)),
+		}
+	}
+	return &Gesture{Contacts: []Contact{
+		{Path: LinePath(point(from, -1), point(to, -1)), End: t},
+		{Path: LinePath(point(from, 1), point(to, 1)), End: t},
+	}}
+}
+
+// RotateGesture returns a two-finger Gesture in which the fingers are on
+// opposite sides of the circle of the given radius around center and
+// rotate by degrees. Positive degrees rotate clockwise.
+func RotateGesture(center TouchPoint, radius, degrees float64, t time.Duration) *Gesture {
+	return &Gesture{Contacts: []Contact{
+		{Path: ArcPath(center, radius, 180, 180+degrees), End: t},
+		{Path: ArcPath(center, radius, 0, degrees), End: t},
+	}}
+}
+
+// FlingGesture returns a one-finger Gesture which accelerates from one
+// point to another and leaves the surface while still moving fast.
+func FlingGesture(from, to TouchPoint, t time.Duration) *Gesture {
+	return &Gesture{Contacts: []Contact{
+		{Path: LinePath(from, to), Easing: EaseIn, End: t},
+	}}
+}
+
+// PalmContact returns a Contact which stays at p from start to end with a
+// large contact area, like a resting palm.
+func PalmContact(p TouchPoint, start, end time.Duration) Contact {
+	const (
+		palmTouchMajor = 200
+		palmTouchMinor = 150
+	)
+	return Contact{
+		Path:       LinePath(p, p),
+		Start:      start,
+		End:        end,
+		TouchMajor: palmTouchMajor,
+		TouchMinor: palmTouchMinor,
+	}
+}
+
+// gestureFrame is a batch of events which are sent together at a point
+// in time while performing a gesture.
+type gestureFrame struct {
+	at     time.Duration
+	events []kernelEventEntry
+}
+
+// compileGesture returns the batches of events which perform g with the
+// touches of tw. Batches are made every touchFrequency, as well as when
+// a contact starts or ends. A contact is lifted in the batch following
+// its end.
+func (tw *TouchEventWriter) compileGesture(g *Gesture) ([]gestureFrame, error) {
+	if len(g.Contacts) == 0 {
+		return nil, errors.New("gesture has no contacts")
+	}
+	if len(g.Contacts) > len(tw.touches) {
+		return nil, errors.Errorf("gesture has %d contacts; got %d touches", len(g.Contacts), len(tw.touches))
+	}
+	for i, c := range g.Contacts {
+		if c.Path == nil {
+			return nil, errors.Errorf("contact %d has no path", i)
+		}
+		if c.Start < 0 || c.End < c.Start {
+			return nil, errors.Errorf("contact %d has invalid time range [%v, %v]", i, c.Start, c.End)
+		}
+	}
+
+	end := g.Duration()
+	timeSet := map[time.Duration]struct{}{end + touchFrequency: {}}
+	for t := time.Duration(0); t <= end; t += touchFrequency {
+		timeSet[t] = struct{}{}
+	}
+	for _, c := range g.Contacts {
+		timeSet[c.Start] = struct{}{}
+		timeSet[c.End] = struct{}{}
+	}
+	var times []time.Duration
+	for t := range timeSet {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	defaultPressure := tw.touches[0].absPressure
+	defaultMajor := tw.touches[0].touchMajor
+	defaultMinor := tw.touches[0].touchMinor
+	down := make([]bool, len(g.Contacts))
+	var frames []gestureFrame
+	for _, t := range times {
+		var events []kernelEventEntry
+		var first *TouchState
+		for i, c := range g.Contacts {
+			ts := &tw.touches[i]
+			if t < c.Start || t > c.End {
+				if down[i] {
+					events = append(events,
+						kernelEventEntry{EV_ABS, ABS_MT_SLOT, ts.slot},
+						kernelEventEntry{EV_ABS, ABS_MT_TRACKING_ID, -1})
+					down[i] = false
+				}
+				continue
+			}
+			if !down[i] {
+				ts.touchID = tw.tsw.nextTouchID
+				tw.tsw.nextTouchID = (tw.tsw.nextTouchID + 1) % int32(tw.tsw.maxTrackingID)
+				down[i] = true
+			}
+
+			frac := 1.0
+			if c.End > c.Start {
+				frac = float64(t-c.Start) / float64(c.End-c.Start)
+			}
+			easing := c.Easing
+			if easing == nil {
+				easing = EaseLinear
+			}
+			x, y := c.Path.At(easing(frac))
+			if err := ts.SetPos(TouchCoord(math.Round(x)), TouchCoord(math.Round(y))); err != nil {
+				return nil, errors.Wrapf(err, "contact %d at %v", i, t)
+			}
+			ts.absPressure = interpolateValue(c.Pressure, c.EndPressure, defaultPressure, frac)
+			ts.touchMajor = interpolateValue(c.TouchMajor, c.EndTouchMajor, defaultMajor, frac)
+			ts.touchMinor = interpolateValue(c.TouchMinor, c.EndTouchMinor, defaultMinor, frac)
+			events = append(events,
+				kernelEventEntry{EV_ABS, ABS_MT_SLOT, ts.slot},
+				kernelEventEntry{EV_ABS, ABS_MT_TRACKING_ID, ts.touchID},
+				kernelEventEntry{EV_ABS, ABS_MT_POSITION_X, int32(ts.x)},
+				kernelEventEntry{EV_ABS, ABS_MT_POSITION_Y, int32(ts.y)},
+				kernelEventEntry{EV_ABS, ABS_MT_PRESSURE, ts.absPressure},
+				kernelEventEntry{EV_ABS, ABS_MT_TOUCH_MAJOR, ts.touchMajor},
+				kernelEventEntry{EV_ABS, ABS_MT_TOUCH_MINOR, ts.touchMinor})
+			if first == nil {
+				first = ts
+			}
+		}
+		if len(events) == 0 {
+			// Nothing is touching the surface between contacts.
+			continue
+		}
+		if first != nil {
+			events = append(events,
+				kernelEventEntry{EV_KEY, BTN_TOUCH, 1},
+				kernelEventEntry{EV_ABS, ABS_X, int32(first.x)},
+				kernelEventEntry{EV_ABS, ABS_Y, int32(first.y)},
+				kernelEventEntry{EV_ABS, ABS_PRESSURE, first.absPressure})
+		} else {
+			events = append(events,
+				kernelEventEntry{EV_ABS, ABS_PRESSURE, 0},
+				kernelEventEntry{EV_KEY, BTN_TOUCH, 0})
+		}
+		frames = append(frames, gestureFrame{at: t, events: events})
+	}
+	return frames, nil
+}
+
+// interpolateValue returns the value between start and end at frac. A
+// zero start means def, and a zero end means the same as start.
+func interpolateValue(start, end, def int32, frac float64) int32 {
+	if start == 0 {
+		start = def
+	}
+	if end == 0 {
+		end = start
+	}
+	return int32(math.Round(lerp(float64(start), float64(end), frac)))
+}
+
+// lerp returns the linear interpolation between a and b at t.
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+// Perform performs g with the touches of tw. The gesture needs as many
+// touches as contacts; use NewMultiTouchWriter to create tw accordingly.
+// Every contact is lifted once it ends, so Perform does not need to be
+// followed by End().
+func (tw *TouchEventWriter) Perform(ctx context.Context, g *Gesture) error {
+	frames, err := tw.compileGesture(g)
+	if err != nil {
+		return err
+	}
+	var prev time.Duration
+	for _, f := range frames {
+		if err := testing.Sleep(ctx, f.at-prev); err != nil {
+			return errors.Wrap(err, "timeout while doing sleep")
+		}
+		prev = f.at
+		for _, e := range f.events {
+			if err := tw.tsw.rw.Event(e.et, e.ec, e.val); err != nil {
+				return err
+			}
+		}
+		if err := tw.tsw.rw.Sync(); err != nil {
+			return err
+		}
+	}
+	tw.ended = true
+	return nil
+}
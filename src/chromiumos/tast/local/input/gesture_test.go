@@ -0,0 +1,161 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package input
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPaths(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		path Path
+		t    float64
+		x, y float64
+	}{
+		{"line start", LinePath(TouchPoint{10, 20}, TouchPoint{30, 60}), 0, 10, 20},
+		{"line middle", LinePath(TouchPoint{10, 20}, TouchPoint{30, 60}), 0.5, 20, 40},
+		{"bezier end", BezierPath(TouchPoint{0, 0}, TouchPoint{50, 100}, TouchPoint{100, 0}), 1, 100, 0},
+		{"bezier middle", BezierPath(TouchPoint{0, 0}, TouchPoint{50, 100}, TouchPoint{100, 0}), 0.5, 50, 50},
+		{"arc quarter", ArcPath(TouchPoint{100, 100}, 10, 0, 90), 1, 100, 110},
+	} {
+		x, y := tc.path.At(tc.t)
+		if math.Abs(x-tc.x) > 1e-9 || math.Abs(y-tc.y) > 1e-9 {
+			t.Errorf("%s: At(%v) = (%v, %v); want (%v, %v)", tc.name, tc.t, x, y, tc.x, tc.y)
+		}
+	}
+}
+
+func TestPerformGesture(t *testing.T) {
+	const touchID = 100
+
+	b := testBuffer{}
+	now := time.Unix(5, 0)
+	mw := TouchscreenEventWriter{
+		rw:            &RawEventWriter{&b, func() time.Time { return now }},
+		nextTouchID:   touchID,
+		width:         1000,
+		height:        1000,
+		maxTouchSlot:  9,
+		maxTrackingID: 65536,
+		maxPressure:   128,
+	}
+	tw, err := mw.NewMultiTouchWriter(2)
+	if err != nil {
+		t.Fatal("NewMultiTouchWriter returned error: ", err)
+	}
+	// Contacts get new tracking IDs when they start.
+	id := mw.nextTouchID
+
+	// The second contact starts after the first one has moved for one frame.
+	g := &Gesture{Contacts: []Contact{
+		{Path: LinePath(TouchPoint{100, 100}, TouchPoint{200, 100}), End: 2 * touchFrequency, Pressure: 10, EndPressure: 30},
+		{Path: LinePath(TouchPoint{500, 500}, TouchPoint{500, 500}), Start: touchFrequency, End: touchFrequency},
+	}}
+	if err := tw.Perform(context.Background(), g); err != nil {
+		t.Fatal("Perform returned error: ", err)
+	}
+
+	written, err := readAllEvents(bytes.NewReader(b.buf.Bytes()))
+	if err != nil {
+		t.Fatal("Failed to read events: ", err)
+	}
+
+	tv := syscall.NsecToTimeval(now.UnixNano())
+	ev := func(et EventType, ec EventCode, val int32) string {
+		return eventString(tv, uint16(et), uint16(ec), val)
+	}
+	syn := ev(EV_SYN, SYN_REPORT, 0)
+	expected := []string{
+		ev(EV_ABS, ABS_MT_SLOT, 0),
+		ev(EV_ABS, ABS_MT_TRACKING_ID, id),
+		ev(EV_ABS, ABS_MT_POSITION_X, 100),
+		ev(EV_ABS, ABS_MT_POSITION_Y, 100),
+		ev(EV_ABS, ABS_MT_PRESSURE, 10),
+		ev(EV_ABS, ABS_MT_TOUCH_MAJOR, 5),
+		ev(EV_ABS, ABS_MT_TOUCH_MINOR, 5),
+		ev(EV_KEY, BTN_TOUCH, 1),
+		ev(EV_ABS, ABS_X, 100),
+		ev(EV_ABS, ABS_Y, 100),
+		ev(EV_ABS, ABS_PRESSURE, 10),
+		syn,
+		ev(EV_ABS, ABS_MT_SLOT, 0),
+		ev(EV_ABS, ABS_MT_TRACKING_ID, id),
+		ev(EV_ABS, ABS_MT_POSITION_X, 150),
+		ev(EV_ABS, ABS_MT_POSITION_Y, 100),
+		ev(EV_ABS, ABS_MT_PRESSURE, 20),
+		ev(EV_ABS, ABS_MT_TOUCH_MAJOR, 5),
+		ev(EV_ABS, ABS_MT_TOUCH_MINOR, 5),
+		ev(EV_ABS, ABS_MT_SLOT, 1),
+		ev(EV_ABS, ABS_MT_TRACKING_ID, id+1),
+		ev(EV_ABS, ABS_MT_POSITION_X, 500),
+		ev(EV_ABS, ABS_MT_POSITION_Y, 500),
+		ev(EV_ABS, ABS_MT_PRESSURE, 33),
+		ev(EV_ABS, ABS_MT_TOUCH_MAJOR, 5),
+		ev(EV_ABS, ABS_MT_TOUCH_MINOR, 5),
+		ev(EV_KEY, BTN_TOUCH, 1),
+		ev(EV_ABS, ABS_X, 150),
+		ev(EV_ABS, ABS_Y, 100),
+		ev(EV_ABS, ABS_PRESSURE, 20),
+		syn,
+		ev(EV_ABS, ABS_MT_SLOT, 0),
+		ev(EV_ABS, ABS_MT_TRACKING_ID, id),
+		ev(EV_ABS, ABS_MT_POSITION_X, 200),
+		ev(EV_ABS, ABS_MT_POSITION_Y, 100),
+		ev(EV_ABS, ABS_MT_PRESSURE, 30),
+		ev(EV_ABS, ABS_MT_TOUCH_MAJOR, 5),
+		ev(EV_ABS, ABS_MT_TOUCH_MINOR, 5),
+		ev(EV_ABS, ABS_MT_SLOT, 1),
+		ev(EV_ABS, ABS_MT_TRACKING_ID, -1),
+		ev(EV_KEY, BTN_TOUCH, 1),
+		ev(EV_ABS, ABS_X, 200),
+		ev(EV_ABS, ABS_Y, 100),
+		ev(EV_ABS, ABS_PRESSURE, 30),
+		syn,
+		ev(EV_ABS, ABS_MT_SLOT, 0),
+		ev(EV_ABS, ABS_MT_TRACKING_ID, -1),
+		ev(EV_ABS, ABS_PRESSURE, 0),
+		ev(EV_KEY, BTN_TOUCH, 0),
+		syn,
+	}
+	if !reflect.DeepEqual(written, expected) {
+		t.Errorf("Wrote %v; want %v", written, expected)
+	}
+}
+
+func TestPerformGestureErrors(t *testing.T) {
+	mw := TouchscreenEventWriter{
+		rw:            &RawEventWriter{&testBuffer{}, time.Now},
+		width:         1000,
+		height:        1000,
+		maxTouchSlot:  9,
+		maxTrackingID: 65536,
+		maxPressure:   128,
+	}
+	tw, err := mw.NewSingleTouchWriter()
+	if err != nil {
+		t.Fatal("NewSingleTouchWriter returned error: ", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		g    *Gesture
+	}{
+		{"empty", &Gesture{}},
+		{"too many contacts", PinchGesture(TouchPoint{500, 500}, 100, 300, 0, touchFrequency)},
+		{"out of bounds", FlingGesture(TouchPoint{500, 500}, TouchPoint{1500, 500}, touchFrequency)},
+		{"invalid time", &Gesture{Contacts: []Contact{{Path: LinePath(TouchPoint{}, TouchPoint{}), Start: time.Second}}}},
+	} {
+		if err := tw.Perform(context.Background(), tc.g); err == nil {
+			t.Errorf("Perform unexpectedly succeeded for %s gesture", tc.name)
+		}
+	}
+}
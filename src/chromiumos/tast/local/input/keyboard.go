@@ -21,6 +21,8 @@ type KeyboardEventWriter struct {
 	virt *os.File // if non-nil, used to hold a virtual device open
 	fast bool     // if true, do not sleep after type; useful for unit tests
 	dev  string   // path to underlying device in /dev/input
+
+	layout *KeyboardLayout // layout used by Type; USLayout if nil
 }
 
 var nextVirtKbdNum = 1 // appended to virtual keyboard device name
@@ -129,44 +131,57 @@ func (kw *KeyboardEventWriter) sendKey(ec EventCode, val int32, firstErr *error)
 	}
 }
 
+// SetLayout sets the keyboard layout used by Type to l. It should match the layout of
+// the current input method, which can be looked up with KeyboardLayoutForInputMethod.
+func (kw *KeyboardEventWriter) SetLayout(l *KeyboardLayout) {
+	kw.layout = l
+}
+
+// Layout returns the keyboard layout used by Type.
+func (kw *KeyboardEventWriter) Layout() *KeyboardLayout {
+	if kw.layout == nil {
+		return USLayout
+	}
+	return kw.layout
+}
+
 // Type injects key events suitable for generating the string s.
-// Only characters that can be typed using a QWERTY keyboard are supported,
-// and the current keyboard layout must be QWERTY. The left Shift key is automatically
-// pressed and released for uppercase letters or other characters that can be typed
-// using Shift.
+// Only characters that can be typed using the layout set by SetLayout (QWERTY by default)
+// are supported, and the current keyboard layout must match it. The left Shift and right Alt
+// (i.e. AltGr) keys are automatically pressed and released for characters typed using them,
+// and dead keys are used to type accented characters which have no key of their own.
 func (kw *KeyboardEventWriter) Type(ctx context.Context, s string) error {
 	// Look up runes first so we can report an error before we start injecting events.
-	type key struct {
-		code    EventCode
-		shifted bool
-	}
-	var keys []key
-	for i, r := range []rune(s) {
-		if code, ok := runeKeyCodes[r]; ok {
-			keys = append(keys, key{code, false})
-		} else if code, ok := shiftedRuneKeyCodes[r]; ok {
-			keys = append(keys, key{code, true})
-		} else {
-			return errors.Errorf("unsupported rune %v at position %d", r, i)
-		}
+	keys, err := kw.Layout().keyStrokes(s)
+	if err != nil {
+		return err
 	}
 
 	firstErr := ctx.Err()
 
-	shifted := false
+	var mods keyModifiers
 	for i, k := range keys {
-		if k.shifted && !shifted {
-			kw.sendKey(KEY_LEFTSHIFT, 1, &firstErr)
-			shifted = true
+		for _, m := range modifierKeys {
+			if k.mods&m.mod != 0 && mods&m.mod == 0 {
+				kw.sendKey(m.code, 1, &firstErr)
+				mods |= m.mod
+			}
 		}
 
 		kw.sendKey(k.code, 1, &firstErr)
 		kw.sleepAfterType(ctx, &firstErr)
 		kw.sendKey(k.code, 0, &firstErr)
 
-		if shifted && (i+1 == len(keys) || !keys[i+1].shifted) {
-			kw.sendKey(KEY_LEFTSHIFT, 0, &firstErr)
-			shifted = false
+		// Release the modifiers which are not needed by the next key in reverse order.
+		var next keyModifiers
+		if i+1 < len(keys) {
+			next = keys[i+1].mods
+		}
+		for j := len(modifierKeys) - 1; j >= 0; j-- {
+			if m := modifierKeys[j]; mods&m.mod != 0 && next&m.mod == 0 {
+				kw.sendKey(m.code, 0, &firstErr)
+				mods &^= m.mod
+			}
 		}
 
 		kw.sleepAfterType(ctx, &firstErr)
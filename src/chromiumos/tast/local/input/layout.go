@@ -0,0 +1,396 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package input
+
+import (
+	"strings"
+
+	"chromiumos/tast/errors"
+)
+
+// keyModifiers is a bitfield of the modifier keys held while pressing a key.
+type keyModifiers uint8
+
+const (
+	shiftModifier keyModifiers = 1 << iota
+	altGrModifier
+)
+
+// modifierKeys contains the keys pressed for each modifier, in the order in which they are pressed.
+var modifierKeys = []struct {
+	mod  keyModifiers
+	code EventCode
+}{
+	{shiftModifier, KEY_LEFTSHIFT},
+	{altGrModifier, KEY_RIGHTALT},
+}
+
+// keyStroke is a key pressed while holding modifier keys.
+type keyStroke struct {
+	code EventCode
+	mods keyModifiers
+}
+
+// layoutKey describes the characters typed by a key of a keyboard layout.
+type layoutKey struct {
+	code EventCode
+	// levels contains the characters typed by the key alone, with Shift, with AltGr and with
+	// Shift and AltGr, in that order. Trailing levels may be omitted. Combining characters
+	// (e.g. U+0302 for a circumflex accent) describe dead keys.
+	levels string
+}
+
+// deadKeyCompositions contains the characters composed by dead keys, keyed by the combining
+// character describing the dead key. The spacing character is typed by the dead key followed
+// by a space, and pairs contains the base characters followed by the characters they compose.
+var deadKeyCompositions = map[rune]struct {
+	spacing rune
+	pairs   string
+}{
+	'\u0300': {'`', "aàeèiìoòuùAÀEÈIÌOÒUÙ"},
+	'\u0301': {'´', "aáeéiíoóuúyýAÁEÉIÍOÓUÚYÝ"},
+	'\u0302': {'^', "aâeêiîoôuûAÂEÊIÎOÔUÛ"},
+	'\u0303': {'~', "aãnñoõAÃNÑOÕ"},
+	'\u0308': {'¨', "aäeëiïoöuüyÿAÄEËIÏOÖUÜ"},
+}
+
+// KeyboardLayout describes the characters that can be typed with a keyboard layout
+// and the key strokes typing them.
+type KeyboardLayout struct {
+	name    string
+	strokes map[rune][]keyStroke
+}
+
+// newKeyboardLayout returns a layout typing the characters of keys. If several keys type
+// the same character, the first one is used. Characters which are not on any key but can be
+// composed with a dead key are typed with the dead key followed by the base character.
+func newKeyboardLayout(name string, keys []layoutKey) *KeyboardLayout {
+	l := &KeyboardLayout{name, make(map[rune][]keyStroke)}
+	levelMods := []keyModifiers{0, shiftModifier, altGrModifier, shiftModifier | altGrModifier}
+
+	type deadKey struct {
+		mark   rune
+		stroke keyStroke
+	}
+	var deadKeys []deadKey
+	for _, k := range keys {
+		for i, r := range []rune(k.levels) {
+			ks := keyStroke{k.code, levelMods[i]}
+			if _, ok := deadKeyCompositions[r]; ok {
+				deadKeys = append(deadKeys, deadKey{r, ks})
+				continue
+			}
+			if _, ok := l.strokes[r]; !ok {
+				l.strokes[r] = []keyStroke{ks}
+			}
+		}
+	}
+
+	for _, dk := range deadKeys {
+		comp := deadKeyCompositions[dk.mark]
+		pairs := []rune(comp.pairs)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			l.addComposition(dk.stroke, pairs[i], pairs[i+1])
+		}
+		l.addComposition(dk.stroke, ' ', comp.spacing)
+	}
+	return l
+}
+
+// addComposition makes composed typeable by dead followed by base, unless it is already typeable.
+func (l *KeyboardLayout) addComposition(dead keyStroke, base, composed rune) {
+	if _, ok := l.strokes[composed]; ok {
+		return
+	}
+	if bs, ok := l.strokes[base]; ok && len(bs) == 1 {
+		l.strokes[composed] = []keyStroke{dead, bs[0]}
+	}
+}
+
+// Name returns the xkb name of the layout, e.g. "fr".
+func (l *KeyboardLayout) Name() string {
+	return l.name
+}
+
+// CanType returns true if all characters of s can be typed with the layout.
+func (l *KeyboardLayout) CanType(s string) bool {
+	_, err := l.keyStrokes(s)
+	return err == nil
+}
+
+// keyStrokes returns the key strokes typing s.
+func (l *KeyboardLayout) keyStrokes(s string) ([]keyStroke, error) {
+	var strokes []keyStroke
+	for i, r := range []rune(s) {
+		rs, ok := l.strokes[r]
+		if !ok {
+			return nil, errors.Errorf("rune %q at position %d cannot be typed with layout %q", r, i, l.name)
+		}
+		strokes = append(strokes, rs...)
+	}
+	return strokes, nil
+}
+
+// controlKeys contains the keys typing control characters and spaces in all layouts.
+var controlKeys = []layoutKey{
+	{KEY_BACKSPACE, "\b"},
+	{KEY_TAB, "\t"},
+	{KEY_ENTER, "\n"},
+	{KEY_SPACE, " "},
+	{KEY_ESC, "\x1b"},
+}
+
+// USLayout is the US English QWERTY layout, i.e. xkb:us::eng.
+var USLayout = func() *KeyboardLayout {
+	var keys []layoutKey
+	for r, code := range runeKeyCodes {
+		keys = append(keys, layoutKey{code, string(r)})
+	}
+	l := newKeyboardLayout("us", keys)
+	for r, code := range shiftedRuneKeyCodes {
+		l.strokes[r] = []keyStroke{{code, shiftModifier}}
+	}
+	return l
+}()
+
+// UKLayout is the UK English QWERTY layout, i.e. xkb:gb:extd:eng.
+var UKLayout = newKeyboardLayout("gb", append([]layoutKey{
+	{KEY_GRAVE, "`¬¦"},
+	{KEY_1, "1!"},
+	{KEY_2, "2\""},
+	{KEY_3, "3£"},
+	{KEY_4, "4$€"},
+	{KEY_5, "5%"},
+	{KEY_6, "6^"},
+	{KEY_7, "7&"},
+	{KEY_8, "8*"},
+	{KEY_9, "9("},
+	{KEY_0, "0)"},
+	{KEY_MINUS, "-_"},
+	{KEY_EQUAL, "=+"},
+	{KEY_Q, "qQ"},
+	{KEY_W, "wW"},
+	{KEY_E, "eEéÉ"},
+	{KEY_R, "rR"},
+	{KEY_T, "tT"},
+	{KEY_Y, "yY"},
+	{KEY_U, "uUúÚ"},
+	{KEY_I, "iIíÍ"},
+	{KEY_O, "oOóÓ"},
+	{KEY_P, "pP"},
+	{KEY_LEFTBRACE, "[{"},
+	{KEY_RIGHTBRACE, "]}"},
+	{KEY_A, "aAáÁ"},
+	{KEY_S, "sS"},
+	{KEY_D, "dD"},
+	{KEY_F, "fF"},
+	{KEY_G, "gG"},
+	{KEY_H, "hH"},
+	{KEY_J, "jJ"},
+	{KEY_K, "kK"},
+	{KEY_L, "lL"},
+	{KEY_SEMICOLON, ";:"},
+	{KEY_APOSTROPHE, "'@"},
+	{KEY_BACKSLASH, "#~"},
+	{KEY_102ND, "\\|"},
+	{KEY_Z, "zZ"},
+	{KEY_X, "xX"},
+	{KEY_C, "cC"},
+	{KEY_V, "vV"},
+	{KEY_B, "bB"},
+	{KEY_N, "nN"},
+	{KEY_M, "mM"},
+	{KEY_COMMA, ",<"},
+	{KEY_DOT, ".>"},
+	{KEY_SLASH, "/?"},
+}, controlKeys...))
+
+// FrenchLayout is the French AZERTY layout, i.e. xkb:fr::fra.
+var FrenchLayout = newKeyboardLayout("fr", append([]layoutKey{
+	{KEY_GRAVE, "²"},
+	{KEY_1, "&1"},
+	{KEY_2, "é2~"},
+	{KEY_3, "\"3#"},
+	{KEY_4, "'4{"},
+	{KEY_5, "(5["},
+	{KEY_6, "-6|"},
+	{KEY_7, "è7`"},
+	{KEY_8, "_8\\"},
+	{KEY_9, "ç9^"},
+	{KEY_0, "à0@"},
+	{KEY_MINUS, ")°]"},
+	{KEY_EQUAL, "=+}"},
+	{KEY_Q, "aA"},
+	{KEY_W, "zZ"},
+	{KEY_E, "eE€"},
+	{KEY_R, "rR"},
+	{KEY_T, "tT"},
+	{KEY_Y, "yY"},
+	{KEY_U, "uU"},
+	{KEY_I, "iI"},
+	{KEY_O, "oO"},
+	{KEY_P, "pP"},
+	{KEY_LEFTBRACE, "\u0302\u0308"},
+	{KEY_RIGHTBRACE, "$£¤"},
+	{KEY_A, "qQ"},
+	{KEY_S, "sS"},
+	{KEY_D, "dD"},
+	{KEY_F, "fF"},
+	{KEY_G, "gG"},
+	{KEY_H, "hH"},
+	{KEY_J, "jJ"},
+	{KEY_K, "kK"},
+	{KEY_L, "lL"},
+	{KEY_SEMICOLON, "mM"},
+	{KEY_APOSTROPHE, "ù%"},
+	{KEY_BACKSLASH, "*µ"},
+	{KEY_102ND, "<>"},
+	{KEY_Z, "wW"},
+	{KEY_X, "xX"},
+	{KEY_C, "cC"},
+	{KEY_V, "vV"},
+	{KEY_B, "bB"},
+	{KEY_N, "nN"},
+	{KEY_M, ",?"},
+	{KEY_COMMA, ";."},
+	{KEY_DOT, ":/"},
+	{KEY_SLASH, "!§"},
+}, controlKeys...))
+
+// GermanLayout is the German QWERTZ layout, i.e. xkb:de::ger.
+var GermanLayout = newKeyboardLayout("de", append([]layoutKey{
+	{KEY_GRAVE, "\u0302°"},
+	{KEY_1, "1!"},
+	{KEY_2, "2\"²"},
+	{KEY_3, "3§³"},
+	{KEY_4, "4$"},
+	{KEY_5, "5%"},
+	{KEY_6, "6&"},
+	{KEY_7, "7/{"},
+	{KEY_8, "8(["},
+	{KEY_9, "9)]"},
+	{KEY_0, "0=}"},
+	{KEY_MINUS, "ß?\\"},
+	{KEY_EQUAL, "\u0301\u0300"},
+	{KEY_Q, "qQ@"},
+	{KEY_W, "wW"},
+	{KEY_E, "eE€"},
+	{KEY_R, "rR"},
+	{KEY_T, "tT"},
+	{KEY_Y, "zZ"},
+	{KEY_U, "uU"},
+	{KEY_I, "iI"},
+	{KEY_O, "oO"},
+	{KEY_P, "pP"},
+	{KEY_LEFTBRACE, "üÜ"},
+	{KEY_RIGHTBRACE, "+*~"},
+	{KEY_A, "aA"},
+	{KEY_S, "sS"},
+	{KEY_D, "dD"},
+	{KEY_F, "fF"},
+	{KEY_G, "gG"},
+	{KEY_H, "hH"},
+	{KEY_J, "jJ"},
+	{KEY_K, "kK"},
+	{KEY_L, "lL"},
+	{KEY_SEMICOLON, "öÖ"},
+	{KEY_APOSTROPHE, "äÄ"},
+	{KEY_BACKSLASH, "#'"},
+	{KEY_102ND, "<>|"},
+	{KEY_Z, "yY"},
+	{KEY_X, "xX"},
+	{KEY_C, "cC"},
+	{KEY_V, "vV"},
+	{KEY_B, "bB"},
+	{KEY_N, "nN"},
+	{KEY_M, "mMµ"},
+	{KEY_COMMA, ",;"},
+	{KEY_DOT, ".:"},
+	{KEY_SLASH, "-_"},
+}, controlKeys...))
+
+// JISLayout is the Japanese JIS layout, i.e. xkb:jp::jpn. Only the characters typed
+// directly by the keys are supported; kana input requires an IME.
+var JISLayout = newKeyboardLayout("jp", append([]layoutKey{
+	{KEY_1, "1!"},
+	{KEY_2, "2\""},
+	{KEY_3, "3#"},
+	{KEY_4, "4$"},
+	{KEY_5, "5%"},
+	{KEY_6, "6&"},
+	{KEY_7, "7'"},
+	{KEY_8, "8("},
+	{KEY_9, "9)"},
+	{KEY_0, "0"},
+	{KEY_MINUS, "-="},
+	{KEY_EQUAL, "^~"},
+	{KEY_YEN, "\\|"},
+	{KEY_Q, "qQ"},
+	{KEY_W, "wW"},
+	{KEY_E, "eE"},
+	{KEY_R, "rR"},
+	{KEY_T, "tT"},
+	{KEY_Y, "yY"},
+	{KEY_U, "uU"},
+	{KEY_I, "iI"},
+	{KEY_O, "oO"},
+	{KEY_P, "pP"},
+	{KEY_LEFTBRACE, "@`"},
+	{KEY_RIGHTBRACE, "[{"},
+	{KEY_A, "aA"},
+	{KEY_S, "sS"},
+	{KEY_D, "dD"},
+	{KEY_F, "fF"},
+	{KEY_G, "gG"},
+	{KEY_H, "hH"},
+	{KEY_J, "jJ"},
+	{KEY_K, "kK"},
+	{KEY_L, "lL"},
+	{KEY_SEMICOLON, ";+"},
+	{KEY_APOSTROPHE, ":*"},
+	{KEY_BACKSLASH, "]}"},
+	{KEY_Z, "zZ"},
+	{KEY_X, "xX"},
+	{KEY_C, "cC"},
+	{KEY_V, "vV"},
+	{KEY_B, "bB"},
+	{KEY_N, "nN"},
+	{KEY_M, "mM"},
+	{KEY_COMMA, ",<"},
+	{KEY_DOT, ".>"},
+	{KEY_SLASH, "/?"},
+	{KEY_RO, "\\_"},
+}, controlKeys...))
+
+// keyboardLayouts contains the supported layouts keyed by the layout and variant
+// parts of xkb input method IDs.
+var keyboardLayouts = map[string]*KeyboardLayout{
+	"us:":     USLayout,
+	"gb:":     UKLayout,
+	"gb:extd": UKLayout,
+	"fr:":     FrenchLayout,
+	"de:":     GermanLayout,
+	"jp:":     JISLayout,
+}
+
+// KeyboardLayoutForInputMethod returns the layout used by the input method with the given ID,
+// e.g. "xkb:fr::fra", possibly prefixed by the ID of the IME extension. An error is returned
+// if the layout is not supported.
+func KeyboardLayoutForInputMethod(id string) (*KeyboardLayout, error) {
+	const prefix = "xkb:"
+	i := strings.Index(id, prefix)
+	if i < 0 {
+		return nil, errors.Errorf("input method %q is not an xkb layout", id)
+	}
+	parts := strings.SplitN(id[i+len(prefix):], ":", 3)
+	if len(parts) != 3 {
+		return nil, errors.Errorf("malformed input method %q", id)
+	}
+	l, ok := keyboardLayouts[parts[0]+":"+parts[1]]
+	if !ok {
+		return nil, errors.Errorf("unsupported layout of input method %q", id)
+	}
+	return l, nil
+}
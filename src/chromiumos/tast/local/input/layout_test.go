@@ -0,0 +1,119 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package input
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKeyStrokes(t *testing.T) {
+	for _, tc := range []struct {
+		layout  *KeyboardLayout
+		s       string
+		strokes []keyStroke
+	}{
+		{USLayout, "a?", []keyStroke{{KEY_A, 0}, {KEY_SLASH, shiftModifier}}},
+		{UKLayout, "£@", []keyStroke{{KEY_3, shiftModifier}, {KEY_APOSTROPHE, shiftModifier}}},
+		{UKLayout, "€\\", []keyStroke{{KEY_4, altGrModifier}, {KEY_102ND, 0}}},
+		{FrenchLayout, "aé1", []keyStroke{{KEY_Q, 0}, {KEY_2, 0}, {KEY_1, shiftModifier}}},
+		// ê is typed with the dead circumflex key, and Ï with the dead diaeresis key.
+		{FrenchLayout, "êÏ", []keyStroke{{KEY_LEFTBRACE, 0}, {KEY_E, 0}, {KEY_LEFTBRACE, shiftModifier}, {KEY_I, shiftModifier}}},
+		// ^ is typed directly with AltGr rather than with the dead key.
+		{FrenchLayout, "^", []keyStroke{{KEY_9, altGrModifier}}},
+		{GermanLayout, "zü@", []keyStroke{{KEY_Y, 0}, {KEY_LEFTBRACE, 0}, {KEY_Q, altGrModifier}}},
+		{GermanLayout, "^ó", []keyStroke{{KEY_GRAVE, 0}, {KEY_SPACE, 0}, {KEY_EQUAL, 0}, {KEY_O, 0}}},
+		{JISLayout, "@_\\", []keyStroke{{KEY_LEFTBRACE, 0}, {KEY_RO, shiftModifier}, {KEY_YEN, 0}}},
+	} {
+		strokes, err := tc.layout.keyStrokes(tc.s)
+		if err != nil {
+			t.Errorf("keyStrokes(%q) with layout %q failed: %v", tc.s, tc.layout.Name(), err)
+		} else if !reflect.DeepEqual(strokes, tc.strokes) {
+			t.Errorf("keyStrokes(%q) with layout %q = %v; want %v", tc.s, tc.layout.Name(), strokes, tc.strokes)
+		}
+	}
+
+	for _, tc := range []struct {
+		layout *KeyboardLayout
+		s      string
+	}{
+		{USLayout, "é"},
+		{FrenchLayout, "ñ"},
+		{JISLayout, "あ"},
+	} {
+		if tc.layout.CanType(tc.s) {
+			t.Errorf("CanType(%q) with layout %q = true; want false", tc.s, tc.layout.Name())
+		}
+	}
+}
+
+func TestKeyboardLayoutForInputMethod(t *testing.T) {
+	for _, tc := range []struct {
+		id     string
+		layout *KeyboardLayout // nil for error
+	}{
+		{"xkb:us::eng", USLayout},
+		{"xkb:gb:extd:eng", UKLayout},
+		{"_comp_ime_jkghodnilhceideoidjikpgommlajknkxkb:fr::fra", FrenchLayout},
+		{"xkb:de::ger", GermanLayout},
+		{"xkb:jp::jpn", JISLayout},
+		{"xkb:us:intl:eng", nil},
+		{"nacl_mozc_jp", nil},
+		{"xkb:fr", nil},
+	} {
+		l, err := KeyboardLayoutForInputMethod(tc.id)
+		if tc.layout == nil {
+			if err == nil {
+				t.Errorf("KeyboardLayoutForInputMethod(%q) unexpectedly succeeded", tc.id)
+			}
+		} else if err != nil {
+			t.Errorf("KeyboardLayoutForInputMethod(%q) failed: %v", tc.id, err)
+		} else if l != tc.layout {
+			t.Errorf("KeyboardLayoutForInputMethod(%q) = %q; want %q", tc.id, l.Name(), tc.layout.Name())
+		}
+	}
+}
+
+func TestEventWriterTypeLayout(t *testing.T) {
+	b := testBuffer{}
+	now := time.Unix(5, 0)
+	kw := KeyboardEventWriter{rw: &RawEventWriter{&b, func() time.Time { return now }}, fast: true}
+	kw.SetLayout(FrenchLayout)
+
+	const str = "Ê€"
+	if err := kw.Type(context.Background(), str); err != nil {
+		t.Fatalf("Type(%q) returned error: %v", str, err)
+	}
+	if err := kw.Type(context.Background(), "é"+string(rune(0x1f600))); err == nil {
+		t.Error("Type unexpectedly succeeded for an untypeable character")
+	}
+
+	written, err := readAllEvents(bytes.NewReader(b.buf.Bytes()))
+	if err != nil {
+		t.Error("Failed to read events: ", err)
+	}
+
+	tv := syscall.NsecToTimeval(now.UnixNano())
+	syn := eventString(tv, uint16(EV_SYN), uint16(SYN_REPORT), 0)
+	expected := []string{
+		eventString(tv, uint16(EV_KEY), uint16(KEY_LEFTBRACE), 1), syn,
+		eventString(tv, uint16(EV_KEY), uint16(KEY_LEFTBRACE), 0), syn,
+		eventString(tv, uint16(EV_KEY), uint16(KEY_LEFTSHIFT), 1), syn,
+		eventString(tv, uint16(EV_KEY), uint16(KEY_E), 1), syn,
+		eventString(tv, uint16(EV_KEY), uint16(KEY_E), 0), syn,
+		eventString(tv, uint16(EV_KEY), uint16(KEY_LEFTSHIFT), 0), syn,
+		eventString(tv, uint16(EV_KEY), uint16(KEY_RIGHTALT), 1), syn,
+		eventString(tv, uint16(EV_KEY), uint16(KEY_E), 1), syn,
+		eventString(tv, uint16(EV_KEY), uint16(KEY_E), 0), syn,
+		eventString(tv, uint16(EV_KEY), uint16(KEY_RIGHTALT), 0), syn,
+	}
+	if !reflect.DeepEqual(written, expected) {
+		t.Errorf("Wrote %v; want %v", written, expected)
+	}
+}
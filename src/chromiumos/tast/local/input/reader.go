@@ -0,0 +1,286 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package input
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"os"
+	"time"
+	"unsafe"
+
+	"chromiumos/tast/errors"
+)
+
+// readPollInterval is how often EventReader checks whether its context is done while waiting for events.
+const readPollInterval = 100 * time.Millisecond
+
+// Event is an input event read from an input event device.
+type Event struct {
+	// Time is the time at which the kernel generated the event.
+	Time  time.Time
+	Type  EventType
+	Code  EventCode
+	Value int32
+}
+
+// EventReader supports reading the input events delivered by the kernel to an input event device.
+type EventReader struct {
+	f       *os.File
+	grabbed bool // true if EVIOCGRAB was used to get exclusive access to the device
+}
+
+// NewEventReader returns an EventReader reading events from the input event device at path,
+// e.g. "/dev/input/event3". If grab is true, the device is grabbed with EVIOCGRAB so that
+// its events are not delivered to other clients (including Chrome) until Close is called.
+func NewEventReader(path string, grab bool) (*EventReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &EventReader{f: f}
+	if grab {
+		if err := r.setGrab(true); err != nil {
+			f.Close()
+			return nil, errors.Wrapf(err, "failed grabbing %v", path)
+		}
+		r.grabbed = true
+	}
+	return r, nil
+}
+
+// Close releases the device if it was grabbed and closes it.
+func (r *EventReader) Close() error {
+	var firstErr error
+	if r.grabbed {
+		firstErr = r.setGrab(false)
+		r.grabbed = false
+	}
+	if err := r.f.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// setGrab grabs or releases the device using the EVIOCGRAB ioctl.
+func (r *EventReader) setGrab(grab bool) error {
+	var v int32
+	if grab {
+		v = 1
+	}
+	return r.control(func(fd int) error {
+		// This corresponds to the EVIOCGRAB macro in input.h.
+		return ioctl(fd, iow('E', 0x90, unsafe.Sizeof(v)), uintptr(v))
+	})
+}
+
+// control calls f with the device's file descriptor. It goes through r.f.SyscallConn,
+// as r.f.Fd would put the device in blocking mode, after which the read deadlines used
+// by Read never expire.
+func (r *EventReader) control(f func(fd int) error) error {
+	rc, err := r.f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ferr error
+	if err := rc.Control(func(fd uintptr) { ferr = f(int(fd)) }); err != nil {
+		return err
+	}
+	return ferr
+}
+
+// Read blocks until the next event is delivered to the device and returns it.
+// An error is returned if ctx is done before an event is delivered.
+func (r *EventReader) Read(ctx context.Context) (*Event, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// Use a deadline so that ctx is checked regularly even if no event is delivered.
+		if err := r.f.SetReadDeadline(time.Now().Add(readPollInterval)); err != nil {
+			return nil, err
+		}
+		ev, err := readInputEvent(r.f)
+		if os.IsTimeout(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ev, nil
+	}
+}
+
+// ReadFrame reads events until a SYN_REPORT event is read and returns them, including
+// the SYN_REPORT event. The events of a frame describe the changes of the device's state
+// happening at a single point in time.
+func (r *EventReader) ReadFrame(ctx context.Context) ([]Event, error) {
+	var evs []Event
+	for {
+		ev, err := r.Read(ctx)
+		if err != nil {
+			return nil, err
+		}
+		evs = append(evs, *ev)
+		if ev.Type == EV_SYN && ev.Code == SYN_REPORT {
+			return evs, nil
+		}
+	}
+}
+
+// readInputEvent reads a single input_event struct from r.
+func readInputEvent(r io.Reader) (*Event, error) {
+	// As in RawEventWriter.Event, the size of input_event depends on the system's int size.
+	// The struct is read in a single call, as reads from input event devices must not be
+	// smaller than input_event.
+	switch intSize := unsafe.Sizeof(int(1)); intSize {
+	case 4:
+		var ev event32
+		if err := readStruct(r, &ev); err != nil {
+			return nil, err
+		}
+		return &Event{time.Unix(int64(ev.Sec), int64(ev.Usec)*1000), EventType(ev.Type), EventCode(ev.Code), ev.Val}, nil
+	case 8:
+		var ev event64
+		if err := readStruct(r, &ev); err != nil {
+			return nil, err
+		}
+		return &Event{time.Unix(0, ev.Tv.Nano()), EventType(ev.Type), EventCode(ev.Code), ev.Val}, nil
+	default:
+		return nil, errors.Errorf("unexpected int size of %d byte(s)", intSize)
+	}
+}
+
+// readStruct reads the fixed-size struct pointed to by data from r using a single read call.
+func readStruct(r io.Reader, data interface{}) error {
+	buf := make([]byte, binary.Size(data))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	return binary.Read(bytes.NewReader(buf), kernelByteOrder, data)
+}
+
+// DeviceDescription describes an input event device: its identity and the events it supports.
+// It contains everything needed to create an equivalent virtual device.
+type DeviceDescription struct {
+	Name                              string
+	Bustype, Vendor, Product, Version uint16
+	// Props is a bitfield of the device's DeviceProperty values.
+	Props uint32
+	// EventTypes is a bitfield of the EventType values supported by the device.
+	EventTypes uint32
+	// EventCodes contains a bitfield of the supported EventCode values for each EventType.
+	EventCodes map[EventType]*big.Int
+	// Axes contains the ranges of the device's EV_ABS axes.
+	Axes map[EventCode]Axis
+}
+
+// Description queries the device for its description.
+func (r *EventReader) Description() (*DeviceDescription, error) {
+	// See the comment in querySwitch about the kernel's bitfields.
+	if kernelByteOrder != binary.LittleEndian {
+		return nil, errors.New("non-little-endian unsupported")
+	}
+	var desc *DeviceDescription
+	err := r.control(func(fd int) error {
+		var err error
+		desc, err = describeDevice(fd)
+		return err
+	})
+	return desc, err
+}
+
+// describeDevice queries the input event device open as fd for its description.
+func describeDevice(fd int) (*DeviceDescription, error) {
+	name := make([]byte, uinputMaxNameLen)
+	// This corresponds to the EVIOCGNAME macro in input.h.
+	if err := ioctl(fd, ioc(iocRead, 'E', 0x06, uintptr(len(name))), uintptr(unsafe.Pointer(&name[0]))); err != nil {
+		return nil, errors.Wrap(err, "failed getting name")
+	}
+
+	var id [4]uint16
+	// This corresponds to the EVIOCGID macro in input.h.
+	if err := ioctl(fd, ior('E', 0x02, unsafe.Sizeof(id)), uintptr(unsafe.Pointer(&id))); err != nil {
+		return nil, errors.Wrap(err, "failed getting ID")
+	}
+
+	desc := &DeviceDescription{
+		Name:       string(bytes.TrimRight(name, "\x00")),
+		Bustype:    id[0],
+		Vendor:     id[1],
+		Product:    id[2],
+		Version:    id[3],
+		EventCodes: make(map[EventType]*big.Int),
+		Axes:       make(map[EventCode]Axis),
+	}
+
+	// This corresponds to the EVIOCGPROP macro in input.h.
+	if err := ioctl(fd, ior('E', 0x09, unsafe.Sizeof(desc.Props)), uintptr(unsafe.Pointer(&desc.Props))); err != nil {
+		return nil, errors.Wrap(err, "failed getting properties")
+	}
+	// This corresponds to the EVIOCGBIT macro in input.h with an event type of 0.
+	if err := ioctl(fd, ior('E', 0x20, unsafe.Sizeof(desc.EventTypes)), uintptr(unsafe.Pointer(&desc.EventTypes))); err != nil {
+		return nil, errors.Wrap(err, "failed getting event types")
+	}
+
+	for et := EventType(1); et <= EV_MAX; et++ {
+		if desc.EventTypes&(1<<uint(et)) == 0 {
+			continue
+		}
+		// KEY_MAX is the largest maximum code of all event types.
+		bits := make([]byte, (KEY_MAX+1)/8)
+		if err := ioctl(fd, ioc(iocRead, 'E', 0x20+uint(et), uintptr(len(bits))), uintptr(unsafe.Pointer(&bits[0]))); err != nil {
+			return nil, errors.Wrapf(err, "failed getting codes of event type %#x", et)
+		}
+		codes := bitsToBigInt(bits)
+		desc.EventCodes[et] = codes
+
+		if et != EV_ABS {
+			continue
+		}
+		for ec := EventCode(0); ec <= ABS_MAX; ec++ {
+			if codes.Bit(int(ec)) == 0 {
+				continue
+			}
+			var info absInfo
+			if err := ioctl(fd, evIOCGAbs(uint(ec)), uintptr(unsafe.Pointer(&info))); err != nil {
+				return nil, errors.Wrapf(err, "failed getting info of axis %#x", ec)
+			}
+			desc.Axes[ec] = Axis{
+				Maximum:    int32(info.maximum),
+				Minimum:    int32(info.minimum),
+				Fuzz:       int32(info.fuzz),
+				Flat:       int32(info.flat),
+				Resolution: int32(info.resolution),
+			}
+		}
+	}
+	return desc, nil
+}
+
+// bitsToBigInt converts a little-endian bitfield to a big.Int.
+func bitsToBigInt(bits []byte) *big.Int {
+	be := make([]byte, len(bits))
+	for i, b := range bits {
+		be[len(bits)-1-i] = b
+	}
+	return new(big.Int).SetBytes(be)
+}
+
+// bigIntToBits converts v to a little-endian bitfield of at least n bytes.
+func bigIntToBits(v *big.Int, n int) []byte {
+	be := v.Bytes()
+	if len(be) > n {
+		n = len(be)
+	}
+	bits := make([]byte, n)
+	for i, b := range be {
+		bits[len(be)-1-i] = b
+	}
+	return bits
+}
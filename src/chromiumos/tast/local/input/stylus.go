@@ -0,0 +1,360 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package input
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/local/coords"
+	"chromiumos/tast/testing"
+)
+
+// StylusTool is the tool reported by a stylus.
+type StylusTool int
+
+const (
+	// PenTool is the tip of the stylus.
+	PenTool StylusTool = iota
+	// EraserTool is the eraser end of the stylus.
+	EraserTool
+)
+
+// eventCode returns the BTN_TOOL_* code reporting the tool.
+func (t StylusTool) eventCode() EventCode {
+	if t == EraserTool {
+		return BTN_TOOL_RUBBER
+	}
+	return BTN_TOOL_PEN
+}
+
+// StylusState describes the state of a stylus in range of the screen.
+type StylusState struct {
+	// X and Y are the position of the stylus.
+	X, Y TouchCoord
+	// Pressure is the pressure of the stylus on the screen. The stylus touches the screen
+	// if it is positive, and hovers above it otherwise.
+	Pressure int32
+	// TiltX and TiltY are the tilt of the stylus in degrees, in [-MaxTilt(), MaxTilt()].
+	// Positive values tilt the top of the stylus towards the right and the bottom.
+	TiltX, TiltY int32
+	// Distance is the distance between the hovering stylus and the screen, in [0, MaxDistance()].
+	// It is ignored when the stylus touches the screen.
+	Distance int32
+	// Barrel is true if the barrel button of the stylus is pressed.
+	Barrel bool
+	// Tool is the tool of the stylus in use.
+	Tool StylusTool
+}
+
+// StylusEventWriter supports injecting events into a stylus device.
+type StylusEventWriter struct {
+	rw            *RawEventWriter
+	virt          *os.File // if non-nil, used to hold a virtual device open
+	dev           string   // path to underlying device in /dev/input
+	width, height TouchCoord
+	maxPressure   int32
+	maxTilt       int32
+	maxDistance   int32
+
+	inRange bool        // true if the stylus was reported in range of the screen
+	last    StylusState // last state sent while in range
+}
+
+var nextVirtStylusNum = 1 // appended to virtual stylus device name
+
+// VirtualStylus creates a virtual stylus device and returns an EventWriter that injects events into it.
+func VirtualStylus(ctx context.Context) (*StylusEventWriter, error) {
+	const (
+		busType = 0x3 // BUS_USB from input.h
+
+		// Device constants taken from the garaged stylus of a Chromebook tablet.
+		vendor  = 0x2d1f
+		product = 0x5143
+		version = 0x100
+
+		// Input characteristics.
+		props   = 1 << INPUT_PROP_DIRECT
+		evTypes = 1<<EV_KEY | 1<<EV_ABS
+
+		// Abs axis constants.
+		axisMaxX            = 25920
+		axisMaxY            = 17280
+		axisMaxPressure     = 2047
+		axisMaxTilt         = 90
+		axisMaxDistance     = 63
+		axisCoordResolution = 100
+		axisTiltResolution  = 57 // units per radian, i.e. degrees
+	)
+
+	// Include our PID in the device name to be extra careful in case an old bundle process hasn't exited.
+	name := fmt.Sprintf("Tast virtual stylus %d.%d", os.Getpid(), nextVirtStylusNum)
+	nextVirtStylusNum++
+	testing.ContextLogf(ctx, "Creating virtual stylus device %q", name)
+
+	sw := &StylusEventWriter{
+		width:       axisMaxX,
+		height:      axisMaxY,
+		maxPressure: axisMaxPressure,
+		maxTilt:     axisMaxTilt,
+		maxDistance: axisMaxDistance,
+	}
+	var err error
+	if sw.dev, sw.virt, err = createVirtual(name, devID{busType, vendor, product, version}, props, evTypes,
+		map[EventType]*big.Int{
+			EV_KEY: makeBigIntFromEventCodes([]EventCode{BTN_TOOL_PEN, BTN_TOOL_RUBBER, BTN_TOUCH, BTN_STYLUS}),
+			EV_ABS: makeBigIntFromEventCodes([]EventCode{ABS_X, ABS_Y, ABS_PRESSURE, ABS_DISTANCE, ABS_TILT_X, ABS_TILT_Y}),
+		}, map[EventCode]Axis{
+			ABS_X:        {axisMaxX, 0, 0, 0, axisCoordResolution},
+			ABS_Y:        {axisMaxY, 0, 0, 0, axisCoordResolution},
+			ABS_PRESSURE: {axisMaxPressure, 0, 0, 0, 0},
+			ABS_DISTANCE: {axisMaxDistance, 0, 0, 0, 0},
+			ABS_TILT_X:   {axisMaxTilt, -axisMaxTilt, 0, 0, axisTiltResolution},
+			ABS_TILT_Y:   {axisMaxTilt, -axisMaxTilt, 0, 0, axisTiltResolution},
+		}); err != nil {
+		return nil, err
+	}
+
+	// Sleep briefly to give Chrome and other processes time to see the new device.
+	// TODO(crbug.com/1015264): Remove the hard-coded sleep.
+	if err := testing.Sleep(ctx, 1*time.Second); err != nil {
+		sw.Close()
+		return nil, err
+	}
+	testing.ContextLog(ctx, "Using virtual stylus device ", sw.dev)
+
+	if sw.rw, err = Device(ctx, sw.dev); err != nil {
+		sw.Close()
+		return nil, err
+	}
+	return sw, nil
+}
+
+// Close closes the stylus device.
+func (sw *StylusEventWriter) Close() error {
+	var firstErr error
+	if sw.rw != nil {
+		firstErr = sw.rw.Close()
+	}
+	if sw.virt != nil {
+		if err := sw.virt.Close(); firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Device returns the path of the stylus device in /dev/input.
+func (sw *StylusEventWriter) Device() string {
+	return sw.dev
+}
+
+// Width returns the width of the stylus device.
+func (sw *StylusEventWriter) Width() TouchCoord {
+	return sw.width
+}
+
+// Height returns the height of the stylus device.
+func (sw *StylusEventWriter) Height() TouchCoord {
+	return sw.height
+}
+
+// MaxPressure returns the maximum pressure of the stylus device.
+func (sw *StylusEventWriter) MaxPressure() int32 {
+	return sw.maxPressure
+}
+
+// MaxTilt returns the maximum tilt in degrees of the stylus device.
+func (sw *StylusEventWriter) MaxTilt() int32 {
+	return sw.maxTilt
+}
+
+// MaxDistance returns the maximum hover distance of the stylus device.
+func (sw *StylusEventWriter) MaxDistance() int32 {
+	return sw.maxDistance
+}
+
+// NewTouchCoordConverter creates a new TouchCoordConverter instance for the
+// given size.
+func (sw *StylusEventWriter) NewTouchCoordConverter(size coords.Size) *TouchCoordConverter {
+	return &TouchCoordConverter{
+		ScaleX: float64(sw.Width()) / float64(size.Width),
+		ScaleY: float64(sw.Height()) / float64(size.Height),
+	}
+}
+
+// Send injects a frame of events bringing the stylus to state s. If the stylus is not in
+// range of the screen yet, it enters range with the tool of s. If the tool of s differs
+// from the tool in use, the stylus leaves range first, as when a stylus is flipped over.
+func (sw *StylusEventWriter) Send(s StylusState) error {
+	if s.X < 0 || s.X > sw.width || s.Y < 0 || s.Y > sw.height {
+		return errors.Errorf("position (%d, %d) is outside of [0, %d]x[0, %d]", s.X, s.Y, sw.width, sw.height)
+	}
+	if s.Pressure < 0 || s.Pressure > sw.maxPressure {
+		return errors.Errorf("pressure %d is outside of [0, %d]", s.Pressure, sw.maxPressure)
+	}
+	if s.TiltX < -sw.maxTilt || s.TiltX > sw.maxTilt || s.TiltY < -sw.maxTilt || s.TiltY > sw.maxTilt {
+		return errors.Errorf("tilt (%d, %d) is outside of [-%d, %d]", s.TiltX, s.TiltY, sw.maxTilt, sw.maxTilt)
+	}
+	if s.Distance < 0 || s.Distance > sw.maxDistance {
+		return errors.Errorf("distance %d is outside of [0, %d]", s.Distance, sw.maxDistance)
+	}
+
+	if sw.inRange && sw.last.Tool != s.Tool {
+		if err := sw.Lift(); err != nil {
+			return err
+		}
+	}
+
+	touching := s.Pressure > 0
+	distance := s.Distance
+	if touching {
+		distance = 0
+	}
+	for _, entry := range []kernelEventEntry{
+		{EV_ABS, ABS_X, int32(s.X)},
+		{EV_ABS, ABS_Y, int32(s.Y)},
+		{EV_ABS, ABS_PRESSURE, s.Pressure},
+		{EV_ABS, ABS_DISTANCE, distance},
+		{EV_ABS, ABS_TILT_X, s.TiltX},
+		{EV_ABS, ABS_TILT_Y, s.TiltY},
+	} {
+		if err := sw.rw.Event(entry.et, entry.ec, entry.val); err != nil {
+			return err
+		}
+	}
+
+	if !sw.inRange {
+		if err := sw.rw.Event(EV_KEY, s.Tool.eventCode(), 1); err != nil {
+			return err
+		}
+	}
+	if !sw.inRange || touching != (sw.last.Pressure > 0) {
+		if err := sw.rw.Event(EV_KEY, BTN_TOUCH, boolToValue(touching)); err != nil {
+			return err
+		}
+	}
+	if !sw.inRange || s.Barrel != sw.last.Barrel {
+		if err := sw.rw.Event(EV_KEY, BTN_STYLUS, boolToValue(s.Barrel)); err != nil {
+			return err
+		}
+	}
+	if err := sw.rw.Sync(); err != nil {
+		return err
+	}
+
+	sw.inRange = true
+	sw.last = s
+	return nil
+}
+
+// Lift injects a frame of events reporting that the stylus left range of the screen.
+// It does nothing if the stylus is not in range.
+func (sw *StylusEventWriter) Lift() error {
+	if !sw.inRange {
+		return nil
+	}
+	for _, entry := range []kernelEventEntry{
+		{EV_ABS, ABS_PRESSURE, 0},
+		{EV_ABS, ABS_DISTANCE, 0},
+		{EV_KEY, BTN_TOUCH, 0},
+		{EV_KEY, BTN_STYLUS, 0},
+		{EV_KEY, sw.last.Tool.eventCode(), 0},
+	} {
+		if err := sw.rw.Event(entry.et, entry.ec, entry.val); err != nil {
+			return err
+		}
+	}
+	if err := sw.rw.Sync(); err != nil {
+		return err
+	}
+	sw.inRange = false
+	return nil
+}
+
+// boolToValue returns the value of a key event reporting a key as pressed or released.
+func boolToValue(pressed bool) int32 {
+	if pressed {
+		return 1
+	}
+	return 0
+}
+
+// Hover injects events hovering the stylus pen tool above location l in screen coordinates.
+// tcc is used to convert l to the coordinates of the stylus device.
+func (sw *StylusEventWriter) Hover(tcc *TouchCoordConverter, l coords.Point) error {
+	x, y := tcc.ConvertLocation(l)
+	return sw.Send(StylusState{X: x, Y: y, Distance: sw.maxDistance / 2})
+}
+
+// Tap injects events tapping the stylus pen tool at location l in screen coordinates,
+// using half of the maximum pressure. The stylus leaves range of the screen afterwards.
+func (sw *StylusEventWriter) Tap(ctx context.Context, tcc *TouchCoordConverter, l coords.Point) error {
+	return sw.Stroke(ctx, tcc, []coords.Point{l}, sw.maxPressure/2, 0)
+}
+
+// Stroke injects events drawing a stroke with the stylus pen tool through points in screen
+// coordinates, at a constant speed along the stroke and with the given pressure. tcc is used
+// to convert points to the coordinates of the stylus device. The stylus hovers above the first
+// point, touches the screen, moves to the last point during t, and leaves range of the screen.
+// If t is less than 5 milliseconds, 5 milliseconds will be used instead.
+func (sw *StylusEventWriter) Stroke(ctx context.Context, tcc *TouchCoordConverter, points []coords.Point, pressure int32, t time.Duration) error {
+	if len(points) == 0 {
+		return errors.New("no points in stroke")
+	}
+	if pressure <= 0 {
+		return errors.Errorf("non-positive pressure %d for stroke", pressure)
+	}
+
+	// Compute the positions and the cumulative length of the stroke at each point in stylus coordinates.
+	xs := make([]float64, len(points))
+	ys := make([]float64, len(points))
+	lengths := make([]float64, len(points))
+	for i, p := range points {
+		x, y := tcc.ConvertLocation(p)
+		xs[i], ys[i] = float64(x), float64(y)
+		if i > 0 {
+			lengths[i] = lengths[i-1] + math.Hypot(xs[i]-xs[i-1], ys[i]-ys[i-1])
+		}
+	}
+	total := lengths[len(lengths)-1]
+
+	if err := sw.Send(StylusState{X: TouchCoord(xs[0]), Y: TouchCoord(ys[0]), Distance: sw.maxDistance / 2}); err != nil {
+		return err
+	}
+
+	steps := int(t/touchFrequency) + 1
+	// A minimum of two steps are needed. One for the start point and another one for the end point.
+	if steps < 2 {
+		steps = 2
+	}
+	seg := 0
+	for i := 0; i < steps; i++ {
+		// Find the segment containing the position at the current length of the stroke.
+		l := total * float64(i) / float64(steps-1)
+		for seg < len(points)-2 && lengths[seg+1] < l {
+			seg++
+		}
+		x, y := xs[seg], ys[seg]
+		if seg+1 < len(points) && lengths[seg+1] > lengths[seg] {
+			f := (l - lengths[seg]) / (lengths[seg+1] - lengths[seg])
+			x += f * (xs[seg+1] - xs[seg])
+			y += f * (ys[seg+1] - ys[seg])
+		}
+		if err := sw.Send(StylusState{X: TouchCoord(math.Round(x)), Y: TouchCoord(math.Round(y)), Pressure: pressure}); err != nil {
+			return err
+		}
+
+		if err := testing.Sleep(ctx, touchFrequency); err != nil {
+			return errors.Wrap(err, "timeout while doing sleep")
+		}
+	}
+	return sw.Lift()
+}
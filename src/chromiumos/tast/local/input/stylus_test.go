@@ -0,0 +1,165 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package input
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"chromiumos/tast/local/coords"
+)
+
+// newTestStylus returns a StylusEventWriter writing to b.
+func newTestStylus(b *testBuffer, now time.Time) *StylusEventWriter {
+	return &StylusEventWriter{
+		rw:          &RawEventWriter{b, func() time.Time { return now }},
+		width:       1000,
+		height:      1000,
+		maxPressure: 100,
+		maxTilt:     90,
+		maxDistance: 60,
+	}
+}
+
+func TestStylusSend(t *testing.T) {
+	b := testBuffer{}
+	now := time.Unix(5, 0)
+	sw := newTestStylus(&b, now)
+
+	for _, s := range []StylusState{
+		{X: 100, Y: 200, Distance: 10},
+		{X: 110, Y: 200, Pressure: 50, TiltX: -30, Barrel: true},
+		{X: 110, Y: 200, Tool: EraserTool, Pressure: 20},
+	} {
+		if err := sw.Send(s); err != nil {
+			t.Fatalf("Send(%+v) failed: %v", s, err)
+		}
+	}
+	if err := sw.Lift(); err != nil {
+		t.Fatal("Lift failed: ", err)
+	}
+
+	written, err := readAllEvents(bytes.NewReader(b.buf.Bytes()))
+	if err != nil {
+		t.Fatal("Failed to read events: ", err)
+	}
+
+	tv := syscall.NsecToTimeval(now.UnixNano())
+	ev := func(et EventType, ec EventCode, val int32) string {
+		return eventString(tv, uint16(et), uint16(ec), val)
+	}
+	syn := ev(EV_SYN, SYN_REPORT, 0)
+	lift := func(tool EventCode) []string {
+		return []string{
+			ev(EV_ABS, ABS_PRESSURE, 0),
+			ev(EV_ABS, ABS_DISTANCE, 0),
+			ev(EV_KEY, BTN_TOUCH, 0),
+			ev(EV_KEY, BTN_STYLUS, 0),
+			ev(EV_KEY, tool, 0),
+			syn,
+		}
+	}
+	var expected []string
+	expected = append(expected,
+		// Hovering pen enters range.
+		ev(EV_ABS, ABS_X, 100),
+		ev(EV_ABS, ABS_Y, 200),
+		ev(EV_ABS, ABS_PRESSURE, 0),
+		ev(EV_ABS, ABS_DISTANCE, 10),
+		ev(EV_ABS, ABS_TILT_X, 0),
+		ev(EV_ABS, ABS_TILT_Y, 0),
+		ev(EV_KEY, BTN_TOOL_PEN, 1),
+		ev(EV_KEY, BTN_TOUCH, 0),
+		ev(EV_KEY, BTN_STYLUS, 0),
+		syn,
+		// Pen touches the screen with the barrel button pressed.
+		ev(EV_ABS, ABS_X, 110),
+		ev(EV_ABS, ABS_Y, 200),
+		ev(EV_ABS, ABS_PRESSURE, 50),
+		ev(EV_ABS, ABS_DISTANCE, 0),
+		ev(EV_ABS, ABS_TILT_X, -30),
+		ev(EV_ABS, ABS_TILT_Y, 0),
+		ev(EV_KEY, BTN_TOUCH, 1),
+		ev(EV_KEY, BTN_STYLUS, 1),
+		syn,
+	)
+	// Switching to the eraser leaves range first.
+	expected = append(expected, lift(BTN_TOOL_PEN)...)
+	expected = append(expected,
+		ev(EV_ABS, ABS_X, 110),
+		ev(EV_ABS, ABS_Y, 200),
+		ev(EV_ABS, ABS_PRESSURE, 20),
+		ev(EV_ABS, ABS_DISTANCE, 0),
+		ev(EV_ABS, ABS_TILT_X, 0),
+		ev(EV_ABS, ABS_TILT_Y, 0),
+		ev(EV_KEY, BTN_TOOL_RUBBER, 1),
+		ev(EV_KEY, BTN_TOUCH, 1),
+		ev(EV_KEY, BTN_STYLUS, 0),
+		syn,
+	)
+	expected = append(expected, lift(BTN_TOOL_RUBBER)...)
+
+	if !reflect.DeepEqual(written, expected) {
+		t.Errorf("Wrote %v; want %v", written, expected)
+	}
+}
+
+func TestStylusSendErrors(t *testing.T) {
+	sw := newTestStylus(&testBuffer{}, time.Now())
+	for _, s := range []StylusState{
+		{X: 1001},
+		{Y: -1},
+		{Pressure: 101},
+		{TiltY: -91},
+		{Distance: 61},
+	} {
+		if err := sw.Send(s); err == nil {
+			t.Errorf("Send(%+v) unexpectedly succeeded", s)
+		}
+	}
+}
+
+func TestStylusStroke(t *testing.T) {
+	b := testBuffer{}
+	sw := newTestStylus(&b, time.Unix(5, 0))
+	tcc := sw.NewTouchCoordConverter(coords.Size{Width: 100, Height: 100})
+
+	// The stroke is 300 units long, so each of the 4 steps moves by 100 units.
+	points := []coords.Point{{X: 10, Y: 10}, {X: 30, Y: 10}, {X: 30, Y: 20}}
+	if err := sw.Stroke(context.Background(), tcc, points, 40, 3*touchFrequency); err != nil {
+		t.Fatal("Stroke failed: ", err)
+	}
+
+	r := bytes.NewReader(b.buf.Bytes())
+	var positions []TouchCoord
+	var pressures []int32
+	for {
+		ev, err := readInputEvent(r)
+		if err != nil {
+			break
+		}
+		switch {
+		case ev.Type == EV_ABS && ev.Code == ABS_X:
+			positions = append(positions, TouchCoord(ev.Value))
+		case ev.Type == EV_ABS && ev.Code == ABS_Y:
+			positions = append(positions, TouchCoord(ev.Value))
+		case ev.Type == EV_ABS && ev.Code == ABS_PRESSURE:
+			pressures = append(pressures, ev.Value)
+		}
+	}
+	if want := []TouchCoord{100, 100, 100, 100, 200, 100, 300, 100, 300, 200}; !reflect.DeepEqual(positions, want) {
+		t.Errorf("Stroke moved through %v; want %v", positions, want)
+	}
+	if want := []int32{0, 40, 40, 40, 40, 0}; !reflect.DeepEqual(pressures, want) {
+		t.Errorf("Stroke used pressures %v; want %v", pressures, want)
+	}
+	if sw.inRange {
+		t.Error("Stylus still in range after Stroke")
+	}
+}
@@ -0,0 +1,631 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uhid
+
+import (
+	"fmt"
+
+	"chromiumos/tast/errors"
+)
+
+// The item types and tags below are taken from section 6.2.2 of the
+// Device Class Definition for HID 1.11.
+const (
+	itemTypeMain   = 0
+	itemTypeGlobal = 1
+	itemTypeLocal  = 2
+
+	mainTagInput         = 0x8
+	mainTagOutput        = 0x9
+	mainTagCollection    = 0xa
+	mainTagFeature       = 0xb
+	mainTagEndCollection = 0xc
+
+	globalTagUsagePage       = 0x0
+	globalTagLogicalMinimum  = 0x1
+	globalTagLogicalMaximum  = 0x2
+	globalTagPhysicalMinimum = 0x3
+	globalTagPhysicalMaximum = 0x4
+	globalTagUnitExponent    = 0x5
+	globalTagUnit            = 0x6
+	globalTagReportSize      = 0x7
+	globalTagReportID        = 0x8
+	globalTagReportCount     = 0x9
+	globalTagPush            = 0xa
+	globalTagPop             = 0xb
+
+	localTagUsage        = 0x0
+	localTagUsageMinimum = 0x1
+	localTagUsageMaximum = 0x2
+
+	// longItemPrefix introduces a long item, which is skipped.
+	longItemPrefix = 0xfe
+)
+
+// ReportType replicates enum uhid_report_type in uhid.h. It is the type
+// of a report declared by a main item of a report descriptor.
+type ReportType uint8
+
+const (
+	// FeatureReport is a report declared by a Feature main item.
+	FeatureReport ReportType = 0
+	// OutputReport is a report declared by an Output main item.
+	OutputReport ReportType = 1
+	// InputReport is a report declared by an Input main item.
+	InputReport ReportType = 2
+)
+
+// String returns the string representation of ReportType.
+func (t ReportType) String() string {
+	switch t {
+	case FeatureReport:
+		return "Feature"
+	case OutputReport:
+		return "Output"
+	case InputReport:
+		return "Input"
+	}
+	return fmt.Sprintf("ReportType(%d)", uint8(t))
+}
+
+// MainItemFlags is the data of an Input, Output or Feature main item.
+// The zero value means Data, Array and Absolute.
+type MainItemFlags uint32
+
+// The flags below are defined in section 6.2.2.5 of the Device Class
+// Definition for HID 1.11.
+const (
+	Constant      MainItemFlags = 1 << 0
+	Variable      MainItemFlags = 1 << 1
+	Relative      MainItemFlags = 1 << 2
+	Wrap          MainItemFlags = 1 << 3
+	NonLinear     MainItemFlags = 1 << 4
+	NoPreferred   MainItemFlags = 1 << 5
+	NullState     MainItemFlags = 1 << 6
+	Volatile      MainItemFlags = 1 << 7
+	BufferedBytes MainItemFlags = 1 << 8
+)
+
+// CollectionType is the data of a Collection main item.
+type CollectionType uint8
+
+// The collection types below are defined in section 6.2.2.6 of the
+// Device Class Definition for HID 1.11.
+const (
+	PhysicalCollection    CollectionType = 0x00
+	ApplicationCollection CollectionType = 0x01
+	LogicalCollection     CollectionType = 0x02
+)
+
+// UsagePage is a usage page as defined in the HID Usage Tables.
+type UsagePage uint16
+
+// Usage pages used by the devices emulated in tests.
+const (
+	GenericDesktopPage UsagePage = 0x01
+	SimulationPage     UsagePage = 0x02
+	KeyboardPage       UsagePage = 0x07
+	LEDPage            UsagePage = 0x08
+	ButtonPage         UsagePage = 0x09
+	ConsumerPage       UsagePage = 0x0c
+	DigitizerPage      UsagePage = 0x0d
+)
+
+// Usages of the Generic Desktop page.
+const (
+	UsagePointer   uint16 = 0x01
+	UsageMouse     uint16 = 0x02
+	UsageJoystick  uint16 = 0x04
+	UsageGamepad   uint16 = 0x05
+	UsageKeyboard  uint16 = 0x06
+	UsageX         uint16 = 0x30
+	UsageY         uint16 = 0x31
+	UsageZ         uint16 = 0x32
+	UsageRx        uint16 = 0x33
+	UsageRy        uint16 = 0x34
+	UsageRz        uint16 = 0x35
+	UsageSlider    uint16 = 0x36
+	UsageDial      uint16 = 0x37
+	UsageWheel     uint16 = 0x38
+	UsageHatSwitch uint16 = 0x39
+)
+
+// Usages of the Digitizer page.
+const (
+	UsageDigitizer         uint16 = 0x01
+	UsagePen               uint16 = 0x02
+	UsageTouchScreen       uint16 = 0x04
+	UsageTouchPad          uint16 = 0x05
+	UsageStylus            uint16 = 0x20
+	UsageFinger            uint16 = 0x22
+	UsageTipPressure       uint16 = 0x30
+	UsageInRange           uint16 = 0x32
+	UsageInvert            uint16 = 0x3c
+	UsageXTilt             uint16 = 0x3d
+	UsageYTilt             uint16 = 0x3e
+	UsageTipSwitch         uint16 = 0x42
+	UsageBarrelSwitch      uint16 = 0x44
+	UsageEraser            uint16 = 0x45
+	UsageConfidence        uint16 = 0x47
+	UsageWidth             uint16 = 0x48
+	UsageHeight            uint16 = 0x49
+	UsageContactIdentifier uint16 = 0x51
+	UsageContactCount      uint16 = 0x54
+)
+
+// usageNames contains the names given to fields of known usages.
+var usageNames = map[UsagePage]map[uint16]string{
+	GenericDesktopPage: {
+		UsageX:         "X",
+		UsageY:         "Y",
+		UsageZ:         "Z",
+		UsageRx:        "Rx",
+		UsageRy:        "Ry",
+		UsageRz:        "Rz",
+		UsageSlider:    "Slider",
+		UsageDial:      "Dial",
+		UsageWheel:     "Wheel",
+		UsageHatSwitch: "HatSwitch",
+	},
+	DigitizerPage: {
+		UsageTipPressure:       "TipPressure",
+		UsageInRange:           "InRange",
+		UsageInvert:            "Invert",
+		UsageXTilt:             "XTilt",
+		UsageYTilt:             "YTilt",
+		UsageTipSwitch:         "TipSwitch",
+		UsageBarrelSwitch:      "BarrelSwitch",
+		UsageEraser:            "Eraser",
+		UsageConfidence:        "Confidence",
+		UsageWidth:             "Width",
+		UsageHeight:            "Height",
+		UsageContactIdentifier: "ContactIdentifier",
+		UsageContactCount:      "ContactCount",
+	},
+}
+
+// pageNames contains the names of known usage pages.
+var pageNames = map[UsagePage]string{
+	GenericDesktopPage: "GenericDesktop",
+	SimulationPage:     "Simulation",
+	KeyboardPage:       "Keyboard",
+	LEDPage:            "LED",
+	ButtonPage:         "Button",
+	ConsumerPage:       "Consumer",
+	DigitizerPage:      "Digitizer",
+}
+
+// pageName returns the name of page p.
+func pageName(p UsagePage) string {
+	if name, ok := pageNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Page%04X", uint16(p))
+}
+
+// usageName returns the name of usage u in page p. Buttons are named
+// after their number, e.g. "Button1", and unknown usages after their
+// page and number, e.g. "Consumer00E9".
+func usageName(p UsagePage, u uint16) string {
+	if name, ok := usageNames[p][u]; ok {
+		return name
+	}
+	if p == ButtonPage {
+		return fmt.Sprintf("Button%d", u)
+	}
+	return fmt.Sprintf("%s%04X", pageName(p), u)
+}
+
+// DescriptorBuilder builds a HID report descriptor item by item. Its
+// methods return the builder itself so that calls can be chained:
+//
+//	desc := uhid.NewDescriptorBuilder().
+//		UsagePage(uhid.GenericDesktopPage).
+//		Usage(uhid.UsageMouse).
+//		Collection(uhid.ApplicationCollection).
+//		...
+//		EndCollection().
+//		String()
+type DescriptorBuilder struct {
+	buf []byte
+}
+
+// NewDescriptorBuilder returns an empty DescriptorBuilder.
+func NewDescriptorBuilder() *DescriptorBuilder {
+	return &DescriptorBuilder{}
+}
+
+// Bytes returns the report descriptor built so far.
+func (b *DescriptorBuilder) Bytes() []byte {
+	return append([]byte(nil), b.buf...)
+}
+
+// String returns the report descriptor built so far as a string, as
+// expected by NewDevice.
+func (b *DescriptorBuilder) String() string {
+	return string(b.buf)
+}
+
+// item appends a short item with the given type, tag and data. size is
+// the number of bytes of data, which must be 0, 1, 2 or 4.
+func (b *DescriptorBuilder) item(typ, tag byte, data uint32, size int) *DescriptorBuilder {
+	sizeCode := byte(size)
+	if size == 4 {
+		sizeCode = 3
+	}
+	b.buf = append(b.buf, tag<<4|typ<<2|sizeCode)
+	for i := 0; i < size; i++ {
+		b.buf = append(b.buf, byte(data>>(8*i)))
+	}
+	return b
+}
+
+// unsignedItem appends a short item whose data is the unsigned value v
+// encoded in as few bytes as possible.
+func (b *DescriptorBuilder) unsignedItem(typ, tag byte, v uint32) *DescriptorBuilder {
+	switch {
+	case v <= 0xff:
+		return b.item(typ, tag, v, 1)
+	case v <= 0xffff:
+		return b.item(typ, tag, v, 2)
+	}
+	return b.item(typ, tag, v, 4)
+}
+
+// signedItem appends a short item whose data is the signed value v
+// encoded in as few bytes as possible.
+func (b *DescriptorBuilder) signedItem(typ, tag byte, v int32) *DescriptorBuilder {
+	switch {
+	case -0x80 <= v && v <= 0x7f:
+		return b.item(typ, tag, uint32(v), 1)
+	case -0x8000 <= v && v <= 0x7fff:
+		return b.item(typ, tag, uint32(v), 2)
+	}
+	return b.item(typ, tag, uint32(v), 4)
+}
+
+// UsagePage appends a Usage Page global item.
+func (b *DescriptorBuilder) UsagePage(p UsagePage) *DescriptorBuilder {
+	return b.unsignedItem(itemTypeGlobal, globalTagUsagePage, uint32(p))
+}
+
+// LogicalMinimum appends a Logical Minimum global item.
+func (b *DescriptorBuilder) LogicalMinimum(v int32) *DescriptorBuilder {
+	return b.signedItem(itemTypeGlobal, globalTagLogicalMinimum, v)
+}
+
+// LogicalMaximum appends a Logical Maximum global item.
+func (b *DescriptorBuilder) LogicalMaximum(v int32) *DescriptorBuilder {
+	return b.signedItem(itemTypeGlobal, globalTagLogicalMaximum, v)
+}
+
+// PhysicalMinimum appends a Physical Minimum global item.
+func (b *DescriptorBuilder) PhysicalMinimum(v int32) *DescriptorBuilder {
+	return b.signedItem(itemTypeGlobal, globalTagPhysicalMinimum, v)
+}
+
+// PhysicalMaximum appends a Physical Maximum global item.
+func (b *DescriptorBuilder) PhysicalMaximum(v int32) *DescriptorBuilder {
+	return b.signedItem(itemTypeGlobal, globalTagPhysicalMaximum, v)
+}
+
+// UnitExponent appends a Unit Exponent global item.
+func (b *DescriptorBuilder) UnitExponent(v int32) *DescriptorBuilder {
+	return b.signedItem(itemTypeGlobal, globalTagUnitExponent, v)
+}
+
+// Unit appends a Unit global item.
+func (b *DescriptorBuilder) Unit(v uint32) *DescriptorBuilder {
+	return b.unsignedItem(itemTypeGlobal, globalTagUnit, v)
+}
+
+// ReportSize appends a Report Size global item. bits is the size of
+// each of the following fields.
+func (b *DescriptorBuilder) ReportSize(bits uint32) *DescriptorBuilder {
+	return b.unsignedItem(itemTypeGlobal, globalTagReportSize, bits)
+}
+
+// ReportID appends a Report ID global item.
+func (b *DescriptorBuilder) ReportID(id uint8) *DescriptorBuilder {
+	return b.unsignedItem(itemTypeGlobal, globalTagReportID, uint32(id))
+}
+
+// ReportCount appends a Report Count global item. n is the number of
+// the following fields.
+func (b *DescriptorBuilder) ReportCount(n uint32) *DescriptorBuilder {
+	return b.unsignedItem(itemTypeGlobal, globalTagReportCount, n)
+}
+
+// Push appends a Push global item.
+func (b *DescriptorBuilder) Push() *DescriptorBuilder {
+	return b.item(itemTypeGlobal, globalTagPush, 0, 0)
+}
+
+// Pop appends a Pop global item.
+func (b *DescriptorBuilder) Pop() *DescriptorBuilder {
+	return b.item(itemTypeGlobal, globalTagPop, 0, 0)
+}
+
+// Usage appends a Usage local item. The usage belongs to the current
+// usage page.
+func (b *DescriptorBuilder) Usage(u uint16) *DescriptorBuilder {
+	return b.unsignedItem(itemTypeLocal, localTagUsage, uint32(u))
+}
+
+// UsageMinimum appends a Usage Minimum local item.
+func (b *DescriptorBuilder) UsageMinimum(u uint16) *DescriptorBuilder {
+	return b.unsignedItem(itemTypeLocal, localTagUsageMinimum, uint32(u))
+}
+
+// UsageMaximum appends a Usage Maximum local item.
+func (b *DescriptorBuilder) UsageMaximum(u uint16) *DescriptorBuilder {
+	return b.unsignedItem(itemTypeLocal, localTagUsageMaximum, uint32(u))
+}
+
+// Collection appends a Collection main item.
+func (b *DescriptorBuilder) Collection(t CollectionType) *DescriptorBuilder {
+	return b.item(itemTypeMain, mainTagCollection, uint32(t), 1)
+}
+
+// EndCollection appends an End Collection main item.
+func (b *DescriptorBuilder) EndCollection() *DescriptorBuilder {
+	return b.item(itemTypeMain, mainTagEndCollection, 0, 0)
+}
+
+// Input appends an Input main item.
+func (b *DescriptorBuilder) Input(flags MainItemFlags) *DescriptorBuilder {
+	return b.unsignedItem(itemTypeMain, mainTagInput, uint32(flags))
+}
+
+// Output appends an Output main item.
+func (b *DescriptorBuilder) Output(flags MainItemFlags) *DescriptorBuilder {
+	return b.unsignedItem(itemTypeMain, mainTagOutput, uint32(flags))
+}
+
+// Feature appends a Feature main item.
+func (b *DescriptorBuilder) Feature(flags MainItemFlags) *DescriptorBuilder {
+	return b.unsignedItem(itemTypeMain, mainTagFeature, uint32(flags))
+}
+
+// Field is a single value in a report, as declared by an Input, Output
+// or Feature main item of a report descriptor.
+type Field struct {
+	// Name identifies the field in EncodeReport and DecodeReport. It
+	// is derived from the usage, e.g. "X" or "Button1". If several
+	// fields of a report have the same usage, "#2", "#3" and so on are
+	// appended to the names of the later ones. Elements of arrays are
+	// named after the usage page and their index, e.g. "Keyboard[0]".
+	Name      string
+	Type      ReportType
+	ReportID  uint8
+	UsagePage UsagePage
+	// Usage is the usage of the field. For arrays, it is the usage
+	// reported by the value LogicalMinimum.
+	Usage uint16
+	// BitOffset is the position of the field in the report, not
+	// counting the report ID.
+	BitOffset int
+	BitSize   int
+
+	LogicalMinimum int32
+	LogicalMaximum int32
+	Flags          MainItemFlags
+}
+
+// reportKey identifies a report in a report descriptor.
+type reportKey struct {
+	typ ReportType
+	id  uint8
+}
+
+// ReportDescriptor is the field layout of the reports declared by a
+// report descriptor.
+type ReportDescriptor struct {
+	// Fields contains all non-constant fields in the order they are
+	// declared.
+	Fields []Field
+	// UsesReportIDs is true if reports are prefixed with their ID.
+	UsesReportIDs bool
+	// bits contains the size of each report in bits.
+	bits map[reportKey]int
+}
+
+// globalState is the state of global items while parsing.
+type globalState struct {
+	usagePage      UsagePage
+	logicalMinimum int32
+	logicalMaximum int32
+	reportSize     int
+	reportID       uint8
+	reportCount    int
+}
+
+// ParseDescriptor parses the report descriptor in data and returns the
+// layout of the reports declared in it.
+func ParseDescriptor(data []byte) (*ReportDescriptor, error) {
+	rd := &ReportDescriptor{bits: make(map[reportKey]int)}
+	var global globalState
+	var stack []globalState
+	var usages []uint32
+	var usageMin, usageMax uint32
+	hasUsageMin, hasUsageMax := false, false
+	depth := 0
+	names := make(map[reportKey]map[string]int)
+
+	for i := 0; i < len(data); {
+		prefix := data[i]
+		if prefix == longItemPrefix {
+			if i+1 >= len(data) {
+				return nil, errors.Errorf("truncated long item at byte %d", i)
+			}
+			i += 3 + int(data[i+1])
+			continue
+		}
+		size := int(prefix & 0x3)
+		if size == 3 {
+			size = 4
+		}
+		typ, tag := (prefix>>2)&0x3, prefix>>4
+		if i+1+size > len(data) {
+			return nil, errors.Errorf("truncated item 0x%02x at byte %d", prefix, i)
+		}
+		var udata uint32
+		for j := 0; j < size; j++ {
+			udata |= uint32(data[i+1+j]) << (8 * j)
+		}
+		// sdata is the data interpreted as a signed value.
+		sdata := int32(udata)
+		if size > 0 && size < 4 && udata&(1<<(8*size-1)) != 0 {
+			sdata = int32(udata | ^uint32(0)<<(8*size))
+		}
+		offset := i
+		i += 1 + size
+
+		switch typ {
+		case itemTypeMain:
+			var rt ReportType
+			switch tag {
+			case mainTagInput:
+				rt = InputReport
+			case mainTagOutput:
+				rt = OutputReport
+			case mainTagFeature:
+				rt = FeatureReport
+			case mainTagCollection:
+				depth++
+			case mainTagEndCollection:
+				if depth == 0 {
+					return nil, errors.Errorf("unbalanced End Collection at byte %d", offset)
+				}
+				depth--
+			default:
+				return nil, errors.Errorf("unknown main item 0x%02x at byte %d", prefix, offset)
+			}
+			if tag == mainTagInput || tag == mainTagOutput || tag == mainTagFeature {
+				key := reportKey{rt, global.reportID}
+				if names[key] == nil {
+					names[key] = make(map[string]int)
+				}
+				all := append([]uint32(nil), usages...)
+				if hasUsageMin && hasUsageMax {
+					for u := usageMin; u <= usageMax && len(all) < global.reportCount; u++ {
+						all = append(all, u)
+					}
+				}
+				// Array fields report usages relative to the first one.
+				base := uint32(global.usagePage) << 16
+				if hasUsageMin {
+					base = usageMin
+				} else if len(usages) > 0 {
+					base = usages[0]
+				}
+				rd.addFields(key, global, MainItemFlags(udata), all, base, names[key])
+			}
+			usages = nil
+			hasUsageMin, hasUsageMax = false, false
+		case itemTypeGlobal:
+			switch tag {
+			case globalTagUsagePage:
+				global.usagePage = UsagePage(udata)
+			case globalTagLogicalMinimum:
+				global.logicalMinimum = sdata
+			case globalTagLogicalMaximum:
+				// As in the kernel, the maximum is unsigned unless the
+				// minimum is negative, e.g. 0xff is 255 after a minimum of 0.
+				if global.logicalMinimum < 0 {
+					global.logicalMaximum = sdata
+				} else {
+					global.logicalMaximum = int32(udata)
+				}
+			case globalTagReportSize:
+				global.reportSize = int(udata)
+			case globalTagReportID:
+				if udata == 0 {
+					return nil, errors.Errorf("invalid report ID 0 at byte %d", offset)
+				}
+				global.reportID = uint8(udata)
+				rd.UsesReportIDs = true
+			case globalTagReportCount:
+				global.reportCount = int(udata)
+			case globalTagPush:
+				stack = append(stack, global)
+			case globalTagPop:
+				if len(stack) == 0 {
+					return nil, errors.Errorf("unbalanced Pop at byte %d", offset)
+				}
+				global = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case itemTypeLocal:
+			// Usages of 4 bytes contain their usage page, and others
+			// belong to the current usage page.
+			if size < 4 {
+				udata |= uint32(global.usagePage) << 16
+			}
+			switch tag {
+			case localTagUsage:
+				usages = append(usages, udata)
+			case localTagUsageMinimum:
+				usageMin, hasUsageMin = udata, true
+			case localTagUsageMaximum:
+				usageMax, hasUsageMax = udata, true
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errors.Errorf("%d collections are not closed", depth)
+	}
+	return rd, nil
+}
+
+// addFields adds the fields declared by a main item with the given
+// flags to the report identified by key. usages are the usages to
+// assign to the fields in order, each including its usage page in the
+// upper 16 bits. arrayBase is the usage of array fields. names counts
+// the fields of the report by name.
+func (rd *ReportDescriptor) addFields(key reportKey, g globalState, flags MainItemFlags, usages []uint32, arrayBase uint32, names map[string]int) {
+	for i := 0; i < g.reportCount; i++ {
+		offset := rd.bits[key]
+		rd.bits[key] += g.reportSize
+		if flags&Constant != 0 {
+			continue
+		}
+
+		var usage uint32
+		switch {
+		case flags&Variable == 0:
+			usage = arrayBase
+		case i < len(usages):
+			usage = usages[i]
+		case len(usages) > 0:
+			usage = usages[len(usages)-1]
+		}
+		page, id := UsagePage(usage>>16), uint16(usage)
+
+		var name string
+		if flags&Variable == 0 {
+			name = fmt.Sprintf("%s[%d]", pageName(page), i)
+		} else {
+			name = usageName(page, id)
+		}
+		names[name]++
+		if n := names[name]; n > 1 {
+			name = fmt.Sprintf("%s#%d", name, n)
+		}
+
+		rd.Fields = append(rd.Fields, Field{
+			Name:           name,
+			Type:           key.typ,
+			ReportID:       key.id,
+			UsagePage:      page,
+			Usage:          id,
+			BitOffset:      offset,
+			BitSize:        g.reportSize,
+			LogicalMinimum: g.logicalMinimum,
+			LogicalMaximum: g.logicalMaximum,
+			Flags:          flags,
+		})
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uhid
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// mouseDescriptor returns the descriptor of a mouse with three buttons
+// and relative X and Y axes, whose input report has ID 2, along with a
+// LED feature report with ID 3.
+func mouseDescriptor() *DescriptorBuilder {
+	return NewDescriptorBuilder().
+		UsagePage(GenericDesktopPage).
+		Usage(UsageMouse).
+		Collection(ApplicationCollection).
+		ReportID(2).
+		Usage(UsagePointer).
+		Collection(PhysicalCollection).
+		UsagePage(ButtonPage).
+		UsageMinimum(1).
+		UsageMaximum(3).
+		LogicalMinimum(0).
+		LogicalMaximum(1).
+		ReportCount(3).
+		ReportSize(1).
+		Input(Variable).
+		ReportCount(1).
+		ReportSize(5).
+		Input(Constant).
+		UsagePage(GenericDesktopPage).
+		Usage(UsageX).
+		Usage(UsageY).
+		LogicalMinimum(-127).
+		LogicalMaximum(127).
+		ReportSize(8).
+		ReportCount(2).
+		Input(Variable | Relative).
+		EndCollection().
+		ReportID(3).
+		UsagePage(LEDPage).
+		Usage(0x01).
+		LogicalMinimum(0).
+		LogicalMaximum(1).
+		ReportSize(1).
+		ReportCount(1).
+		Feature(Variable).
+		ReportCount(7).
+		Feature(Constant).
+		EndCollection()
+}
+
+func TestDescriptorBuilder(t *testing.T) {
+	got := NewDescriptorBuilder().
+		UsagePage(GenericDesktopPage).
+		LogicalMinimum(-127).
+		LogicalMaximum(255).
+		Unit(0x12345).
+		Input(Variable | Relative).
+		EndCollection().
+		Bytes()
+	want := []byte{
+		0x05, 0x01, // Usage Page (Generic Desktop)
+		0x15, 0x81, // Logical Minimum (-127)
+		0x26, 0xff, 0x00, // Logical Maximum (255)
+		0x67, 0x45, 0x23, 0x01, 0x00, // Unit (0x12345)
+		0x81, 0x06, // Input (Data,Var,Rel)
+		0xc0, // End Collection
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("DescriptorBuilder built % x; want % x", got, want)
+	}
+}
+
+func TestParseDescriptor(t *testing.T) {
+	rd, err := ParseDescriptor(mouseDescriptor().Bytes())
+	if err != nil {
+		t.Fatal("ParseDescriptor failed: ", err)
+	}
+	if !rd.UsesReportIDs {
+		t.Error("UsesReportIDs is false")
+	}
+
+	var names []string
+	for _, f := range rd.Fields {
+		names = append(names, f.Name)
+	}
+	if want := []string{"Button1", "Button2", "Button3", "X", "Y", "LED0001"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ParseDescriptor returned fields %v; want %v", names, want)
+	}
+
+	y, err := rd.Field(InputReport, 2, "Y")
+	if err != nil {
+		t.Fatal("Field failed: ", err)
+	}
+	if y.BitOffset != 16 || y.BitSize != 8 || y.LogicalMinimum != -127 || y.Flags != Variable|Relative {
+		t.Errorf("Field Y = %+v; want offset 16, size 8, minimum -127 and relative", *y)
+	}
+
+	for _, tc := range []struct {
+		typ  ReportType
+		id   uint8
+		size int
+	}{
+		{InputReport, 2, 4},
+		{FeatureReport, 3, 2},
+	} {
+		if size, ok := rd.ReportSize(tc.typ, tc.id); !ok || size != tc.size {
+			t.Errorf("ReportSize(%v, %d) = (%d, %v); want %d", tc.typ, tc.id, size, ok, tc.size)
+		}
+	}
+}
+
+func TestParseDescriptorUnsignedMaximum(t *testing.T) {
+	// Usage Page (Generic Desktop), Usage (X), Logical Minimum (0),
+	// Logical Maximum (0xff), Report Size (8), Report Count (1),
+	// Input (Variable).
+	rd, err := ParseDescriptor([]byte{0x05, 0x01, 0x09, 0x30, 0x15, 0x00, 0x25, 0xff, 0x75, 0x08, 0x95, 0x01, 0x81, 0x02})
+	if err != nil {
+		t.Fatal("ParseDescriptor failed: ", err)
+	}
+	x, err := rd.Field(InputReport, 0, "X")
+	if err != nil {
+		t.Fatal("Field failed: ", err)
+	}
+	if x.LogicalMinimum != 0 || x.LogicalMaximum != 255 {
+		t.Errorf("Field X has range [%d, %d]; want [0, 255]", x.LogicalMinimum, x.LogicalMaximum)
+	}
+	if _, err := rd.EncodeReport(InputReport, 0, map[string]int32{"X": 200}); err != nil {
+		t.Error("EncodeReport failed for a value in range: ", err)
+	}
+	if _, err := rd.EncodeReport(InputReport, 0, map[string]int32{"X": 256}); err == nil {
+		t.Error("EncodeReport unexpectedly succeeded for a value out of range")
+	}
+}
+
+func TestParseDescriptorErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", []byte{0x05}},
+		{"unclosed collection", NewDescriptorBuilder().Collection(ApplicationCollection).Bytes()},
+		{"unbalanced end", NewDescriptorBuilder().EndCollection().Bytes()},
+		{"unbalanced pop", NewDescriptorBuilder().Pop().Bytes()},
+	} {
+		if _, err := ParseDescriptor(tc.data); err == nil {
+			t.Errorf("ParseDescriptor unexpectedly succeeded for %s descriptor", tc.name)
+		}
+	}
+}
+
+func TestEncodeDecodeReport(t *testing.T) {
+	rd, err := ParseDescriptor(mouseDescriptor().Bytes())
+	if err != nil {
+		t.Fatal("ParseDescriptor failed: ", err)
+	}
+
+	values, err := ParseFieldValues("Button1=1, Button3=1, X=-2, Y=0x10")
+	if err != nil {
+		t.Fatal("ParseFieldValues failed: ", err)
+	}
+	data, err := rd.EncodeReport(InputReport, 2, values)
+	if err != nil {
+		t.Fatal("EncodeReport failed: ", err)
+	}
+	if want := []byte{0x02, 0x05, 0xfe, 0x10}; !bytes.Equal(data, want) {
+		t.Errorf("EncodeReport returned % x; want % x", data, want)
+	}
+
+	id, decoded, err := rd.DecodeReport(InputReport, data)
+	if err != nil {
+		t.Fatal("DecodeReport failed: ", err)
+	}
+	want := map[string]int32{"Button1": 1, "Button2": 0, "Button3": 1, "X": -2, "Y": 16}
+	if id != 2 || !reflect.DeepEqual(decoded, want) {
+		t.Errorf("DecodeReport returned (%d, %v); want (2, %v)", id, decoded, want)
+	}
+
+	for _, bad := range []map[string]int32{
+		{"Z": 1},
+		{"X": 128},
+		{"Button1": 2},
+	} {
+		if _, err := rd.EncodeReport(InputReport, 2, bad); err == nil {
+			t.Errorf("EncodeReport unexpectedly succeeded for %v", bad)
+		}
+	}
+}
+
+func TestDecodeReportZeroSizeField(t *testing.T) {
+	// The descriptor ends with a zero byte, which must be kept.
+	desc := NewDescriptorBuilder().
+		UsagePage(GenericDesktopPage).
+		Usage(UsageX).
+		LogicalMinimum(-127).
+		LogicalMaximum(127).
+		ReportSize(8).
+		ReportCount(1).
+		Input(Variable | Relative).
+		Usage(UsageY).
+		ReportSize(0).
+		Input(0).Bytes()
+	d, err := NewDevice("device", string(desc))
+	if err != nil {
+		t.Fatal("NewDevice failed: ", err)
+	}
+	rd, err := d.ReportDescriptor()
+	if err != nil {
+		t.Fatalf("ReportDescriptor failed for % x: %v", desc, err)
+	}
+
+	_, decoded, err := rd.DecodeReport(InputReport, []byte{0xfe})
+	if err != nil {
+		t.Fatal("DecodeReport failed: ", err)
+	}
+	if want := map[string]int32{"X": -2}; !reflect.DeepEqual(decoded, want) {
+		t.Errorf("DecodeReport returned %v; want %v", decoded, want)
+	}
+}
+
+func TestParseFieldValues(t *testing.T) {
+	for _, s := range []string{"X", "X=a", "X=1,=", "X=99999999999"} {
+		if v, err := ParseFieldValues(s); err == nil {
+			t.Errorf("ParseFieldValues(%q) = %v; want error", s, v)
+		}
+	}
+}
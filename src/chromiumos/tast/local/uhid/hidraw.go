@@ -0,0 +1,125 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uhid
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// hidrawReportDescriptor replicates struct hidraw_report_descriptor in
+// hidraw.h.
+type hidrawReportDescriptor struct {
+	size  uint32
+	value [hidMaxDescriptorSize]byte
+}
+
+// hidrawDevinfo replicates struct hidraw_devinfo in hidraw.h.
+type hidrawDevinfo struct {
+	bustype uint32
+	vendor  int16
+	product int16
+}
+
+// hidrawIoctl returns an encoded read ioctl request for hidraw with the
+// given number and data size. This is analogous to the _IOC C macro
+// with _IOC_READ direction and the 'H' type.
+func hidrawIoctl(nr, size uintptr) uintptr {
+	const (
+		iocRead     = 2
+		iocNrShift  = 0
+		iocTypShift = 8
+		iocSizShift = 16
+		iocDirShift = 30
+	)
+	return iocRead<<iocDirShift | 'H'<<iocTypShift | nr<<iocNrShift | size<<iocSizShift
+}
+
+// The following requests are from hidraw.h.
+var (
+	hidiocGRDescSize = hidrawIoctl(0x01, unsafe.Sizeof(int32(0)))
+	hidiocGRDesc     = hidrawIoctl(0x02, unsafe.Sizeof(hidrawReportDescriptor{}))
+	hidiocGRawInfo   = hidrawIoctl(0x03, unsafe.Sizeof(hidrawDevinfo{}))
+)
+
+// hidiocGRawName returns the HIDIOCGRAWNAME request for a buffer of size n.
+func hidiocGRawName(n int) uintptr {
+	return hidrawIoctl(0x04, uintptr(n))
+}
+
+// hidiocGRawPhys returns the HIDIOCGRAWPHYS request for a buffer of size n.
+func hidiocGRawPhys(n int) uintptr {
+	return hidrawIoctl(0x05, uintptr(n))
+}
+
+// hidrawCall makes an ioctl system call against fd with the given request
+// and data.
+func hidrawCall(fd, req uintptr, data unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(data)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// readHidrawFile returns the DeviceData of the hidraw device opened as f,
+// along with its report descriptor. The ioctls are issued through
+// f.SyscallConn, as f.Fd would put f in blocking mode, after which the
+// read deadlines used by Recorder never expire.
+func readHidrawFile(f *os.File) (DeviceData, []byte, error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return DeviceData{}, nil, err
+	}
+	var dd DeviceData
+	var descriptor []byte
+	var ioctlErr error
+	if err := rc.Control(func(fd uintptr) {
+		dd, descriptor, ioctlErr = readHidrawData(fd)
+	}); err != nil {
+		return DeviceData{}, nil, err
+	}
+	return dd, descriptor, ioctlErr
+}
+
+// readHidrawData returns the DeviceData of the hidraw device opened as fd,
+// along with its report descriptor.
+func readHidrawData(fd uintptr) (DeviceData, []byte, error) {
+	dd := DeviceData{}
+
+	var size int32
+	if err := hidrawCall(fd, hidiocGRDescSize, unsafe.Pointer(&size)); err != nil {
+		return dd, nil, err
+	}
+	desc := hidrawReportDescriptor{size: uint32(size)}
+	if err := hidrawCall(fd, hidiocGRDesc, unsafe.Pointer(&desc)); err != nil {
+		return dd, nil, err
+	}
+	dd.descriptorSize = copy(dd.descriptor[:], desc.value[:desc.size])
+
+	var info hidrawDevinfo
+	if err := hidrawCall(fd, hidiocGRawInfo, unsafe.Pointer(&info)); err != nil {
+		return dd, nil, err
+	}
+	dd.bus = uint16(info.bustype)
+	dd.vendorID = uint32(uint16(info.vendor))
+	dd.productID = uint32(uint16(info.product))
+
+	// The strings written by the kernel are NUL-terminated.
+	var name [128]byte
+	if err := hidrawCall(fd, hidiocGRawName(len(name)), unsafe.Pointer(&name[0])); err != nil {
+		return dd, nil, err
+	}
+	copy(dd.name[:], bytes.TrimRight(name[:], "\x00"))
+
+	var phys [64]byte
+	if err := hidrawCall(fd, hidiocGRawPhys(len(phys)), unsafe.Pointer(&phys[0])); err != nil {
+		return dd, nil, err
+	}
+	copy(dd.phys[:], bytes.TrimRight(phys[:], "\x00"))
+
+	return dd, append([]byte(nil), desc.value[:desc.size]...), nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uhid
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"chromiumos/tast/errors"
+)
+
+// recorderReadTimeout is how long a single read from the hidraw node
+// may block before the context is checked again.
+const recorderReadTimeout = 100 * time.Millisecond
+
+// Recorder captures the report descriptor and the input reports of a
+// device through its /dev/hidraw* node. The recording is written in
+// the format read by NewDeviceFromRecording and Replay, so a real
+// device can be recorded once and replayed in tests.
+type Recorder struct {
+	// Data contains the information of the recorded device.
+	Data       DeviceData
+	descriptor []byte
+	file       *os.File
+}
+
+// NewRecorder opens the hidraw node in path and reads the information
+// of the device behind it. Close must be called after using it.
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed opening %s", path)
+	}
+	dd, descriptor, err := readHidrawFile(f)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "failed reading device information from %s", path)
+	}
+	return &Recorder{Data: dd, descriptor: descriptor, file: f}, nil
+}
+
+// Close closes the hidraw node.
+func (r *Recorder) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// Record writes the device information to w and then every input
+// report sent by the device, timestamped from the moment Record was
+// called. It keeps recording until ctx is done, which is not treated
+// as an error.
+func (r *Recorder) Record(ctx context.Context, w io.Writer) error {
+	if r.file == nil {
+		return errors.New("recorder has been closed")
+	}
+	if err := writeRecordingData(w, &r.Data, r.descriptor); err != nil {
+		return errors.Wrap(err, "failed writing device information")
+	}
+
+	start := time.Now()
+	buf := make([]byte, hidMaxBufferSize)
+	for ctx.Err() == nil {
+		if err := r.file.SetReadDeadline(time.Now().Add(recorderReadTimeout)); err != nil {
+			return errors.Wrap(err, "failed setting read deadline")
+		}
+		n, err := r.file.Read(buf)
+		if os.IsTimeout(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed reading input report")
+		}
+		e := RecordedEvent{Time: time.Since(start), Data: append([]byte(nil), buf[:n]...)}
+		if err := writeRecordedEvent(w, e); err != nil {
+			return errors.Wrap(err, "failed writing input report")
+		}
+	}
+	return nil
+}
+
+// writeRecordingData writes the information of dd and its report
+// descriptor to w in the hid recording format.
+func writeRecordingData(w io.Writer, dd *DeviceData, descriptor []byte) error {
+	name := string(bytes.TrimRight(dd.name[:], "\x00"))
+	phys := string(bytes.TrimRight(dd.phys[:], "\x00"))
+	lines := []string{
+		"# " + name,
+		"R: " + formatArray(descriptor),
+		"N: " + name,
+		"P: " + phys,
+		fmt.Sprintf("I: %x %04x %04x", dd.bus, dd.vendorID, dd.productID),
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// writeRecordedEvent writes e to w as an event line of the hid
+// recording format.
+func writeRecordedEvent(w io.Writer, e RecordedEvent) error {
+	us := e.Time.Microseconds()
+	_, err := fmt.Fprintf(w, "E: %06d.%06d %s\n", us/1000000, us%1000000, formatArray(e.Data))
+	return err
+}
+
+// formatArray returns data in the form parsed by parseArray.
+func formatArray(data []byte) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d", len(data))
+	for _, b := range data {
+		fmt.Fprintf(&sb, " %02x", b)
+	}
+	return sb.String()
+}
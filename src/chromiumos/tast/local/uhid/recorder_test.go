@@ -0,0 +1,96 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uhid
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordingRoundTrip(t *testing.T) {
+	descriptor := []byte{0x05, 0x01, 0x09, 0x02, 0xa1, 0x01, 0xc0}
+	dd := DeviceData{bus: 0x3, vendorID: 0x46d, productID: 0xc077}
+	copy(dd.name[:], "Logitech USB Optical Mouse")
+	copy(dd.phys[:], "usb-0000:00:14.0-1/input0")
+	dd.descriptorSize = copy(dd.descriptor[:], descriptor)
+
+	events := []RecordedEvent{
+		{Time: 0, Data: []byte{0x00, 0x01, 0x00, 0x00}},
+		{Time: 1500 * time.Microsecond, Data: []byte{0x01, 0xff, 0x7f, 0x00}},
+		{Time: 12*time.Second + 345678*time.Microsecond, Data: []byte{0x00}},
+	}
+
+	var b bytes.Buffer
+	if err := writeRecordingData(&b, &dd, descriptor); err != nil {
+		t.Fatal("writeRecordingData failed: ", err)
+	}
+	for _, e := range events {
+		if err := writeRecordedEvent(&b, e); err != nil {
+			t.Fatal("writeRecordedEvent failed: ", err)
+		}
+	}
+
+	ctx := context.Background()
+	gotData, err := readRecordingData(ctx, bytes.NewReader(b.Bytes()), "recording")
+	if err != nil {
+		t.Fatalf("readRecordingData failed for %q: %v", b.String(), err)
+	}
+	if gotData != dd {
+		t.Errorf("readRecordingData returned %+v; want %+v", gotData, dd)
+	}
+
+	gotEvents, err := readRecordingEvents(ctx, bytes.NewReader(b.Bytes()), "recording")
+	if err != nil {
+		t.Fatalf("readRecordingEvents failed for %q: %v", b.String(), err)
+	}
+	if !reflect.DeepEqual(gotEvents, events) {
+		t.Errorf("readRecordingEvents returned %v; want %v", gotEvents, events)
+	}
+}
+
+func TestWriteRecordedEvent(t *testing.T) {
+	var b bytes.Buffer
+	e := RecordedEvent{Time: 3*time.Second + 42*time.Microsecond, Data: []byte{0x0a, 0xb0}}
+	if err := writeRecordedEvent(&b, e); err != nil {
+		t.Fatal("writeRecordedEvent failed: ", err)
+	}
+	const want = "E: 000003.000042 2 0a b0\n"
+	if got := b.String(); got != want {
+		t.Errorf("writeRecordedEvent wrote %q; want %q", got, want)
+	}
+}
+
+func TestRecordCancelIdle(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal("Pipe failed: ", err)
+	}
+	defer pw.Close()
+
+	// The ioctls fail on a pipe, but must leave it in non-blocking mode.
+	if _, _, err := readHidrawFile(pr); err == nil {
+		t.Error("readHidrawFile unexpectedly succeeded on a pipe")
+	}
+	r := &Recorder{file: pr}
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- r.Record(ctx, ioutil.Discard) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error("Record failed: ", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Record did not return after ctx was done on an idle device")
+	}
+}
@@ -7,6 +7,7 @@ package uhid
 import (
 	"bufio"
 	"context"
+	"io"
 	"os"
 	"regexp"
 	"strconv"
@@ -17,17 +18,61 @@ import (
 	"chromiumos/tast/testing"
 )
 
+// RecordedEvent is an input report found in a hid recording.
+type RecordedEvent struct {
+	// Time is the time elapsed from the start of the recording.
+	Time time.Duration
+	// Data is the raw input report.
+	Data []byte
+}
+
 // NewDeviceFromRecording receives a file containing a hid recording recorded using
-// hid-tools (https://gitlab.freedesktop.org/libevdev/hid-tools) and
+// hid-tools (https://gitlab.freedesktop.org/libevdev/hid-tools) or Recorder and
 // creates a device based on the information contained in it.
 func NewDeviceFromRecording(ctx context.Context, file *os.File) (*Device, error) {
+	dd, err := readRecordingData(ctx, file, file.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &Device{Data: dd}, nil
+}
+
+// Replay receives a file containing a hid recording, parses it and
+// injects the events into the given device. An error is returned if
+// the recording file is invalid.
+func (d *Device) Replay(ctx context.Context, file *os.File) error {
+	if d.file == nil {
+		return errors.New("device has not been initialized")
+	}
+	events, err := readRecordingEvents(ctx, file, file.Name())
+	if err != nil {
+		return err
+	}
+	sleep := time.Duration(0)
+	for _, e := range events {
+		if err := testing.Sleep(ctx, e.Time-sleep); err != nil {
+			return errors.Wrap(err, "failed while sleeping during replay")
+		}
+		sleep = e.Time
+		if err := d.InjectEvent(e.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRecordingData returns the device information found in the hid
+// recording read from r. Events in the recording are ignored. name is
+// only used for logging.
+func readRecordingData(ctx context.Context, r io.Reader, name string) (DeviceData, error) {
 	dd := DeviceData{}
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(r)
 	var line string
 	// The protocol used in hid recording files can be found here:
 	// https://github.com/bentiss/hid-replay/blob/6d83e4883763b55ac809e3ad6c08926e8d1aea72/src/hid-replay.txt#L49
-	i := 1
-	for ; scanner.Scan(); line, i = scanner.Text(), i+1 {
+	i := 0
+	for scanner.Scan() {
+		line, i = scanner.Text(), i+1
 		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "E: ") {
 			// We ignore comments, empty lines or event lines.
 			continue
@@ -35,85 +80,75 @@ func NewDeviceFromRecording(ctx context.Context, file *os.File) (*Device, error)
 		if len(line) < 4 {
 			// If it's not a comment or an empty line it'll have a length of
 			// at least 4.
-			return nil, parsingError(ctx, "line is empty (line: %d)", line, file.Name(), i)
+			return dd, parsingError(ctx, "line is empty (line: %d)", line, name, i)
 		}
 		prefix, data := line[:3], line[3:]
 		switch prefix {
 		case "D: ":
-			return nil, parsingError(ctx, "multi device recordings are not supported", line, file.Name(), i)
+			return dd, parsingError(ctx, "multi device recordings are not supported", line, name, i)
 		case "N: ":
 			copy(dd.name[:], data)
 		case "I: ":
 			var err error
 			if dd.bus, dd.vendorID, dd.productID, err = parseInfo(ctx, data); err != nil {
-				return nil, errors.Wrap(err, parsingError(ctx, "invalid info in recording file", line, file.Name(), i).Error())
+				return dd, errors.Wrap(err, parsingError(ctx, "invalid info in recording file", line, name, i).Error())
 			}
 		case "P: ":
 			copy(dd.phys[:], data)
 		case "R: ":
 			descriptor, err := parseArray(data)
 			if err != nil {
-				return nil, errors.Wrap(err, parsingError(ctx, "invalid descriptor in recording file", line, file.Name(), i).Error())
+				return dd, errors.Wrap(err, parsingError(ctx, "invalid descriptor in recording file", line, name, i).Error())
 			}
-			copy(dd.descriptor[:], descriptor[:])
+			dd.descriptorSize = copy(dd.descriptor[:], descriptor[:])
 		default:
-			return nil, parsingError(ctx, "invalid line prefix in recording file", line, file.Name(), i)
+			return dd, parsingError(ctx, "invalid line prefix in recording file", line, name, i)
 		}
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, errors.Wrap(err, parsingError(ctx, "failure to parse", line, file.Name(), i).Error())
+		return dd, errors.Wrap(err, parsingError(ctx, "failure to parse", line, name, i).Error())
 	}
-	return &Device{Data: dd}, nil
+	return dd, nil
 }
 
-// Replay receives a file containing a hid recording, parses it and
-// injects the events into the given device. An error is returned if
-// the recording file is invalid.
-func (d *Device) Replay(ctx context.Context, file *os.File) error {
-	if d.file == nil {
-		return errors.New("device has not been initialized")
-	}
-	scanner := bufio.NewScanner(file)
+// readRecordingEvents returns the events found in the hid recording
+// read from r. name is only used for logging.
+func readRecordingEvents(ctx context.Context, r io.Reader, name string) ([]RecordedEvent, error) {
+	var events []RecordedEvent
+	scanner := bufio.NewScanner(r)
 	var line string
-	i := 1
-	sleep := time.Duration(0)
-	for ; scanner.Scan(); line, i = scanner.Text(), i+1 {
+	i := 0
+	for scanner.Scan() {
+		line, i = scanner.Text(), i+1
 		if len(line) == 0 || strings.HasPrefix(line, "#") {
 			// We ignore comments or empty lines.
 			continue
 		}
 		if strings.HasPrefix(line, "D: ") {
-			return parsingError(ctx, "multi device recordings are not supported", line, file.Name(), i)
+			return nil, parsingError(ctx, "multi device recordings are not supported", line, name, i)
 		}
 		if strings.HasPrefix(line, "E: ") {
 			if len(line) < 15 {
-				return parsingError(ctx, "unexpected format for event line", line, file.Name(), i)
+				return nil, parsingError(ctx, "unexpected format for event line", line, name, i)
 			}
 			line = line[3:]
 			var err error
-			var nextTimestamp time.Duration
-			if nextTimestamp, err = parseTime(ctx, line); err != nil {
-				return errors.Wrap(err, parsingError(ctx, "invalid recording file", line, file.Name(), i).Error())
-			}
-			if err := testing.Sleep(ctx, nextTimestamp-sleep); err != nil {
-				return errors.Wrap(err, "failed while sleeping during replay")
+			var e RecordedEvent
+			if e.Time, err = parseTime(ctx, line); err != nil {
+				return nil, errors.Wrap(err, parsingError(ctx, "invalid recording file", line, name, i).Error())
 			}
-			sleep = nextTimestamp
 			// The timestamp always occupies 13 spaces.
 			line = line[14:]
-			var data []byte
-			if data, err = parseArray(line); err != nil {
-				return err
-			}
-			if err = d.InjectEvent(data); err != nil {
-				return err
+			if e.Data, err = parseArray(line); err != nil {
+				return nil, err
 			}
+			events = append(events, e)
 		}
 	}
 	if err := scanner.Err(); err != nil {
-		return errors.Wrapf(err, "failure to parse file (line: %d)", i)
+		return nil, errors.Wrapf(err, "failure to parse file (line: %d)", i)
 	}
-	return nil
+	return events, nil
 }
 
 // parseInfo returns the bus, vendor id and product id found in line.
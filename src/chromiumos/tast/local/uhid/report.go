@@ -0,0 +1,190 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package uhid
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"chromiumos/tast/errors"
+)
+
+// ReportSize returns the size in bytes of the report of the given type
+// and ID, including the report ID prefix if any. It returns false if
+// the report is not declared.
+func (rd *ReportDescriptor) ReportSize(t ReportType, id uint8) (int, bool) {
+	bits, ok := rd.bits[reportKey{t, id}]
+	if !ok {
+		return 0, false
+	}
+	size := (bits + 7) / 8
+	if rd.UsesReportIDs {
+		size++
+	}
+	return size, true
+}
+
+// Field returns the field with the given name in the report of the
+// given type and ID.
+func (rd *ReportDescriptor) Field(t ReportType, id uint8, name string) (*Field, error) {
+	for i := range rd.Fields {
+		f := &rd.Fields[i]
+		if f.Type == t && f.ReportID == id && f.Name == name {
+			return f, nil
+		}
+	}
+	return nil, errors.Errorf("no field %q in %v report %d", name, t, id)
+}
+
+// EncodeReport returns the report of the given type and ID with its
+// fields set to values, keyed by field name. Fields not present in
+// values are set to 0. It returns an error if a field does not exist
+// or a value is outside of the logical range of its field.
+func (rd *ReportDescriptor) EncodeReport(t ReportType, id uint8, values map[string]int32) ([]byte, error) {
+	size, ok := rd.ReportSize(t, id)
+	if !ok {
+		return nil, errors.Errorf("no %v report %d in descriptor", t, id)
+	}
+	data := make([]byte, size)
+	report := data
+	if rd.UsesReportIDs {
+		data[0] = id
+		report = data[1:]
+	}
+
+	// Sort the names so that the first invalid field is always reported.
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f, err := rd.Field(t, id, name)
+		if err != nil {
+			return nil, err
+		}
+		v := values[name]
+		if f.LogicalMinimum < f.LogicalMaximum && (v < f.LogicalMinimum || v > f.LogicalMaximum) {
+			return nil, errors.Errorf("value %d of field %q is outside of [%d, %d]", v, name, f.LogicalMinimum, f.LogicalMaximum)
+		}
+		writeBits(report, f.BitOffset, f.BitSize, uint32(v))
+	}
+	return data, nil
+}
+
+// DecodeReport returns the ID of the report of the given type in data
+// and the values of its fields keyed by field name. data must start
+// with the report ID if the descriptor uses report IDs, as the reports
+// injected by InjectEvent and the data of SetReport requests do.
+func (rd *ReportDescriptor) DecodeReport(t ReportType, data []byte) (uint8, map[string]int32, error) {
+	var id uint8
+	report := data
+	if rd.UsesReportIDs {
+		if len(data) == 0 {
+			return 0, nil, errors.New("empty report")
+		}
+		id = data[0]
+		report = data[1:]
+	}
+	size, ok := rd.ReportSize(t, id)
+	if !ok {
+		return 0, nil, errors.Errorf("no %v report %d in descriptor", t, id)
+	}
+	if len(data) < size {
+		return 0, nil, errors.Errorf("report too short; got %d bytes, want %d", len(data), size)
+	}
+
+	values := make(map[string]int32)
+	for _, f := range rd.Fields {
+		// Fields without bits, e.g. declared with a zero Report Size,
+		// carry no value.
+		if f.Type != t || f.ReportID != id || f.BitSize == 0 {
+			continue
+		}
+		v := readBits(report, f.BitOffset, f.BitSize)
+		// Fields which can be negative are in two's complement.
+		if f.LogicalMinimum < 0 && f.BitSize < 32 && v&(1<<(f.BitSize-1)) != 0 {
+			v |= ^uint32(0) << f.BitSize
+		}
+		values[f.Name] = int32(v)
+	}
+	return id, values, nil
+}
+
+// writeBits writes the lowest size bits of v into data starting from
+// the bit at offset. Bits are in little endian order, as in HID reports.
+func writeBits(data []byte, offset, size int, v uint32) {
+	for i := 0; i < size && i < 32; i++ {
+		pos := offset + i
+		if v&(1<<i) != 0 {
+			data[pos/8] |= 1 << (pos % 8)
+		} else {
+			data[pos/8] &^= 1 << (pos % 8)
+		}
+	}
+}
+
+// readBits returns size bits of data starting from the bit at offset.
+func readBits(data []byte, offset, size int) uint32 {
+	var v uint32
+	for i := 0; i < size && i < 32; i++ {
+		pos := offset + i
+		if data[pos/8]&(1<<(pos%8)) != 0 {
+			v |= 1 << i
+		}
+	}
+	return v
+}
+
+// ParseFieldValues parses field values written as a comma-separated list
+// of name=value pairs, e.g. "X=100, Button1=1", to be passed to
+// EncodeReport.
+func ParseFieldValues(s string) (map[string]int32, error) {
+	values := make(map[string]int32)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("field value %q is not of the form name=value", pair)
+		}
+		name := strings.TrimSpace(kv[0])
+		v, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 0, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for field %q", name)
+		}
+		values[name] = int32(v)
+	}
+	return values, nil
+}
+
+// ReportDescriptor parses the report descriptor of the device.
+func (d *Device) ReportDescriptor() (*ReportDescriptor, error) {
+	// The descriptor is stored in a fixed size array padded with zeros,
+	// which must not be confused with zeros ending the descriptor.
+	return ParseDescriptor(d.Data.descriptor[:d.Data.descriptorSize])
+}
+
+// InjectReport injects the input report with the given ID into the
+// device. fields are the values of the fields of the report as parsed
+// by ParseFieldValues, e.g. "X=100, Button1=1".
+func (d *Device) InjectReport(id uint8, fields string) error {
+	rd, err := d.ReportDescriptor()
+	if err != nil {
+		return errors.Wrap(err, "failed parsing report descriptor")
+	}
+	values, err := ParseFieldValues(fields)
+	if err != nil {
+		return err
+	}
+	data, err := rd.EncodeReport(InputReport, id, values)
+	if err != nil {
+		return err
+	}
+	return d.InjectEvent(data)
+}
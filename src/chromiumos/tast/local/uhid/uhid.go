@@ -25,6 +25,10 @@ const (
 	// from uhid.h.
 	hidMaxDescriptorSize = 4096
 
+	// hidMaxBufferSize represents the maximum length of a report read
+	// from a hidraw device. It matches HID_MAX_BUFFER_SIZE from hid.h.
+	hidMaxBufferSize = 16384
+
 	// uhidEventSize refers to the size of struct uhid_event from
 	// uhid.h. This is the struct that is always written by the
 	// kernel to /dev/uhid.
@@ -118,6 +122,27 @@ type GetReportReplyRequest struct {
 	Data        [hidMaxDescriptorSize]byte
 }
 
+// SetReportRequest replicates struct uhid_set_report_req in uhid.h.
+// It is used to read SetReport requests written by the kernel. The
+// report can be decoded with ReportDescriptor.DecodeReport.
+type SetReportRequest struct {
+	RequestType uint32
+	ID          uint32
+	RNum        RNumType
+	RType       uint8
+	DataSize    uint16
+	Data        [hidMaxDescriptorSize]byte
+}
+
+// SetReportReplyRequest replicates struct uhid_set_report_reply_req
+// in uhid.h. It should be written to Device.File in response to a
+// SetReportRequest by the kernel.
+type SetReportReplyRequest struct {
+	RequestType uint32
+	ID          uint32
+	Err         uint16
+}
+
 // uhidCreate2Request replicates struct uhid_create2_req in uhid.h.
 // Create requests are written into /dev/uhid in order to create a
 // virtual HID device. This device will have the given name and IDs as
@@ -145,9 +170,12 @@ type DeviceData struct {
 	phys       [64]byte
 	uniq       [64]byte
 	descriptor [hidMaxDescriptorSize]byte
-	bus        uint16
-	vendorID   uint32
-	productID  uint32
+	// descriptorSize is the size of the report descriptor in descriptor,
+	// as given to NewDevice, recorded or reported by the kernel.
+	descriptorSize int
+	bus            uint16
+	vendorID       uint32
+	productID      uint32
 }
 
 type eventHandler func(ctx context.Context, d *Device, buf []byte) error
@@ -187,6 +215,7 @@ func NewDevice(name, descriptor string) (*Device, error) {
 	d := Device{}
 	copy(d.Data.name[:], name)
 	copy(d.Data.descriptor[:], descriptor)
+	d.Data.descriptorSize = len(descriptor)
 	return &d, nil
 }
 
@@ -6,6 +6,8 @@ package firmware
 
 import (
 	"context"
+	"io/ioutil"
+	"path/filepath"
 
 	"chromiumos/tast/remote/firmware"
 	"chromiumos/tast/testing"
@@ -35,4 +37,17 @@ func Config(ctx context.Context, s *testing.State) {
 	if h.Config.Platform != expectedPlatform {
 		s.Errorf("Unexpected Platform value; got %s, want %s", h.Config.Platform, expectedPlatform)
 	}
+
+	// Save the resolved config of the DUT for debugging.
+	cs, err := firmware.LoadConfigSet(s.DataPath(firmware.ConfigFile))
+	if err != nil {
+		s.Fatal("Failed to load firmware configs: ", err)
+	}
+	b, err := cs.Dump(expectedPlatform, h.Model)
+	if err != nil {
+		s.Fatal("Failed to dump resolved config: ", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(s.OutDir(), "config.json"), b, 0644); err != nil {
+		s.Error("Failed to save resolved config: ", err)
+	}
 }
@@ -20,6 +20,7 @@ import (
 	"chromiumos/tast/testing"
 )
 
+// These are the default timeouts of ModeSwitcher.
 const (
 	// cmdTimeout is a short duration used for sending commands.
 	cmdTimeout = 3 * time.Second
@@ -32,8 +33,16 @@ const (
 )
 
 // ModeSwitcher enables booting the DUT into different firmware boot modes (normal, dev, rec).
+// Its timeouts can be shortened, e.g. for a DUT simulated by SimDUT.
 type ModeSwitcher struct {
 	Helper *Helper
+
+	// CmdTimeout is the timeout of the commands sent to the DUT, such as poweroff.
+	CmdTimeout time.Duration
+	// OffTimeout is the timeout to wait for the DUT to be unreachable after powering off.
+	OffTimeout time.Duration
+	// ReconnectTimeout is the timeout to wait to reconnect to the DUT after rebooting.
+	ReconnectTimeout time.Duration
 }
 
 // NewModeSwitcher creates a new ModeSwitcher. It relies on a firmware Helper to track dependent objects, such as servo and RPC client.
@@ -42,7 +51,10 @@ func NewModeSwitcher(ctx context.Context, h *Helper) (*ModeSwitcher, error) {
 		return nil, errors.Wrap(err, "requiring firmware config")
 	}
 	return &ModeSwitcher{
-		Helper: h,
+		Helper:           h,
+		CmdTimeout:       cmdTimeout,
+		OffTimeout:       offTimeout,
+		ReconnectTimeout: reconnectTimeout,
 	}, nil
 }
 
@@ -79,9 +91,9 @@ func (ms ModeSwitcher) RebootToMode(ctx context.Context, toMode fwCommon.BootMod
 		if err := testing.Sleep(ctx, h.Config.ECBootToPwrButton); err != nil {
 			return errors.Wrapf(err, "waiting %s (ECBootToPwrButton) while booting DUT into normal mode", h.Config.ECBootToPwrButton)
 		}
-		offCtx, cancel := context.WithTimeout(ctx, offTimeout)
+		offCtx, cancel := context.WithTimeout(ctx, ms.OffTimeout)
 		defer cancel()
-		if err := h.DUT.WaitUnreachable(offCtx); err != nil {
+		if err := h.dutController().WaitUnreachable(offCtx); err != nil {
 			return errors.Wrap(err, "waiting for DUT to be unreachable after powering off")
 		}
 		if err := h.Servo.SetPowerState(ctx, servo.PowerStateOn); err != nil {
@@ -115,8 +127,8 @@ func (ms ModeSwitcher) RebootToMode(ctx context.Context, toMode fwCommon.BootMod
 	// Reconnect to the DUT.
 	testing.ContextLog(ctx, "Reestablishing connection to DUT")
 	if err := testing.Poll(ctx, func(ctx context.Context) error {
-		return h.DUT.WaitConnect(ctx)
-	}, &testing.PollOptions{Timeout: reconnectTimeout}); err != nil {
+		return h.dutController().WaitConnect(ctx)
+	}, &testing.PollOptions{Timeout: ms.ReconnectTimeout}); err != nil {
 		return errors.Wrapf(err, "failed to reconnect to DUT after booting to %s", toMode)
 	}
 
@@ -181,9 +193,9 @@ func (ms *ModeSwitcher) ModeAwareReboot(ctx context.Context, resetType ResetType
 	if err := h.Servo.SetPowerState(ctx, powerState); err != nil {
 		return err
 	}
-	offCtx, cancel := context.WithTimeout(ctx, offTimeout)
+	offCtx, cancel := context.WithTimeout(ctx, ms.OffTimeout)
 	defer cancel()
-	if err := h.DUT.WaitUnreachable(offCtx); err != nil {
+	if err := h.dutController().WaitUnreachable(offCtx); err != nil {
 		return errors.Wrapf(err, "waiting for DUT to be unreachable after setting power_state to %q", powerState)
 	}
 
@@ -197,8 +209,8 @@ func (ms *ModeSwitcher) ModeAwareReboot(ctx context.Context, resetType ResetType
 	// Reconnect to the DUT.
 	testing.ContextLog(ctx, "Reestablishing connection to DUT")
 	if err := testing.Poll(ctx, func(ctx context.Context) error {
-		return h.DUT.WaitConnect(ctx)
-	}, &testing.PollOptions{Timeout: reconnectTimeout}); err != nil {
+		return h.dutController().WaitConnect(ctx)
+	}, &testing.PollOptions{Timeout: ms.ReconnectTimeout}); err != nil {
 		return errors.Wrapf(err, "failed to reconnect to DUT after resetting from %s", fromMode)
 	}
 
@@ -390,13 +402,13 @@ func (ms *ModeSwitcher) poweroff(ctx context.Context) error {
 		return errors.Wrap(err, "requiring servo")
 	}
 	testing.ContextLog(ctx, "Powering off DUT")
-	poweroffCtx, cancel := context.WithTimeout(ctx, cmdTimeout)
+	poweroffCtx, cancel := context.WithTimeout(ctx, ms.CmdTimeout)
 	defer cancel()
-	h.DUT.Command("poweroff").Run(poweroffCtx) // ignore the error
+	h.dutController().Poweroff(poweroffCtx) // ignore the error
 
-	offCtx, cancel := context.WithTimeout(ctx, offTimeout)
+	offCtx, cancel := context.WithTimeout(ctx, ms.OffTimeout)
 	defer cancel()
-	if err := h.DUT.WaitUnreachable(offCtx); err != nil {
+	if err := h.dutController().WaitUnreachable(offCtx); err != nil {
 		return errors.Wrap(err, "waiting for DUT to be unreachable after sending poweroff command")
 	}
 	// Show servod that the power state has changed
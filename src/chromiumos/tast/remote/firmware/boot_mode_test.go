@@ -0,0 +1,315 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package firmware
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+
+	fwCommon "chromiumos/tast/common/firmware"
+	"chromiumos/tast/errors"
+	"chromiumos/tast/remote/servo"
+	fwpb "chromiumos/tast/services/cros/firmware"
+)
+
+// These are the configs of the firmware UIs simulated in the tests.
+var (
+	keyboardConfig       = &Config{ModeSwitcherType: KeyboardDevSwitcher}
+	powerButtonConfig    = &Config{ModeSwitcherType: KeyboardDevSwitcher, PowerButtonDevSwitch: true}
+	recButtonConfig      = &Config{ModeSwitcherType: KeyboardDevSwitcher, RecButtonDevSwitch: true}
+	tabletConfig         = &Config{ModeSwitcherType: TabletDetachableSwitcher}
+	unknownSwitcherCfg   = &Config{ModeSwitcherType: "unknown"}
+	stuckAtScreenTimeout = 2 * time.Second
+)
+
+// simTimeout is the timeout of the ModeSwitchers of the tests, which the simulated DUT meets at once.
+const simTimeout = 10 * time.Millisecond
+
+// newSimModeSwitcher returns a ModeSwitcher using cfg for a SimDUT whose firmware UI is described by simCfg.
+func newSimModeSwitcher(ctx context.Context, t *testing.T, cfg, simCfg *Config) (*ModeSwitcher, *SimDUT, *servo.FakeServod) {
+	fs, err := servo.NewFakeServod()
+	if err != nil {
+		t.Fatal("NewFakeServod failed: ", err)
+	}
+	fs.HangOnPowerOff = false
+	d := NewSimDUT(fs, simCfg)
+	svo, err := servo.New(ctx, fs.ConnSpec())
+	if err != nil {
+		fs.Close()
+		t.Fatal("servo.New failed: ", err)
+	}
+	ms, err := NewModeSwitcher(ctx, NewSimHelper(d, svo, cfg))
+	if err != nil {
+		fs.Close()
+		t.Fatal("NewModeSwitcher failed: ", err)
+	}
+	ms.CmdTimeout, ms.OffTimeout, ms.ReconnectTimeout = simTimeout, simTimeout, simTimeout
+	return ms, d, fs
+}
+
+func TestRebootToMode(t *testing.T) {
+	toDev := []string{"power:off", "power:rec", "screen:rec_insert", "screen:to_dev", "screen:dev_warning", "boot:dev"}
+	toNormal := []string{"power:off", "power:on", "screen:dev_warning", "screen:to_norm", "boot:normal"}
+	for _, tc := range []struct {
+		name     string
+		cfg      *Config
+		fromMode fwCommon.BootMode
+		toMode   fwCommon.BootMode
+		events   []string
+	}{
+		{"keyboard normal to dev", keyboardConfig, fwCommon.BootModeNormal, fwCommon.BootModeDev, toDev},
+		{"power button normal to dev", powerButtonConfig, fwCommon.BootModeNormal, fwCommon.BootModeDev, toDev},
+		{"rec button normal to dev", recButtonConfig, fwCommon.BootModeNormal, fwCommon.BootModeDev, toDev},
+		{"tablet normal to dev", tabletConfig, fwCommon.BootModeNormal, fwCommon.BootModeDev, toDev},
+		{"keyboard dev to normal", keyboardConfig, fwCommon.BootModeDev, fwCommon.BootModeNormal, toNormal},
+		{"tablet dev to normal", tabletConfig, fwCommon.BootModeDev, fwCommon.BootModeNormal, toNormal},
+		{"normal to normal", keyboardConfig, fwCommon.BootModeNormal, fwCommon.BootModeNormal, []string{"power:off", "power:on", "boot:normal"}},
+		{"normal to rec", keyboardConfig, fwCommon.BootModeNormal, fwCommon.BootModeRecovery, []string{"power:off", "power:rec", "boot:rec"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			ms, d, fs := newSimModeSwitcher(ctx, t, tc.cfg, tc.cfg)
+			defer fs.Close()
+			d.SetBootMode(tc.fromMode)
+
+			if err := ms.RebootToMode(ctx, tc.toMode); err != nil {
+				t.Fatalf("RebootToMode(%s) failed: %v; DUT events: %v", tc.toMode, err, d.Events())
+			}
+			if mode, err := ms.Helper.Reporter.CurrentBootMode(ctx); err != nil {
+				t.Error("CurrentBootMode failed: ", err)
+			} else if mode != tc.toMode {
+				t.Errorf("CurrentBootMode() = %s; want %s", mode, tc.toMode)
+			}
+			if events := d.Events(); !reflect.DeepEqual(events, tc.events) {
+				t.Errorf("RebootToMode(%s) from %s went through %v; want %v", tc.toMode, tc.fromMode, events, tc.events)
+			}
+			if d.Syncs() != 1 {
+				t.Errorf("DUT was synced %d times; want 1", d.Syncs())
+			}
+			if ms.Helper.RPCUtils != nil {
+				t.Error("RPC utils were not closed")
+			}
+		})
+	}
+}
+
+func TestRebootToModeFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cfg      *Config
+		simCfg   *Config
+		fromMode fwCommon.BootMode
+		toMode   fwCommon.BootMode
+		prepare  func(ctx context.Context, d *SimDUT) error
+		errMsg   string
+		lastStep string
+	}{
+		{
+			name:     "crossystem fails",
+			cfg:      keyboardConfig,
+			fromMode: fwCommon.BootModeNormal,
+			toMode:   fwCommon.BootModeDev,
+			prepare: func(ctx context.Context, d *SimDUT) error {
+				d.SetFailure(SimOpCommand, errors.New("ssh: connection refused"))
+				return nil
+			},
+			errMsg: "determining boot mode at the start of RebootToMode",
+		},
+		{
+			name:     "sync fails",
+			cfg:      keyboardConfig,
+			fromMode: fwCommon.BootModeNormal,
+			toMode:   fwCommon.BootModeDev,
+			prepare: func(ctx context.Context, d *SimDUT) error {
+				d.SetFailure(SimOpSync, errors.New("sync: I/O error"))
+				return nil
+			},
+			errMsg: "syncing DUT before reboot",
+		},
+		{
+			name:     "DUT does not shut down",
+			cfg:      keyboardConfig,
+			fromMode: fwCommon.BootModeDev,
+			toMode:   fwCommon.BootModeNormal,
+			prepare: func(ctx context.Context, d *SimDUT) error {
+				d.SetFailure(SimOpWaitUnreachable, errors.New("DUT is still reachable"))
+				return nil
+			},
+			errMsg:   "waiting for DUT to be unreachable after powering off",
+			lastStep: "power:off",
+		},
+		{
+			name:     "stuck at TO_DEV screen",
+			cfg:      keyboardConfig,
+			simCfg:   powerButtonConfig,
+			fromMode: fwCommon.BootModeNormal,
+			toMode:   fwCommon.BootModeDev,
+			errMsg:   "failed to reconnect to DUT after booting to dev",
+			lastStep: "screen:to_dev",
+		},
+		{
+			name:     "stuck at INSERT screen",
+			cfg:      tabletConfig,
+			simCfg:   keyboardConfig,
+			fromMode: fwCommon.BootModeNormal,
+			toMode:   fwCommon.BootModeDev,
+			errMsg:   "failed to reconnect to DUT after booting to dev",
+			lastStep: "screen:rec_insert",
+		},
+		{
+			name:     "TO_NORM blocked by GBB flags",
+			cfg:      keyboardConfig,
+			fromMode: fwCommon.BootModeDev,
+			toMode:   fwCommon.BootModeNormal,
+			prepare: func(ctx context.Context, d *SimDUT) error {
+				_, err := d.ClearAndSetGBBFlags(ctx, &fwpb.GBBFlagsState{Set: []fwpb.GBBFlag{fwpb.GBBFlag_FORCE_DEV_SWITCH_ON}})
+				return err
+			},
+			errMsg:   "incorrect boot mode after RebootToMode: got dev; want normal",
+			lastStep: "boot:dev",
+		},
+		{
+			name:     "unsupported ModeSwitcherType",
+			cfg:      unknownSwitcherCfg,
+			simCfg:   keyboardConfig,
+			fromMode: fwCommon.BootModeNormal,
+			toMode:   fwCommon.BootModeDev,
+			errMsg:   "unsupported ModeSwitcherType: unknown",
+			lastStep: "screen:rec_insert",
+		},
+		{
+			name:     "unsupported boot mode",
+			cfg:      keyboardConfig,
+			fromMode: fwCommon.BootModeNormal,
+			toMode:   fwCommon.BootModeUnspecified,
+			errMsg:   "unsupported firmware boot mode: unspecified",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), stuckAtScreenTimeout)
+			defer cancel()
+			simCfg := tc.simCfg
+			if simCfg == nil {
+				simCfg = tc.cfg
+			}
+			ms, d, fs := newSimModeSwitcher(ctx, t, tc.cfg, simCfg)
+			defer fs.Close()
+			d.SetBootMode(tc.fromMode)
+			if tc.prepare != nil {
+				if err := tc.prepare(ctx, d); err != nil {
+					t.Fatal("Failed to prepare the DUT: ", err)
+				}
+			}
+
+			err := ms.RebootToMode(ctx, tc.toMode)
+			if err == nil {
+				t.Fatalf("RebootToMode(%s) unexpectedly succeeded; DUT events: %v", tc.toMode, d.Events())
+			}
+			if !strings.Contains(err.Error(), tc.errMsg) {
+				t.Errorf("RebootToMode(%s) returned %q; want an error containing %q", tc.toMode, err, tc.errMsg)
+			}
+			events := d.Events()
+			if tc.lastStep == "" {
+				if len(events) > 0 {
+					t.Errorf("DUT changed state: %v", events)
+				}
+			} else if len(events) == 0 || events[len(events)-1] != tc.lastStep {
+				t.Errorf("DUT went through %v; want it to end with %q", events, tc.lastStep)
+			}
+		})
+	}
+}
+
+func TestModeAwareReboot(t *testing.T) {
+	for _, tc := range []struct {
+		cfg        *Config
+		fromMode   fwCommon.BootMode
+		resetType  ResetType
+		expectMode fwCommon.BootMode
+		events     []string
+	}{
+		{keyboardConfig, fwCommon.BootModeNormal, WarmReset, fwCommon.BootModeNormal, []string{"power:on", "boot:normal"}},
+		{keyboardConfig, fwCommon.BootModeNormal, ColdReset, fwCommon.BootModeNormal, []string{"power:on", "boot:normal"}},
+		{keyboardConfig, fwCommon.BootModeDev, WarmReset, fwCommon.BootModeDev, []string{"power:on", "screen:dev_warning", "boot:dev"}},
+		{recButtonConfig, fwCommon.BootModeDev, ColdReset, fwCommon.BootModeDev, []string{"power:on", "screen:dev_warning", "boot:dev"}},
+		{keyboardConfig, fwCommon.BootModeRecovery, WarmReset, fwCommon.BootModeNormal, []string{"power:on", "boot:normal"}},
+		{tabletConfig, fwCommon.BootModeNormal, ColdReset, fwCommon.BootModeNormal, []string{"power:on", "boot:normal"}},
+	} {
+		ctx := context.Background()
+		ms, d, fs := newSimModeSwitcher(ctx, t, tc.cfg, tc.cfg)
+		d.SetBootMode(tc.fromMode)
+		if err := ms.ModeAwareReboot(ctx, tc.resetType); err != nil {
+			t.Errorf("ModeAwareReboot(%s) from %s with %s failed: %v", tc.resetType, tc.fromMode, tc.cfg.ModeSwitcherType, err)
+		} else if mode, err := ms.Helper.Reporter.CurrentBootMode(ctx); err != nil {
+			t.Error("CurrentBootMode failed: ", err)
+		} else if mode != tc.expectMode {
+			t.Errorf("ModeAwareReboot(%s) from %s booted to %s; want %s", tc.resetType, tc.fromMode, mode, tc.expectMode)
+		}
+		if events := d.Events(); !reflect.DeepEqual(events, tc.events) {
+			t.Errorf("ModeAwareReboot(%s) from %s went through %v; want %v", tc.resetType, tc.fromMode, events, tc.events)
+		}
+		fs.Close()
+	}
+}
+
+func TestSimDUTFWTries(t *testing.T) {
+	ctx := context.Background()
+	ms, d, fs := newSimModeSwitcher(ctx, t, keyboardConfig, keyboardConfig)
+	defer fs.Close()
+	r := ms.Helper.Reporter
+
+	if err := CheckFWTries(ctx, r, fwCommon.RWSectionA, fwCommon.RWSectionA, 0); err != nil {
+		t.Fatal("Unexpected initial FW tries: ", err)
+	}
+	if _, err := d.Output(ctx, "crossystem", "fw_try_next=B", "fw_try_count=1"); err != nil {
+		t.Fatal("Failed to set FW tries: ", err)
+	}
+	// The DUT tries firmware B once, and keeps booting it.
+	for i := 0; i < 2; i++ {
+		if err := ms.ModeAwareReboot(ctx, WarmReset); err != nil {
+			t.Fatal("ModeAwareReboot failed: ", err)
+		}
+		if err := CheckFWTries(ctx, r, fwCommon.RWSectionB, fwCommon.RWSectionB, 0); err != nil {
+			t.Errorf("Unexpected FW tries after reboot %d: %v", i+1, err)
+		}
+	}
+	if _, err := d.Output(ctx, "crossystem", "fw_try_next=C"); err == nil {
+		t.Error("Setting fw_try_next=C unexpectedly succeeded")
+	}
+}
+
+func TestSimDUTGBBFlags(t *testing.T) {
+	ctx := context.Background()
+	fs, err := servo.NewFakeServod()
+	if err != nil {
+		t.Fatal("NewFakeServod failed: ", err)
+	}
+	defer fs.Close()
+	d := NewSimDUT(fs, keyboardConfig)
+
+	if _, err := d.ClearAndSetGBBFlags(ctx, &fwpb.GBBFlagsState{Set: []fwpb.GBBFlag{fwpb.GBBFlag_FORCE_DEV_SWITCH_ON, fwpb.GBBFlag_DEV_SCREEN_SHORT_DELAY}}); err != nil {
+		t.Fatal("ClearAndSetGBBFlags failed: ", err)
+	}
+	if _, err := d.ClearAndSetGBBFlags(ctx, &fwpb.GBBFlagsState{Clear: []fwpb.GBBFlag{fwpb.GBBFlag_DEV_SCREEN_SHORT_DELAY}}); err != nil {
+		t.Fatal("ClearAndSetGBBFlags failed: ", err)
+	}
+	state, err := d.GetGBBFlags(ctx, &empty.Empty{})
+	if err != nil {
+		t.Fatal("GetGBBFlags failed: ", err)
+	}
+	if expected := []fwpb.GBBFlag{fwpb.GBBFlag_FORCE_DEV_SWITCH_ON}; !reflect.DeepEqual(state.Set, expected) {
+		t.Errorf("GetGBBFlags() set %v; want %v", state.Set, expected)
+	}
+	for _, f := range state.Clear {
+		if f == fwpb.GBBFlag_FORCE_DEV_SWITCH_ON {
+			t.Errorf("GetGBBFlags() reports %v as both set and cleared", f)
+		}
+	}
+}
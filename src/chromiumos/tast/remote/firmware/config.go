@@ -127,57 +127,11 @@ func parentFromBytes(b []byte) (string, error) {
 // NewConfig creates a new Config matching the DUT platform.
 // cfgFilepath should take s.DataPath(firmware.ConfigFile).
 func NewConfig(cfgFilepath, board, model string) (*Config, error) {
-	// Load CONSOLIDATED.json as bytes
-	b, err := ioutil.ReadFile(cfgFilepath)
+	cs, err := LoadConfigSet(cfgFilepath)
 	if err != nil {
-		return nil, errors.Wrapf(err, "reading config file %s", cfgFilepath)
+		return nil, err
 	}
-
-	// Unmarshal consolidated JSON bytes onto a map from platform name to raw JSON
-	var consolidated map[string]json.RawMessage
-	if err := json.Unmarshal(b, &consolidated); err != nil {
-		return nil, errors.Wrapf(err, "unmarshaling consolidated JSON bytes %s", b)
-	}
-
-	// inherits is an array of platform names to be inherited, from most specific (board) to most general (DEFAULTS).
-	var inherits []string
-	for platform := CfgPlatformFromLSBBoard(board); platform != ""; {
-		b, ok := consolidated[platform]
-		if !ok {
-			return nil, errors.Wrapf(err, "consolidated JSON did not contain platform %s", platform)
-		}
-		parent, err := parentFromBytes(b)
-		if err != nil {
-			return nil, errors.Wrapf(err, "determining parent from bytes for %s", platform)
-		}
-		inherits = append(inherits, platform)
-		platform = parent
-	}
-
-	// Unmarshal JSON bytes in order from most general (DEFAULTS) to most specific (board).
-	var cfg Config
-	for i := len(inherits) - 1; i >= 0; i-- {
-		if err := json.Unmarshal(consolidated[inherits[i]], &cfg); err != nil {
-			return nil, errors.Wrapf(err, "failed to unmarshal config for %q", inherits[i])
-		}
-	}
-
-	// Unmarshal model-level config on top of the existing config.
-	// Models are only expected to be defined in the lowest-level (board) config files, not in parent config files.
-	if modelCfg, ok := cfg.Models[model]; ok {
-		if err := json.Unmarshal(modelCfg, &cfg); err != nil {
-			return nil, errors.Wrapf(err, "failed to unmarshal model-level config for %q", model)
-		}
-	}
-
-	// Populate actual durations based on raw JSON values.
-	cfg.ConfirmScreen = toSeconds(cfg.RawConfirmScreen)
-	cfg.DelayRebootToPing = toSeconds(cfg.RawDelayRebootToPing)
-	cfg.ECBootToPwrButton = toSeconds(cfg.RawECBootToPwrButton)
-	cfg.FirmwareScreen = toSeconds(cfg.RawFirmwareScreen)
-	cfg.USBPlug = toSeconds(cfg.RawUSBPlug)
-
-	return &cfg, nil
+	return cs.Resolve(CfgPlatformFromLSBBoard(board), model)
 }
 
 // HasECCapability checks whether cfg has a certain ECCapability.
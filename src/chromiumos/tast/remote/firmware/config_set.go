@@ -0,0 +1,422 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// This file implements ConfigSet, which validates and queries the configs of all platforms.
+
+package firmware
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"chromiumos/tast/errors"
+)
+
+// ModeSwitcherTypes lists the known values of ModeSwitcherType.
+var ModeSwitcherTypes = []ModeSwitcherType{JetStreamSwitcher, KeyboardDevSwitcher, MenuSwitcher, TabletDetachableSwitcher}
+
+// ECCapabilities lists the known values of ECCapability.
+var ECCapabilities = []ECCapability{
+	ECADCECTemp, ECARM, ECBattery, ECCBI, ECCharging, ECDoubleBoot, ECKeyboard,
+	ECLid, ECPECI, ECSmartUSBCharge, ECThermal, ECUSB, ECUSBPDUART, ECX86,
+}
+
+// Attributes of a platform config with a special meaning.
+const (
+	attrPlatform = "platform"
+	attrParent   = "parent"
+	attrModels   = "models"
+)
+
+// configSchema maps the JSON attributes of Config to the kind of their values.
+var configSchema = func() map[string]reflect.Kind {
+	s := make(map[string]reflect.Kind)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name != "" {
+			s[name] = t.Field(i).Type.Kind()
+		}
+	}
+	return s
+}()
+
+// configEnums lists the values accepted by attributes taking (lists of) enumerated strings.
+var configEnums = map[string][]string{
+	"mode_switcher_type": func() []string {
+		var vs []string
+		for _, v := range ModeSwitcherTypes {
+			vs = append(vs, string(v))
+		}
+		return vs
+	}(),
+	"ec_capability": func() []string {
+		var vs []string
+		for _, v := range ECCapabilities {
+			vs = append(vs, string(v))
+		}
+		return vs
+	}(),
+}
+
+// ConfigID identifies the config of a platform, or of a model of the platform if Model is not empty.
+type ConfigID struct {
+	Platform string
+	Model    string
+}
+
+// String returns "platform" or "platform/model".
+func (id ConfigID) String() string {
+	if id.Model == "" {
+		return id.Platform
+	}
+	return id.Platform + "/" + id.Model
+}
+
+// ConfigSet holds the unresolved configs of all platforms, as found in CONSOLIDATED.json.
+type ConfigSet struct {
+	raw map[string]json.RawMessage
+}
+
+// LoadConfigSet reads the configs of all platforms from cfgFilepath, which should take s.DataPath(firmware.ConfigFile).
+func LoadConfigSet(cfgFilepath string) (*ConfigSet, error) {
+	b, err := ioutil.ReadFile(cfgFilepath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading config file %s", cfgFilepath)
+	}
+	return NewConfigSet(b)
+}
+
+// NewConfigSet creates a ConfigSet from the contents of CONSOLIDATED.json.
+func NewConfigSet(b []byte) (*ConfigSet, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, errors.Wrapf(err, "unmarshaling consolidated JSON bytes %s", b)
+	}
+	return &ConfigSet{raw}, nil
+}
+
+// Platforms returns the sorted names of the platforms, excluding DEFAULTS.
+func (cs *ConfigSet) Platforms() []string {
+	var ps []string
+	for p := range cs.raw {
+		if p != defaultName {
+			ps = append(ps, p)
+		}
+	}
+	sort.Strings(ps)
+	return ps
+}
+
+// Models returns the sorted names of the models overriding the config of platform.
+func (cs *ConfigSet) Models(platform string) ([]string, error) {
+	attrs, err := cs.attrs(platform)
+	if err != nil {
+		return nil, err
+	}
+	var models map[string]json.RawMessage
+	if b, ok := attrs[attrModels]; ok {
+		if err := json.Unmarshal(b, &models); err != nil {
+			return nil, errors.Wrapf(err, "unmarshaling models of %s", platform)
+		}
+	}
+	var ms []string
+	for m := range models {
+		ms = append(ms, m)
+	}
+	sort.Strings(ms)
+	return ms, nil
+}
+
+// attrs returns the attributes set by the config of platform.
+func (cs *ConfigSet) attrs(platform string) (map[string]json.RawMessage, error) {
+	b, ok := cs.raw[platform]
+	if !ok {
+		return nil, errors.Errorf("consolidated JSON did not contain platform %s", platform)
+	}
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(b, &attrs); err != nil {
+		return nil, errors.Wrapf(err, "unmarshaling config of %s", platform)
+	}
+	return attrs, nil
+}
+
+// inheritance returns the names of the platforms inherited by platform, from most specific (platform) to most general (DEFAULTS).
+func (cs *ConfigSet) inheritance(platform string) ([]string, error) {
+	var inherits []string
+	seen := make(map[string]bool)
+	for p := platform; p != ""; {
+		if seen[p] {
+			return nil, errors.Errorf("inheritance cycle: %s -> %s", strings.Join(inherits, " -> "), p)
+		}
+		seen[p] = true
+		b, ok := cs.raw[p]
+		if !ok {
+			return nil, errors.Errorf("consolidated JSON did not contain platform %s", p)
+		}
+		parent, err := parentFromBytes(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "determining parent from bytes for %s", p)
+		}
+		inherits = append(inherits, p)
+		p = parent
+	}
+	return inherits, nil
+}
+
+// resolvedAttrs returns the attributes of the config of platform and model, after inheritance.
+// Null values override inherited ones and are kept, as they reset inherited lists and maps
+// when Resolve unmarshals the configs.
+func (cs *ConfigSet) resolvedAttrs(platform, model string) (map[string]json.RawMessage, error) {
+	inherits, err := cs.inheritance(platform)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]json.RawMessage)
+	merge := func(attrs map[string]json.RawMessage) {
+		for k, v := range attrs {
+			res[k] = v
+		}
+	}
+	for i := len(inherits) - 1; i >= 0; i-- {
+		attrs, err := cs.attrs(inherits[i])
+		if err != nil {
+			return nil, err
+		}
+		merge(attrs)
+	}
+	// Models are only expected to be defined in the lowest-level (board) config files, not in parent config files.
+	if model != "" {
+		var models map[string]map[string]json.RawMessage
+		if b, ok := res[attrModels]; ok {
+			if err := json.Unmarshal(b, &models); err != nil {
+				return nil, errors.Wrapf(err, "failed to unmarshal model-level configs of %q", platform)
+			}
+		}
+		merge(models[model])
+	}
+	return res, nil
+}
+
+// Resolve returns the config of platform, overridden by the config of model if the platform defines it.
+func (cs *ConfigSet) Resolve(platform, model string) (*Config, error) {
+	inherits, err := cs.inheritance(platform)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the configs in order from most general (DEFAULTS) to most specific (platform).
+	// As a result, null values reset inherited lists and maps, but leave other inherited values unchanged.
+	var cfg Config
+	for i := len(inherits) - 1; i >= 0; i-- {
+		if err := json.Unmarshal(cs.raw[inherits[i]], &cfg); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal config for %q", inherits[i])
+		}
+	}
+
+	// Unmarshal model-level config on top of the existing config.
+	if modelCfg, ok := cfg.Models[model]; ok && model != "" {
+		if err := json.Unmarshal(modelCfg, &cfg); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal model-level config for %q", ConfigID{platform, model})
+		}
+	}
+
+	// Populate actual durations based on raw JSON values.
+	cfg.ConfirmScreen = toSeconds(cfg.RawConfirmScreen)
+	cfg.DelayRebootToPing = toSeconds(cfg.RawDelayRebootToPing)
+	cfg.ECBootToPwrButton = toSeconds(cfg.RawECBootToPwrButton)
+	cfg.FirmwareScreen = toSeconds(cfg.RawFirmwareScreen)
+	cfg.USBPlug = toSeconds(cfg.RawUSBPlug)
+
+	return &cfg, nil
+}
+
+// Dump returns the indented JSON of all the attributes of the config of platform and model after inheritance,
+// including the ones not used by Config. Model-level configs are omitted, and attributes overridden with null are dumped as null.
+func (cs *ConfigSet) Dump(platform, model string) ([]byte, error) {
+	attrs, err := cs.resolvedAttrs(platform, model)
+	if err != nil {
+		return nil, err
+	}
+	delete(attrs, attrModels)
+	return json.MarshalIndent(attrs, "", "  ")
+}
+
+// Select returns the IDs of the platform and model configs for which match returns true, sorted by platform.
+// Model configs are only matched if includeModels is true.
+//
+// Example:
+//  ids, err := cs.Select(func(cfg *firmware.Config) bool {
+//     return cfg.HasECCapability(firmware.ECBattery) && cfg.ModeSwitcherType == firmware.TabletDetachableSwitcher
+//  }, false)
+func (cs *ConfigSet) Select(match func(cfg *Config) bool, includeModels bool) ([]ConfigID, error) {
+	var ids []ConfigID
+	for _, p := range cs.Platforms() {
+		cfg, err := cs.Resolve(p, "")
+		if err != nil {
+			return nil, err
+		}
+		if match(cfg) {
+			ids = append(ids, ConfigID{Platform: p})
+		}
+		if !includeModels {
+			continue
+		}
+		models, err := cs.Models(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range models {
+			cfg, err := cs.Resolve(p, m)
+			if err != nil {
+				return nil, err
+			}
+			if match(cfg) {
+				ids = append(ids, ConfigID{p, m})
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Validate checks the configs of all platforms and models against the schema of Config, and returns all the problems found.
+// Attributes unknown to Config are accepted if DEFAULTS declares them.
+func (cs *ConfigSet) Validate() []error {
+	var errs []error
+	defaults, err := cs.attrs(defaultName)
+	if err != nil {
+		return []error{err}
+	}
+	for _, p := range append([]string{defaultName}, cs.Platforms()...) {
+		attrs, err := cs.attrs(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var platform string
+		if b, ok := attrs[attrPlatform]; ok {
+			if err := json.Unmarshal(b, &platform); err != nil {
+				errs = append(errs, errors.Wrapf(err, "%s: unmarshaling platform", p))
+				platform = p
+			}
+		}
+		if p != defaultName && platform != p {
+			errs = append(errs, errors.Errorf("%s: platform is %q; want %q", p, platform, p))
+		}
+		for _, err := range validateAttrs(attrs, defaults) {
+			errs = append(errs, errors.Wrap(err, p))
+		}
+		if _, err := cs.inheritance(p); err != nil {
+			errs = append(errs, errors.Wrap(err, p))
+			continue
+		}
+		if _, err := cs.Resolve(p, ""); err != nil {
+			errs = append(errs, errors.Wrap(err, p))
+		}
+
+		models, err := cs.Models(p)
+		if err != nil {
+			errs = append(errs, errors.Wrap(err, p))
+			continue
+		}
+		for _, m := range models {
+			id := ConfigID{p, m}.String()
+			var modelAttrs map[string]map[string]json.RawMessage
+			if err := json.Unmarshal(attrs[attrModels], &modelAttrs); err != nil || modelAttrs[m] == nil {
+				errs = append(errs, errors.Errorf("%s: model config is not an object", id))
+				continue
+			}
+			for _, a := range []string{attrPlatform, attrParent, attrModels} {
+				if _, ok := modelAttrs[m][a]; ok {
+					errs = append(errs, errors.Errorf("%s: %s cannot be set by a model", id, a))
+				}
+			}
+			for _, err := range validateAttrs(modelAttrs[m], defaults) {
+				errs = append(errs, errors.Wrap(err, id))
+			}
+			if _, err := cs.Resolve(p, m); err != nil {
+				errs = append(errs, errors.Wrap(err, id))
+			}
+		}
+	}
+	return errs
+}
+
+// validateAttrs checks the values of attrs against configSchema and configEnums.
+// Attributes missing from the schema must be declared in defaults.
+func validateAttrs(attrs, defaults map[string]json.RawMessage) []error {
+	var names []string
+	for k := range attrs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, k := range names {
+		kind, ok := configSchema[k]
+		if !ok {
+			if _, ok := defaults[k]; !ok {
+				errs = append(errs, errors.Errorf("unknown attribute %q", k))
+			}
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(attrs[k], &v); err != nil {
+			errs = append(errs, errors.Wrapf(err, "unmarshaling %s", k))
+			continue
+		}
+		if v == nil {
+			// null resets lists and maps, and leaves other values inherited from the parent.
+			continue
+		}
+		var vs []interface{}
+		switch kind {
+		case reflect.String:
+			vs = []interface{}{v}
+			if _, ok := v.(string); !ok {
+				errs = append(errs, errors.Errorf("%s is %v; want a string", k, v))
+				continue
+			}
+		case reflect.Bool:
+			if _, ok := v.(bool); !ok {
+				errs = append(errs, errors.Errorf("%s is %v; want a boolean", k, v))
+			}
+		case reflect.Float64:
+			if f, ok := v.(float64); !ok || f < 0 {
+				errs = append(errs, errors.Errorf("%s is %v; want a non-negative number", k, v))
+			}
+		case reflect.Slice:
+			l, ok := v.([]interface{})
+			if !ok {
+				errs = append(errs, errors.Errorf("%s is %v; want a list", k, v))
+				continue
+			}
+			vs = l
+		case reflect.Map:
+			if _, ok := v.(map[string]interface{}); !ok {
+				errs = append(errs, errors.Errorf("%s is %v; want an object", k, v))
+			}
+		}
+		if enum, ok := configEnums[k]; ok {
+			for _, e := range vs {
+				if s, ok := e.(string); !ok || !containsString(enum, s) {
+					errs = append(errs, errors.Errorf("%s has unknown value %v; want one of %q", k, e, enum))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// containsString returns whether ss contains s.
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package firmware
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newMockConfigSet returns a ConfigSet holding mockData, with the platforms of extra added or replaced.
+func newMockConfigSet(t *testing.T, extra map[string]string) *ConfigSet {
+	data := make(map[string]json.RawMessage)
+	for k, v := range mockData {
+		data[k] = v
+	}
+	for k, v := range extra {
+		data[k] = json.RawMessage(v)
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal("Marshaling mock data: ", err)
+	}
+	cs, err := NewConfigSet(b)
+	if err != nil {
+		t.Fatal("NewConfigSet failed: ", err)
+	}
+	return cs
+}
+
+// TestLoadConfigSet verifies that a ConfigSet resolves the same configs as NewConfig.
+func TestLoadConfigSet(t *testing.T) {
+	cfgDir, cfgFilepath, err := setupMockData(t)
+	defer os.RemoveAll(cfgDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := LoadConfigSet(cfgFilepath)
+	if err != nil {
+		t.Fatal("LoadConfigSet failed: ", err)
+	}
+	if ps, expected := cs.Platforms(), []string{myBoardName, myGrandparentName, myParentName, withECBatteryName}; !reflect.DeepEqual(ps, expected) {
+		t.Errorf("Platforms() = %v; want %v", ps, expected)
+	}
+	if ms, err := cs.Models(myBoardName); err != nil {
+		t.Error("Models failed: ", err)
+	} else if !reflect.DeepEqual(ms, []string{myModelName}) {
+		t.Errorf("Models(%q) = %v; want [%s]", myBoardName, ms, myModelName)
+	}
+	for _, id := range []ConfigID{{myBoardName, ""}, {myBoardName, myModelName}, {myGrandparentName, ""}, {withECBatteryName, ""}} {
+		cfg, err := cs.Resolve(id.Platform, id.Model)
+		if err != nil {
+			t.Errorf("Resolve(%s) failed: %v", id, err)
+			continue
+		}
+		expected, err := NewConfig(cfgFilepath, id.Platform, id.Model)
+		if err != nil {
+			t.Errorf("NewConfig(%s) failed: %v", id, err)
+			continue
+		}
+		if !reflect.DeepEqual(cfg, expected) {
+			t.Errorf("Resolve(%s) = %+v; want %+v", id, cfg, expected)
+		}
+	}
+	if _, err := cs.Resolve("missing", ""); err == nil {
+		t.Error("Resolve unexpectedly succeeded for a missing platform")
+	}
+}
+
+// TestConfigSetDump verifies that Dump returns the attributes of a config after inheritance.
+func TestConfigSetDump(t *testing.T) {
+	cs := newMockConfigSet(t, map[string]string{
+		// Attributes unknown to Config are dumped too, and null overrides inherited values.
+		myParentName: `{"platform": "myparent", "parent": "mygrandparent", "usb_plug": null, "has_lid": true}`,
+	})
+	b, err := cs.Dump(myBoardName, myModelName)
+	if err != nil {
+		t.Fatal("Dump failed: ", err)
+	}
+	var attrs map[string]interface{}
+	if err := json.Unmarshal(b, &attrs); err != nil {
+		t.Fatalf("Dump returned invalid JSON %s: %v", b, err)
+	}
+	expected := map[string]interface{}{
+		"platform":             myBoardName,
+		"parent":               myParentName,
+		"firmware_screen":      myModelValue,
+		"delay_reboot_to_ping": float64(defaultValue),
+		"confirm_screen":       myGrandparentValue,
+		"usb_plug":             nil,
+		"has_lid":              true,
+	}
+	if !reflect.DeepEqual(attrs, expected) {
+		t.Errorf("Dump returned %s; want %v", b, expected)
+	}
+}
+
+// TestConfigSetResolveNull verifies that null values reset inherited lists and maps, and leave other inherited values unchanged,
+// as when unmarshaling the configs in order.
+func TestConfigSetResolveNull(t *testing.T) {
+	const nullName = "withNulls"
+	cs := newMockConfigSet(t, map[string]string{
+		nullName: fmt.Sprintf(`{"platform": %q, "parent": %q, "ec_capability": null, "usb_plug": null, "models": null}`, nullName, withECBatteryName),
+		myParentName: fmt.Sprintf(`{"platform": %q, "parent": %q, "confirm_screen": null, "models": {%q: {"usb_plug": %f}}}`,
+			myParentName, myGrandparentName, myOtherModelName, myParentValue),
+	})
+
+	cfg, err := cs.Resolve(withECBatteryName, "")
+	if err != nil {
+		t.Fatal("Resolve failed: ", err)
+	}
+	if !cfg.HasECCapability(ECBattery) {
+		t.Fatalf("Platform %q has EC capabilities %v; want %q", withECBatteryName, cfg.ECCapability, ECBattery)
+	}
+	parentCfg := cfg
+
+	cfg, err = cs.Resolve(nullName, "")
+	if err != nil {
+		t.Fatal("Resolve failed: ", err)
+	}
+	if cfg.ECCapability != nil {
+		t.Errorf("Platform %q has EC capabilities %v; want nil", nullName, cfg.ECCapability)
+	}
+	if cfg.USBPlug != parentCfg.USBPlug {
+		t.Errorf("Platform %q has USBPlug %v; want %v inherited from %q", nullName, cfg.USBPlug, parentCfg.USBPlug, withECBatteryName)
+	}
+
+	// The models of parents are merged with the models of the platform.
+	cfg, err = cs.Resolve(myBoardName, myOtherModelName)
+	if err != nil {
+		t.Fatal("Resolve failed: ", err)
+	}
+	if cfg.USBPlug != myParentDuration {
+		t.Errorf("Model %q has USBPlug %v; want %v from the config of %q", myOtherModelName, cfg.USBPlug, myParentDuration, myParentName)
+	}
+	if cfg.ConfirmScreen != myGrandparentDuration {
+		t.Errorf("Platform %q has ConfirmScreen %v; want %v inherited from %q", myBoardName, cfg.ConfirmScreen, myGrandparentDuration, myGrandparentName)
+	}
+}
+
+// TestConfigSetSelect verifies that Select finds the platforms and models matching a query.
+func TestConfigSetSelect(t *testing.T) {
+	cs := newMockConfigSet(t, map[string]string{
+		"detachable": `{
+			"platform": "detachable",
+			"mode_switcher_type": "tablet_detachable_switcher",
+			"ec_capability": ["battery", "lid"],
+			"models": {"clamshell": {"mode_switcher_type": "keyboard_dev_switcher"}}
+		}`,
+	})
+	match := func(cfg *Config) bool {
+		return cfg.HasECCapability(ECBattery) && cfg.ModeSwitcherType == TabletDetachableSwitcher
+	}
+	ids, err := cs.Select(match, false)
+	if err != nil {
+		t.Fatal("Select failed: ", err)
+	}
+	if expected := []ConfigID{{Platform: "detachable"}}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Select returned %v; want %v", ids, expected)
+	}
+
+	ids, err = cs.Select(func(cfg *Config) bool { return cfg.HasECCapability(ECBattery) }, true)
+	if err != nil {
+		t.Fatal("Select failed: ", err)
+	}
+	if expected := []ConfigID{{"detachable", ""}, {"detachable", "clamshell"}, {withECBatteryName, ""}}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Select including models returned %v; want %v", ids, expected)
+	}
+}
+
+// TestConfigSetValidate verifies that Validate accepts the mock data and reports invalid configs.
+func TestConfigSetValidate(t *testing.T) {
+	if errs := newMockConfigSet(t, nil).Validate(); len(errs) != 0 {
+		t.Errorf("Validate returned %v for valid configs; want none", errs)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		platform string
+		cfg      string
+		want     string
+	}{
+		{"wrong platform", "bad", `{"platform": "other"}`, `platform is "other"`},
+		{"unknown attribute", "bad", `{"platform": "bad", "no_such_attribute": 1}`, "unknown attribute"},
+		{"wrong type", "bad", `{"platform": "bad", "power_button_dev_switch": "yes"}`, "want a boolean"},
+		{"negative duration", "bad", `{"platform": "bad", "usb_plug": -1}`, "want a non-negative number"},
+		{"unknown mode switcher", "bad", `{"platform": "bad", "mode_switcher_type": "magic_switcher"}`, "unknown value magic_switcher"},
+		{"unknown EC capability", "bad", `{"platform": "bad", "ec_capability": ["battery", "warp"]}`, "unknown value warp"},
+		{"missing parent", "bad", `{"platform": "bad", "parent": "nobody"}`, "did not contain platform nobody"},
+		{"inheritance cycle", myGrandparentName, `{"platform": "mygrandparent", "parent": "myboard"}`, "inheritance cycle"},
+		{"model sets parent", "bad", `{"platform": "bad", "models": {"m": {"parent": "myboard"}}}`, "bad/m: parent cannot be set by a model"},
+		{"invalid model", "bad", `{"platform": "bad", "models": {"m": {"usb_plug": "slow"}}}`, "bad/m: usb_plug"},
+		{"non-string platform", "bad", `{"platform": 1}`, "bad: unmarshaling platform"},
+	} {
+		errs := newMockConfigSet(t, map[string]string{tc.platform: tc.cfg}).Validate()
+		var msgs []string
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		if !strings.Contains(strings.Join(msgs, "\n"), tc.want) {
+			t.Errorf("%s: Validate returned %q; want an error containing %q", tc.name, msgs, tc.want)
+		}
+	}
+}
+
+// TestValidateCheckedInConfigs validates the configs of fw-testing-configs if they are checked out,
+// and the configs of testdata, which follow the layout of fw-testing-configs.
+func TestValidateCheckedInConfigs(t *testing.T) {
+	paths := []string{filepath.Join("testdata", consolidatedBasename)}
+	// fw-testing-configs is checked out in the data directory of this package, see the symlink
+	// to it from the data directory of the firmware test bundle.
+	if p := filepath.Join("data", ConfigFile); fileExists(p) {
+		paths = append(paths, p)
+	} else {
+		t.Logf("%s is not checked out; only validating %s", p, paths[0])
+	}
+	for _, p := range paths {
+		cs, err := LoadConfigSet(p)
+		if err != nil {
+			t.Error("LoadConfigSet failed: ", err)
+			continue
+		}
+		if len(cs.Platforms()) == 0 {
+			t.Errorf("%s contains no platforms", p)
+		}
+		for _, err := range cs.Validate() {
+			t.Errorf("%s: %v", p, err)
+		}
+	}
+}
+
+// fileExists returns whether the file at path exists.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
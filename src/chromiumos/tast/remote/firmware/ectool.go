@@ -9,11 +9,63 @@ package firmware
 import (
 	"context"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"chromiumos/tast/dut"
 	"chromiumos/tast/errors"
+	"chromiumos/tast/remote/firmware/reporters"
 )
 
+// ECToolName is the name of an EC device, as passed to ectool's --name flag.
+type ECToolName string
+
+// These are the EC devices which tests talk to.
+const (
+	ECToolNameMain        ECToolName = "cros_ec"
+	ECToolNameFingerprint ECToolName = "cros_fp"
+	ECToolNameISH         ECToolName = "cros_ish"
+)
+
+// ECTool runs ectool subcommands on the DUT, and parses their output.
+// It is shared by firmware, power and USB-C tests, so that they agree on the meaning of ectool's output.
+type ECTool struct {
+	runner reporters.CommandRunner
+	name   ECToolName
+}
+
+// NewECTool creates an ECTool talking to the EC device name of d.
+func NewECTool(d *dut.DUT, name ECToolName) *ECTool {
+	return &ECTool{dutConn{d}, name}
+}
+
+// NewECToolWithRunner creates an ECTool talking to the EC device name, which runs commands with cr.
+func NewECToolWithRunner(cr reporters.CommandRunner, name ECToolName) *ECTool {
+	return &ECTool{cr, name}
+}
+
+// Command runs "ectool --name=<name> <args>" and returns its output.
+func (ec *ECTool) Command(ctx context.Context, args ...string) (string, error) {
+	args = append([]string{"--name=" + string(ec.name)}, args...)
+	out, err := ec.runner.Output(ctx, "ectool", args...)
+	if err != nil {
+		return "", errors.Wrapf(err, "running 'ectool %s' on dut", strings.Join(args, " "))
+	}
+	return string(out), nil
+}
+
+// parse runs the ectool subcommand args, and parses its output with parse.
+func (ec *ECTool) parse(ctx context.Context, parse func(string) error, args ...string) error {
+	out, err := ec.Command(ctx, args...)
+	if err != nil {
+		return err
+	}
+	if err := parse(out); err != nil {
+		return errors.Wrapf(err, "parsing 'ectool %s' output", strings.Join(args, " "))
+	}
+	return nil
+}
+
 // Regexps to capture values outputted by ectool version.
 var (
 	reFirmwareCopy = regexp.MustCompile(`Firmware copy:\s*(RO|RW)`)
@@ -23,16 +75,27 @@ var (
 
 // ECVersion queries ectool for the EC version on the active firmware.
 func ECVersion(ctx context.Context, d *dut.DUT) (string, error) {
-	output, err := d.Command("ectool", "version").Output(ctx)
-	if err != nil {
-		return "", errors.Wrap(err, "running 'ectool version' on dut")
-	}
-	match := reFirmwareCopy.FindSubmatch(output)
+	return NewECTool(d, ECToolNameMain).Version(ctx)
+}
+
+// Version returns the version of the active EC firmware copy.
+func (ec *ECTool) Version(ctx context.Context) (string, error) {
+	var v string
+	err := ec.parse(ctx, func(out string) (err error) {
+		v, err = parseECVersion(out)
+		return err
+	}, "version")
+	return v, err
+}
+
+// parseECVersion returns the version of the active firmware copy from the output of "ectool version".
+func parseECVersion(output string) (string, error) {
+	match := reFirmwareCopy.FindStringSubmatch(output)
 	if len(match) == 0 {
 		return "", errors.Errorf("did not find firmware copy in 'ectool version' output: %s", output)
 	}
 	var reActiveFWVersion *regexp.Regexp
-	switch string(match[1]) {
+	switch match[1] {
 	case "RO":
 		reActiveFWVersion = reROVersion
 	case "RW":
@@ -40,9 +103,455 @@ func ECVersion(ctx context.Context, d *dut.DUT) (string, error) {
 	default:
 		return "", errors.Errorf("unexpected match from reFirmwareCopy: got %s; want RO or RW", match[1])
 	}
-	match = reActiveFWVersion.FindSubmatch(output)
+	match = reActiveFWVersion.FindStringSubmatch(output)
 	if len(match) == 0 {
 		return "", errors.Errorf("failed to match regexp %s in ectool version output: %s", reActiveFWVersion, output)
 	}
-	return string(match[1]), nil
+	return match[1], nil
+}
+
+// reKeyValue matches the "key: value" or "key   value" lines of ectool's output.
+// Keys contain single spaces, and are separated from values by a colon or by several spaces.
+var reKeyValue = regexp.MustCompile(`^([^\s:]+(?: [^\s:]+)*?)\s*(?::|\s{2,})\s*(.*)$`)
+
+// parseKeyValues parses the "key: value" lines of output. Other lines are ignored.
+func parseKeyValues(output string) map[string]string {
+	kvs := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if m := reKeyValue.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			kvs[m[1]] = m[2]
+		}
+	}
+	return kvs
+}
+
+// reLeadingInt matches the integer at the start of a value.
+var reLeadingInt = regexp.MustCompile(`^-?\d+`)
+
+// leadingInt parses the integer at the start of s, ignoring a unit following it, e.g. "4550 mAh" or "13200mV".
+func leadingInt(s string) (int, error) {
+	m := reLeadingInt.FindString(strings.TrimSpace(s))
+	if m == "" {
+		return 0, errors.Errorf("no integer in %q", s)
+	}
+	return strconv.Atoi(m)
+}
+
+// intFields parses the integers at the start of the values of kvs, storing them in the destinations of fields.
+func intFields(kvs map[string]string, fields map[string]*int) error {
+	for k, dst := range fields {
+		v, ok := kvs[k]
+		if !ok {
+			return errors.Errorf("missing %q", k)
+		}
+		n, err := leadingInt(v)
+		if err != nil {
+			return errors.Wrapf(err, "parsing %q", k)
+		}
+		*dst = n
+	}
+	return nil
+}
+
+// ECBatteryInfo contains the battery info reported by "ectool battery".
+type ECBatteryInfo struct {
+	OEMName      string
+	ModelNumber  string
+	Chemistry    string
+	SerialNumber string
+
+	DesignCapacityMAh    int
+	LastFullChargeMAh    int
+	DesignVoltageMV      int
+	CycleCount           int
+	VoltageMV            int
+	CurrentMA            int
+	RemainingCapacityMAh int
+
+	// Flags contains the names of the battery flags which are set, e.g. "AC_PRESENT" or "CHARGING".
+	Flags []string
+}
+
+// HasFlag returns whether the battery flag f, e.g. "BATT_PRESENT", is set.
+func (b *ECBatteryInfo) HasFlag(f string) bool {
+	for _, x := range b.Flags {
+		if x == f {
+			return true
+		}
+	}
+	return false
+}
+
+// Battery returns the battery info.
+func (ec *ECTool) Battery(ctx context.Context) (*ECBatteryInfo, error) {
+	var b *ECBatteryInfo
+	err := ec.parse(ctx, func(out string) (err error) {
+		b, err = parseECBattery(out)
+		return err
+	}, "battery")
+	return b, err
+}
+
+// parseECBattery parses the output of "ectool battery".
+func parseECBattery(output string) (*ECBatteryInfo, error) {
+	kvs := parseKeyValues(output)
+	b := &ECBatteryInfo{
+		OEMName:      kvs["OEM name"],
+		ModelNumber:  kvs["Model number"],
+		Chemistry:    kvs["Chemistry"],
+		SerialNumber: kvs["Serial number"],
+	}
+	if err := intFields(kvs, map[string]*int{
+		"Design capacity":       &b.DesignCapacityMAh,
+		"Last full charge":      &b.LastFullChargeMAh,
+		"Design output voltage": &b.DesignVoltageMV,
+		"Cycle count":           &b.CycleCount,
+		"Present voltage":       &b.VoltageMV,
+		"Present current":       &b.CurrentMA,
+		"Remaining capacity":    &b.RemainingCapacityMAh,
+	}); err != nil {
+		return nil, err
+	}
+	// Flags are printed as a hex mask followed by their names.
+	if f := strings.Fields(kvs["Flags"]); len(f) > 0 {
+		b.Flags = f[1:]
+	}
+	return b, nil
+}
+
+// ECChargeState contains the charge state reported by "ectool chargestate show".
+type ECChargeState struct {
+	ACPresent bool
+
+	ChargerVoltageMV      int
+	ChargerCurrentMA      int
+	ChargerInputCurrentMA int
+
+	BatteryPercent int
+}
+
+// ChargeState returns the charge state.
+func (ec *ECTool) ChargeState(ctx context.Context) (*ECChargeState, error) {
+	var cs *ECChargeState
+	err := ec.parse(ctx, func(out string) (err error) {
+		cs, err = parseECChargeState(out)
+		return err
+	}, "chargestate", "show")
+	return cs, err
+}
+
+// parseECChargeState parses the "key = value" lines of the output of "ectool chargestate show".
+func parseECChargeState(output string) (*ECChargeState, error) {
+	kvs := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+			kvs[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	cs := &ECChargeState{ACPresent: kvs["ac"] == "1"}
+	if err := intFields(kvs, map[string]*int{
+		"chg_voltage":          &cs.ChargerVoltageMV,
+		"chg_current":          &cs.ChargerCurrentMA,
+		"chg_input_current":    &cs.ChargerInputCurrentMA,
+		"batt_state_of_charge": &cs.BatteryPercent,
+	}); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// ECTemp is the temperature of a sensor reported by "ectool temps all".
+type ECTemp struct {
+	// Name is the name of the sensor, or its index with ectool versions which do not print names.
+	Name   string
+	Kelvin int
+}
+
+// Celsius returns the temperature in Celsius.
+func (t ECTemp) Celsius() int {
+	return t.Kelvin - 273
+}
+
+// Temps returns the temperatures of all the sensors which could be read.
+func (ec *ECTool) Temps(ctx context.Context) ([]ECTemp, error) {
+	var temps []ECTemp
+	err := ec.parse(ctx, func(out string) (err error) {
+		temps, err = parseECTemps(out)
+		return err
+	}, "temps", "all")
+	return temps, err
+}
+
+// reTemp matches the temperature lines of "ectool temps all", e.g. "Battery   303 K (= 30 C) ..." or "0: 316 K".
+var reTemp = regexp.MustCompile(`^(\S.*?):?\s+(\d+) K\b`)
+
+// parseECTemps parses the output of "ectool temps all".
+// Sensors which could not be read, e.g. "Sensor 2 not calibrated" or "Core  Error", are skipped.
+func parseECTemps(output string) ([]ECTemp, error) {
+	var temps []ECTemp
+	for _, line := range strings.Split(output, "\n") {
+		m := reTemp.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		k, err := strconv.Atoi(m[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing temperature of %q", m[1])
+		}
+		temps = append(temps, ECTemp{m[1], k})
+	}
+	if len(temps) == 0 {
+		return nil, errors.Errorf("no temperature found in %q", output)
+	}
+	return temps, nil
+}
+
+// ECFan is the state of a fan reported by "ectool pwmgetfanrpm all".
+type ECFan struct {
+	Index   int
+	RPM     int
+	Stalled bool
+}
+
+// FanRPMs returns the state of the fans which are present.
+func (ec *ECTool) FanRPMs(ctx context.Context) ([]ECFan, error) {
+	var fans []ECFan
+	err := ec.parse(ctx, func(out string) (err error) {
+		fans, err = parseECFanRPMs(out)
+		return err
+	}, "pwmgetfanrpm", "all")
+	return fans, err
+}
+
+// reFan matches the lines of "ectool pwmgetfanrpm all", e.g. "Fan 0 RPM: 3298" or "Fan 1 stalled!".
+var reFan = regexp.MustCompile(`^Fan (\d+) (?:RPM: (\d+)|(stalled)!|(not present))$`)
+
+// parseECFanRPMs parses the output of "ectool pwmgetfanrpm all".
+func parseECFanRPMs(output string) ([]ECFan, error) {
+	var fans []ECFan
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		m := reFan.FindStringSubmatch(line)
+		if m == nil {
+			return nil, errors.Errorf("unexpected line %q", line)
+		}
+		if m[4] != "" {
+			continue
+		}
+		f := ECFan{Stalled: m[3] != ""}
+		f.Index, _ = strconv.Atoi(m[1])
+		if m[2] != "" {
+			f.RPM, _ = strconv.Atoi(m[2])
+		}
+		fans = append(fans, f)
+	}
+	return fans, nil
+}
+
+// ECSwitches contains the state of the switches reported by "ectool mkbpget switches".
+type ECSwitches struct {
+	LidOpen      bool
+	TabletMode   bool
+	BaseAttached bool
+}
+
+// Switches returns the state of the lid, tablet mode and base attached switches.
+func (ec *ECTool) Switches(ctx context.Context) (*ECSwitches, error) {
+	var sw *ECSwitches
+	err := ec.parse(ctx, func(out string) (err error) {
+		sw, err = parseECSwitches(out)
+		return err
+	}, "mkbpget", "switches")
+	return sw, err
+}
+
+// Bits of the MKBP switches, as defined by EC_MKBP_LID_OPEN, EC_MKBP_TABLET_MODE and EC_MKBP_BASE_ATTACHED in ec_commands.h.
+const (
+	mkbpLidOpen      = 1 << 0
+	mkbpTabletMode   = 1 << 1
+	mkbpBaseAttached = 1 << 2
+)
+
+// reSwitches matches the mask of the switches in the output of "ectool mkbpget switches",
+// which ectool prints on the line following "MKBP switches state:".
+var reSwitches = regexp.MustCompile(`switches state:\s*0x([0-9a-fA-F]+)`)
+
+// parseECSwitches parses the output of "ectool mkbpget switches".
+func parseECSwitches(output string) (*ECSwitches, error) {
+	m := reSwitches.FindStringSubmatch(output)
+	if m == nil {
+		return nil, errors.Errorf("did not find the switches state in %q", output)
+	}
+	mask, err := strconv.ParseUint(m[1], 16, 32)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing switches state %q", m[1])
+	}
+	return &ECSwitches{
+		LidOpen:      mask&mkbpLidOpen != 0,
+		TabletMode:   mask&mkbpTabletMode != 0,
+		BaseAttached: mask&mkbpBaseAttached != 0,
+	}, nil
+}
+
+// ECPDPort is the status of a USB-C PD port reported by "ectool usbpd <port>".
+type ECPDPort struct {
+	Port      int
+	Enabled   bool
+	Connected bool
+	// PowerRole is "SRC" or "SNK".
+	PowerRole string
+	// DataRole is "DFP" or "UFP".
+	DataRole string
+	VCONN    bool
+	// Polarity is 1 or 2, for CC1 or CC2.
+	Polarity int
+	// State is the state of the PD state machine, e.g. "SNK_READY".
+	State string
+}
+
+// PDPort returns the status of the USB-C PD port.
+func (ec *ECTool) PDPort(ctx context.Context, port int) (*ECPDPort, error) {
+	var p *ECPDPort
+	err := ec.parse(ctx, func(out string) (err error) {
+		p, err = parseECPDPort(out)
+		return err
+	}, "usbpd", strconv.Itoa(port))
+	return p, err
+}
+
+// Regexps to capture values outputted by ectool usbpd <port>, e.g.
+// "Port C0 is enabled,connected, Role:SNK UFP Polarity:CC2 State:SNK_READY".
+var (
+	rePDPort     = regexp.MustCompile(`Port C(\d+) is (enabled|disabled)`)
+	rePDRole     = regexp.MustCompile(`Role:(SRC|SNK) (DFP|UFP)( VCONN)?`)
+	rePDPolarity = regexp.MustCompile(`Polarity:CC(\d)`)
+	rePDState    = regexp.MustCompile(`State:(\S+)`)
+)
+
+// parseECPDPort parses the output of "ectool usbpd <port>".
+// Older versions of ectool do not report whether the port is connected; connected ports are then in a READY state.
+func parseECPDPort(output string) (*ECPDPort, error) {
+	m := rePDPort.FindStringSubmatch(output)
+	if m == nil {
+		return nil, errors.Errorf("did not find the port in %q", output)
+	}
+	p := &ECPDPort{Enabled: m[2] == "enabled"}
+	p.Port, _ = strconv.Atoi(m[1])
+	if m := rePDRole.FindStringSubmatch(output); m != nil {
+		p.PowerRole, p.DataRole, p.VCONN = m[1], m[2], m[3] != ""
+	} else {
+		return nil, errors.Errorf("did not find the role in %q", output)
+	}
+	if m := rePDPolarity.FindStringSubmatch(output); m != nil {
+		p.Polarity, _ = strconv.Atoi(m[1])
+	}
+	if m := rePDState.FindStringSubmatch(output); m != nil {
+		p.State = strings.TrimSuffix(m[1], ",")
+	}
+	switch {
+	case strings.Contains(output, ",connected"):
+		p.Connected = true
+	case strings.Contains(output, ",disconnected"):
+		p.Connected = false
+	default:
+		p.Connected = strings.HasSuffix(p.State, "_READY")
+	}
+	return p, nil
+}
+
+// KeyboardBacklight returns the keyboard backlight brightness in percent, and whether the backlight is enabled.
+func (ec *ECTool) KeyboardBacklight(ctx context.Context) (int, bool, error) {
+	var percent int
+	var enabled bool
+	err := ec.parse(ctx, func(out string) (err error) {
+		percent, enabled, err = parseECKeyboardBacklight(out)
+		return err
+	}, "pwmgetkblight")
+	return percent, enabled, err
+}
+
+// SetKeyboardBacklight sets the keyboard backlight brightness in percent.
+func (ec *ECTool) SetKeyboardBacklight(ctx context.Context, percent int) error {
+	if percent < 0 || percent > 100 {
+		return errors.Errorf("unexpected keyboard backlight percent %d; want 0 to 100", percent)
+	}
+	_, err := ec.Command(ctx, "pwmsetkblight", strconv.Itoa(percent))
+	return err
+}
+
+// reKeyboardBacklight matches the output of "ectool pwmgetkblight" when the backlight is enabled.
+var reKeyboardBacklight = regexp.MustCompile(`Current keyboard backlight:\s*(\d+)`)
+
+// parseECKeyboardBacklight parses the output of "ectool pwmgetkblight".
+func parseECKeyboardBacklight(output string) (int, bool, error) {
+	if strings.Contains(output, "Keyboard backlight disabled") {
+		return 0, false, nil
+	}
+	m := reKeyboardBacklight.FindStringSubmatch(output)
+	if m == nil {
+		return 0, false, errors.Errorf("did not find the keyboard backlight in %q", output)
+	}
+	percent, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false, err
+	}
+	return percent, true, nil
+}
+
+// ECFlashInfo contains the EC flash info reported by "ectool flashinfo", in bytes.
+type ECFlashInfo struct {
+	FlashSize   int
+	WriteSize   int
+	EraseSize   int
+	ProtectSize int
+	// WriteIdealSize and Flags are only reported by newer ECs, and are 0 otherwise.
+	WriteIdealSize int
+	Flags          int
+}
+
+// FlashInfo returns the EC flash info.
+func (ec *ECTool) FlashInfo(ctx context.Context) (*ECFlashInfo, error) {
+	var fi *ECFlashInfo
+	err := ec.parse(ctx, func(out string) (err error) {
+		fi, err = parseECFlashInfo(out)
+		return err
+	}, "flashinfo")
+	return fi, err
+}
+
+// parseECFlashInfo parses the output of "ectool flashinfo", whose lines are like "FlashSize 524288".
+func parseECFlashInfo(output string) (*ECFlashInfo, error) {
+	kvs := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if f := strings.Fields(line); len(f) == 2 {
+			kvs[f[0]] = f[1]
+		}
+	}
+	fi := &ECFlashInfo{}
+	if err := intFields(kvs, map[string]*int{
+		"FlashSize":   &fi.FlashSize,
+		"WriteSize":   &fi.WriteSize,
+		"EraseSize":   &fi.EraseSize,
+		"ProtectSize": &fi.ProtectSize,
+	}); err != nil {
+		return nil, err
+	}
+	if v, ok := kvs["WriteIdealSize"]; ok {
+		n, err := leadingInt(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing WriteIdealSize")
+		}
+		fi.WriteIdealSize = n
+	}
+	if v, ok := kvs["Flags"]; ok {
+		n, err := strconv.ParseInt(v, 0, 32)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing Flags")
+		}
+		fi.Flags = int(n)
+	}
+	return fi, nil
 }
@@ -0,0 +1,333 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package firmware
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"chromiumos/tast/errors"
+)
+
+// These are outputs of ectool captured on DUTs.
+const (
+	ectoolVersionOutput = `RO version:    nami_v1.1.8713-6bb3b1d1b
+RW version:    nami_v1.1.8739-25e9d2c14
+Firmware copy: RW
+Build info:    nami_v1.1.8739-25e9d2c14 2019-10-16 10:55:21 @build
+Tool version:  v2.0.5147-7eb9a0a88 2020-09-09 05:45:03 @build
+`
+
+	ectoolBatteryOutput = `Battery info:
+  OEM name:               SMP
+  Model number:           L17M3PB0
+  Chemistry   :           LION
+  Serial number:          0B2A
+  Design capacity:        4550 mAh
+  Last full charge:       4193 mAh
+  Design output voltage   11520 mV
+  Cycle count             52
+  Present voltage         12611 mV
+  Present current         1321 mA
+  Remaining capacity      4114 mAh
+  Flags                   0x0b AC_PRESENT BATT_PRESENT CHARGING
+`
+
+	ectoolChargeStateOutput = `ac = 1
+chg_voltage = 13200mV
+chg_current = 1536mA
+chg_input_current = 2900mA
+batt_state_of_charge = 96%
+`
+
+	ectoolTempsOutput = `--sensor name -------- temperature -------- ratio (fan_off and fan_max) --
+Battery                 303 K (= 30 C)          0% (313 K and 333 K)
+Charger                 305 K (= 32 C)        N/A (fan_off=0 K, fan_max=0 K)
+Core                 Error
+Ambient                 301 K (= 28 C)          7% (300 K and 315 K)
+`
+
+	ectoolTempsOldOutput = `0: 316 K
+1: 309 K
+Sensor 2 not calibrated
+`
+
+	ectoolFanOutput = `Fan 0 RPM: 3298
+Fan 1 stalled!
+Fan 2 not present
+`
+
+	ectoolSwitchesOutput = `MKBP switches state:
+0x0005
+Lid open
+Tablet mode disabled
+Base attached
+`
+
+	ectoolPDPortOutput = `Port C1 is enabled,connected, Role:SNK UFP Polarity:CC2 State:SNK_READY
+`
+
+	ectoolPDPortOldOutput = `Port C0 is enabled, Role:SRC DFP VCONN Polarity:CC1 State:SRC_READY
+`
+
+	ectoolPDPortDisconnectedOutput = `Port C0 is enabled,disconnected, Role:SNK UFP Polarity:CC1 State:SNK_DISCONNECTED
+`
+
+	ectoolFlashInfoOutput = `FlashSize 524288
+WriteSize 1
+EraseSize 4096
+ProtectSize 4096
+WriteIdealSize 4
+Flags 0x1
+`
+)
+
+func TestParseECVersion(t *testing.T) {
+	v, err := parseECVersion(ectoolVersionOutput)
+	if err != nil {
+		t.Fatal("parseECVersion failed: ", err)
+	}
+	if expected := "nami_v1.1.8739-25e9d2c14"; v != expected {
+		t.Errorf("parseECVersion returned %q; want %q", v, expected)
+	}
+	ro := strings.Replace(ectoolVersionOutput, "Firmware copy: RW", "Firmware copy: RO", 1)
+	if v, err := parseECVersion(ro); err != nil {
+		t.Error("parseECVersion failed for RO: ", err)
+	} else if expected := "nami_v1.1.8713-6bb3b1d1b"; v != expected {
+		t.Errorf("parseECVersion returned %q for RO; want %q", v, expected)
+	}
+	if _, err := parseECVersion("RO version: foo\n"); err == nil {
+		t.Error("parseECVersion unexpectedly succeeded without a firmware copy")
+	}
+}
+
+func TestParseECBattery(t *testing.T) {
+	b, err := parseECBattery(ectoolBatteryOutput)
+	if err != nil {
+		t.Fatal("parseECBattery failed: ", err)
+	}
+	expected := &ECBatteryInfo{
+		OEMName:              "SMP",
+		ModelNumber:          "L17M3PB0",
+		Chemistry:            "LION",
+		SerialNumber:         "0B2A",
+		DesignCapacityMAh:    4550,
+		LastFullChargeMAh:    4193,
+		DesignVoltageMV:      11520,
+		CycleCount:           52,
+		VoltageMV:            12611,
+		CurrentMA:            1321,
+		RemainingCapacityMAh: 4114,
+		Flags:                []string{"AC_PRESENT", "BATT_PRESENT", "CHARGING"},
+	}
+	if !reflect.DeepEqual(b, expected) {
+		t.Errorf("parseECBattery returned %+v; want %+v", b, expected)
+	}
+	if !b.HasFlag("CHARGING") || b.HasFlag("DISCHARGING") {
+		t.Errorf("HasFlag is wrong for flags %v", b.Flags)
+	}
+	if _, err := parseECBattery("Battery info:\n  OEM name: SMP\n"); err == nil {
+		t.Error("parseECBattery unexpectedly succeeded without capacities")
+	}
+}
+
+func TestParseECChargeState(t *testing.T) {
+	cs, err := parseECChargeState(ectoolChargeStateOutput)
+	if err != nil {
+		t.Fatal("parseECChargeState failed: ", err)
+	}
+	expected := &ECChargeState{
+		ACPresent:             true,
+		ChargerVoltageMV:      13200,
+		ChargerCurrentMA:      1536,
+		ChargerInputCurrentMA: 2900,
+		BatteryPercent:        96,
+	}
+	if !reflect.DeepEqual(cs, expected) {
+		t.Errorf("parseECChargeState returned %+v; want %+v", cs, expected)
+	}
+	if _, err := parseECChargeState("ac = 0\n"); err == nil {
+		t.Error("parseECChargeState unexpectedly succeeded without charger params")
+	}
+}
+
+func TestParseECTemps(t *testing.T) {
+	for _, tc := range []struct {
+		output   string
+		expected []ECTemp
+	}{
+		{ectoolTempsOutput, []ECTemp{{"Battery", 303}, {"Charger", 305}, {"Ambient", 301}}},
+		{ectoolTempsOldOutput, []ECTemp{{"0", 316}, {"1", 309}}},
+	} {
+		temps, err := parseECTemps(tc.output)
+		if err != nil {
+			t.Errorf("parseECTemps(%q) failed: %v", tc.output, err)
+		} else if !reflect.DeepEqual(temps, tc.expected) {
+			t.Errorf("parseECTemps(%q) = %v; want %v", tc.output, temps, tc.expected)
+		}
+	}
+	if c := (ECTemp{"Battery", 303}).Celsius(); c != 30 {
+		t.Errorf("Celsius() = %d; want 30", c)
+	}
+	if _, err := parseECTemps("Sensor 0 not present\n"); err == nil {
+		t.Error("parseECTemps unexpectedly succeeded without temperatures")
+	}
+}
+
+func TestParseECFanRPMs(t *testing.T) {
+	fans, err := parseECFanRPMs(ectoolFanOutput)
+	if err != nil {
+		t.Fatal("parseECFanRPMs failed: ", err)
+	}
+	if expected := []ECFan{{0, 3298, false}, {1, 0, true}}; !reflect.DeepEqual(fans, expected) {
+		t.Errorf("parseECFanRPMs returned %v; want %v", fans, expected)
+	}
+	if _, err := parseECFanRPMs("EC result 3 (INVALID_PARAM)\n"); err == nil {
+		t.Error("parseECFanRPMs unexpectedly succeeded with an error message")
+	}
+}
+
+func TestParseECSwitches(t *testing.T) {
+	for _, tc := range []struct {
+		output   string
+		expected ECSwitches
+	}{
+		{ectoolSwitchesOutput, ECSwitches{LidOpen: true, BaseAttached: true}},
+		{"MKBP switches state:\n0x0002\nLid closed\nTablet mode enabled\nBase detached\n", ECSwitches{TabletMode: true}},
+	} {
+		sw, err := parseECSwitches(tc.output)
+		if err != nil {
+			t.Errorf("parseECSwitches(%q) failed: %v", tc.output, err)
+		} else if *sw != tc.expected {
+			t.Errorf("parseECSwitches(%q) returned %+v; want %+v", tc.output, *sw, tc.expected)
+		}
+	}
+	if _, err := parseECSwitches("Unknown info type\n"); err == nil {
+		t.Error("parseECSwitches unexpectedly succeeded without a state")
+	}
+}
+
+func TestParseECPDPort(t *testing.T) {
+	for _, tc := range []struct {
+		output   string
+		expected ECPDPort
+	}{
+		{ectoolPDPortOutput, ECPDPort{Port: 1, Enabled: true, Connected: true, PowerRole: "SNK", DataRole: "UFP", Polarity: 2, State: "SNK_READY"}},
+		{ectoolPDPortOldOutput, ECPDPort{Port: 0, Enabled: true, Connected: true, PowerRole: "SRC", DataRole: "DFP", VCONN: true, Polarity: 1, State: "SRC_READY"}},
+		{ectoolPDPortDisconnectedOutput, ECPDPort{Port: 0, Enabled: true, PowerRole: "SNK", DataRole: "UFP", Polarity: 1, State: "SNK_DISCONNECTED"}},
+	} {
+		p, err := parseECPDPort(tc.output)
+		if err != nil {
+			t.Errorf("parseECPDPort(%q) failed: %v", tc.output, err)
+		} else if *p != tc.expected {
+			t.Errorf("parseECPDPort(%q) = %+v; want %+v", tc.output, *p, tc.expected)
+		}
+	}
+	if _, err := parseECPDPort("EC result 3 (INVALID_PARAM)\n"); err == nil {
+		t.Error("parseECPDPort unexpectedly succeeded with an error message")
+	}
+}
+
+func TestParseECKeyboardBacklight(t *testing.T) {
+	for _, tc := range []struct {
+		output  string
+		percent int
+		enabled bool
+	}{
+		{"Current keyboard backlight: 50\n", 50, true},
+		{"Keyboard backlight disabled.\n", 0, false},
+	} {
+		percent, enabled, err := parseECKeyboardBacklight(tc.output)
+		if err != nil {
+			t.Errorf("parseECKeyboardBacklight(%q) failed: %v", tc.output, err)
+		} else if percent != tc.percent || enabled != tc.enabled {
+			t.Errorf("parseECKeyboardBacklight(%q) = %d, %v; want %d, %v", tc.output, percent, enabled, tc.percent, tc.enabled)
+		}
+	}
+	if _, _, err := parseECKeyboardBacklight("EC result 1 (INVALID_COMMAND)\n"); err == nil {
+		t.Error("parseECKeyboardBacklight unexpectedly succeeded with an error message")
+	}
+}
+
+func TestParseECFlashInfo(t *testing.T) {
+	fi, err := parseECFlashInfo(ectoolFlashInfoOutput)
+	if err != nil {
+		t.Fatal("parseECFlashInfo failed: ", err)
+	}
+	if expected := (ECFlashInfo{524288, 1, 4096, 4096, 4, 1}); *fi != expected {
+		t.Errorf("parseECFlashInfo returned %+v; want %+v", *fi, expected)
+	}
+	// Older ECs do not report the ideal write size and flags.
+	old := strings.Join(strings.Split(ectoolFlashInfoOutput, "\n")[:4], "\n")
+	if fi, err := parseECFlashInfo(old); err != nil {
+		t.Error("parseECFlashInfo failed for an older EC: ", err)
+	} else if expected := (ECFlashInfo{524288, 1, 4096, 4096, 0, 0}); *fi != expected {
+		t.Errorf("parseECFlashInfo returned %+v for an older EC; want %+v", *fi, expected)
+	}
+}
+
+// fakeECToolRunner returns the outputs of ectool commands, and records the commands it runs.
+type fakeECToolRunner struct {
+	outputs map[string]string
+	cmds    []string
+}
+
+func (r *fakeECToolRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	r.cmds = append(r.cmds, cmd)
+	out, ok := r.outputs[cmd]
+	if !ok {
+		return nil, errors.Errorf("unexpected command %q", cmd)
+	}
+	return []byte(out), nil
+}
+
+func TestECTool(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeECToolRunner{outputs: map[string]string{
+		"ectool --name=cros_ec version":          ectoolVersionOutput,
+		"ectool --name=cros_ec battery":          ectoolBatteryOutput,
+		"ectool --name=cros_ec usbpd 1":          ectoolPDPortOutput,
+		"ectool --name=cros_ec pwmsetkblight 30": "",
+		"ectool --name=cros_ec flashinfo":        "EC result 1 (INVALID_COMMAND)\n",
+	}}
+	ec := NewECToolWithRunner(r, ECToolNameMain)
+
+	if v, err := ec.Version(ctx); err != nil {
+		t.Error("Version failed: ", err)
+	} else if expected := "nami_v1.1.8739-25e9d2c14"; v != expected {
+		t.Errorf("Version() = %q; want %q", v, expected)
+	}
+	if b, err := ec.Battery(ctx); err != nil {
+		t.Error("Battery failed: ", err)
+	} else if b.CycleCount != 52 {
+		t.Errorf("Battery() has cycle count %d; want 52", b.CycleCount)
+	}
+	if p, err := ec.PDPort(ctx, 1); err != nil {
+		t.Error("PDPort failed: ", err)
+	} else if p.Port != 1 || !p.Connected {
+		t.Errorf("PDPort(1) = %+v; want port 1 connected", *p)
+	}
+	if err := ec.SetKeyboardBacklight(ctx, 30); err != nil {
+		t.Error("SetKeyboardBacklight failed: ", err)
+	}
+	if err := ec.SetKeyboardBacklight(ctx, 101); err == nil {
+		t.Error("SetKeyboardBacklight unexpectedly succeeded with 101%")
+	}
+	if _, err := ec.FlashInfo(ctx); err == nil || !strings.Contains(err.Error(), "parsing 'ectool flashinfo' output") {
+		t.Errorf("FlashInfo returned error %v; want a parsing error", err)
+	}
+	if _, err := ec.Temps(ctx); err == nil {
+		t.Error("Temps unexpectedly succeeded when ectool fails")
+	}
+
+	fp := NewECToolWithRunner(r, ECToolNameFingerprint)
+	fp.Version(ctx)
+	if last := r.cmds[len(r.cmds)-1]; last != "ectool --name=cros_fp version" {
+		t.Errorf("Fingerprint ECTool ran %q; want ectool --name=cros_fp version", last)
+	}
+}
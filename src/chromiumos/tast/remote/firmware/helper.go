@@ -50,6 +50,9 @@ type Helper struct {
 	// RPCUtils allows the Helper to call the firmware utils RPC service.
 	RPCUtils fwpb.UtilsServiceClient
 
+	// RPCBios allows the Helper to call the firmware BIOS RPC service.
+	RPCBios fwpb.BiosServiceClient
+
 	// Servo allows us to send commands to a servo device.
 	Servo *servo.Servo
 
@@ -58,6 +61,59 @@ type Helper struct {
 
 	// ServoProxy wraps the Servo object, and communicates with the servod instance.
 	ServoProxy *servo.Proxy
+
+	// dutCtl powers off the DUT and tracks whether it can be reached. If it is nil, DUT is used.
+	dutCtl dutController
+
+	// newRPCUtils creates RPCUtils instead of dialing the DUT's gRPC server, if it is set.
+	newRPCUtils func(ctx context.Context) (fwpb.UtilsServiceClient, error)
+
+	// newRPCBios creates RPCBios instead of dialing the DUT's gRPC server, if it is set.
+	newRPCBios func(ctx context.Context) (fwpb.BiosServiceClient, error)
+}
+
+// dutController runs commands on the DUT, powers it off and tracks whether it can be reached.
+type dutController interface {
+	WaitUnreachable(ctx context.Context) error
+	WaitConnect(ctx context.Context) error
+	Poweroff(ctx context.Context) error
+	Run(ctx context.Context, name string, args ...string) error
+}
+
+// dutConn implements dutController and reporters.CommandRunner for a real DUT.
+type dutConn struct {
+	d *dut.DUT
+}
+
+func (c dutConn) WaitUnreachable(ctx context.Context) error {
+	return c.d.WaitUnreachable(ctx)
+}
+
+func (c dutConn) WaitConnect(ctx context.Context) error {
+	return c.d.WaitConnect(ctx)
+}
+
+// Poweroff runs the "poweroff" command on the DUT.
+func (c dutConn) Poweroff(ctx context.Context) error {
+	return c.d.Command("poweroff").Run(ctx)
+}
+
+// Run runs a command on the DUT.
+func (c dutConn) Run(ctx context.Context, name string, args ...string) error {
+	return c.d.Command(name, args...).Run(ctx)
+}
+
+// Output runs the command on the DUT and returns its stdout.
+func (c dutConn) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return c.d.Command(name, args...).Output(ctx)
+}
+
+// dutController returns the dutController of the DUT.
+func (h *Helper) dutController() dutController {
+	if h.dutCtl != nil {
+		return h.dutCtl
+	}
+	return dutConn{h.DUT}
 }
 
 // NewHelper creates a new Helper object with info from testing.State.
@@ -66,7 +122,7 @@ func NewHelper(d *dut.DUT, rpcHint *testing.RPCHint, cfgFilepath, servoHostPort
 	return &Helper{
 		cfgFilepath:   cfgFilepath,
 		DUT:           d,
-		Reporter:      reporters.New(d),
+		Reporter:      reporters.NewWithRunner(dutConn{d}),
 		rpcHint:       rpcHint,
 		servoHostPort: servoHostPort,
 	}
@@ -111,6 +167,14 @@ func (h *Helper) RequireRPCUtils(ctx context.Context) error {
 	if h.RPCUtils != nil {
 		return nil
 	}
+	if h.newRPCUtils != nil {
+		u, err := h.newRPCUtils(ctx)
+		if err != nil {
+			return errors.Wrap(err, "creating RPC utils")
+		}
+		h.RPCUtils = u
+		return nil
+	}
 	if err := h.RequireRPCClient(ctx); err != nil {
 		return errors.Wrap(err, "requiring RPC client")
 	}
@@ -118,15 +182,35 @@ func (h *Helper) RequireRPCUtils(ctx context.Context) error {
 	return nil
 }
 
+// RequireRPCBios creates a firmware.BiosServiceClient, unless one already exists.
+func (h *Helper) RequireRPCBios(ctx context.Context) error {
+	if h.RPCBios != nil {
+		return nil
+	}
+	if h.newRPCBios != nil {
+		b, err := h.newRPCBios(ctx)
+		if err != nil {
+			return errors.Wrap(err, "creating RPC bios")
+		}
+		h.RPCBios = b
+		return nil
+	}
+	if err := h.RequireRPCClient(ctx); err != nil {
+		return errors.Wrap(err, "requiring RPC client")
+	}
+	h.RPCBios = fwpb.NewBiosServiceClient(h.RPCClient.Conn)
+	return nil
+}
+
 // CloseRPCConnection shuts down the RPC client (if present), and removes any RPC clients that the Helper was tracking.
 func (h *Helper) CloseRPCConnection(ctx context.Context) error {
 	if h.RPCClient != nil {
 		if err := h.RPCClient.Close(ctx); err != nil {
-			h.RPCClient, h.RPCUtils = nil, nil
+			h.RPCClient, h.RPCUtils, h.RPCBios = nil, nil, nil
 			return errors.Wrap(err, "closing rpc client")
 		}
 	}
-	h.RPCClient, h.RPCUtils = nil, nil
+	h.RPCClient, h.RPCUtils, h.RPCBios = nil, nil, nil
 	return nil
 }
 
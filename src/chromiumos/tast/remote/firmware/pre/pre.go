@@ -24,6 +24,7 @@ type Value struct {
 type impl struct {
 	v            *Value
 	origBootMode *common.BootMode
+	origState    *firmware.StateSnapshot
 	timeout      time.Duration
 }
 
@@ -83,6 +84,15 @@ func (i *impl) Prepare(ctx context.Context, s *testing.PreState) interface{} {
 		i.origBootMode = &mode
 	}
 
+	// Likewise, save the writable crossystem params and GBB flags, which tests may alter.
+	if i.origState == nil {
+		snap, err := i.v.Helper.SnapshotState(ctx)
+		if err != nil {
+			s.Fatal("Could not save DUT state: ", err)
+		}
+		i.origState = snap
+	}
+
 	if mode != i.v.BootMode {
 		s.Logf("Current boot mode is %q, rebooting to %q to satisfy precondition", mode, i.v.BootMode)
 		if err := i.rebootToMode(ctx, i.v.BootMode); err != nil {
@@ -93,11 +103,12 @@ func (i *impl) Prepare(ctx context.Context, s *testing.PreState) interface{} {
 	return i.v
 }
 
-// Close restores the boot mode before the first Prepare().
+// Close restores the boot mode, crossystem params and GBB flags before the first Prepare().
 func (i *impl) Close(ctx context.Context, s *testing.PreState) {
 	defer func() {
 		i.destroyHelper(ctx, s)
 		i.origBootMode = nil
+		i.origState = nil
 	}()
 
 	// Don't reuse the Helper, as the helper's servo RPC connection may be down.
@@ -119,6 +130,12 @@ func (i *impl) Close(ctx context.Context, s *testing.PreState) {
 			s.Fatal("Failed to restore boot mode: ", err)
 		}
 	}
+
+	if i.origState != nil {
+		if err := i.v.Helper.RestoreState(ctx, i.origState); err != nil {
+			s.Fatal("Failed to restore DUT state: ", err)
+		}
+	}
 }
 
 // String identifies this Precondition.
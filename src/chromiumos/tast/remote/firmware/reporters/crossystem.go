@@ -17,18 +17,26 @@ type CrossystemParam string
 
 // Crossystem params used by tests, add more as needed.
 const (
-	CrossystemParamDevswBoot  CrossystemParam = "devsw_boot"
-	CrossystemParamFWBTries   CrossystemParam = "fwb_tries"
-	CrossystemParamFWTryNext  CrossystemParam = "fw_try_next"
-	CrossystemParamFWTryCount CrossystemParam = "fw_try_count"
-	CrossystemParamFWVboot2   CrossystemParam = "fw_vboot2"
-	CrossystemParamKernkeyVfy CrossystemParam = "kernkey_vfy"
-	CrossystemParamMainfwAct  CrossystemParam = "mainfw_act"
-	CrossystemParamMainfwType CrossystemParam = "mainfw_type"
+	CrossystemParamDevBootLegacy     CrossystemParam = "dev_boot_legacy"
+	CrossystemParamDevBootSignedOnly CrossystemParam = "dev_boot_signed_only"
+	CrossystemParamDevBootUSB        CrossystemParam = "dev_boot_usb"
+	CrossystemParamDevDefaultBoot    CrossystemParam = "dev_default_boot"
+	CrossystemParamDevswBoot         CrossystemParam = "devsw_boot"
+	CrossystemParamFWBTries          CrossystemParam = "fwb_tries"
+	CrossystemParamFWTryNext         CrossystemParam = "fw_try_next"
+	CrossystemParamFWTryCount        CrossystemParam = "fw_try_count"
+	CrossystemParamFWVboot2          CrossystemParam = "fw_vboot2"
+	CrossystemParamKernkeyVfy        CrossystemParam = "kernkey_vfy"
+	CrossystemParamMainfwAct         CrossystemParam = "mainfw_act"
+	CrossystemParamMainfwType        CrossystemParam = "mainfw_type"
 )
 
 var (
 	knownCrossystemParams = []CrossystemParam{
+		CrossystemParamDevBootLegacy,
+		CrossystemParamDevBootSignedOnly,
+		CrossystemParamDevBootUSB,
+		CrossystemParamDevDefaultBoot,
 		CrossystemParamDevswBoot,
 		CrossystemParamFWBTries,
 		CrossystemParamFWTryCount,
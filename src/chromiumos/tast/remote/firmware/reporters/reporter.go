@@ -5,15 +5,38 @@
 package reporters
 
 import (
+	"context"
+
 	"chromiumos/tast/dut"
 )
 
+// CommandRunner runs commands on the DUT and returns their output.
+// It allows a Reporter to be backed by something other than a real DUT, e.g. a simulation in unit tests.
+type CommandRunner interface {
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// dutRunner runs commands over the SSH connection of a DUT.
+type dutRunner struct {
+	d *dut.DUT
+}
+
+// Output runs the command on the DUT and returns its stdout.
+func (r dutRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return r.d.Conn().Command(name, args...).Output(ctx)
+}
+
 // Reporter provides information about the DUT.
 type Reporter struct {
-	d *dut.DUT
+	runner CommandRunner
 }
 
 // New creates a reporter.
 func New(d *dut.DUT) *Reporter {
-	return &Reporter{d}
+	return &Reporter{dutRunner{d}}
+}
+
+// NewWithRunner creates a reporter which runs commands with cr.
+func NewWithRunner(cr CommandRunner) *Reporter {
+	return &Reporter{cr}
 }
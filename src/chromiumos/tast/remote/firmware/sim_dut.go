@@ -0,0 +1,683 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package firmware
+
+/*
+This file implements a simulated DUT, for unit tests of the firmware libraries without a real DUT or servo.
+*/
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc"
+
+	fwCommon "chromiumos/tast/common/firmware"
+	"chromiumos/tast/errors"
+	"chromiumos/tast/remote/firmware/reporters"
+	"chromiumos/tast/remote/servo"
+	fwpb "chromiumos/tast/services/cros/firmware"
+)
+
+// The board and model reported by a SimDUT.
+const (
+	simBoard = "sim"
+	simModel = "sim"
+)
+
+// simScreen is a firmware screen shown by a SimDUT.
+type simScreen string
+
+// These are the firmware screens of a SimDUT.
+const (
+	// screenNone is shown while the DUT is off or booting the OS.
+	screenNone simScreen = ""
+	// screenDevWarning is the developer mode warning, which times out to boot in dev mode.
+	screenDevWarning simScreen = "dev_warning"
+	// screenRecInsert asks for a USB image to boot in recovery mode.
+	screenRecInsert simScreen = "rec_insert"
+	// screenToDev asks to confirm switching to dev mode.
+	screenToDev simScreen = "to_dev"
+	// screenToNorm asks to confirm switching to normal mode.
+	screenToNorm simScreen = "to_norm"
+)
+
+// Menu items selected on the firmware screens of a tablet or detachable SimDUT.
+const (
+	menuConfirm                = "confirm"
+	menuCancel                 = "cancel"
+	menuEnableRootVerification = "enable_root_verification"
+)
+
+// SimOp is an operation of a SimDUT which can be made to fail with SetFailure.
+type SimOp string
+
+// These are the operations of a SimDUT which can be made to fail.
+const (
+	SimOpCommand         SimOp = "command"
+	SimOpSync            SimOp = "sync"
+	SimOpWaitUnreachable SimOp = "wait_unreachable"
+	SimOpWaitConnect     SimOp = "wait_connect"
+	// SimOpTryFirmware makes the firmware tried with fw_try_next fail to boot, so that the DUT
+	// falls back to the other firmware and tries it next, as vboot does.
+	SimOpTryFirmware SimOp = "try_firmware"
+)
+
+// SimDUT simulates the firmware of a DUT, for unit tests of ModeSwitcher and the reporters.
+// It models the power state, the boot mode, the firmware screens navigated with the keyboard
+// or the menu UI, firmware tries and GBB flags, and reports them through crossystem.
+//
+// A SimDUT is powered and controlled through the servo controls of a servo.FakeServod.
+// It implements reporters.CommandRunner, the firmware utils and BIOS RPC services, and
+// the DUT connection used by ModeSwitcher, so a Helper created with NewSimHelper can be used
+// in place of one talking to a real DUT.
+//
+// Example:
+//  fs, err := servo.NewFakeServod()
+//  ...
+//  cfg := &firmware.Config{ModeSwitcherType: firmware.KeyboardDevSwitcher}
+//  d := firmware.NewSimDUT(fs, cfg)
+//  svo, err := servo.New(ctx, fs.ConnSpec())
+//  ...
+//  h := firmware.NewSimHelper(d, svo, cfg)
+type SimDUT struct {
+	cfg *Config
+
+	mu        sync.Mutex
+	powered   bool
+	booted    bool              // whether the OS is up and reachable
+	screen    simScreen         // firmware screen shown while booting
+	selection string            // selected menu item of a menu UI screen
+	next      fwCommon.BootMode // mode in which the OS boots when it leaves the firmware screens
+	mode      fwCommon.BootMode // mode in which the running OS booted
+	devSwitch bool              // virtual dev switch
+	recMode   string            // value of the rec_mode servo control
+	gbb       map[fwpb.GBBFlag]bool
+	mainfwAct fwCommon.RWSection
+	tryNext   fwCommon.RWSection
+	tryCount  uint
+	devBoot   map[reporters.CrossystemParam]string // dev_boot_* params, stored in the NVRAM
+	syncs     int
+	failures  map[SimOp]error
+	events    []string
+}
+
+// NewSimDUT creates a SimDUT booted in normal mode from firmware A, whose firmware screens behave
+// as described by cfg. It handles the servo controls of fs powering the DUT and pressing its keys.
+func NewSimDUT(fs *servo.FakeServod, cfg *Config) *SimDUT {
+	d := &SimDUT{
+		cfg:       cfg,
+		powered:   true,
+		booted:    true,
+		next:      fwCommon.BootModeNormal,
+		mode:      fwCommon.BootModeNormal,
+		recMode:   string(servo.Off),
+		gbb:       make(map[fwpb.GBBFlag]bool),
+		mainfwAct: fwCommon.RWSectionA,
+		tryNext:   fwCommon.RWSectionA,
+		devBoot: map[reporters.CrossystemParam]string{
+			reporters.CrossystemParamDevBootLegacy:     "0",
+			reporters.CrossystemParamDevBootSignedOnly: "0",
+			reporters.CrossystemParamDevBootUSB:        "0",
+			reporters.CrossystemParamDevDefaultBoot:    "disk",
+		},
+		failures: make(map[SimOp]error),
+	}
+	fs.SetControl(string(servo.PowerState), string(servo.PowerStateOn))
+	fs.Handle(string(servo.PowerState), d.setPowerState)
+	fs.Handle(string(servo.RecMode), d.setRecMode)
+	for _, k := range []string{string(servo.CtrlD), string(servo.Enter), string(servo.PowerKey),
+		string(servo.VolumeUpHold), string(servo.VolumeDownHold), string(servo.VolumeUpDownHold)} {
+		k := k
+		fs.Handle(k, func(ctrls map[string]string, value string) error {
+			d.press(k)
+			return nil
+		})
+	}
+	return d
+}
+
+// NewSimHelper creates a Helper for the DUT simulated by d, which uses svo as its servo and cfg as its config.
+// svo is typically connected to the servo.FakeServod passed to NewSimDUT. As the simulated DUT detects
+// the USB image key at once, svo does not wait for it to.
+func NewSimHelper(d *SimDUT, svo *servo.Servo, cfg *Config) *Helper {
+	svo.SetUSBDetectionDelay(0)
+	return &Helper{
+		Board:    simBoard,
+		Config:   cfg,
+		Model:    simModel,
+		Reporter: reporters.NewWithRunner(d),
+		Servo:    svo,
+		dutCtl:   d,
+		newRPCUtils: func(ctx context.Context) (fwpb.UtilsServiceClient, error) {
+			return d, nil
+		},
+		newRPCBios: func(ctx context.Context) (fwpb.BiosServiceClient, error) {
+			return d, nil
+		},
+	}
+}
+
+// SetBootMode makes the DUT booted in mode, with the dev switch set accordingly.
+func (d *SimDUT) SetBootMode(mode fwCommon.BootMode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.powered, d.booted, d.screen = true, true, screenNone
+	d.mode, d.next = mode, mode
+	switch mode {
+	case fwCommon.BootModeDev:
+		d.devSwitch = true
+	case fwCommon.BootModeNormal:
+		d.devSwitch = false
+	}
+}
+
+// SetFailure makes the operation op fail with err. A nil err makes it succeed again.
+func (d *SimDUT) SetFailure(op SimOp, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err == nil {
+		delete(d.failures, op)
+		return
+	}
+	d.failures[op] = err
+}
+
+// Events returns the state changes of the DUT so far, in order, e.g. "screen:to_dev" or "boot:dev".
+func (d *SimDUT) Events() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.events...)
+}
+
+// Syncs returns the number of BlockingSync calls which succeeded.
+func (d *SimDUT) Syncs() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.syncs
+}
+
+// logf records a state change. d.mu must be held.
+func (d *SimDUT) logf(format string, args ...interface{}) {
+	d.events = append(d.events, fmt.Sprintf(format, args...))
+}
+
+// setScreen shows s, selecting the menu item sel. d.mu must be held.
+func (d *SimDUT) setScreen(s simScreen, sel string) {
+	d.screen, d.selection = s, sel
+	if s != screenNone {
+		d.logf("screen:%s", s)
+	}
+}
+
+// devEnabled returns whether the firmware boots in dev mode, which GBB flags can force. d.mu must be held.
+func (d *SimDUT) devEnabled() bool {
+	return d.devSwitch || d.gbb[fwpb.GBBFlag_FORCE_DEV_SWITCH_ON]
+}
+
+// powerOff turns the DUT off. d.mu must be held.
+func (d *SimDUT) powerOff() {
+	if !d.powered {
+		return
+	}
+	d.powered, d.booted = false, false
+	d.setScreen(screenNone, "")
+	d.logf("power:off")
+}
+
+// boot resets the DUT into its firmware. If rec is true, it boots in recovery mode,
+// from the USB image if usb is true. d.mu must be held.
+func (d *SimDUT) boot(rec, usb bool) {
+	d.powered, d.booted = true, false
+	d.setScreen(screenNone, "")
+	if rec {
+		d.logf("power:rec")
+	} else {
+		d.logf("power:on")
+	}
+	switch {
+	case rec && usb:
+		d.next = fwCommon.BootModeRecovery
+	case rec:
+		d.setScreen(screenRecInsert, "")
+	case d.devEnabled():
+		d.next = fwCommon.BootModeDev
+		d.setScreen(screenDevWarning, "")
+	default:
+		d.next = fwCommon.BootModeNormal
+	}
+}
+
+// bootOS leaves the firmware screens and boots the OS in the pending boot mode. d.mu must be held.
+func (d *SimDUT) bootOS() {
+	d.booted = true
+	d.setScreen(screenNone, "")
+	d.mode = d.next
+	if d.mode != fwCommon.BootModeRecovery && d.tryCount > 0 {
+		// The DUT keeps booting the firmware it booted last, unless it is asked to try the other one.
+		d.tryCount--
+		if d.failures[SimOpTryFirmware] != nil {
+			d.tryCount = 0
+			if d.tryNext == fwCommon.RWSectionA {
+				d.tryNext = fwCommon.RWSectionB
+			} else {
+				d.tryNext = fwCommon.RWSectionA
+			}
+		}
+		d.mainfwAct = d.tryNext
+	}
+	d.logf("boot:%s", d.mode)
+}
+
+// confirmToDev enables dev mode from the TO_DEV screen. d.mu must be held.
+func (d *SimDUT) confirmToDev() {
+	d.devSwitch = true
+	d.next = fwCommon.BootModeDev
+	d.setScreen(screenDevWarning, "")
+}
+
+// confirmToNorm disables dev mode from the TO_NORM screen.
+// GBB flags forcing dev mode block it, sending the DUT back to the dev warning. d.mu must be held.
+func (d *SimDUT) confirmToNorm() {
+	if d.gbb[fwpb.GBBFlag_FORCE_DEV_SWITCH_ON] {
+		d.logf("to_norm:blocked")
+		d.setScreen(screenDevWarning, "")
+		return
+	}
+	d.devSwitch = false
+	d.next = fwCommon.BootModeNormal
+	d.bootOS()
+}
+
+// setPowerState handles the power_state servo control.
+func (d *SimDUT) setPowerState(ctrls map[string]string, value string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch servo.PowerStateValue(value) {
+	case servo.PowerStateOff:
+		d.powerOff()
+	case servo.PowerStateOn:
+		if !d.powered {
+			d.boot(false, false)
+		}
+	case servo.PowerStateRec, servo.PowerStateRecForceMRC:
+		usb := ctrls[string(servo.ImageUSBKeyDirection)] == string(servo.USBMuxDUT) && ctrls[string(servo.ImageUSBKeyPwr)] == "on"
+		d.boot(true, usb)
+	case servo.PowerStateReset, servo.PowerStateCR50Reset:
+		d.boot(false, false)
+	case servo.PowerStateWarmReset:
+		if d.powered {
+			d.boot(false, false)
+		}
+	default:
+		return errors.Errorf("invalid value %q for %s", value, servo.PowerState)
+	}
+	if d.powered {
+		ctrls[string(servo.PowerState)] = string(servo.PowerStateOn)
+	} else {
+		ctrls[string(servo.PowerState)] = string(servo.PowerStateOff)
+	}
+	return nil
+}
+
+// setRecMode handles the rec_mode servo control. Toggling the recovery button confirms
+// the TO_DEV screen of DUTs switching to dev mode with it.
+func (d *SimDUT) setRecMode(ctrls map[string]string, value string) error {
+	if value != string(servo.On) && value != string(servo.Off) {
+		return errors.Errorf("invalid value %q for %s", value, servo.RecMode)
+	}
+	ctrls[string(servo.RecMode)] = value
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	pressed := d.recMode == string(servo.Off) && value == string(servo.On)
+	d.recMode = value
+	if pressed && d.powered && !d.booted && d.screen == screenToDev && d.cfg.RecButtonDevSwitch {
+		d.confirmToDev()
+	}
+	return nil
+}
+
+// press handles a keypress on the firmware screens. Keypresses are ignored while the DUT is off or
+// booting the OS, and keys which do nothing on the current screen are ignored too.
+func (d *SimDUT) press(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.powered || d.booted || d.screen == screenNone {
+		return
+	}
+	if d.cfg.ModeSwitcherType == TabletDetachableSwitcher {
+		d.pressMenu(key)
+	} else {
+		d.pressKeyboard(key)
+	}
+}
+
+// pressKeyboard handles a keypress on the firmware screens of a DUT with a keyboard. d.mu must be held.
+func (d *SimDUT) pressKeyboard(key string) {
+	switch d.screen {
+	case screenRecInsert:
+		if key == string(servo.CtrlD) {
+			d.setScreen(screenToDev, "")
+		}
+	case screenToDev:
+		switch {
+		case d.cfg.RecButtonDevSwitch:
+			// Only the recovery button confirms.
+		case d.cfg.PowerButtonDevSwitch:
+			if key == string(servo.PowerKey) {
+				d.confirmToDev()
+			}
+		default:
+			if key == string(servo.Enter) {
+				d.confirmToDev()
+			}
+		}
+	case screenDevWarning:
+		switch key {
+		case string(servo.CtrlD):
+			d.bootOS()
+		case string(servo.Enter):
+			d.setScreen(screenToNorm, "")
+		}
+	case screenToNorm:
+		if key == string(servo.Enter) {
+			d.confirmToNorm()
+		}
+	}
+}
+
+// pressMenu handles a keypress on the menu UI of a tablet or detachable DUT, navigated with the
+// volume buttons and selected with the power button. d.mu must be held.
+func (d *SimDUT) pressMenu(key string) {
+	switch d.screen {
+	case screenRecInsert:
+		if key == string(servo.VolumeUpDownHold) {
+			d.setScreen(screenToDev, menuCancel)
+		}
+	case screenToDev:
+		switch key {
+		case string(servo.VolumeUpHold):
+			d.selection = menuConfirm
+		case string(servo.VolumeDownHold):
+			d.selection = menuCancel
+		case string(servo.PowerKey):
+			if d.selection == menuConfirm {
+				d.confirmToDev()
+			} else {
+				d.setScreen(screenRecInsert, "")
+			}
+		}
+	case screenDevWarning:
+		switch key {
+		case string(servo.VolumeUpHold):
+			d.selection = menuEnableRootVerification
+		case string(servo.VolumeDownHold):
+			d.selection = ""
+		case string(servo.PowerKey):
+			if d.selection == menuEnableRootVerification {
+				d.setScreen(screenToNorm, menuConfirm)
+			}
+		}
+	case screenToNorm:
+		switch key {
+		case string(servo.VolumeUpHold):
+			d.selection = menuConfirm
+		case string(servo.VolumeDownHold):
+			d.selection = menuCancel
+		case string(servo.PowerKey):
+			if d.selection == menuConfirm {
+				d.confirmToNorm()
+			} else {
+				d.setScreen(screenDevWarning, "")
+			}
+		}
+	}
+}
+
+// fail returns the error injected for op, or an error if the DUT cannot be reached. d.mu must be held.
+func (d *SimDUT) fail(op SimOp) error {
+	if err := d.failures[op]; err != nil {
+		return err
+	}
+	if !d.booted {
+		return errors.New("simulated DUT is unreachable")
+	}
+	return nil
+}
+
+// WaitUnreachable returns an error if the DUT is still reachable.
+func (d *SimDUT) WaitUnreachable(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.failures[SimOpWaitUnreachable]; err != nil {
+		return err
+	}
+	if d.booted {
+		return errors.New("simulated DUT is still reachable")
+	}
+	return nil
+}
+
+// WaitConnect lets the DUT finish booting, and returns an error if it cannot be reached,
+// e.g. because it is off or waiting at a firmware screen.
+// The dev warning screen times out, so the DUT boots from it.
+func (d *SimDUT) WaitConnect(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.failures[SimOpWaitConnect]; err != nil {
+		return err
+	}
+	switch {
+	case d.booted:
+		return nil
+	case !d.powered:
+		return errors.New("simulated DUT is off")
+	case d.screen != screenNone && d.screen != screenDevWarning:
+		return errors.Errorf("simulated DUT is waiting at the %s firmware screen", d.screen)
+	}
+	d.bootOS()
+	return nil
+}
+
+// Poweroff handles the "poweroff" command.
+func (d *SimDUT) Poweroff(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.fail(SimOpCommand); err != nil {
+		return err
+	}
+	d.powerOff()
+	return nil
+}
+
+// Run runs a command on the DUT, discarding its output.
+func (d *SimDUT) Run(ctx context.Context, name string, args ...string) error {
+	_, err := d.Output(ctx, name, args...)
+	return err
+}
+
+// Output runs a command on the DUT and returns its output. It simulates the commands used by the reporters.
+func (d *SimDUT) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.fail(SimOpCommand); err != nil {
+		return nil, err
+	}
+	var out string
+	switch cmd := strings.Join(append([]string{name}, args...), " "); {
+	case name == "crossystem":
+		var err error
+		if out, err = d.crossystem(args); err != nil {
+			return nil, err
+		}
+	case cmd == "rootdev -s":
+		if d.mode == fwCommon.BootModeRecovery {
+			out = "/dev/sda3"
+		} else {
+			out = "/dev/mmcblk0p3"
+		}
+	case cmd == "cat /etc/lsb-release":
+		out = "CHROMEOS_RELEASE_BOARD=" + simBoard
+	case cmd == "cat /sys/block/sda/removable":
+		out = "1"
+	case cmd == "cat /sys/block/mmcblk0/removable":
+		out = "0"
+	case cmd == "cros_config / name":
+		out = simModel
+	default:
+		return nil, errors.Errorf("command %q is not simulated", cmd)
+	}
+	return []byte(out + "\n"), nil
+}
+
+// crossystemValues returns the crossystem params of the DUT, with their descriptions. d.mu must be held.
+func (d *SimDUT) crossystemValues() map[reporters.CrossystemParam][2]string {
+	mainfwType := map[fwCommon.BootMode]string{
+		fwCommon.BootModeNormal:   "normal",
+		fwCommon.BootModeDev:      "developer",
+		fwCommon.BootModeRecovery: "recovery",
+	}[d.mode]
+	devswBoot := "0"
+	if d.mode == fwCommon.BootModeDev || (d.mode == fwCommon.BootModeRecovery && d.devEnabled()) {
+		devswBoot = "1"
+	}
+	mainfwAct := string(d.mainfwAct)
+	if d.mode == fwCommon.BootModeRecovery {
+		mainfwAct = "recovery"
+	}
+	return map[reporters.CrossystemParam][2]string{
+		reporters.CrossystemParamDevBootLegacy:     {d.devBoot[reporters.CrossystemParamDevBootLegacy], "[RW/int] Enable developer mode boot Legacy OSes"},
+		reporters.CrossystemParamDevBootSignedOnly: {d.devBoot[reporters.CrossystemParamDevBootSignedOnly], "[RW/int] Enable developer mode boot only from official kernels"},
+		reporters.CrossystemParamDevBootUSB:        {d.devBoot[reporters.CrossystemParamDevBootUSB], "[RW/int] Enable developer mode boot from external disk (USB/SD)"},
+		reporters.CrossystemParamDevDefaultBoot:    {d.devBoot[reporters.CrossystemParamDevDefaultBoot], "[RW/str] Default boot from disk, legacy or usb"},
+		reporters.CrossystemParamDevswBoot:         {devswBoot, "[RO/int] Developer switch position at boot"},
+		reporters.CrossystemParamFWBTries:          {"0", "[RW/int] Try firmware B count"},
+		reporters.CrossystemParamFWTryCount:        {strconv.Itoa(int(d.tryCount)), "[RW/int] Number of times to try fw_try_next"},
+		reporters.CrossystemParamFWTryNext:         {string(d.tryNext), "[RW/str] Firmware to try next (A/B)"},
+		reporters.CrossystemParamFWVboot2:          {"1", "[RO/int] 1 if firmware was selected by vboot2 or 0 otherwise"},
+		reporters.CrossystemParamKernkeyVfy:        {"sig", "[RO/str] Type of verification done on kernel keyblock"},
+		reporters.CrossystemParamMainfwAct:         {mainfwAct, "[RO/str] Active main firmware"},
+		reporters.CrossystemParamMainfwType:        {mainfwType, "[RO/str] Active main firmware type"},
+	}
+}
+
+// crossystem handles the crossystem command: without args it prints all the params,
+// with a param it prints its value, and with param=value args it sets the firmware tries or the dev_boot_* params. d.mu must be held.
+func (d *SimDUT) crossystem(args []string) (string, error) {
+	values := d.crossystemValues()
+	if len(args) == 0 {
+		var names []string
+		for p := range values {
+			names = append(names, string(p))
+		}
+		sort.Strings(names)
+		var lines []string
+		for _, n := range names {
+			v := values[reporters.CrossystemParam(n)]
+			lines = append(lines, fmt.Sprintf("%-23s = %-30s # %s", n, v[0], v[1]))
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	if len(args) == 1 && !strings.Contains(args[0], "=") {
+		v, ok := values[reporters.CrossystemParam(args[0])]
+		if !ok {
+			return "", errors.Errorf("crossystem: invalid param %q", args[0])
+		}
+		return v[0], nil
+	}
+	for _, a := range args {
+		kv := strings.SplitN(a, "=", 2)
+		if len(kv) != 2 {
+			return "", errors.Errorf("crossystem: cannot mix getting and setting params: %q", a)
+		}
+		switch reporters.CrossystemParam(kv[0]) {
+		case reporters.CrossystemParamFWTryNext:
+			if kv[1] != string(fwCommon.RWSectionA) && kv[1] != string(fwCommon.RWSectionB) {
+				return "", errors.Errorf("crossystem: invalid value %q for %s", kv[1], kv[0])
+			}
+			d.tryNext = fwCommon.RWSection(kv[1])
+		case reporters.CrossystemParamFWTryCount:
+			n, err := strconv.ParseUint(kv[1], 10, 32)
+			if err != nil {
+				return "", errors.Errorf("crossystem: invalid value %q for %s", kv[1], kv[0])
+			}
+			d.tryCount = uint(n)
+		case reporters.CrossystemParamDevBootLegacy, reporters.CrossystemParamDevBootSignedOnly, reporters.CrossystemParamDevBootUSB:
+			if kv[1] != "0" && kv[1] != "1" {
+				return "", errors.Errorf("crossystem: invalid value %q for %s", kv[1], kv[0])
+			}
+			d.devBoot[reporters.CrossystemParam(kv[0])] = kv[1]
+		case reporters.CrossystemParamDevDefaultBoot:
+			if kv[1] != "disk" && kv[1] != "usb" && kv[1] != "legacy" {
+				return "", errors.Errorf("crossystem: invalid value %q for %s", kv[1], kv[0])
+			}
+			d.devBoot[reporters.CrossystemParamDevDefaultBoot] = kv[1]
+		default:
+			return "", errors.Errorf("crossystem: cannot set %q", kv[0])
+		}
+	}
+	return "", nil
+}
+
+// BlockingSync syncs the disks of the DUT.
+func (d *SimDUT) BlockingSync(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*empty.Empty, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.fail(SimOpSync); err != nil {
+		return nil, err
+	}
+	d.syncs++
+	return &empty.Empty{}, nil
+}
+
+// ReadServoKeyboard is not simulated.
+func (d *SimDUT) ReadServoKeyboard(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*fwpb.ReadServoKeyboardResponse, error) {
+	return nil, errors.New("ReadServoKeyboard is not simulated")
+}
+
+// GetGBBFlags returns the GBB flags which are cleared and set.
+func (d *SimDUT) GetGBBFlags(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*fwpb.GBBFlagsState, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.fail(SimOpCommand); err != nil {
+		return nil, err
+	}
+	var flags []int
+	for f := range fwpb.GBBFlag_name {
+		flags = append(flags, int(f))
+	}
+	sort.Ints(flags)
+	state := &fwpb.GBBFlagsState{}
+	for _, f := range flags {
+		if d.gbb[fwpb.GBBFlag(f)] {
+			state.Set = append(state.Set, fwpb.GBBFlag(f))
+		} else {
+			state.Clear = append(state.Clear, fwpb.GBBFlag(f))
+		}
+	}
+	return state, nil
+}
+
+// ClearAndSetGBBFlags clears and sets GBB flags, leaving the others unchanged.
+// They take effect at the next boot.
+func (d *SimDUT) ClearAndSetGBBFlags(ctx context.Context, in *fwpb.GBBFlagsState, opts ...grpc.CallOption) (*empty.Empty, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.fail(SimOpCommand); err != nil {
+		return nil, err
+	}
+	for _, f := range in.Clear {
+		delete(d.gbb, f)
+	}
+	for _, f := range in.Set {
+		d.gbb[f] = true
+	}
+	return &empty.Empty{}, nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// This file implements functions to save the writable crossystem params and GBB flags of the DUT, and to restore them.
+
+package firmware
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes/empty"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/remote/firmware/reporters"
+	fwpb "chromiumos/tast/services/cros/firmware"
+	"chromiumos/tast/testing"
+)
+
+// snapshotParams are the writable crossystem params saved by SnapshotState, mapped to whether they persist across reboots.
+// Params which the firmware updates while booting, such as the number of tries left or the firmware to try next,
+// which vboot changes when the tried firmware fails, are restored but not verified after rebooting.
+var snapshotParams = map[reporters.CrossystemParam]bool{
+	reporters.CrossystemParamDevBootLegacy:     true,
+	reporters.CrossystemParamDevBootSignedOnly: true,
+	reporters.CrossystemParamDevBootUSB:        true,
+	reporters.CrossystemParamDevDefaultBoot:    true,
+	reporters.CrossystemParamFWBTries:          false,
+	reporters.CrossystemParamFWTryCount:        false,
+	reporters.CrossystemParamFWTryNext:         false,
+}
+
+// StateSnapshot contains the writable crossystem params and the GBB flags of the DUT at some point.
+// Tests altering them should take a snapshot during setup, and restore it with Helper.RestoreState during teardown.
+type StateSnapshot struct {
+	// Crossystem maps the writable crossystem params reported by the DUT to their values.
+	// Params which the DUT does not report, e.g. fwb_tries on some vboot2 DUTs, are not included.
+	Crossystem map[reporters.CrossystemParam]string
+
+	// GBBFlags contains the GBB flags which are set, sorted.
+	GBBFlags []fwpb.GBBFlag
+}
+
+// SnapshotState saves the writable crossystem params and the GBB flags of the DUT.
+func (h *Helper) SnapshotState(ctx context.Context) (*StateSnapshot, error) {
+	cs, err := h.Reporter.Crossystem(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "reporting crossystem params")
+	}
+	snap := &StateSnapshot{Crossystem: make(map[reporters.CrossystemParam]string)}
+	for p := range snapshotParams {
+		if v, ok := cs[p]; ok {
+			snap.Crossystem[p] = v
+		}
+	}
+	if snap.GBBFlags, err = h.setGBBFlags(ctx); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// setGBBFlags returns the sorted GBB flags which are set on the DUT.
+func (h *Helper) setGBBFlags(ctx context.Context) ([]fwpb.GBBFlag, error) {
+	if err := h.RequireRPCBios(ctx); err != nil {
+		return nil, errors.Wrap(err, "requiring RPC bios")
+	}
+	state, err := h.RPCBios.GetGBBFlags(ctx, &empty.Empty{})
+	if err != nil {
+		return nil, errors.Wrap(err, "getting GBB flags")
+	}
+	flags := append([]fwpb.GBBFlag(nil), state.Set...)
+	sort.Slice(flags, func(i, j int) bool { return flags[i] < flags[j] })
+	return flags, nil
+}
+
+// stateDrift describes a difference between the state of the DUT and a StateSnapshot.
+type stateDrift struct {
+	param reporters.CrossystemParam // empty for the GBB flags
+	got   string
+	want  string
+}
+
+func (d stateDrift) String() string {
+	if d.param == "" {
+		return fmt.Sprintf("GBB flags are [%s]; want [%s]", d.got, d.want)
+	}
+	return fmt.Sprintf("%s is %q; want %q", d.param, d.got, d.want)
+}
+
+// formatGBBFlags returns the names of flags, separated by spaces.
+func formatGBBFlags(flags []fwpb.GBBFlag) string {
+	var names []string
+	for _, f := range flags {
+		names = append(names, f.String())
+	}
+	return strings.Join(names, " ")
+}
+
+// driftFrom returns the differences between the state of the DUT and snap, sorted by param.
+// If persistentOnly is true, the params consumed while booting are not compared.
+func (h *Helper) driftFrom(ctx context.Context, snap *StateSnapshot, persistentOnly bool) ([]stateDrift, error) {
+	cs, err := h.Reporter.Crossystem(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "reporting crossystem params")
+	}
+	var drifts []stateDrift
+	for p, want := range snap.Crossystem {
+		if persistentOnly && !snapshotParams[p] {
+			continue
+		}
+		if got := cs[p]; got != want {
+			drifts = append(drifts, stateDrift{p, got, want})
+		}
+	}
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].param < drifts[j].param })
+
+	flags, err := h.setGBBFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if got, want := formatGBBFlags(flags), formatGBBFlags(snap.GBBFlags); got != want {
+		drifts = append(drifts, stateDrift{"", got, want})
+	}
+	return drifts, nil
+}
+
+// CheckState returns an error listing the differences between the state of the DUT and snap.
+func (h *Helper) CheckState(ctx context.Context, snap *StateSnapshot) error {
+	drifts, err := h.driftFrom(ctx, snap, false)
+	if err != nil {
+		return err
+	}
+	return driftError(drifts)
+}
+
+// driftError returns an error listing drifts, or nil if there are none.
+func driftError(drifts []stateDrift) error {
+	if len(drifts) == 0 {
+		return nil
+	}
+	var msgs []string
+	for _, d := range drifts {
+		msgs = append(msgs, d.String())
+	}
+	return errors.Errorf("DUT state drifted from snapshot: %s", strings.Join(msgs, "; "))
+}
+
+// RestoreState restores the crossystem params and GBB flags which differ from snap.
+// If anything was restored, it reboots the DUT while preserving its boot mode, so that the GBB flags take effect,
+// and returns an error listing the params and flags which did not persist across the reboot.
+// This has the side-effect of disconnecting the RPC connection if the DUT is rebooted.
+func (h *Helper) RestoreState(ctx context.Context, snap *StateSnapshot) error {
+	drifts, err := h.driftFrom(ctx, snap, false)
+	if err != nil {
+		return errors.Wrap(err, "comparing DUT state to snapshot")
+	}
+	if len(drifts) == 0 {
+		return nil
+	}
+
+	var args []string
+	for _, d := range drifts {
+		testing.ContextLog(ctx, "Restoring DUT state: ", d)
+		if d.param != "" {
+			args = append(args, fmt.Sprintf("%s=%s", d.param, d.want))
+		}
+	}
+	if len(args) > 0 {
+		if err := h.dutController().Run(ctx, "crossystem", args...); err != nil {
+			return errors.Wrapf(err, "running crossystem %s", strings.Join(args, " "))
+		}
+	}
+	if d := drifts[len(drifts)-1]; d.param == "" {
+		req := &fwpb.GBBFlagsState{Set: snap.GBBFlags}
+		for f := range fwpb.GBBFlag_name {
+			if !containsGBBFlag(snap.GBBFlags, fwpb.GBBFlag(f)) {
+				req.Clear = append(req.Clear, fwpb.GBBFlag(f))
+			}
+		}
+		sort.Slice(req.Clear, func(i, j int) bool { return req.Clear[i] < req.Clear[j] })
+		if _, err := h.RPCBios.ClearAndSetGBBFlags(ctx, req); err != nil {
+			return errors.Wrap(err, "restoring GBB flags")
+		}
+	}
+
+	ms, err := NewModeSwitcher(ctx, h)
+	if err != nil {
+		return errors.Wrap(err, "creating mode switcher")
+	}
+	if err := ms.ModeAwareReboot(ctx, WarmReset); err != nil {
+		return errors.Wrap(err, "rebooting DUT after restoring state")
+	}
+	if drifts, err = h.driftFrom(ctx, snap, true); err != nil {
+		return errors.Wrap(err, "comparing DUT state to snapshot after reboot")
+	}
+	if err := driftError(drifts); err != nil {
+		return errors.Wrap(err, "after restoring and rebooting")
+	}
+	return nil
+}
+
+// containsGBBFlag returns whether flags contains f.
+func containsGBBFlag(flags []fwpb.GBBFlag, f fwpb.GBBFlag) bool {
+	for _, x := range flags {
+		if x == f {
+			return true
+		}
+	}
+	return false
+}
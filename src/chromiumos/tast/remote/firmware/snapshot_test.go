@@ -0,0 +1,137 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package firmware
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	fwCommon "chromiumos/tast/common/firmware"
+	"chromiumos/tast/errors"
+	"chromiumos/tast/remote/firmware/reporters"
+	fwpb "chromiumos/tast/services/cros/firmware"
+)
+
+func TestSnapshotState(t *testing.T) {
+	ctx := context.Background()
+	ms, d, fs := newSimModeSwitcher(ctx, t, keyboardConfig, keyboardConfig)
+	defer fs.Close()
+	h := ms.Helper
+
+	if _, err := d.ClearAndSetGBBFlags(ctx, &fwpb.GBBFlagsState{Set: []fwpb.GBBFlag{fwpb.GBBFlag_FAFT_KEY_OVERIDE}}); err != nil {
+		t.Fatal("ClearAndSetGBBFlags failed: ", err)
+	}
+	snap, err := h.SnapshotState(ctx)
+	if err != nil {
+		t.Fatal("SnapshotState failed: ", err)
+	}
+	expected := &StateSnapshot{
+		Crossystem: map[reporters.CrossystemParam]string{
+			reporters.CrossystemParamDevBootLegacy:     "0",
+			reporters.CrossystemParamDevBootSignedOnly: "0",
+			reporters.CrossystemParamDevBootUSB:        "0",
+			reporters.CrossystemParamDevDefaultBoot:    "disk",
+			reporters.CrossystemParamFWBTries:          "0",
+			reporters.CrossystemParamFWTryCount:        "0",
+			reporters.CrossystemParamFWTryNext:         "A",
+		},
+		GBBFlags: []fwpb.GBBFlag{fwpb.GBBFlag_FAFT_KEY_OVERIDE},
+	}
+	if !reflect.DeepEqual(snap, expected) {
+		t.Errorf("SnapshotState() = %+v; want %+v", snap, expected)
+	}
+
+	// Nothing changed, so nothing is restored and the DUT is not rebooted.
+	if err := h.CheckState(ctx, snap); err != nil {
+		t.Error("CheckState failed without changes: ", err)
+	}
+	if err := h.RestoreState(ctx, snap); err != nil {
+		t.Error("RestoreState failed without changes: ", err)
+	}
+	if events := d.Events(); len(events) != 0 {
+		t.Errorf("RestoreState without changes went through %v; want no events", events)
+	}
+
+	// Alter the state as a test would.
+	if err := h.dutController().Run(ctx, "crossystem", "dev_boot_usb=1", "fw_try_next=B", "fw_try_count=1"); err != nil {
+		t.Fatal("Failed to set crossystem params: ", err)
+	}
+	if _, err := d.ClearAndSetGBBFlags(ctx, &fwpb.GBBFlagsState{
+		Set:   []fwpb.GBBFlag{fwpb.GBBFlag_DEV_SCREEN_SHORT_DELAY},
+		Clear: []fwpb.GBBFlag{fwpb.GBBFlag_FAFT_KEY_OVERIDE},
+	}); err != nil {
+		t.Fatal("ClearAndSetGBBFlags failed: ", err)
+	}
+	err = h.CheckState(ctx, snap)
+	if err == nil {
+		t.Fatal("CheckState unexpectedly succeeded after changes")
+	}
+	for _, want := range []string{`dev_boot_usb is "1"; want "0"`, `fw_try_count is "1"; want "0"`, `fw_try_next is "B"; want "A"`,
+		"GBB flags are [DEV_SCREEN_SHORT_DELAY]; want [FAFT_KEY_OVERIDE]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("CheckState returned %q; want it to contain %q", err, want)
+		}
+	}
+
+	if err := h.RestoreState(ctx, snap); err != nil {
+		t.Fatal("RestoreState failed: ", err)
+	}
+	if err := h.CheckState(ctx, snap); err != nil {
+		t.Error("CheckState failed after RestoreState: ", err)
+	}
+	if events, expected := d.Events(), []string{"power:on", "boot:normal"}; !reflect.DeepEqual(events, expected) {
+		t.Errorf("RestoreState went through %v; want %v", events, expected)
+	}
+	// The restored try count kept the DUT booting firmware A.
+	if err := CheckFWTries(ctx, h.Reporter, fwCommon.RWSectionA, fwCommon.RWSectionA, 0); err != nil {
+		t.Error("Unexpected FW tries after RestoreState: ", err)
+	}
+}
+
+func TestRestoreStateBootConsumedParams(t *testing.T) {
+	ctx := context.Background()
+	ms, d, fs := newSimModeSwitcher(ctx, t, keyboardConfig, keyboardConfig)
+	defer fs.Close()
+	h := ms.Helper
+
+	snap, err := h.SnapshotState(ctx)
+	if err != nil {
+		t.Fatal("SnapshotState failed: ", err)
+	}
+	// The DUT was about to try firmware B once when the snapshot was taken.
+	snap.Crossystem[reporters.CrossystemParamFWTryNext] = "B"
+	snap.Crossystem[reporters.CrossystemParamFWTryCount] = "1"
+	if err := h.RestoreState(ctx, snap); err != nil {
+		t.Fatal("RestoreState failed: ", err)
+	}
+	// The reboot consumed the try, which is not a drift.
+	if err := CheckFWTries(ctx, h.Reporter, fwCommon.RWSectionB, fwCommon.RWSectionB, 0); err != nil {
+		t.Error("Unexpected FW tries after RestoreState: ", err)
+	}
+	if events, expected := d.Events(), []string{"power:on", "boot:normal"}; !reflect.DeepEqual(events, expected) {
+		t.Errorf("RestoreState went through %v; want %v", events, expected)
+	}
+
+	// The tried firmware fails to boot, so vboot falls back to firmware A and tries it next.
+	if err := h.dutController().Run(ctx, "crossystem", "dev_boot_usb=1", "fw_try_next=B", "fw_try_count=1"); err != nil {
+		t.Fatal("Failed to set crossystem params: ", err)
+	}
+	d.SetFailure(SimOpTryFirmware, errors.New("invalid signature"))
+	if err := h.RestoreState(ctx, snap); err != nil {
+		t.Fatal("RestoreState failed when the tried firmware failed: ", err)
+	}
+	d.SetFailure(SimOpTryFirmware, nil)
+	if err := CheckFWTries(ctx, h.Reporter, fwCommon.RWSectionA, fwCommon.RWSectionA, 0); err != nil {
+		t.Error("Unexpected FW tries after RestoreState with a failed try: ", err)
+	}
+
+	// Values which cannot be restored make RestoreState fail.
+	snap.Crossystem[reporters.CrossystemParamDevDefaultBoot] = "network"
+	if err := h.RestoreState(ctx, snap); err == nil {
+		t.Error("RestoreState unexpectedly succeeded with an invalid dev_default_boot")
+	}
+}
@@ -0,0 +1,430 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package servo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
+)
+
+// A ControlType is the type of the values taken by a servo control.
+type ControlType string
+
+// These are the types of the values taken by servo controls.
+const (
+	ControlTypeString   ControlType = "string"
+	ControlTypeInt      ControlType = "int"
+	ControlTypeOnOff    ControlType = "onoff"
+	ControlTypeKeypress ControlType = "keypress"
+)
+
+// ControlInfo describes a servo control.
+type ControlInfo struct {
+	// Type is the type of the values taken by the control.
+	Type ControlType
+	// Values lists the values accepted by the control. Any value of Type is accepted if it is empty.
+	Values []string
+	// ReadOnly is true if the control cannot be set.
+	ReadOnly bool
+}
+
+// controlCatalog describes the controls used by this package, and must list every control
+// declared in this package. It mirrors the metadata of the servod control configs, against
+// which Catalog.Validate cross-checks it, and is only a fallback for what servod does not
+// report: see Catalog.Info. Whether a servo provides a control is not listed here, but
+// queried from servod by Servo.Catalog.
+var controlCatalog = map[string]ControlInfo{
+	string(ActiveChgPort):        {Type: ControlTypeString},
+	string(DUTVoltageMV):         {Type: ControlTypeString, ReadOnly: true},
+	string(FWWPState):            {Type: ControlTypeString},
+	string(ImageUSBKeyDirection): {Type: ControlTypeString, Values: []string{string(USBMuxDUT), string(USBMuxHost)}},
+	string(ImageUSBKeyPwr):       {Type: ControlTypeOnOff},
+	string(PowerState): {Type: ControlTypeString, Values: []string{
+		string(PowerStateCR50Reset), string(PowerStateOff), string(PowerStateOn), string(PowerStateRec),
+		string(PowerStateRecForceMRC), string(PowerStateReset), string(PowerStateWarmReset),
+	}},
+	string(V4Role):    {Type: ControlTypeString, Values: []string{string(V4RoleSnk), string(V4RoleSrc)}},
+	string(ECUARTCmd): {Type: ControlTypeString},
+
+	string(VolumeDownHold):   {Type: ControlTypeInt},
+	string(VolumeUpHold):     {Type: ControlTypeInt},
+	string(VolumeUpDownHold): {Type: ControlTypeInt},
+
+	string(RecMode): {Type: ControlTypeOnOff},
+
+	string(CtrlD):        {Type: ControlTypeKeypress},
+	string(CtrlU):        {Type: ControlTypeKeypress},
+	string(CtrlEnter):    {Type: ControlTypeKeypress},
+	string(Ctrl):         {Type: ControlTypeKeypress},
+	string(Enter):        {Type: ControlTypeKeypress},
+	string(Refresh):      {Type: ControlTypeKeypress},
+	string(CtrlRefresh):  {Type: ControlTypeKeypress},
+	string(ImaginaryKey): {Type: ControlTypeKeypress},
+	string(SysRQX):       {Type: ControlTypeKeypress},
+	string(PowerKey):     {Type: ControlTypeKeypress},
+	string(Pwrbutton):    {Type: ControlTypeKeypress},
+
+	string(UARTEC.captureControl()):   {Type: ControlTypeOnOff},
+	string(UARTEC.streamControl()):    {Type: ControlTypeString, ReadOnly: true},
+	string(UARTCPU.captureControl()):  {Type: ControlTypeOnOff},
+	string(UARTCPU.streamControl()):   {Type: ControlTypeString, ReadOnly: true},
+	string(UARTCr50.captureControl()): {Type: ControlTypeOnOff},
+	string(UARTCr50.streamControl()):  {Type: ControlTypeString, ReadOnly: true},
+}
+
+// LookupControl returns the description of control in controlCatalog, if it is known.
+// Catalog.Info should be preferred when the catalog of the servo is available.
+func LookupControl(control string) (ControlInfo, bool) {
+	ci, ok := controlCatalog[control]
+	return ci, ok
+}
+
+// validateControl returns an error if value is not accepted by control, as described by cat,
+// or by controlCatalog if cat is nil. Unknown controls are not validated.
+func validateControl(cat *Catalog, control string, value interface{}) error {
+	ci, ok := LookupControl(control)
+	if cat != nil {
+		ci, ok = cat.Info(control)
+	}
+	if !ok {
+		return nil
+	}
+	if ci.ReadOnly {
+		return errors.Errorf("servo control %q is read-only", control)
+	}
+
+	s := fmt.Sprint(value)
+	switch ci.Type {
+	case ControlTypeInt:
+		if _, err := strconv.Atoi(s); err != nil {
+			return errors.Errorf("servo control %q takes an integer; got %q", control, s)
+		}
+	case ControlTypeOnOff:
+		if s != string(On) && s != string(Off) {
+			return errors.Errorf("servo control %q takes %q or %q; got %q", control, On, Off, s)
+		}
+	case ControlTypeKeypress:
+		switch KeypressDuration(s) {
+		case DurTab, DurPress, DurLongPress:
+		default:
+			// Keypresses also take a duration in seconds.
+			if _, err := strconv.ParseFloat(s, 64); err != nil {
+				return errors.Errorf("servo control %q takes a keypress duration; got %q", control, s)
+			}
+		}
+	}
+	if len(ci.Values) == 0 {
+		return nil
+	}
+	for _, v := range ci.Values {
+		if s == v {
+			return nil
+		}
+	}
+	return errors.Errorf("servo control %q takes one of %q; got %q", control, ci.Values, s)
+}
+
+// A Capability is a feature of a servo setup, provided by a set of controls.
+type Capability string
+
+// These are the capabilities which can be queried with Catalog.Supports.
+const (
+	CapUSBMux      Capability = "usb_mux"
+	CapV4Role      Capability = "v4_role"
+	CapPowerState  Capability = "power_state"
+	CapKeyboard    Capability = "keyboard"
+	CapECConsole   Capability = "ec_console"
+	CapCPUConsole  Capability = "cpu_console"
+	CapCr50Console Capability = "cr50_console"
+)
+
+// capabilityControls lists the controls required by each capability.
+var capabilityControls = map[Capability][]string{
+	CapUSBMux:      {string(ImageUSBKeyPwr), string(ImageUSBKeyDirection)},
+	CapV4Role:      {string(V4Role)},
+	CapPowerState:  {string(PowerState)},
+	CapKeyboard:    {string(CtrlD), string(Enter), string(PowerKey)},
+	CapECConsole:   {string(ECUARTCmd), string(UARTEC.captureControl()), string(UARTEC.streamControl())},
+	CapCPUConsole:  {string(UARTCPU.captureControl()), string(UARTCPU.streamControl())},
+	CapCr50Console: {string(UARTCr50.captureControl()), string(UARTCr50.streamControl())},
+}
+
+// ErrUnsupported is returned by Catalog.Require if a capability is not supported.
+var ErrUnsupported = errors.New("unsupported by the servo setup")
+
+// Catalog lists the controls provided by a servod instance, along with their docs and params.
+type Catalog struct {
+	version  string
+	controls map[string]*servodControl
+	// maps contains the value maps of servod, e.g. "onoff", mapping the values accepted by
+	// the controls using them to the values written to the hardware.
+	maps map[string]map[string]string
+}
+
+// servodControl is a control listed by servod's doc_all method.
+type servodControl struct {
+	doc string
+	// get and set contain the params used by servod to get and set the control in its config,
+	// e.g. "drv", "map" or "input_type". Controls have separate params lines for each command
+	// when the commands differ, and a single line for both otherwise. set is nil if the control
+	// cannot be set, and both are nil if servod reported no params.
+	get, set map[string]string
+}
+
+var (
+	// docAllEntryRe matches the lines of servod's doc_all output describing a control or map,
+	// e.g. "power_state :: Power state of the DUT.".
+	docAllEntryRe = regexp.MustCompile(`^\s*([a-z0-9_]+)\s+::\s?(.*)$`)
+	// docAllSectionRe matches the headers of the sections of servod's doc_all output, e.g. "* MAP".
+	docAllSectionRe = regexp.MustCompile(`^\*\s+(\w+)\s*$`)
+	// docAllParamRe matches the params listed on the lines following an entry, e.g. "'map': 'onoff'".
+	docAllParamRe = regexp.MustCompile(`'([^']*)': '([^']*)'`)
+)
+
+// parseDocAll parses the output of servod's doc_all method, and returns its controls and maps.
+// Entries preceding any section header are controls.
+func parseDocAll(doc string) (controls map[string]*servodControl, maps map[string]map[string]string) {
+	controls = make(map[string]*servodControl)
+	maps = make(map[string]map[string]string)
+	section := "CONTROL"
+	var ctrl *servodControl
+	var mp map[string]string
+	for _, line := range strings.Split(doc, "\n") {
+		if m := docAllSectionRe.FindStringSubmatch(line); m != nil {
+			section = strings.ToUpper(m[1])
+			ctrl, mp = nil, nil
+			continue
+		}
+		if m := docAllEntryRe.FindStringSubmatch(line); m != nil {
+			ctrl, mp = nil, nil
+			switch section {
+			case "CONTROL":
+				ctrl = &servodControl{doc: m[2]}
+				controls[m[1]] = ctrl
+			case "MAP":
+				mp = make(map[string]string)
+				maps[m[1]] = mp
+			}
+			continue
+		}
+		params := docAllParamRe.FindAllStringSubmatch(line, -1)
+		if len(params) == 0 {
+			continue
+		}
+		if mp != nil {
+			for _, m := range params {
+				mp[m[1]] = m[2]
+			}
+			continue
+		}
+		if ctrl == nil {
+			continue
+		}
+		// A params line applies to the command given by its "cmd" param, or to both.
+		var cmd string
+		for _, m := range params {
+			if m[1] == "cmd" {
+				cmd = m[2]
+			}
+		}
+		if cmd != "set" {
+			ctrl.get = addParams(ctrl.get, params)
+		}
+		if cmd != "get" {
+			ctrl.set = addParams(ctrl.set, params)
+		}
+	}
+	return controls, maps
+}
+
+// addParams adds the params matched by docAllParamRe to dst, creating it if needed, and returns it.
+func addParams(dst map[string]string, params [][]string) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string)
+	}
+	for _, m := range params {
+		dst[m[1]] = m[2]
+	}
+	return dst
+}
+
+// Catalog queries servod for the controls available on its servo, along with their docs and params.
+func (s *Servo) Catalog(ctx context.Context) (*Catalog, error) {
+	version, err := s.GetServoVersion(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting servo version")
+	}
+	var doc string
+	if err := s.run(ctx, newCall("doc_all"), &doc); err != nil {
+		return nil, errors.Wrap(err, "getting servo control docs")
+	}
+	c := &Catalog{version: version}
+	c.controls, c.maps = parseDocAll(doc)
+	return c, nil
+}
+
+// cachedCatalog returns the catalog of the servo, against which the values of controls are
+// validated. It is queried from servod once: if servod failed to provide it, the error is
+// returned by later calls without querying servod again.
+func (s *Servo) cachedCatalog(ctx context.Context) (*Catalog, error) {
+	s.catalogMu.Lock()
+	defer s.catalogMu.Unlock()
+	if s.catalog == nil && s.catalogErr == nil {
+		s.catalog, s.catalogErr = s.Catalog(ctx)
+		if s.catalogErr != nil {
+			testing.ContextLog(ctx, "Failed to get the servo catalog; not validating controls: ", s.catalogErr)
+		}
+	}
+	return s.catalog, s.catalogErr
+}
+
+// validateSet returns an error if value is not accepted by control, as described by the
+// catalog of the servo. Values are not validated if servod failed to provide the catalog.
+func (s *Servo) validateSet(ctx context.Context, control string, value interface{}) error {
+	cat, err := s.cachedCatalog(ctx)
+	if err != nil {
+		return nil
+	}
+	return validateControl(cat, control, value)
+}
+
+// Version returns the version of the servo, e.g. "servo_v4_with_servo_micro".
+func (c *Catalog) Version() string {
+	return c.version
+}
+
+// Has returns whether the servo provides control.
+func (c *Catalog) Has(control string) bool {
+	_, ok := c.controls[control]
+	return ok
+}
+
+// Doc returns the documentation of control given by servod.
+func (c *Catalog) Doc(control string) string {
+	if sc, ok := c.controls[control]; ok {
+		return sc.doc
+	}
+	return ""
+}
+
+// Info returns the description of control derived from its params reported by servod, e.g.
+// the keys of its value map, falling back to controlCatalog for what servod does not report.
+// It returns false if neither servod nor controlCatalog know the control.
+func (c *Catalog) Info(control string) (ControlInfo, bool) {
+	ci, known := controlCatalog[control]
+	sc, ok := c.controls[control]
+	if !ok {
+		return ci, known
+	}
+	// The values of a control are validated against its set params, if it can be set.
+	if sc.get != nil && sc.set == nil {
+		ci.ReadOnly = true
+	}
+	if inputType, ok := sc.set["input_type"]; ok {
+		if inputType == "int" {
+			ci.Type = ControlTypeInt
+		} else if ci.Type == ControlTypeInt {
+			ci.Type = ControlTypeString
+		}
+	}
+	if m, ok := c.maps[sc.set["map"]]; ok {
+		values := mapKeys(m)
+		if reflect.DeepEqual(values, []string{string(Off), string(On)}) {
+			ci.Type, ci.Values = ControlTypeOnOff, nil
+		} else {
+			ci.Type, ci.Values = ControlTypeString, values
+		}
+	}
+	if ci.Type == "" {
+		ci.Type = ControlTypeString
+	}
+	return ci, true
+}
+
+// mapKeys returns the sorted keys of the servod map m.
+func mapKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate cross-checks the controls of controlCatalog provided by the servo against their
+// params reported by servod, and returns the mismatches. The values of controls using a servod
+// map must be the keys of the map, and controls taking integers must be declared as such.
+// Params which servod does not report are not checked.
+func (c *Catalog) Validate() []error {
+	var names []string
+	for name := range controlCatalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		ci := controlCatalog[name]
+		sc, ok := c.controls[name]
+		if !ok {
+			continue
+		}
+		if inputType, ok := sc.set["input_type"]; ok && (inputType == "int") != (ci.Type == ControlTypeInt) {
+			errs = append(errs, errors.Errorf("servo control %q has input type %q in servod; catalog type is %q", name, inputType, ci.Type))
+		}
+		m, ok := c.maps[sc.set["map"]]
+		if !ok {
+			continue
+		}
+		values := mapKeys(m)
+		want := append([]string(nil), ci.Values...)
+		if ci.Type == ControlTypeOnOff {
+			want = []string{string(Off), string(On)}
+		}
+		sort.Strings(want)
+		if len(want) == 0 {
+			errs = append(errs, errors.Errorf("servo control %q takes %q in servod; catalog accepts any value", name, values))
+		} else if !reflect.DeepEqual(values, want) {
+			errs = append(errs, errors.Errorf("servo control %q takes %q in servod; catalog accepts %q", name, values, want))
+		}
+	}
+	return errs
+}
+
+// Supports returns whether the servo provides all the controls required by capability.
+func (c *Catalog) Supports(capability Capability) bool {
+	ctrls, ok := capabilityControls[capability]
+	if !ok {
+		return false
+	}
+	for _, ctrl := range ctrls {
+		if !c.Has(ctrl) {
+			return false
+		}
+	}
+	return true
+}
+
+// Require returns an error wrapping ErrUnsupported if the servo does not support all of caps.
+func (c *Catalog) Require(caps ...Capability) error {
+	var missing []string
+	for _, cp := range caps {
+		if !c.Supports(cp) {
+			missing = append(missing, string(cp))
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Wrapf(ErrUnsupported, "%s does not support %s", c.version, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package servo
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"chromiumos/tast/errors"
+)
+
+// declaredControls returns the names of the controls declared as constants in the files of
+// this package, including the controls of the declared UARTs.
+func declaredControls(t *testing.T) []string {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", nil, 0)
+	if err != nil {
+		t.Fatal("Failed to parse package: ", err)
+	}
+	var controls []string
+	for _, f := range pkgs["servo"].Files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				typ, ok := vs.Type.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				for _, v := range vs.Values {
+					lit, ok := v.(*ast.BasicLit)
+					if !ok || lit.Kind != token.STRING {
+						continue
+					}
+					name, err := strconv.Unquote(lit.Value)
+					if err != nil {
+						t.Fatalf("Failed to unquote %s: %v", lit.Value, err)
+					}
+					switch typ.Name {
+					case "StringControl", "IntControl", "OnOffControl", "KeypressControl":
+						controls = append(controls, name)
+					case "UART":
+						controls = append(controls, string(UART(name).captureControl()), string(UART(name).streamControl()))
+					}
+				}
+			}
+		}
+	}
+	return controls
+}
+
+func TestControlCatalogComplete(t *testing.T) {
+	controls := declaredControls(t)
+	if len(controls) == 0 {
+		t.Fatal("No controls are declared in this package")
+	}
+	for _, c := range controls {
+		if _, ok := LookupControl(c); !ok {
+			t.Errorf("Control %q is missing from the catalog", c)
+		}
+	}
+	for _, ctrls := range capabilityControls {
+		for _, c := range ctrls {
+			if _, ok := LookupControl(c); !ok {
+				t.Errorf("Capability control %q is missing from the catalog", c)
+			}
+		}
+	}
+}
+
+func TestValidateControl(t *testing.T) {
+	for _, tc := range []struct {
+		control   string
+		value     interface{}
+		expectErr bool
+	}{
+		{string(PowerState), "rec", false},
+		{string(PowerState), "recovery", true},
+		{string(V4Role), "snk", false},
+		{string(V4Role), "sink", true},
+		{string(ImageUSBKeyPwr), "on", false},
+		{string(ImageUSBKeyPwr), "1", true},
+		{string(VolumeUpHold), 100, false},
+		{string(VolumeUpHold), "long", true},
+		{string(CtrlD), "press", false},
+		{string(CtrlD), "0.5", false},
+		{string(CtrlD), "hold", true},
+		{string(DUTVoltageMV), "5000", true},
+		{string(UARTEC.streamControl()), "", true},
+		{string(FWWPState), "force_on", false},
+		{"unknown_control", "anything", false},
+	} {
+		err := validateControl(nil, tc.control, tc.value)
+		if err != nil && !tc.expectErr {
+			t.Errorf("validateControl(%q, %q) failed: %v", tc.control, tc.value, err)
+		} else if err == nil && tc.expectErr {
+			t.Errorf("validateControl(%q, %q) unexpectedly succeeded", tc.control, tc.value)
+		}
+	}
+}
+
+func TestSetStringValidation(t *testing.T) {
+	ctx := context.Background()
+	svo, fs := newFakeServo(ctx, t)
+	defer fs.Close()
+
+	if err := svo.SetString(ctx, ImageUSBKeyDirection, "dut_sees_usb"); err == nil {
+		t.Errorf("SetString(%q) with a typo unexpectedly succeeded", ImageUSBKeyDirection)
+	}
+	if len(fs.Sets()) != 0 {
+		t.Errorf("Invalid values were sent to servod: %v", fs.Sets())
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	ctx := context.Background()
+	svo, fs := newFakeServo(ctx, t)
+	defer fs.Close()
+
+	cat, err := svo.Catalog(ctx)
+	if err != nil {
+		t.Fatal("Catalog failed: ", err)
+	}
+	for cp := range capabilityControls {
+		if !cat.Supports(cp) {
+			t.Errorf("Catalog of %s does not support %q", cat.Version(), cp)
+		}
+	}
+	if cat.Doc(string(PowerState)) == "" {
+		t.Errorf("Catalog has no doc for %q", PowerState)
+	}
+
+	if errs := cat.Validate(); len(errs) != 0 {
+		t.Errorf("Validate returned %v for servod params matching the catalog; want none", errs)
+	}
+
+	// Controls unknown to servod are missing.
+	fs.DeleteControl(string(UARTCPU.streamControl()))
+	// Controls of servo v4 are not provided by servo micro alone.
+	fs.SetVersion("servo_micro")
+	for _, c := range []StringControl{ImageUSBKeyPwr, ImageUSBKeyDirection, V4Role} {
+		fs.DeleteControl(string(c))
+	}
+	if cat, err = svo.Catalog(ctx); err != nil {
+		t.Fatal("Catalog failed: ", err)
+	}
+	for _, tc := range []struct {
+		cp       Capability
+		expected bool
+	}{
+		{CapUSBMux, false},
+		{CapV4Role, false},
+		{CapCPUConsole, false},
+		{CapECConsole, true},
+		{CapCr50Console, true},
+		{CapKeyboard, true},
+	} {
+		if actual := cat.Supports(tc.cp); actual != tc.expected {
+			t.Errorf("Supports(%q) = %v on %s; want %v", tc.cp, actual, cat.Version(), tc.expected)
+		}
+	}
+	if err := cat.Require(CapECConsole, CapUSBMux); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Require(%q, %q) returned %v; want ErrUnsupported", CapECConsole, CapUSBMux, err)
+	}
+	if err := cat.Require(CapECConsole, CapKeyboard); err != nil {
+		t.Errorf("Require(%q, %q) failed: %v", CapECConsole, CapKeyboard, err)
+	}
+}
+
+// testDocAll is formatted like the output of servod's doc_all method, with params which do not
+// match controlCatalog. Controls may have separate params lines for getting and setting them.
+const testDocAll = `*************
+* MAP
+*************
+onoff          :: On/off.
+-------------- --> {'on': '1', 'off': '0'}
+v4_role        :: Power role.
+-------------- --> {'src': '1', 'snk': '0', 'drp': '2'}
+*************
+* CONTROL
+*************
+power_state    :: Power state of the DUT.
+rec_mode       :: Recovery button.
+-------------- --> {'interface': '2', 'drv': 'gpio', 'map': 'onoff'}
+servo_v4_role  :: Power role of servo v4.
+-------------- --> {'drv': 'pd', 'map': 'v4_role'}
+active_chg_port :: Active charging port.
+-------------- --> {'map': 'onoff'}
+volume_up_hold :: Holds volume up.
+-------------- --> {'input_type': 'float'}
+ec_uart_cmd    :: Sends a command to the EC.
+-------------- --> {'input_type': 'int'}
+fw_wp_state    :: Firmware write protect state.
+-------------- --> {'cmd': 'set', 'drv': 'fw_wp_state'}
+-------------- --> {'cmd': 'get', 'drv': 'fw_wp_state', 'input_type': 'int'}
+dut_voltage_mv :: Voltage of the DUT.
+-------------- --> {'cmd': 'get', 'drv': 'ec'}
+`
+
+func TestCatalogValidate(t *testing.T) {
+	c := &Catalog{version: "servo_v4"}
+	c.controls, c.maps = parseDocAll(testDocAll)
+	if !c.Has(string(PowerState)) || c.Has(string(ImageUSBKeyPwr)) || c.Has("onoff") {
+		t.Errorf("parseDocAll returned controls %v", c.controls)
+	}
+	if doc := c.Doc(string(RecMode)); doc != "Recovery button." {
+		t.Errorf("Doc(%q) = %q; want %q", RecMode, doc, "Recovery button.")
+	}
+
+	var msgs []string
+	for _, err := range c.Validate() {
+		msgs = append(msgs, err.Error())
+	}
+	for _, want := range []string{
+		`"active_chg_port" takes ["off" "on"] in servod; catalog accepts any value`,
+		`"ec_uart_cmd" has input type "int" in servod; catalog type is "string"`,
+		`"servo_v4_role" takes ["drp" "snk" "src"] in servod; catalog accepts ["snk" "src"]`,
+		`"volume_up_hold" has input type "float" in servod; catalog type is "int"`,
+	} {
+		if !strings.Contains(strings.Join(msgs, "\n"), want) {
+			t.Errorf("Validate returned %q; want an error containing %q", msgs, want)
+		}
+	}
+	if len(msgs) != 4 {
+		t.Errorf("Validate returned %d errors; want 4", len(msgs))
+	}
+}
+
+func TestCatalogInfo(t *testing.T) {
+	c := &Catalog{version: "servo_v4"}
+	c.controls, c.maps = parseDocAll(testDocAll)
+
+	// The params reported by servod take precedence over controlCatalog.
+	for _, tc := range []struct {
+		control  string
+		expected ControlInfo
+	}{
+		{string(V4Role), ControlInfo{Type: ControlTypeString, Values: []string{"drp", "snk", "src"}}},
+		{string(ActiveChgPort), ControlInfo{Type: ControlTypeOnOff}},
+		{string(ECUARTCmd), ControlInfo{Type: ControlTypeInt}},
+		{string(VolumeUpHold), ControlInfo{Type: ControlTypeString}},
+		{string(PowerState), controlCatalog[string(PowerState)]},
+		// Controls are described by their set params, and are read-only only without them.
+		{string(FWWPState), ControlInfo{Type: ControlTypeString}},
+		{string(DUTVoltageMV), ControlInfo{Type: ControlTypeString, ReadOnly: true}},
+		// Controls unknown to servod are described by controlCatalog.
+		{string(CtrlD), controlCatalog[string(CtrlD)]},
+	} {
+		if actual, ok := c.Info(tc.control); !ok {
+			t.Errorf("Info(%q) found no control", tc.control)
+		} else if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("Info(%q) = %+v; want %+v", tc.control, actual, tc.expected)
+		}
+	}
+	if ci, ok := c.Info("unknown_control"); ok {
+		t.Errorf("Info(%q) = %+v for an unknown control", "unknown_control", ci)
+	}
+
+	if err := validateControl(c, string(V4Role), "drp"); err != nil {
+		t.Errorf("validateControl(%q, %q) failed with a value listed by servod: %v", V4Role, "drp", err)
+	}
+	if err := validateControl(c, string(VolumeUpHold), "0.5"); err != nil {
+		t.Errorf("validateControl(%q, %q) failed with a value accepted by servod: %v", VolumeUpHold, "0.5", err)
+	}
+	if err := validateControl(c, string(ActiveChgPort), "port0"); err == nil {
+		t.Errorf("validateControl(%q, %q) unexpectedly succeeded with a value missing from the servod map", ActiveChgPort, "port0")
+	}
+}
+
+func TestControlCatalogDescribesParams(t *testing.T) {
+	// This is written by hand in the format of servod's doc_all output, with params describing
+	// the controls of this package as controlCatalog does. It is not captured from servod, so
+	// this only checks that Catalog.Info derives from such params the descriptions declared in
+	// controlCatalog, and that every declared control is listed. Drift between controlCatalog
+	// and the servod configs can only be found by calling Catalog.Validate with a real servod.
+	const fn = "testdata/doc_all_example.txt"
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal("Failed to read doc_all output: ", err)
+	}
+	c := &Catalog{version: "example"}
+	c.controls, c.maps = parseDocAll(string(b))
+
+	for _, ctrl := range declaredControls(t) {
+		if !c.Has(ctrl) {
+			t.Errorf("Control %q is missing from %s", ctrl, fn)
+		}
+	}
+	for _, err := range c.Validate() {
+		t.Errorf("Catalog does not match %s: %v", fn, err)
+	}
+	// controlCatalog must describe the controls as their params do, so that it is a suitable fallback.
+	for ctrl, expected := range controlCatalog {
+		actual, _ := c.Info(ctrl)
+		expected.Values = append([]string(nil), expected.Values...)
+		sort.Strings(expected.Values)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Control %q is described as %+v by %s; catalog has %+v", ctrl, actual, fn, expected)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package servo
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"chromiumos/tast/errors"
+	"chromiumos/tast/testing"
+)
+
+// A UART is a serial console of the DUT which servod can capture.
+type UART string
+
+// These are the UARTs which servod can capture.
+const (
+	UARTEC   UART = "ec"
+	UARTCPU  UART = "cpu"
+	UARTCr50 UART = "cr50"
+)
+
+// captureControl returns the control turning the capture of u on and off.
+func (u UART) captureControl() StringControl {
+	return StringControl(string(u) + "_uart_capture")
+}
+
+// streamControl returns the control returning the output of u captured since it was last read.
+func (u UART) streamControl() StringControl {
+	return StringControl(string(u) + "_uart_stream")
+}
+
+// consolePollInterval is the interval at which Console reads the captured output from servod.
+const consolePollInterval = 200 * time.Millisecond
+
+// Console captures the output of a UART of the DUT through servod.
+//
+// Example:
+//  con, err := svo.StartConsole(ctx, servo.UARTEC)
+//  if err != nil {
+//     s.Fatal("Failed to capture the EC console: ", err)
+//  }
+//  defer con.Close(ctx)
+//  ...
+//  if _, err := con.WaitForRegexp(ctx, regexp.MustCompile(`power state \d+ = S0`), time.Minute); err != nil {
+//     s.Fatal("EC did not reach S0: ", err)
+//  }
+type Console struct {
+	svo  *Servo
+	uart UART
+
+	mu  sync.Mutex
+	out strings.Builder
+	pos int   // offset in out from which WaitForRegexp searches
+	err error // first error reading the captured output
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartConsole starts capturing the output of the UART u, until Close is called.
+func (s *Servo) StartConsole(ctx context.Context, u UART) (*Console, error) {
+	if err := s.SetString(ctx, u.captureControl(), string(On)); err != nil {
+		return nil, errors.Wrapf(err, "failed to start capturing the %s UART", u)
+	}
+	// Discard the output captured before, if capture was already on.
+	if _, err := s.GetString(ctx, u.streamControl()); err != nil {
+		return nil, errors.Wrapf(err, "failed to read the %s UART", u)
+	}
+
+	c := &Console{svo: s, uart: u, done: make(chan struct{})}
+	ctx, c.cancel = context.WithCancel(ctx)
+	go func() {
+		defer close(c.done)
+		for {
+			if err := testing.Sleep(ctx, consolePollInterval); err != nil {
+				return
+			}
+			if err := c.read(ctx); err != nil {
+				if ctx.Err() == nil {
+					c.mu.Lock()
+					c.err = err
+					c.mu.Unlock()
+				}
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+// read appends the output captured by servod since the previous read.
+func (c *Console) read(ctx context.Context) error {
+	s, err := c.svo.GetString(ctx, c.uart.streamControl())
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.out.WriteString(s)
+	return nil
+}
+
+// Output returns the whole output captured so far.
+func (c *Console) Output() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.out.String()
+}
+
+// Skip makes following calls of WaitForRegexp ignore the output captured so far.
+func (c *Console) Skip() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pos = c.out.Len()
+}
+
+// WaitForRegexp waits until re matches the output captured after the end of the previous
+// match, or after the last call of Skip, and returns the match and its submatches.
+func (c *Console) WaitForRegexp(ctx context.Context, re *regexp.Regexp, timeout time.Duration) ([]string, error) {
+	var match []string
+	if err := testing.Poll(ctx, func(ctx context.Context) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.err != nil {
+			return testing.PollBreak(errors.Wrapf(c.err, "failed to read the %s UART", c.uart))
+		}
+		out := c.out.String()[c.pos:]
+		loc := re.FindStringSubmatchIndex(out)
+		if loc == nil {
+			return errors.Errorf("%s UART output does not match %q", c.uart, re)
+		}
+		match = make([]string, len(loc)/2)
+		for i := range match {
+			if loc[2*i] >= 0 {
+				match[i] = out[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		c.pos += loc[1]
+		return nil
+	}, &testing.PollOptions{Timeout: timeout, Interval: consolePollInterval}); err != nil {
+		return nil, err
+	}
+	return match, nil
+}
+
+// Close stops capturing the output, and saves it in <uart>_uart.txt in the output
+// directory of the test if there is one.
+func (c *Console) Close(ctx context.Context) error {
+	if c.cancel == nil {
+		return nil
+	}
+	c.cancel()
+	<-c.done
+	c.cancel = nil
+
+	// Read the output captured since the last poll.
+	readErr := c.read(ctx)
+	if err := c.svo.SetString(ctx, c.uart.captureControl(), string(Off)); err != nil {
+		testing.ContextLogf(ctx, "Failed to stop capturing the %s UART: %v", c.uart, err)
+	}
+	if dir, ok := testing.ContextOutDir(ctx); ok {
+		if err := c.Save(filepath.Join(dir, string(c.uart)+"_uart.txt")); err != nil {
+			return err
+		}
+	}
+	return readErr
+}
+
+// Save writes the output captured so far to path.
+func (c *Console) Save(path string) error {
+	if err := ioutil.WriteFile(path, []byte(c.Output()), 0644); err != nil {
+		return errors.Wrapf(err, "failed to save the %s UART output", c.uart)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package servo
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"chromiumos/tast/testutil"
+)
+
+func TestConsole(t *testing.T) {
+	ctx := context.Background()
+	svo, fs := newFakeServo(ctx, t)
+	defer fs.Close()
+
+	// Output printed before the capture starts is not captured.
+	fs.WriteUART(UARTEC, "boot\n")
+	con, err := svo.StartConsole(ctx, UARTEC)
+	if err != nil {
+		t.Fatal("StartConsole failed: ", err)
+	}
+	defer con.Close(ctx)
+	if v, _ := fs.Control("ec_uart_capture"); v != "on" {
+		t.Errorf("ec_uart_capture = %q after StartConsole; want %q", v, "on")
+	}
+
+	// Make the EC reach S0 when the DUT is powered on.
+	fs.Handle(string(PowerState), func(ctrls map[string]string, value string) error {
+		if err := setPowerState(ctrls, value); err != nil {
+			return err
+		}
+		WriteFakeUART(ctrls, UARTEC, "[1.000 power state 2 = S5->S3]\n[1.100 power state 3 = S0]\n")
+		return nil
+	})
+	if err := svo.SetPowerState(ctx, PowerStateOn); err != nil {
+		t.Fatal("SetPowerState failed: ", err)
+	}
+	stateRe := regexp.MustCompile(`power state \d+ = (\S+)\]`)
+	for _, expected := range []string{"S5->S3", "S0"} {
+		match, err := con.WaitForRegexp(ctx, stateRe, 5*time.Second)
+		if err != nil {
+			t.Fatalf("WaitForRegexp(%q) failed: %v", stateRe, err)
+		}
+		if match[1] != expected {
+			t.Errorf("WaitForRegexp(%q) matched %q; want %q", stateRe, match, expected)
+		}
+	}
+	// All the matching output was consumed.
+	if _, err := con.WaitForRegexp(ctx, stateRe, 500*time.Millisecond); err == nil {
+		t.Errorf("WaitForRegexp(%q) unexpectedly matched again", stateRe)
+	}
+
+	if err := svo.RunECCommand(ctx, "version"); err != nil {
+		t.Fatal("RunECCommand failed: ", err)
+	}
+	if _, err := con.WaitForRegexp(ctx, regexp.MustCompile(`> version`), 5*time.Second); err != nil {
+		t.Error("EC command echo not found: ", err)
+	}
+	fs.WriteUART(UARTEC, "Chip: fake\n")
+
+	if err := con.Close(ctx); err != nil {
+		t.Fatal("Close failed: ", err)
+	}
+	if v, _ := fs.Control("ec_uart_capture"); v != "off" {
+		t.Errorf("ec_uart_capture = %q after Close; want %q", v, "off")
+	}
+	expected := "[1.000 power state 2 = S5->S3]\n[1.100 power state 3 = S0]\n> version\nChip: fake\n"
+	if out := con.Output(); out != expected {
+		t.Errorf("Output() = %q; want %q", out, expected)
+	}
+
+	td := testutil.TempDir(t)
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "ec_uart.txt")
+	if err := con.Save(path); err != nil {
+		t.Fatal("Save failed: ", err)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if string(b) != expected {
+		t.Errorf("Saved %q; want %q", b, expected)
+	}
+}
+
+func TestConsoleWaitForRegexpSubmatches(t *testing.T) {
+	ctx := context.Background()
+	svo, fs := newFakeServo(ctx, t)
+	defer fs.Close()
+
+	con, err := svo.StartConsole(ctx, UARTCPU)
+	if err != nil {
+		t.Fatal("StartConsole failed: ", err)
+	}
+	defer con.Close(ctx)
+	fs.WriteUART(UARTCPU, "localhost login: ")
+	re := regexp.MustCompile(`(\w+) login:( root)?`)
+	match, err := con.WaitForRegexp(ctx, re, 5*time.Second)
+	if err != nil {
+		t.Fatalf("WaitForRegexp(%q) failed: %v", re, err)
+	}
+	if expected := []string{"localhost login:", "localhost", ""}; !reflect.DeepEqual(match, expected) {
+		t.Errorf("WaitForRegexp(%q) = %q; want %q", re, match, expected)
+	}
+}
@@ -0,0 +1,475 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package servo
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"chromiumos/tast/errors"
+)
+
+// FakeSetFunc is called when a control of a FakeServod is set, instead of storing the value.
+// ctrls holds the values of all the controls and can be modified, e.g. to store value or to
+// update related controls. A non-nil error is returned to the client as an XML-RPC fault.
+type FakeSetFunc func(ctrls map[string]string, value string) error
+
+// FakeSet records a set call received by a FakeServod.
+type FakeSet struct {
+	Control string
+	Value   string
+}
+
+// FakeServod is an in-process fake of servod, serving get, set, echo, doc, doc_all
+// and get_version over the same XML-RPC wire format. It is meant for unit tests of
+// code using Servo without servo hardware.
+//
+// Controls hold string values, initialized to those of a servo v4 with a DUT
+// powered on. Setting power_state, the USB mux controls, servo_v4_role and on/off
+// controls is validated like servod does, and keypress controls are logged rather
+// than stored. UART streams return the output written with WriteUART while capture
+// is on. Other behaviors can be programmed with Handle.
+//
+// Example:
+//  fs, err := servo.NewFakeServod()
+//  if err != nil {
+//     t.Fatal(err)
+//  }
+//  defer fs.Close()
+//  svo, err := servo.New(ctx, fs.ConnSpec())
+type FakeServod struct {
+	// HangOnPowerOff makes set calls of power_state to off hang until the client gives up,
+	// like servod does when the DUT is turned off. It is true by default.
+	HangOnPowerOff bool
+
+	ln  net.Listener
+	srv *http.Server
+
+	mu         sync.Mutex
+	version    string
+	controls   map[string]string
+	docs       map[string]string
+	params     map[string]map[string]string
+	handlers   map[string]FakeSetFunc
+	sets       []FakeSet
+	keypresses []FakeSet
+}
+
+// fakeServodMaps are the value maps listed by the doc_all method of FakeServod.
+var fakeServodMaps = map[string]map[string]string{
+	"onoff":        {string(On): "1", string(Off): "0"},
+	"usbkey_mux":   {string(USBMuxDUT): "1", string(USBMuxHost): "0"},
+	"v4_role":      {string(V4RoleSrc): "1", string(V4RoleSnk): "0"},
+	"power_states": {"on": "1", "off": "0", "rec": "2", "rec_force_mrc": "3", "reset": "4", "warm_reset": "5", "cr50_reset": "6"},
+}
+
+// Fault codes returned by FakeServod.
+const (
+	fakeFaultUnknownMethod = 1
+	fakeFaultBadRequest    = 2
+	fakeFaultControl       = 3
+)
+
+// NewFakeServod starts a FakeServod listening on a local port.
+// The caller is responsible for calling Close.
+func NewFakeServod() (*FakeServod, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen")
+	}
+	fs := &FakeServod{
+		HangOnPowerOff: true,
+		ln:             ln,
+		version:        "servo_v4_with_servo_micro",
+		controls: map[string]string{
+			string(PowerState):           string(PowerStateOn),
+			string(ImageUSBKeyPwr):       string(USBMuxOff),
+			string(ImageUSBKeyDirection): string(USBMuxHost),
+			string(V4Role):               string(V4RoleSrc),
+			string(FWWPState):            "force_off",
+			string(RecMode):              string(Off),
+			string(DUTVoltageMV):         "5000",
+			string(ActiveChgPort):        "port0",
+			string(ECUARTCmd):            "",
+		},
+		docs: map[string]string{
+			string(PowerState):           "Power state of the DUT. Values: on, off, rec, rec_force_mrc, reset, warm_reset, cr50_reset.",
+			string(ImageUSBKeyPwr):       "Power of the USB image key. Values: on, off.",
+			string(ImageUSBKeyDirection): "Direction of the USB image key mux. Values: dut_sees_usbkey, servo_sees_usbkey.",
+			string(V4Role):               "Power role of servo v4. Values: src, snk.",
+			string(RecMode):              "Recovery button. Values: on, off.",
+		},
+		params: map[string]map[string]string{
+			string(PowerState):           {"map": "power_states"},
+			string(ImageUSBKeyPwr):       {"map": "onoff"},
+			string(ImageUSBKeyDirection): {"map": "usbkey_mux"},
+			string(V4Role):               {"map": "v4_role"},
+			string(RecMode):              {"map": "onoff"},
+		},
+		handlers: make(map[string]FakeSetFunc),
+	}
+
+	fs.handlers[string(PowerState)] = setPowerState
+	fs.handlers[string(ImageUSBKeyPwr)] = oneOf(string(ImageUSBKeyPwr), "on", "off")
+	fs.handlers[string(ImageUSBKeyDirection)] = setUSBKeyDirection
+	fs.handlers[string(V4Role)] = oneOf(string(V4Role), string(V4RoleSnk), string(V4RoleSrc))
+	fs.handlers[string(RecMode)] = oneOf(string(RecMode), string(On), string(Off))
+	for _, c := range []KeypressControl{CtrlD, CtrlU, CtrlEnter, Ctrl, Enter, Refresh, CtrlRefresh, ImaginaryKey, SysRQX, PowerKey, Pwrbutton} {
+		fs.docs[string(c)] = "Presses a key. Values: tab, press, long_press or a duration in seconds."
+	}
+	for _, c := range []IntControl{VolumeDownHold, VolumeUpHold, VolumeUpDownHold} {
+		fs.docs[string(c)] = "Holds volume buttons for a number of milliseconds."
+		fs.params[string(c)] = map[string]string{"input_type": "int"}
+	}
+	for _, u := range []UART{UARTEC, UARTCPU, UARTCr50} {
+		fs.controls[string(u.captureControl())] = string(Off)
+		fs.controls[string(u.streamControl())] = ""
+		fs.handlers[string(u.captureControl())] = oneOf(string(u.captureControl()), string(On), string(Off))
+		fs.params[string(u.captureControl())] = map[string]string{"map": "onoff"}
+	}
+	fs.handlers[string(ECUARTCmd)] = setECUARTCmd
+
+	fs.srv = &http.Server{Handler: http.HandlerFunc(fs.serveHTTP)}
+	go fs.srv.Serve(ln)
+	return fs, nil
+}
+
+// Close stops the FakeServod.
+func (fs *FakeServod) Close() error {
+	return fs.srv.Close()
+}
+
+// ConnSpec returns the "host:port" location of the FakeServod, to be passed to New.
+func (fs *FakeServod) ConnSpec() string {
+	return fs.ln.Addr().String()
+}
+
+// SetVersion sets the value returned by get_version, e.g. "servo_v3".
+func (fs *FakeServod) SetVersion(version string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.version = version
+}
+
+// Control returns the current value of the control ctrl, and whether it exists.
+func (fs *FakeServod) Control(ctrl string) (string, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	v, ok := fs.controls[ctrl]
+	return v, ok
+}
+
+// SetControl sets the control ctrl to value, adding it if needed. Handlers are not called.
+func (fs *FakeServod) SetControl(ctrl, value string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.controls[ctrl] = value
+}
+
+// SetParams sets the params of the control ctrl listed by doc_all, e.g. {"drv": "ina231"},
+// adding it if needed.
+func (fs *FakeServod) SetParams(ctrl string, params map[string]string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.controls[ctrl]; !ok {
+		fs.controls[ctrl] = ""
+	}
+	fs.params[ctrl] = params
+}
+
+// DeleteControl removes the control ctrl, as if the servo did not provide it.
+func (fs *FakeServod) DeleteControl(ctrl string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.controls, ctrl)
+	delete(fs.docs, ctrl)
+	delete(fs.params, ctrl)
+	delete(fs.handlers, ctrl)
+}
+
+// Handle makes f handle set calls of the control ctrl, adding it if needed.
+// A nil f restores the default behavior of storing the value.
+// Keypresses handled by f are still logged.
+func (fs *FakeServod) Handle(ctrl string, f FakeSetFunc) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.controls[ctrl]; !ok {
+		fs.controls[ctrl] = ""
+	}
+	if f == nil {
+		delete(fs.handlers, ctrl)
+		return
+	}
+	fs.handlers[ctrl] = f
+}
+
+// Sets returns the successful set calls received so far, in order. Keypresses are included.
+func (fs *FakeServod) Sets() []FakeSet {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]FakeSet(nil), fs.sets...)
+}
+
+// Keypresses returns the keypresses received so far, in order, including presses of
+// the power button with the power_normal_press method.
+func (fs *FakeServod) Keypresses() []FakeSet {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]FakeSet(nil), fs.keypresses...)
+}
+
+// WriteUART makes the UART u print output, which is captured if capture is on.
+func (fs *FakeServod) WriteUART(u UART, output string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	WriteFakeUART(fs.controls, u, output)
+}
+
+// WriteFakeUART appends output to the stream of u in ctrls if capture is on.
+// It is meant to be called by FakeSetFuncs, e.g. to print the EC's response to a command.
+func WriteFakeUART(ctrls map[string]string, u UART, output string) {
+	if ctrls[string(u.captureControl())] == string(On) {
+		ctrls[string(u.streamControl())] += output
+	}
+}
+
+// setECUARTCmd handles ec_uart_cmd. Like the EC, it echoes the command on the EC UART.
+func setECUARTCmd(ctrls map[string]string, value string) error {
+	ctrls[string(ECUARTCmd)] = value
+	WriteFakeUART(ctrls, UARTEC, "> "+value+"\n")
+	return nil
+}
+
+// oneOf returns a FakeSetFunc storing the value of ctrl if it is one of values.
+func oneOf(ctrl string, values ...string) FakeSetFunc {
+	return func(ctrls map[string]string, value string) error {
+		for _, v := range values {
+			if value == v {
+				ctrls[ctrl] = value
+				return nil
+			}
+		}
+		return errors.Errorf("invalid value %q for %s; want one of %q", value, ctrl, values)
+	}
+}
+
+// setPowerState handles power_state. Resets and recovery boots leave the DUT powered on.
+func setPowerState(ctrls map[string]string, value string) error {
+	switch PowerStateValue(value) {
+	case PowerStateOff:
+		ctrls[string(PowerState)] = string(PowerStateOff)
+	case PowerStateOn, PowerStateRec, PowerStateRecForceMRC, PowerStateReset, PowerStateWarmReset, PowerStateCR50Reset:
+		ctrls[string(PowerState)] = string(PowerStateOn)
+	default:
+		return errors.Errorf("invalid value %q for %s", value, PowerState)
+	}
+	return nil
+}
+
+// setUSBKeyDirection handles image_usbkey_direction. Like servod, it powers the USB key on.
+func setUSBKeyDirection(ctrls map[string]string, value string) error {
+	if value != string(USBMuxDUT) && value != string(USBMuxHost) {
+		return errors.Errorf("invalid value %q for %s", value, ImageUSBKeyDirection)
+	}
+	ctrls[string(ImageUSBKeyDirection)] = value
+	ctrls[string(ImageUSBKeyPwr)] = "on"
+	return nil
+}
+
+// isKeypress returns whether ctrl presses keys or buttons.
+func isKeypress(ctrl string) bool {
+	switch ctrl {
+	case string(CtrlD), string(CtrlU), string(CtrlEnter), string(Ctrl), string(Enter), string(Refresh),
+		string(CtrlRefresh), string(ImaginaryKey), string(SysRQX), string(PowerKey), string(Pwrbutton),
+		string(VolumeDownHold), string(VolumeUpHold), string(VolumeUpDownHold):
+		return true
+	}
+	return false
+}
+
+// serveHTTP handles an XML-RPC request.
+func (fs *FakeServod) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var mc methodCall
+	if err := xml.Unmarshal(body, &mc); err != nil {
+		writeFault(w, &Fault{fakeFaultBadRequest, fmt.Sprintf("malformed request: %v", err)})
+		return
+	}
+	args := make([]string, len(mc.Params))
+	for i := range mc.Params {
+		if err := mc.Params[i].Value.decode(&args[i]); err != nil {
+			writeFault(w, &Fault{fakeFaultBadRequest, fmt.Sprintf("argument %d: %v", i, err)})
+			return
+		}
+	}
+
+	if mc.MethodName == "set" && len(args) == 2 && args[0] == string(PowerState) && args[1] == string(PowerStateOff) && fs.HangOnPowerOff {
+		// servod does not respond once the DUT is off; wait for the client to give up.
+		if _, err := fs.call(mc.MethodName, args); err == nil {
+			<-r.Context().Done()
+		}
+		return
+	}
+
+	out, err := fs.call(mc.MethodName, args)
+	if err != nil {
+		f, ok := err.(*Fault)
+		if !ok {
+			f = &Fault{fakeFaultControl, err.Error()}
+		}
+		writeFault(w, f)
+		return
+	}
+	params, err := newParams([]interface{}{out})
+	if err != nil {
+		writeFault(w, &Fault{fakeFaultBadRequest, err.Error()})
+		return
+	}
+	writeResponse(w, &response{Params: params})
+}
+
+// writeFault writes an XML-RPC fault response.
+func writeFault(w http.ResponseWriter, f *Fault) {
+	v, err := newValue(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeResponse(w, &response{Fault: &v})
+}
+
+// writeResponse writes an XML-RPC response.
+func writeResponse(w http.ResponseWriter, res *response) {
+	b, err := xml.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write(append([]byte(xml.Header), b...))
+}
+
+// call executes the servod method with args, and returns its result.
+func (fs *FakeServod) call(method string, args []string) (interface{}, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	wantArgs := map[string]int{"echo": 1, "get": 1, "set": 2, "doc": 1, "doc_all": 0, "get_version": 0, "power_normal_press": 0}
+	n, ok := wantArgs[method]
+	if !ok {
+		return nil, &Fault{fakeFaultUnknownMethod, fmt.Sprintf("method %q is not supported", method)}
+	}
+	if len(args) != n {
+		return nil, &Fault{fakeFaultBadRequest, fmt.Sprintf("%s takes %d argument(s); got %d", method, n, len(args))}
+	}
+
+	switch method {
+	case "echo":
+		return "ECH0ING: " + args[0], nil
+	case "get_version":
+		return fs.version, nil
+	case "power_normal_press":
+		fs.keypresses = append(fs.keypresses, FakeSet{string(PowerKey), string(DurPress)})
+		return true, nil
+	case "doc":
+		if doc, ok := fs.docs[args[0]]; ok {
+			return doc, nil
+		}
+		if _, ok := fs.controls[args[0]]; ok || isKeypress(args[0]) {
+			return fmt.Sprintf("Control %s.", args[0]), nil
+		}
+		return nil, errors.Errorf("no control named %s", args[0])
+	case "doc_all":
+		return fs.docAll(), nil
+	case "get":
+		v, ok := fs.controls[args[0]]
+		if !ok {
+			return nil, errors.Errorf("no control named %s", args[0])
+		}
+		if strings.HasSuffix(args[0], "_uart_stream") {
+			// Streams return the output captured since they were last read.
+			fs.controls[args[0]] = ""
+		}
+		return v, nil
+	}
+
+	// set
+	ctrl, v := args[0], args[1]
+	if h, ok := fs.handlers[ctrl]; ok {
+		if err := h(fs.controls, v); err != nil {
+			return nil, err
+		}
+		if isKeypress(ctrl) {
+			fs.keypresses = append(fs.keypresses, FakeSet{ctrl, v})
+		}
+	} else if isKeypress(ctrl) {
+		fs.keypresses = append(fs.keypresses, FakeSet{ctrl, v})
+	} else if _, ok := fs.controls[ctrl]; ok {
+		fs.controls[ctrl] = v
+	} else {
+		return nil, errors.Errorf("no control named %s", ctrl)
+	}
+	fs.sets = append(fs.sets, FakeSet{ctrl, v})
+	return true, nil
+}
+
+// docAll returns the output of the doc_all method, in the format of servod: the value maps
+// and the controls with their docs, each followed by its params.
+func (fs *FakeServod) docAll() string {
+	var doc strings.Builder
+	writeEntries := func(section string, docs map[string]string, params map[string]map[string]string) {
+		fmt.Fprintf(&doc, "*************\n* %s\n*************\n", section)
+		var names []string
+		for name := range docs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&doc, "%-24s :: %s\n", name, docs[name])
+			if p := params[name]; len(p) > 0 {
+				var keys []string
+				for k := range p {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				var items []string
+				for _, k := range keys {
+					items = append(items, fmt.Sprintf("'%s': '%s'", k, p[k]))
+				}
+				fmt.Fprintf(&doc, "%s --> {%s}\n", strings.Repeat("-", 24), strings.Join(items, ", "))
+			}
+		}
+	}
+
+	mapDocs := make(map[string]string)
+	for name := range fakeServodMaps {
+		mapDocs[name] = fmt.Sprintf("Values of %s.", name)
+	}
+	writeEntries("MAP", mapDocs, fakeServodMaps)
+
+	ctrlDocs := make(map[string]string)
+	for name := range fs.controls {
+		ctrlDocs[name] = fmt.Sprintf("Control %s.", name)
+	}
+	for name, d := range fs.docs {
+		ctrlDocs[name] = d
+	}
+	writeEntries("CONTROL", ctrlDocs, fs.params)
+	return doc.String()
+}
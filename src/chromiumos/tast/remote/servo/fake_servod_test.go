@@ -0,0 +1,187 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package servo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"chromiumos/tast/errors"
+)
+
+// newFakeServo starts a FakeServod and returns a Servo connected to it.
+func newFakeServo(ctx context.Context, t *testing.T) (*Servo, *FakeServod) {
+	fs, err := NewFakeServod()
+	if err != nil {
+		t.Fatal("NewFakeServod failed: ", err)
+	}
+	svo, err := New(ctx, fs.ConnSpec())
+	if err != nil {
+		fs.Close()
+		t.Fatal("New failed: ", err)
+	}
+	return svo, fs
+}
+
+func TestFakeServodGetSet(t *testing.T) {
+	ctx := context.Background()
+	svo, fs := newFakeServo(ctx, t)
+	defer fs.Close()
+
+	if v, err := svo.GetString(ctx, FWWPState); err != nil {
+		t.Errorf("GetString(%q) failed: %v", FWWPState, err)
+	} else if v != "force_off" {
+		t.Errorf("GetString(%q) = %q; want %q", FWWPState, v, "force_off")
+	}
+	if err := svo.SetStringAndCheck(ctx, FWWPState, "force_on"); err != nil {
+		t.Errorf("SetStringAndCheck(%q) failed: %v", FWWPState, err)
+	}
+	var f *Fault
+	if _, err := svo.GetString(ctx, "rutabaga"); !errors.As(err, &f) {
+		t.Errorf("GetString of an unknown control returned %v; want a fault", err)
+	}
+	// Bypass the validation of SetString.
+	if err := svo.run(ctx, newCall("set", string(V4Role), "rutabaga")); !errors.As(err, &f) {
+		t.Errorf("Setting %q to an invalid value returned %v; want a fault", V4Role, err)
+	}
+	if v, _ := fs.Control(string(V4Role)); v != string(V4RoleSrc) {
+		t.Errorf("%q = %q after setting an invalid value; want %q", V4Role, v, V4RoleSrc)
+	}
+
+	var doc string
+	if err := svo.run(ctx, newCall("doc", string(PowerState)), &doc); err != nil {
+		t.Errorf("doc(%q) failed: %v", PowerState, err)
+	} else if doc == "" {
+		t.Errorf("doc(%q) returned an empty string", PowerState)
+	}
+}
+
+func TestFakeServodUSBMux(t *testing.T) {
+	ctx := context.Background()
+	svo, fs := newFakeServo(ctx, t)
+	defer fs.Close()
+
+	for _, want := range []USBMuxState{USBMuxHost, USBMuxOff, USBMuxHost} {
+		if err := svo.SetUSBMuxState(ctx, want); err != nil {
+			t.Fatalf("SetUSBMuxState(%q) failed: %v", want, err)
+		}
+		if got, err := svo.GetUSBMuxState(ctx); err != nil {
+			t.Fatal("GetUSBMuxState failed: ", err)
+		} else if got != want {
+			t.Errorf("GetUSBMuxState() = %q; want %q", got, want)
+		}
+	}
+
+	fs.SetControl(string(ImageUSBKeyDirection), "rutabaga")
+	if _, err := svo.GetUSBMuxState(ctx); err == nil {
+		t.Error("GetUSBMuxState with an unknown direction unexpectedly succeeded")
+	}
+}
+
+func TestFakeServodPowerState(t *testing.T) {
+	ctx := context.Background()
+	svo, fs := newFakeServo(ctx, t)
+	defer fs.Close()
+
+	for _, tc := range []struct {
+		value PowerStateValue
+		want  PowerStateValue
+	}{
+		{PowerStateOff, PowerStateOff},
+		{PowerStateOn, PowerStateOn},
+		{PowerStateRec, PowerStateOn},
+		{PowerStateWarmReset, PowerStateOn},
+	} {
+		// Setting power_state to off hangs, so keep the timeout short.
+		shortCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		err := svo.SetPowerState(shortCtx, tc.value)
+		cancel()
+		if err != nil {
+			t.Errorf("SetPowerState(%q) failed: %v", tc.value, err)
+		}
+		if v, _ := fs.Control(string(PowerState)); v != string(tc.want) {
+			t.Errorf("%q = %q after setting %q; want %q", PowerState, v, tc.value, tc.want)
+		}
+	}
+
+	// Without hanging, SetPowerState reports the unexpected response.
+	fs.HangOnPowerOff = false
+	if err := svo.SetPowerState(ctx, PowerStateOff); err == nil {
+		t.Error("SetPowerState(off) unexpectedly succeeded without a timeout")
+	}
+}
+
+func TestFakeServodKeypresses(t *testing.T) {
+	ctx := context.Background()
+	svo, fs := newFakeServo(ctx, t)
+	defer fs.Close()
+
+	if err := svo.KeypressWithDuration(ctx, CtrlD, DurPress); err != nil {
+		t.Fatal("KeypressWithDuration failed: ", err)
+	}
+	if err := svo.SetInt(ctx, VolumeUpHold, 100); err != nil {
+		t.Fatal("SetInt failed: ", err)
+	}
+	if _, err := svo.PowerNormalPress(ctx); err != nil {
+		t.Fatal("PowerNormalPress failed: ", err)
+	}
+	if err := svo.ToggleOffOn(ctx, RecMode); err != nil {
+		t.Fatal("ToggleOffOn failed: ", err)
+	}
+
+	want := []FakeSet{{"ctrl_d", "press"}, {"volume_up_hold", "100"}, {"power_key", "press"}}
+	if got := fs.Keypresses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Keypresses() = %v; want %v", got, want)
+	}
+	wantSets := []FakeSet{{"ctrl_d", "press"}, {"volume_up_hold", "100"}, {"rec_mode", "off"}, {"rec_mode", "on"}}
+	if got := fs.Sets(); !reflect.DeepEqual(got, wantSets) {
+		t.Errorf("Sets() = %v; want %v", got, wantSets)
+	}
+}
+
+func TestFakeServodHandle(t *testing.T) {
+	ctx := context.Background()
+	svo, fs := newFakeServo(ctx, t)
+	defer fs.Close()
+
+	// Make servo_v4_role changes flip the voltage seen by the DUT.
+	fs.Handle(string(V4Role), func(ctrls map[string]string, value string) error {
+		switch V4RoleValue(value) {
+		case V4RoleSnk:
+			ctrls[string(DUTVoltageMV)] = "0"
+		case V4RoleSrc:
+			ctrls[string(DUTVoltageMV)] = "5000"
+		default:
+			return errors.Errorf("invalid role %q", value)
+		}
+		ctrls[string(V4Role)] = value
+		return nil
+	})
+	if err := svo.SetV4Role(ctx, V4RoleSnk); err != nil {
+		t.Fatal("SetV4Role failed: ", err)
+	}
+	if v, err := svo.DUTVoltageMV(ctx); err != nil {
+		t.Fatal("DUTVoltageMV failed: ", err)
+	} else if v != "0" {
+		t.Errorf("DUTVoltageMV() = %q after setting the role to %q; want %q", v, V4RoleSnk, "0")
+	}
+	if err := svo.Close(ctx); err != nil {
+		t.Fatal("Close failed: ", err)
+	}
+	if v, _ := fs.Control(string(V4Role)); v != string(V4RoleSrc) {
+		t.Errorf("%q = %q after Close; want %q", V4Role, v, V4RoleSrc)
+	}
+
+	// Servo versions other than v4 have no role.
+	fs.SetVersion("servo_v3")
+	if err := svo.SetV4Role(ctx, V4RoleSnk); err != nil {
+		t.Fatal("SetV4Role failed: ", err)
+	}
+	if v, _ := fs.Control(string(V4Role)); v != string(V4RoleSrc) {
+		t.Errorf("%q = %q on servo_v3; want %q", V4Role, v, V4RoleSrc)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package servo
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"chromiumos/tast/common/perf"
+	"chromiumos/tast/errors"
+)
+
+// An INAMeasurement is a quantity measured by the INA power monitors of a servo.
+// Its value is the suffix of the controls reading it, e.g. ppvar_sys_mw.
+type INAMeasurement string
+
+// These are the quantities measured by INA power monitors.
+const (
+	INAPower   INAMeasurement = "mw"
+	INACurrent INAMeasurement = "ma"
+	INAVoltage INAMeasurement = "mv"
+)
+
+// inaMetrics describes how INA measurements are reported as perf metrics.
+// Values are converted from servod's milli-units to SI units to match other
+// power metrics such as RAPL's.
+var inaMetrics = map[INAMeasurement]struct {
+	name string
+	unit string
+}{
+	INAPower:   {"power", "W"},
+	INACurrent: {"current", "A"},
+	INAVoltage: {"voltage", "V"},
+}
+
+// inaControlRe matches the names of INA controls, e.g. "ppvar_sys_mw".
+var inaControlRe = regexp.MustCompile(`^([a-z0-9_]+?)_(mw|ma|mv)$`)
+
+// inaDrvPrefix is the prefix of the servod drivers of INA power monitors, e.g. "ina219" or "ina231".
+const inaDrvPrefix = "ina"
+
+// INAControl returns the name of the control reading m on rail, e.g. "ppvar_sys_mw".
+func INAControl(rail string, m INAMeasurement) string {
+	return rail + "_" + string(m)
+}
+
+// GetFloat returns the value of a control as a float.
+func (s *Servo) GetFloat(ctx context.Context, control string) (float64, error) {
+	// servod returns floats for INA controls, but strings for some other numeric controls.
+	var value string
+	if err := s.run(ctx, newCall("get", control), &value); err != nil {
+		return 0, errors.Wrapf(err, "getting value for servo control %q", control)
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parsing value of servo control %q", control)
+	}
+	return f, nil
+}
+
+// INARails returns the power rails which have INA controls on this servo, along with
+// the quantities measured on each of them, as listed by the catalog of the servo.
+func (s *Servo) INARails(ctx context.Context) (map[string][]INAMeasurement, error) {
+	cat, err := s.cachedCatalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cat.INARails(), nil
+}
+
+// INARails returns the power rails which have INA controls, along with the quantities
+// measured on each of them. INA controls are read by the servod drivers of INA power monitors.
+func (c *Catalog) INARails() map[string][]INAMeasurement {
+	rails := make(map[string][]INAMeasurement)
+	for name, sc := range c.controls {
+		if !strings.HasPrefix(sc.get["drv"], inaDrvPrefix) {
+			continue
+		}
+		if m := inaControlRe.FindStringSubmatch(name); m != nil {
+			rails[m[1]] = append(rails[m[1]], INAMeasurement(m[2]))
+		}
+	}
+	for _, ms := range rails {
+		sort.Slice(ms, func(i, j int) bool { return ms[i] < ms[j] })
+	}
+	return rails
+}
+
+// inaControl is an INA control sampled by INAMetrics.
+type inaControl struct {
+	name   string
+	metric perf.Metric
+	sum    float64
+}
+
+// INAMetrics records the power, current or voltage of servo INA rails, as reported by servod.
+// The controls are sampled on the host at a fixed interval, and each snapshot reports the average
+// of the samples taken since the previous snapshot.
+type INAMetrics struct {
+	svo      *Servo
+	rails    []string
+	ms       []INAMeasurement
+	interval time.Duration
+
+	mu       sync.Mutex
+	controls []*inaControl
+	samples  int
+	err      error // first sampling error
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Assert that INAMetrics can be used in perf.Timeline.
+var _ perf.TimelineDatasource = &INAMetrics{}
+
+// NewINAMetrics creates a timeline metric sampling the quantities ms of rails every interval.
+// If rails is empty, all the rails with INA controls are recorded. If ms is empty, power is
+// recorded. interval must be positive, or Setup fails. Stop must be called to stop sampling once the timeline is not used anymore.
+func NewINAMetrics(svo *Servo, rails []string, interval time.Duration, ms ...INAMeasurement) *INAMetrics {
+	if len(ms) == 0 {
+		ms = []INAMeasurement{INAPower}
+	}
+	return &INAMetrics{svo: svo, rails: rails, ms: ms, interval: interval}
+}
+
+// Setup looks up the INA controls available on the servo, and creates the metrics.
+func (m *INAMetrics) Setup(ctx context.Context, prefix string) error {
+	if m.interval <= 0 {
+		return errors.Errorf("invalid INA sampling interval %v", m.interval)
+	}
+	avail, err := m.svo.INARails(ctx)
+	if err != nil {
+		return err
+	}
+	rails := m.rails
+	if len(rails) == 0 {
+		for r := range avail {
+			rails = append(rails, r)
+		}
+		sort.Strings(rails)
+	}
+
+	m.controls = nil
+	for _, r := range rails {
+		for _, ms := range m.ms {
+			if !hasINAMeasurement(avail[r], ms) {
+				if len(m.rails) == 0 {
+					// Discovered rails do not necessarily measure every quantity.
+					continue
+				}
+				return errors.Errorf("servo has no control %q", INAControl(r, ms))
+			}
+			mt := inaMetrics[ms]
+			m.controls = append(m.controls, &inaControl{
+				name: INAControl(r, ms),
+				metric: perf.Metric{Name: prefix + "servo." + r + "." + mt.name, Unit: mt.unit,
+					Direction: perf.SmallerIsBetter, Multiple: true},
+			})
+		}
+	}
+	if len(m.controls) == 0 {
+		return errors.New("no INA controls found")
+	}
+	return nil
+}
+
+// hasINAMeasurement returns whether ms contains m.
+func hasINAMeasurement(ms []INAMeasurement, m INAMeasurement) bool {
+	for _, x := range ms {
+		if x == m {
+			return true
+		}
+	}
+	return false
+}
+
+// Start starts sampling the INA controls in the background until ctx is done or Stop is called.
+func (m *INAMetrics) Start(ctx context.Context) error {
+	if m.done != nil {
+		return errors.New("already started")
+	}
+	if err := m.sample(ctx); err != nil {
+		return errors.Wrap(err, "failed to take initial INA samples")
+	}
+	m.reset()
+
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := m.sample(ctx); err != nil {
+				if ctx.Err() == nil {
+					m.mu.Lock()
+					m.err = err
+					m.mu.Unlock()
+				}
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops sampling the INA controls.
+func (m *INAMetrics) Stop() {
+	if m.done == nil {
+		return
+	}
+	m.cancel()
+	<-m.done
+	m.done = nil
+}
+
+// sample reads all the INA controls once, and adds their values to the running sums.
+func (m *INAMetrics) sample(ctx context.Context) error {
+	vs := make([]float64, len(m.controls))
+	for i, c := range m.controls {
+		v, err := m.svo.GetFloat(ctx, c.name)
+		if err != nil {
+			return err
+		}
+		vs[i] = v
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, c := range m.controls {
+		c.sum += vs[i]
+	}
+	m.samples++
+	return nil
+}
+
+// reset clears the running sums.
+func (m *INAMetrics) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.controls {
+		c.sum = 0
+	}
+	m.samples = 0
+}
+
+// Snapshot reports the average values of the INA controls since the previous snapshot.
+// If no sample was taken in the meantime, the controls are sampled once.
+func (m *INAMetrics) Snapshot(ctx context.Context, values *perf.Values) error {
+	m.mu.Lock()
+	err, samples := m.err, m.samples
+	m.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "failed to sample INA controls")
+	}
+	if samples == 0 {
+		if err := m.sample(ctx); err != nil {
+			return errors.Wrap(err, "failed to sample INA controls")
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.controls {
+		// Convert from milli-units.
+		values.Append(c.metric, c.sum/float64(m.samples)/1000)
+		c.sum = 0
+	}
+	m.samples = 0
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package servo
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"chromiumos/tast/common/perf"
+	"chromiumos/tast/testutil"
+)
+
+func TestCatalogINARails(t *testing.T) {
+	const doc = `dut_voltage_mv   :: Voltage on the DUT port.
+---------------- --> {'cmd': 'get', 'drv': 'ec', 'subtype': 'dut_voltage'}
+ppvar_sys_mw     :: Power of ppvar_sys.
+---------------- --> {'cmd': 'get', 'drv': 'ina231', 'subtype': 'milliwatts'}
+ppvar_sys_ma     :: Current of ppvar_sys.
+---------------- --> {'cmd': 'get', 'drv': 'ina231', 'subtype': 'milliamps'}
+ppvar_sys_mv     :: Voltage of ppvar_sys.
+---------------- --> {'cmd': 'get', 'drv': 'ina231', 'subtype': 'millivolts'}
+pp3300_a_mw      :: Power of pp3300_a.
+---------------- --> {'cmd': 'get', 'drv': 'ina219', 'subtype': 'milliwatts'}
+pp3300_a_shuntmv :: Shunt voltage of pp3300_a.
+---------------- --> {'cmd': 'get', 'drv': 'ina219', 'subtype': 'shuntmv'}
+power_state      :: Power state. Mentions ppvar_sys_mw in the middle of a line.
+`
+	c := &Catalog{}
+	c.controls, c.maps = parseDocAll(doc)
+	expected := map[string][]INAMeasurement{
+		"ppvar_sys": {INACurrent, INAVoltage, INAPower},
+		"pp3300_a":  {INAPower},
+	}
+	if actual := c.INARails(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("INARails() = %v; want %v", actual, expected)
+	}
+}
+
+// readCrosbolt saves values and returns the values of each metric.
+func readCrosbolt(t *testing.T, values *perf.Values) map[string][]float64 {
+	td := testutil.TempDir(t)
+	defer os.RemoveAll(td)
+	if err := values.Save(td); err != nil {
+		t.Fatal("Save failed: ", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(td, "results-chart.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var charts map[string]map[string]struct {
+		Units  string    `json:"units"`
+		Values []float64 `json:"values"`
+	}
+	if err := json.Unmarshal(b, &charts); err != nil {
+		t.Fatal(err)
+	}
+	res := make(map[string][]float64)
+	for name, traces := range charts {
+		for _, tr := range traces {
+			res[name+" "+tr.Units] = tr.Values
+		}
+	}
+	return res
+}
+
+func TestINAMetrics(t *testing.T) {
+	ctx := context.Background()
+	svo, fs := newFakeServo(ctx, t)
+	defer fs.Close()
+	for ctrl, v := range map[string]string{"ppvar_sys_mw": "1500", "ppvar_sys_mv": "12000", "pp3300_a_mw": "330"} {
+		fs.SetControl(ctrl, v)
+		fs.SetParams(ctrl, map[string]string{"cmd": "get", "drv": "ina231"})
+	}
+	// Controls which are not read by INA drivers are not rails.
+	fs.SetControl(string(DUTVoltageMV), "5000")
+
+	for _, tc := range []struct {
+		rails    []string
+		ms       []INAMeasurement
+		expected map[string][]float64
+	}{
+		{nil, nil, map[string][]float64{
+			"INA.servo.ppvar_sys.power W": {1.5},
+			"INA.servo.pp3300_a.power W":  {0.33},
+		}},
+		{[]string{"ppvar_sys"}, []INAMeasurement{INAPower, INAVoltage}, map[string][]float64{
+			"INA.servo.ppvar_sys.power W":   {1.5},
+			"INA.servo.ppvar_sys.voltage V": {12},
+		}},
+	} {
+		m := NewINAMetrics(svo, tc.rails, 10*time.Millisecond, tc.ms...)
+		if err := m.Setup(ctx, "INA."); err != nil {
+			t.Fatal("Setup failed: ", err)
+		}
+		if err := m.Start(ctx); err != nil {
+			t.Fatal("Start failed: ", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		values := perf.NewValues()
+		err := m.Snapshot(ctx, values)
+		m.Stop()
+		if err != nil {
+			t.Fatal("Snapshot failed: ", err)
+		}
+		if actual := readCrosbolt(t, values); !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("NewINAMetrics(%q, %q) reported %v; want %v", tc.rails, tc.ms, actual, tc.expected)
+		}
+	}
+
+	m := NewINAMetrics(svo, []string{"ppvar_sys"}, time.Second, INACurrent)
+	if err := m.Setup(ctx, ""); err == nil {
+		t.Error("Setup unexpectedly succeeded for a missing control")
+	}
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if err := NewINAMetrics(svo, nil, interval).Setup(ctx, ""); err == nil {
+			t.Errorf("Setup unexpectedly succeeded with interval %v", interval)
+		}
+	}
+}
@@ -139,14 +139,14 @@ func (s *Servo) SetActChgPort(ctx context.Context, port string) error {
 	// Servo's Set method returns a bool stating whether the call succeeded or not.
 	// This is redundant, because a failed call will return an error anyway.
 	// So, we can skip unpacking the output.
-	err := s.run(ctx, newCall("set", ActiveChgPort, port))
+	err := s.run(ctx, newCall("set", string(ActiveChgPort), port))
 	return err
 }
 
 // DUTVoltageMV reads the voltage present on the DUT port on fluffy.
 func (s *Servo) DUTVoltageMV(ctx context.Context) (string, error) {
 	var voltageMV string
-	err := s.run(ctx, newCall("get", DUTVoltageMV), &voltageMV)
+	err := s.run(ctx, newCall("get", string(DUTVoltageMV)), &voltageMV)
 	return voltageMV, err
 }
 
@@ -167,7 +167,11 @@ func (s *Servo) GetString(ctx context.Context, control StringControl) (string, e
 }
 
 // SetString sets a Servo control to a string value.
+// The value is validated against the catalog of the servo before being sent, if servod provides it.
 func (s *Servo) SetString(ctx context.Context, control StringControl, value string) error {
+	if err := s.validateSet(ctx, string(control), value); err != nil {
+		return err
+	}
 	// Servo's Set method returns a bool stating whether the call succeeded or not.
 	// This is redundant, because a failed call will return an error anyway.
 	// So, we can skip unpacking the output.
@@ -178,7 +182,11 @@ func (s *Servo) SetString(ctx context.Context, control StringControl, value stri
 }
 
 // SetInt sets a Servo control to an integer value.
+// The value is validated against the catalog of the servo before being sent, if servod provides it.
 func (s *Servo) SetInt(ctx context.Context, control IntControl, value int) error {
+	if err := s.validateSet(ctx, string(control), value); err != nil {
+		return err
+	}
 	if err := s.run(ctx, newCall("set", string(control), value)); err != nil {
 		return errors.Wrapf(err, "setting servo control %q to %d", control, value)
 	}
@@ -248,13 +256,19 @@ func (s *Servo) SetUSBMuxState(ctx context.Context, value USBMuxState) error {
 	// has had time to enumerate the USB.
 	// TODO(b/157751281): Clean this up once servo_v3 has been removed.
 	if value == USBMuxDUT {
-		if err := testing.Sleep(ctx, 5*time.Second); err != nil {
+		if err := testing.Sleep(ctx, s.usbDetectionDelay); err != nil {
 			return errors.Wrap(err, "sleeping after switching usbkey direction")
 		}
 	}
 	return nil
 }
 
+// SetUSBDetectionDelay sets how long SetUSBMuxState waits for the DUT to detect the USB image key
+// after switching it to the DUT, e.g. to shorten it for a simulated DUT.
+func (s *Servo) SetUSBDetectionDelay(d time.Duration) {
+	s.usbDetectionDelay = d
+}
+
 // SetPowerState sets the PowerState control.
 // Because this is particularly disruptive, it is always logged.
 func (s *Servo) SetPowerState(ctx context.Context, value PowerStateValue) error {
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"chromiumos/tast/errors"
@@ -25,6 +26,17 @@ type Servo struct {
 
 	// If initialV4Role is set, then upon Servo.Close(), the V4Role control will be set to initialV4Role.
 	initialV4Role V4RoleValue
+
+	// usbDetectionDelay is how long SetUSBMuxState waits for the DUT to detect the USB image key.
+	usbDetectionDelay time.Duration
+
+	// catalogMu protects catalog and catalogErr.
+	catalogMu sync.Mutex
+	// catalog is the catalog of the servo against which the values of controls are validated.
+	// It is queried from servod by the first call needing it.
+	catalog *Catalog
+	// catalogErr is the error returned by servod when the catalog was queried, if any.
+	catalogErr error
 }
 
 const (
@@ -34,6 +46,8 @@ const (
 	servodDefaultPort = 9999
 	// rpcTimeout is the default and maximum timeout for XML-RPC requests to servod.
 	rpcTimeout = 10 * time.Second
+	// defaultUSBDetectionDelay is the default time given to the DUT to detect the USB image key.
+	defaultUSBDetectionDelay = 5 * time.Second
 )
 
 // New creates a new Servo object for communicating with a servod instance.
@@ -44,7 +58,7 @@ func New(ctx context.Context, connSpec string) (*Servo, error) {
 	if err != nil {
 		return nil, err
 	}
-	s := &Servo{host: host, port: port}
+	s := &Servo{host: host, port: port, usbDetectionDelay: defaultUSBDetectionDelay}
 
 	// Ensure Servo is set up properly before returning.
 	return s, s.verifyConnectivity(ctx)
@@ -7,12 +7,16 @@ package servo
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"net/http"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"chromiumos/tast/errors"
@@ -38,8 +42,9 @@ type request struct {
 
 // response is an XML-RPC response.
 type response struct {
-	Name   xml.Name `xml:"methodResponse"`
-	Params []param  `xml:"params>param"`
+	XMLName xml.Name `xml:"methodResponse"`
+	Params  []param  `xml:"params>param"`
+	Fault   *value   `xml:"fault>value"`
 }
 
 // param is an XML-RPC param.
@@ -47,14 +52,59 @@ type param struct {
 	Value value `xml:"value"`
 }
 
-// value is an XML-RPC value.
+// value is an XML-RPC value. Exactly one of its fields is set, except for values
+// without a type element, which are strings stored in Raw. Scalars are pointers so
+// that empty elements, e.g. <string></string>, are told apart from missing ones.
 type value struct {
-	Boolean string `xml:"boolean,omitempty"`
-	Double  string `xml:"double,omitempty"`
-	Int     string `xml:"int,omitempty"`
-	String  string `xml:"string,omitempty"`
+	Boolean  *string       `xml:"boolean,omitempty"`
+	Double   *string       `xml:"double,omitempty"`
+	Int      *string       `xml:"int,omitempty"`
+	I4       *string       `xml:"i4,omitempty"`
+	String   *string       `xml:"string,omitempty"`
+	Base64   *string       `xml:"base64,omitempty"`
+	DateTime *string       `xml:"dateTime.iso8601,omitempty"`
+	Array    *xmlrpcArray  `xml:"array,omitempty"`
+	Struct   *xmlrpcStruct `xml:"struct,omitempty"`
+	Nil      *struct{}     `xml:"nil,omitempty"`
+	Raw      string        `xml:",chardata"`
+}
+
+// xmlrpcArray is an XML-RPC array.
+type xmlrpcArray struct {
+	Values []value `xml:"data>value"`
+}
+
+// xmlrpcStruct is an XML-RPC struct.
+type xmlrpcStruct struct {
+	Members []member `xml:"member"`
+}
+
+// member is a member of an XML-RPC struct.
+type member struct {
+	Name  string `xml:"name"`
+	Value value  `xml:"value"`
 }
 
+// Fault is an XML-RPC fault returned by servod, e.g. when getting an unknown control.
+// It can be extracted from errors returned by Servo methods with errors.As.
+type Fault struct {
+	Code    int    `xmlrpc:"faultCode"`
+	Message string `xmlrpc:"faultString"`
+}
+
+// Error implements error.
+func (f *Fault) Error() string {
+	return fmt.Sprintf("servod fault %d: %s", f.Code, f.Message)
+}
+
+// dateTimeLayout is the layout of XML-RPC dateTime.iso8601 values, which have no time zone.
+const dateTimeLayout = "20060102T15:04:05"
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
 // xmlBooleanToBool converts the strings '1' or '0' into boolean.
 func xmlBooleanToBool(xmlBool string) (bool, error) {
 	if len(xmlBool) != 1 {
@@ -78,43 +128,411 @@ func boolToXMLBoolean(v bool) string {
 	return "0"
 }
 
-// xmlIntegerToInt converts numeric strings such as '-1' into integers.
-func xmlIntegerToInt(xmlInt string) (int, error) {
-	if len(xmlInt) == 0 {
-		return 0, errors.New("xmlIntegerToInt got empty xml value")
-	}
-	i, err := strconv.ParseInt(xmlInt, 10, 32)
-	if err != nil {
-		return 0, err
-	}
-	return int(i), nil
+// xmlDoubleToFloat converts an XML-RPC double string into a float.
+func xmlDoubleToFloat(xmlDouble string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSpace(xmlDouble), 64)
 }
 
-// intToXMLInteger converts a Go integer to an XML-RPC integer string.
-func intToXMLInteger(i int) (string, error) {
-	if i > math.MaxInt32 || i < math.MinInt32 {
-		return "", errors.Errorf("intToXMLInteger needs a value that can fit in an int32: got %d, want between %d and %d", i, math.MinInt32, math.MaxInt32)
+// floatToXMLDouble converts a Go float to an XML-RPC double string.
+// XML-RPC doubles have no exponent, and cannot be infinite or NaN.
+func floatToXMLDouble(f float64) (string, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", errors.Errorf("floatToXMLDouble got %v; XML-RPC has no representation for it", f)
 	}
-	return strconv.FormatInt(int64(i), 10), nil
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
+}
+
+// scalar returns a pointer to s, to be stored in a scalar field of value.
+func scalar(s string) *string {
+	return &s
 }
 
-// newValue creates an XML-RPC <value>.
+// newValue creates an XML-RPC <value> from a Go value.
+// Strings, booleans, integers, floats, []byte, time.Time and nil are encoded as scalars,
+// slices and arrays as arrays, and maps with string keys and structs as structs.
+// Struct fields are named by their xmlrpc tag if any, e.g. `xmlrpc:"name"`, and fields
+// tagged with `xmlrpc:"-"` are skipped.
 func newValue(in interface{}) (value, error) {
-	// TODO(jeffcarp): Support more data types.
-	switch v := in.(type) {
-	case string:
-		return value{String: v}, nil
-	case bool:
-		return value{Boolean: boolToXMLBoolean(v)}, nil
-	case int:
-		i, err := intToXMLInteger(v)
+	if in == nil {
+		return value{Nil: &struct{}{}}, nil
+	}
+	return reflectToValue(reflect.ValueOf(in))
+}
+
+// reflectToValue creates an XML-RPC <value> from a reflected Go value.
+func reflectToValue(rv reflect.Value) (value, error) {
+	switch rv.Type() {
+	case timeType:
+		return value{DateTime: scalar(rv.Interface().(time.Time).Format(dateTimeLayout))}, nil
+	case bytesType:
+		return value{Base64: scalar(base64.StdEncoding.EncodeToString(rv.Bytes()))}, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return value{String: scalar(rv.String())}, nil
+	case reflect.Bool:
+		return value{Boolean: scalar(boolToXMLBoolean(rv.Bool()))}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i := rv.Int(); i > math.MaxInt32 || i < math.MinInt32 {
+			return value{}, errors.Errorf("%d does not fit in an XML-RPC int", i)
+		}
+		return value{Int: scalar(strconv.FormatInt(rv.Int(), 10))}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := rv.Uint(); u > math.MaxInt32 {
+			return value{}, errors.Errorf("%d does not fit in an XML-RPC int", u)
+		}
+		return value{Int: scalar(strconv.FormatUint(rv.Uint(), 10))}, nil
+	case reflect.Float32, reflect.Float64:
+		d, err := floatToXMLDouble(rv.Float())
 		if err != nil {
 			return value{}, err
 		}
-		return value{Int: i}, nil
+		return value{Double: scalar(d)}, nil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return value{Nil: &struct{}{}}, nil
+		}
+		return reflectToValue(rv.Elem())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return value{Nil: &struct{}{}}, nil
+		}
+		a := &xmlrpcArray{Values: make([]value, rv.Len())}
+		for i := 0; i < rv.Len(); i++ {
+			v, err := reflectToValue(rv.Index(i))
+			if err != nil {
+				return value{}, errors.Wrapf(err, "array element %d", i)
+			}
+			a.Values[i] = v
+		}
+		return value{Array: a}, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return value{}, errors.Errorf("%v has non-string keys", rv.Type())
+		}
+		if rv.IsNil() {
+			return value{Nil: &struct{}{}}, nil
+		}
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		s := &xmlrpcStruct{}
+		for _, k := range keys {
+			v, err := reflectToValue(rv.MapIndex(k))
+			if err != nil {
+				return value{}, errors.Wrapf(err, "struct member %q", k.String())
+			}
+			s.Members = append(s.Members, member{Name: k.String(), Value: v})
+		}
+		return value{Struct: s}, nil
+	case reflect.Struct:
+		s := &xmlrpcStruct{}
+		for _, f := range structFields(rv.Type()) {
+			v, err := reflectToValue(rv.Field(f.index))
+			if err != nil {
+				return value{}, errors.Wrapf(err, "struct member %q", f.name)
+			}
+			s.Members = append(s.Members, member{Name: f.name, Value: v})
+		}
+		return value{Struct: s}, nil
+	}
+	return value{}, errors.Errorf("%q not of supported type", rv.Interface())
+}
+
+// structField is a field of a Go struct encoded as an XML-RPC struct member.
+type structField struct {
+	name  string
+	index int
+}
+
+// structFields returns the fields of the struct type t encoded as XML-RPC struct members.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// Unexported.
+			continue
+		}
+		name := f.Name
+		if tag := f.Tag.Get("xmlrpc"); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		fields = append(fields, structField{name, i})
+	}
+	return fields
+}
+
+// decode stores v into the Go value pointed to by out. If out is a *interface{}, it
+// receives a string, bool, int, float64, []byte, time.Time, []interface{},
+// map[string]interface{} or nil, depending on the type of v.
+func (v *value) decode(out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.Errorf("cannot decode into non-pointer %T", out)
+	}
+	return v.decodeReflect(rv.Elem())
+}
+
+// decodeReflect stores v into the settable reflected Go value rv.
+func (v *value) decodeReflect(rv reflect.Value) error {
+	if v.Nil != nil {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	switch rv.Type() {
+	case timeType:
+		if v.DateTime == nil {
+			return errors.Errorf("cannot decode %s into time.Time", v.typeName())
+		}
+		t, err := time.Parse(dateTimeLayout, strings.TrimSpace(*v.DateTime))
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(t))
+		return nil
+	case bytesType:
+		if v.Base64 == nil {
+			return errors.Errorf("cannot decode %s into []byte", v.typeName())
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(*v.Base64))
+		if err != nil {
+			return err
+		}
+		rv.SetBytes(b)
+		return nil
 	}
 
-	return value{}, errors.Errorf("%q not of supported type", in)
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.NumMethod() != 0 {
+			return errors.Errorf("cannot decode into non-empty interface %v", rv.Type())
+		}
+		x, err := v.natural()
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			rv.Set(reflect.Zero(rv.Type()))
+		} else {
+			rv.Set(reflect.ValueOf(x))
+		}
+		return nil
+	case reflect.Ptr:
+		p := reflect.New(rv.Type().Elem())
+		if err := v.decodeReflect(p.Elem()); err != nil {
+			return err
+		}
+		rv.Set(p)
+		return nil
+	case reflect.String:
+		// servod returns the values of some controls with their own type, e.g. int,
+		// so scalars are accepted as their textual representation.
+		if v.Array != nil || v.Struct != nil {
+			return errors.Errorf("cannot decode %s into %v", v.typeName(), rv.Type())
+		}
+		rv.SetString(v.text())
+		return nil
+	case reflect.Bool:
+		if v.Boolean == nil {
+			return errors.Errorf("cannot decode %s into %v", v.typeName(), rv.Type())
+		}
+		b, err := xmlBooleanToBool(strings.TrimSpace(*v.Boolean))
+		if err != nil {
+			return err
+		}
+		rv.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s, ok := v.integer()
+		if !ok {
+			return errors.Errorf("cannot decode %s into %v", v.typeName(), rv.Type())
+		}
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		if rv.OverflowInt(i) {
+			return errors.Errorf("%d overflows %v", i, rv.Type())
+		}
+		rv.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s, ok := v.integer()
+		if !ok {
+			return errors.Errorf("cannot decode %s into %v", v.typeName(), rv.Type())
+		}
+		u, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		if rv.OverflowUint(u) {
+			return errors.Errorf("%d overflows %v", u, rv.Type())
+		}
+		rv.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		var s string
+		if i, ok := v.integer(); ok {
+			s = i
+		} else if v.Double != nil {
+			s = *v.Double
+		} else {
+			return errors.Errorf("cannot decode %s into %v", v.typeName(), rv.Type())
+		}
+		f, err := xmlDoubleToFloat(s)
+		if err != nil {
+			return err
+		}
+		rv.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		if v.Array == nil {
+			return errors.Errorf("cannot decode %s into %v", v.typeName(), rv.Type())
+		}
+		s := reflect.MakeSlice(rv.Type(), len(v.Array.Values), len(v.Array.Values))
+		for i := range v.Array.Values {
+			if err := v.Array.Values[i].decodeReflect(s.Index(i)); err != nil {
+				return errors.Wrapf(err, "array element %d", i)
+			}
+		}
+		rv.Set(s)
+		return nil
+	case reflect.Array:
+		if v.Array == nil {
+			return errors.Errorf("cannot decode %s into %v", v.typeName(), rv.Type())
+		}
+		if len(v.Array.Values) != rv.Len() {
+			return errors.Errorf("cannot decode array of %d elements into %v", len(v.Array.Values), rv.Type())
+		}
+		for i := range v.Array.Values {
+			if err := v.Array.Values[i].decodeReflect(rv.Index(i)); err != nil {
+				return errors.Wrapf(err, "array element %d", i)
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.Struct == nil || rv.Type().Key().Kind() != reflect.String {
+			return errors.Errorf("cannot decode %s into %v", v.typeName(), rv.Type())
+		}
+		m := reflect.MakeMapWithSize(rv.Type(), len(v.Struct.Members))
+		for i := range v.Struct.Members {
+			mb := &v.Struct.Members[i]
+			e := reflect.New(rv.Type().Elem()).Elem()
+			if err := mb.Value.decodeReflect(e); err != nil {
+				return errors.Wrapf(err, "struct member %q", mb.Name)
+			}
+			m.SetMapIndex(reflect.ValueOf(mb.Name).Convert(rv.Type().Key()), e)
+		}
+		rv.Set(m)
+		return nil
+	case reflect.Struct:
+		if v.Struct == nil {
+			return errors.Errorf("cannot decode %s into %v", v.typeName(), rv.Type())
+		}
+		fields := make(map[string]int)
+		for _, f := range structFields(rv.Type()) {
+			fields[f.name] = f.index
+		}
+		// Members without a matching field are ignored, so that servod can add new ones.
+		for i := range v.Struct.Members {
+			mb := &v.Struct.Members[i]
+			idx, ok := fields[mb.Name]
+			if !ok {
+				continue
+			}
+			if err := mb.Value.decodeReflect(rv.Field(idx)); err != nil {
+				return errors.Wrapf(err, "struct member %q", mb.Name)
+			}
+		}
+		return nil
+	}
+	return errors.Errorf("cannot decode %s into unsupported type %v", v.typeName(), rv.Type())
+}
+
+// natural returns v as the Go value it naturally maps to. See decode.
+func (v *value) natural() (interface{}, error) {
+	switch v.typeName() {
+	case "nil":
+		return nil, nil
+	case "boolean":
+		var b bool
+		err := v.decodeReflect(reflect.ValueOf(&b).Elem())
+		return b, err
+	case "int":
+		var i int
+		err := v.decodeReflect(reflect.ValueOf(&i).Elem())
+		return i, err
+	case "double":
+		var f float64
+		err := v.decodeReflect(reflect.ValueOf(&f).Elem())
+		return f, err
+	case "base64":
+		var b []byte
+		err := v.decodeReflect(reflect.ValueOf(&b).Elem())
+		return b, err
+	case "dateTime.iso8601":
+		var t time.Time
+		err := v.decodeReflect(reflect.ValueOf(&t).Elem())
+		return t, err
+	case "array":
+		var a []interface{}
+		err := v.decodeReflect(reflect.ValueOf(&a).Elem())
+		return a, err
+	case "struct":
+		var m map[string]interface{}
+		err := v.decodeReflect(reflect.ValueOf(&m).Elem())
+		return m, err
+	}
+	return v.text(), nil
+}
+
+// typeName returns the name of the XML-RPC type of v.
+func (v *value) typeName() string {
+	switch {
+	case v.Nil != nil:
+		return "nil"
+	case v.Array != nil:
+		return "array"
+	case v.Struct != nil:
+		return "struct"
+	case v.Boolean != nil:
+		return "boolean"
+	case v.Int != nil, v.I4 != nil:
+		return "int"
+	case v.Double != nil:
+		return "double"
+	case v.Base64 != nil:
+		return "base64"
+	case v.DateTime != nil:
+		return "dateTime.iso8601"
+	}
+	return "string"
+}
+
+// integer returns the text of v if it is an XML-RPC int.
+func (v *value) integer() (string, bool) {
+	if v.Int != nil {
+		return strings.TrimSpace(*v.Int), true
+	}
+	if v.I4 != nil {
+		return strings.TrimSpace(*v.I4), true
+	}
+	return "", false
+}
+
+// text returns the textual representation of the scalar v.
+func (v *value) text() string {
+	for _, s := range []*string{v.String, v.Int, v.I4, v.Double, v.Boolean, v.Base64, v.DateTime} {
+		if s != nil {
+			return *s
+		}
+	}
+	// Values without a type element are strings.
+	return v.Raw
 }
 
 // newParams creates a list of XML-RPC <params>.
@@ -158,33 +576,33 @@ func getTimeout(ctx context.Context) time.Duration {
 }
 
 // unpack extracts a response's arguments into a list of given pointers.
+// See value.decode for the supported types.
 func (r *response) unpack(out []interface{}) error {
 	if len(r.Params) != len(out) {
 		return errors.Errorf("response contains %d arg(s); want %d", len(r.Params), len(out))
 	}
 
-	for i, p := range r.Params {
-		switch o := out[i].(type) {
-		case *string:
-			*o = p.Value.String
-		case *bool:
-			v, err := xmlBooleanToBool(p.Value.Boolean)
-			if err != nil {
-				return err
-			}
-			*o = v
-		case *int:
-			i, err := xmlIntegerToInt(p.Value.Int)
-			if err != nil {
-				return err
-			}
-			*o = i
+	for i := range r.Params {
+		if err := r.Params[i].Value.decode(out[i]); err != nil {
+			return errors.Wrapf(err, "response arg %d", i)
 		}
 	}
 
 	return nil
 }
 
+// fault returns the fault reported by the response, or nil if it succeeded.
+func (r *response) fault() (*Fault, error) {
+	if r.Fault == nil {
+		return nil, nil
+	}
+	var f Fault
+	if err := r.Fault.decode(&f); err != nil {
+		return nil, errors.Wrap(err, "malformed fault")
+	}
+	return &f, nil
+}
+
 // run makes an XML-RPC call to servod.
 func (s *Servo) run(ctx context.Context, cl call, out ...interface{}) error {
 	body, err := serializeMethodCall(cl)
@@ -210,6 +628,11 @@ func (s *Servo) run(ctx context.Context, cl call, out ...interface{}) error {
 	if err != nil {
 		return err
 	}
+	if f, err := res.fault(); err != nil {
+		return err
+	} else if f != nil {
+		return f
+	}
 
 	// If outs are specified, unpack response params.
 	// Otherwise, return without unpacking.
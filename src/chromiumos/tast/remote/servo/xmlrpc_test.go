@@ -5,8 +5,12 @@
 package servo
 
 import (
+	"encoding/xml"
 	"math"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestXMLBooleanToBool(t *testing.T) {
@@ -50,61 +54,6 @@ func TestBoolToXMLBoolean(t *testing.T) {
 	}
 }
 
-func TestXMLIntegerToInt(t *testing.T) {
-	for _, tc := range []struct {
-		input     string
-		expected  int
-		expectErr bool
-	}{
-		{"1", 1, false},
-		{"0", 0, false},
-		{"-1", -1, false},
-		{"1.5", 0, true},
-		{"3000000000", 0, true}, // too big for an int32
-		{"easter-egg", 0, true},
-		{"true", 0, true},
-	} {
-		actual, err := xmlIntegerToInt(tc.input)
-		if tc.expectErr {
-			if err == nil {
-				t.Errorf("xmlIntegerToInt(%q) unexpectedly succeeded", tc.input)
-			}
-			continue
-		}
-		if err != nil {
-			t.Errorf("xmlBooleanToBool(%q) failed: %v", tc.input, err)
-			continue
-		}
-		if actual != tc.expected {
-			t.Errorf("xmlBooleanToBool(%q) = %v; want %v", tc.input, actual, tc.expected)
-		}
-	}
-}
-
-func TestIntToXMLInteger(t *testing.T) {
-	for _, tc := range []struct {
-		input     int
-		expected  string
-		expectErr bool
-	}{
-		{1, "1", false},
-		{0, "0", false},
-		{-1, "-1", false},
-		{math.MaxInt64, "", true},
-	} {
-		actual, err := intToXMLInteger(tc.input)
-		if tc.expectErr {
-			if err == nil {
-				t.Errorf("intToXMLInteger(%d) unexpectedly succeeded", tc.input)
-				continue
-			}
-		}
-		if actual != tc.expected {
-			t.Errorf("IntToXMLInteger(%v) = %q; want %q", tc.input, actual, tc.expected)
-		}
-	}
-}
-
 func TestNewValue(t *testing.T) {
 	expectedStr := "rutabaga"
 	v, err := newValue(expectedStr)
@@ -112,8 +61,8 @@ func TestNewValue(t *testing.T) {
 		t.Errorf("newValue(%q) failed: %v", expectedStr, err)
 		return
 	}
-	if v.String != expectedStr {
-		t.Errorf("got %q; want %q", v.String, expectedStr)
+	if v.String == nil || *v.String != expectedStr {
+		t.Errorf("got %s %q; want string %q", v.typeName(), v.text(), expectedStr)
 	}
 
 	expectedBool := true
@@ -123,8 +72,8 @@ func TestNewValue(t *testing.T) {
 		t.Errorf("input %v gave unexpected error: %v", expectedStr, err)
 		return
 	}
-	if v.Boolean != expectedBoolStr {
-		t.Errorf("got %q; want %q", v.Boolean, expectedBoolStr)
+	if v.Boolean == nil || *v.Boolean != expectedBoolStr {
+		t.Errorf("got %s %q; want boolean %q", v.typeName(), v.text(), expectedBoolStr)
 	}
 
 	expectedInt := -1
@@ -134,11 +83,28 @@ func TestNewValue(t *testing.T) {
 		t.Errorf("input %v gave unexpected error: %v", expectedInt, err)
 		return
 	}
-	if v.Int != expectedIntStr {
-		t.Errorf("got %q; want %q", v.Int, expectedIntStr)
+	if v.Int == nil || *v.Int != expectedIntStr {
+		t.Errorf("got %s %q; want int %q", v.typeName(), v.text(), expectedIntStr)
+	}
+
+	expectedDouble := 1234.56
+	expectedDoubleStr := "1234.56"
+	v, err = newValue(expectedDouble)
+	if err != nil {
+		t.Errorf("input %v gave unexpected error: %v", expectedDouble, err)
+		return
+	}
+	if v.Double == nil || *v.Double != expectedDoubleStr {
+		t.Errorf("got %s %q; want double %q", v.typeName(), v.text(), expectedDoubleStr)
 	}
 
-	expectedUnsupported := 1234.56
+	for _, tooBig := range []interface{}{math.MaxInt64, uint32(math.MaxUint32)} {
+		if v, err := newValue(tooBig); err == nil {
+			t.Errorf("input %v gave %s %q; want an error as it does not fit in an int32", tooBig, v.typeName(), v.text())
+		}
+	}
+
+	expectedUnsupported := make(chan int)
 	v, err = newValue(expectedUnsupported)
 	if err == nil {
 		t.Errorf("input %v did not throw expected error", expectedUnsupported)
@@ -155,10 +121,166 @@ func TestNewParams(t *testing.T) {
 	if len(actual) != 2 {
 		t.Errorf("got len %d; want %d", len(actual), 3)
 	}
-	if actual[0].Value.String != "rutabaga" {
-		t.Errorf("for first return value got %q; want %q", actual[0].Value.String, "rutabaga")
+	if v := actual[0].Value; v.String == nil || *v.String != "rutabaga" {
+		t.Errorf("for first return value got %s %q; want string %q", v.typeName(), v.text(), "rutabaga")
+	}
+	if v := actual[1].Value; v.Boolean == nil || *v.Boolean != "1" {
+		t.Errorf("for second return value got %s %q; want boolean %q", v.typeName(), v.text(), "1")
+	}
+}
+
+func TestValueRoundTrip(t *testing.T) {
+	type reading struct {
+		Rail    string  `xmlrpc:"rail"`
+		MW      float64 `xmlrpc:"mw"`
+		Samples []int   `xmlrpc:"samples"`
+		Skipped string  `xmlrpc:"-"`
+	}
+	for _, in := range []interface{}{
+		"rutabaga",
+		"",
+		true,
+		int32(-42),
+		uint16(42),
+		3.25,
+		[]byte("\x00binary\xff"),
+		[]byte{},
+		time.Date(2020, 6, 1, 12, 34, 56, 0, time.UTC),
+		[]string{"a", "b"},
+		[2]bool{true, false},
+		map[string]int{"x": 1, "y": 2},
+		reading{Rail: "ppvar_sys", MW: 1.5, Samples: []int{1, 2, 3}},
+		&reading{Rail: "pp3300", Samples: []int{}},
+	} {
+		v, err := newValue(in)
+		if err != nil {
+			t.Errorf("newValue(%#v) failed: %v", in, err)
+			continue
+		}
+		b, err := xml.Marshal(param{v})
+		if err != nil {
+			t.Errorf("Marshaling %#v failed: %v", in, err)
+			continue
+		}
+		var p param
+		if err := xml.Unmarshal(b, &p); err != nil {
+			t.Errorf("Unmarshaling %s failed: %v", b, err)
+			continue
+		}
+		out := reflect.New(reflect.TypeOf(in))
+		if err := p.Value.decode(out.Interface()); err != nil {
+			t.Errorf("Decoding %s failed: %v", b, err)
+			continue
+		}
+		if got := out.Elem().Interface(); !reflect.DeepEqual(got, in) {
+			t.Errorf("Round trip of %#v through %s gave %#v", in, b, got)
+		}
+	}
+}
+
+func TestEncodeEmptyValue(t *testing.T) {
+	// Empty scalars keep their type element, so that they are not decoded as untyped strings.
+	for _, tc := range []struct {
+		in       interface{}
+		expected string
+	}{
+		{"", "<value><string></string></value>"},
+		{[]byte{}, "<value><base64></base64></value>"},
+	} {
+		v, err := newValue(tc.in)
+		if err != nil {
+			t.Errorf("newValue(%#v) failed: %v", tc.in, err)
+			continue
+		}
+		b, err := xml.Marshal(param{v})
+		if err != nil {
+			t.Errorf("Marshaling %#v failed: %v", tc.in, err)
+			continue
+		}
+		if got := strings.TrimSuffix(strings.TrimPrefix(string(b), "<param>"), "</param>"); got != tc.expected {
+			t.Errorf("%#v encoded as %s; want %s", tc.in, got, tc.expected)
+		}
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	for _, tc := range []struct {
+		xml      string
+		expected interface{}
+	}{
+		{"<value>untyped</value>", "untyped"},
+		{"<value><string>typed</string></value>", "typed"},
+		{"<value><i4>-7</i4></value>", -7},
+		{"<value><double>0.5</double></value>", 0.5},
+		{"<value><boolean>0</boolean></value>", false},
+		{"<value><base64>aGk=</base64></value>", []byte("hi")},
+		{"<value><base64></base64></value>", []byte{}},
+		{"<value><string></string></value>", ""},
+		{"<value></value>", ""},
+		{"<value><dateTime.iso8601>20200601T01:02:03</dateTime.iso8601></value>", time.Date(2020, 6, 1, 1, 2, 3, 0, time.UTC)},
+		{"<value><nil/></value>", nil},
+		{"<value><array><data><value><int>1</int></value><value>x</value></data></array></value>",
+			[]interface{}{1, "x"}},
+		{"<value><struct><member><name>a</name><value><array><data></data></array></value></member></struct></value>",
+			map[string]interface{}{"a": []interface{}{}}},
+	} {
+		var v value
+		if err := xml.Unmarshal([]byte(tc.xml), &v); err != nil {
+			t.Errorf("Unmarshaling %s failed: %v", tc.xml, err)
+			continue
+		}
+		var actual interface{}
+		if err := v.decode(&actual); err != nil {
+			t.Errorf("Decoding %s failed: %v", tc.xml, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("Decoding %s gave %#v; want %#v", tc.xml, actual, tc.expected)
+		}
+	}
+}
+
+func TestDecodeValueErrors(t *testing.T) {
+	for _, tc := range []struct {
+		xml string
+		out interface{}
+	}{
+		{"<value><string>x</string></value>", new(int)},
+		{"<value><int>300</int></value>", new(int8)},
+		{"<value><int>-1</int></value>", new(uint)},
+		{"<value><boolean>2</boolean></value>", new(bool)},
+		{"<value><array><data><value>x</value></data></array></value>", new(string)},
+		{"<value><array><data><value>x</value></data></array></value>", new([2]string)},
+		{"<value><struct></struct></value>", new([]int)},
+		{"<value><base64>!!</base64></value>", new([]byte)},
+	} {
+		var v value
+		if err := xml.Unmarshal([]byte(tc.xml), &v); err != nil {
+			t.Errorf("Unmarshaling %s failed: %v", tc.xml, err)
+			continue
+		}
+		if err := v.decode(tc.out); err == nil {
+			t.Errorf("Decoding %s into %T unexpectedly succeeded", tc.xml, tc.out)
+		}
+	}
+}
+
+func TestResponseFault(t *testing.T) {
+	const body = `<?xml version="1.0"?>
+<methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><int>1</int></value></member>
+<member><name>faultString</name><value><string>No control named rutabaga</string></value></member>
+</struct></value></fault></methodResponse>`
+	var res response
+	if err := xml.Unmarshal([]byte(body), &res); err != nil {
+		t.Fatal("Unmarshaling failed: ", err)
+	}
+	f, err := res.fault()
+	if err != nil {
+		t.Fatal("fault failed: ", err)
 	}
-	if actual[1].Value.Boolean != "1" {
-		t.Errorf("for second return value got %q; want %q", actual[1].Value.Boolean, "1")
+	expected := &Fault{Code: 1, Message: "No control named rutabaga"}
+	if !reflect.DeepEqual(f, expected) {
+		t.Errorf("fault() = %+v; want %+v", f, expected)
 	}
 }